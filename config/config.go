@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"net"
 	"strconv"
+	"strings"
 	"time"
 	"github.com/joho/godotenv"
 )
@@ -41,14 +43,14 @@ func LoadConfig(path string) IConfig {
                 return time.Duration(int64(t) * int64(math.Pow10(9)))
             }(),
             bodyLimit: func() int {
-                b, err := strconv.Atoi(envMap["APP_PORT"])
+                b, err := strconv.Atoi(envMap["APP_BODY_LIMIT"])
                 if err != nil {
                     log.Fatalf("convert bodyLimit to int error: %v", err)
                 }
                 return b
             }(),
             fileLimit: func() int {
-                f, err := strconv.Atoi(envMap["APP_PORT"])
+                f, err := strconv.Atoi(envMap["APP_FILE_LIMIT"])
                 if err != nil {
                     log.Fatalf("convert fileLimit to int error: %v", err)
                 }
@@ -78,10 +80,357 @@ func LoadConfig(path string) IConfig {
                 return m
             }(),
         },
+        storage: &storage{
+            driver: func() string {
+                if envMap["STORAGE_DRIVER"] == "" {
+                    return "local"
+                }
+                return envMap["STORAGE_DRIVER"]
+            }(),
+            localDir: func() string {
+                if envMap["STORAGE_LOCAL_DIR"] == "" {
+                    return "./assets/images"
+                }
+                return envMap["STORAGE_LOCAL_DIR"]
+            }(),
+            // files are not public, client download them from image file endpoint that check owner
+            publicUrl: envMap["STORAGE_PUBLIC_URL"],
+            endpoint: envMap["STORAGE_ENDPOINT"],
+            region: func() string {
+                if envMap["STORAGE_REGION"] == "" {
+                    return "auto"
+                }
+                return envMap["STORAGE_REGION"]
+            }(),
+            bucket: envMap["APP_GCP_BUCKET"],
+            accessKey: envMap["STORAGE_ACCESS_KEY"],
+            secretKey: envMap["STORAGE_SECRET_KEY"],
+        },
+        mail: &mail{
+            // no default, console and file driver write reset and verify token in plain text
+            driver: envMap["MAIL_DRIVER"],
+            host: envMap["MAIL_HOST"],
+            port: func() int {
+                if envMap["MAIL_PORT"] == "" {
+                    return 587
+                }
+                p, err := strconv.Atoi(envMap["MAIL_PORT"])
+                if err != nil {
+                    log.Fatalf("convert mail port to int error: %v", err)
+                }
+                return p
+            }(),
+            username: envMap["MAIL_USERNAME"],
+            password: envMap["MAIL_PASSWORD"],
+            from: func() string {
+                if envMap["MAIL_FROM"] == "" {
+                    return "no-reply@localhost"
+                }
+                return envMap["MAIL_FROM"]
+            }(),
+            fileDir: func() string {
+                if envMap["MAIL_FILE_DIR"] == "" {
+                    return "./assets/mails"
+                }
+                return envMap["MAIL_FILE_DIR"]
+            }(),
+            linkUrl: func() string {
+                // page that handle link in email e.g. reset password form
+                if envMap["MAIL_LINK_URL"] == "" {
+                    return fmt.Sprintf("http://%s:%s", envMap["APP_HOST"], envMap["APP_PORT"])
+                }
+                return envMap["MAIL_LINK_URL"]
+            }(),
+        },
+        auth: &auth{
+            unverifiedSignIn: func() string {
+                if envMap["AUTH_UNVERIFIED_SIGNIN"] == "" {
+                    return "deny"
+                }
+                return envMap["AUTH_UNVERIFIED_SIGNIN"]
+            }(),
+            verifyResendInterval: func() int {
+                if envMap["AUTH_VERIFY_RESEND_INTERVAL"] == "" {
+                    return 60
+                }
+                i, err := strconv.Atoi(envMap["AUTH_VERIFY_RESEND_INTERVAL"])
+                if err != nil {
+                    log.Fatalf("convert verifyResendInterval to int error: %v", err)
+                }
+                return i
+            }(),
+            lockoutThreshold: func() int {
+                if envMap["AUTH_LOCKOUT_THRESHOLD"] == "" {
+                    return 5
+                }
+                t, err := strconv.Atoi(envMap["AUTH_LOCKOUT_THRESHOLD"])
+                if err != nil {
+                    log.Fatalf("convert lockoutThreshold to int error: %v", err)
+                }
+                return t
+            }(),
+            lockoutIpThreshold: func() int {
+                if envMap["AUTH_LOCKOUT_IP_THRESHOLD"] == "" {
+                    return 20
+                }
+                t, err := strconv.Atoi(envMap["AUTH_LOCKOUT_IP_THRESHOLD"])
+                if err != nil {
+                    log.Fatalf("convert lockoutIpThreshold to int error: %v", err)
+                }
+                return t
+            }(),
+            lockoutDuration: func() int {
+                if envMap["AUTH_LOCKOUT_DURATION"] == "" {
+                    return 900
+                }
+                d, err := strconv.Atoi(envMap["AUTH_LOCKOUT_DURATION"])
+                if err != nil {
+                    log.Fatalf("convert lockoutDuration to int error: %v", err)
+                }
+                return d
+            }(),
+            accountDelete: func() string {
+                if envMap["AUTH_ACCOUNT_DELETE"] == "" {
+                    return "soft"
+                }
+                return envMap["AUTH_ACCOUNT_DELETE"]
+            }(),
+            bootstrapApiKey: func() string {
+                key := envMap["AUTH_BOOTSTRAP_API_KEY"]
+                if key != "" && (!strings.HasPrefix(key, "wymj_") || len(key) < 37) {
+                    log.Fatalf("AUTH_BOOTSTRAP_API_KEY must be wymj_ and at least 32 random characters")
+                }
+                return key
+            }(),
+        },
+        oidc: &oidc{
+            // OIDC_PROVIDERS=google,github then OIDC_GOOGLE_CLIENT_ID, OIDC_GOOGLE_CLIENT_SECRET, ...
+            providers: func() map[string]IOidcProvider {
+                providers := make(map[string]IOidcProvider)
+                for _, name := range strings.Split(envMap["OIDC_PROVIDERS"], ",") {
+                    name = strings.ToLower(strings.Trim(name, " "))
+                    if name == "" {
+                        continue
+                    }
+                    prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+                    p := &oidcProvider{
+                        name: name,
+                        kind: envMap[prefix+"TYPE"],
+                        issuer: envMap[prefix+"ISSUER"],
+                        clientId: envMap[prefix+"CLIENT_ID"],
+                        clientSecret: envMap[prefix+"CLIENT_SECRET"],
+                        scopes: strings.Fields(strings.ReplaceAll(envMap[prefix+"SCOPES"], ",", " ")),
+                    }
+                    // well known providers need only client id and secret
+                    switch {
+                    case p.kind == "" && name == "github":
+                        p.kind = "github"
+                    case p.kind == "":
+                        p.kind = "oidc"
+                    }
+                    if p.issuer == "" && name == "google" {
+                        p.issuer = "https://accounts.google.com"
+                    }
+                    if p.issuer == "" && p.kind == "github" {
+                        p.issuer = "https://github.com"
+                    }
+                    if len(p.scopes) == 0 {
+                        p.scopes = []string{"openid", "email", "profile"}
+                        if p.kind == "github" {
+                            p.scopes = []string{"read:user", "user:email"}
+                        }
+                    }
+                    if p.issuer == "" || p.clientId == "" {
+                        log.Fatalf("oidc provider %s: %sISSUER and %sCLIENT_ID are required", name, prefix, prefix)
+                    }
+                    providers[name] = p
+                }
+                return providers
+            }(),
+            redirectUrl: envMap["OIDC_REDIRECT_URL"],
+            autoProvision: envMap["OIDC_AUTO_PROVISION"] == "true",
+        },
+        oauth2: &oauth2{
+            issuer: func() string {
+                if envMap["OAUTH2_ISSUER"] == "" {
+                    return fmt.Sprintf("http://%s:%s", envMap["APP_HOST"], envMap["APP_PORT"])
+                }
+                return strings.TrimSuffix(envMap["OAUTH2_ISSUER"], "/")
+            }(),
+            consentUrl: envMap["OAUTH2_CONSENT_URL"],
+            codeExpireAt: func() int {
+                if envMap["OAUTH2_CODE_EXPIRES"] == "" {
+                    return 300
+                }
+                e, err := strconv.Atoi(envMap["OAUTH2_CODE_EXPIRES"])
+                if err != nil {
+                    log.Fatalf("convert codeExpireAt to int error: %v", err)
+                }
+                return e
+            }(),
+            redirectSchemes: splitList(strings.ToLower(envMap["OAUTH2_REDIRECT_SCHEMES"]), ","),
+        },
+        log: &logConfig{
+            level: envMap["LOG_LEVEL"],
+            format: func() string {
+                if envMap["LOG_FORMAT"] == "" {
+                    return "json"
+                }
+                return strings.ToLower(envMap["LOG_FORMAT"])
+            }(),
+            // LOG_SINKS=stdout,file,syslog
+            sinks: func() []string {
+                sinks := make([]string, 0)
+                for _, name := range strings.Split(envMap["LOG_SINKS"], ",") {
+                    name = strings.ToLower(strings.Trim(name, " "))
+                    if name != "" {
+                        sinks = append(sinks, name)
+                    }
+                }
+                if len(sinks) == 0 {
+                    sinks = append(sinks, "stdout")
+                }
+                return sinks
+            }(),
+            bufferSize: func() int {
+                if envMap["LOG_BUFFER_SIZE"] == "" {
+                    return 4096
+                }
+                b, err := strconv.Atoi(envMap["LOG_BUFFER_SIZE"])
+                if err != nil {
+                    log.Fatalf("convert bufferSize to int error: %v", err)
+                }
+                return b
+            }(),
+            fileDir: func() string {
+                if envMap["LOG_FILE_DIR"] == "" {
+                    return "./assets/logs"
+                }
+                return envMap["LOG_FILE_DIR"]
+            }(),
+            fileMaxSize: func() int {
+                if envMap["LOG_FILE_MAX_SIZE"] == "" {
+                    return 100
+                }
+                s, err := strconv.Atoi(envMap["LOG_FILE_MAX_SIZE"])
+                if err != nil {
+                    log.Fatalf("convert fileMaxSize to int error: %v", err)
+                }
+                return s
+            }(),
+            fileMaxAge: func() int {
+                if envMap["LOG_FILE_MAX_AGE"] == "" {
+                    return 7
+                }
+                a, err := strconv.Atoi(envMap["LOG_FILE_MAX_AGE"])
+                if err != nil {
+                    log.Fatalf("convert fileMaxAge to int error: %v", err)
+                }
+                return a
+            }(),
+            fileCompress: envMap["LOG_FILE_COMPRESS"] != "false",
+            syslogAddr: envMap["LOG_SYSLOG_ADDR"],
+            // LOG_REDACT_FIELDS=pin,*_otp
+            redactFields: splitList(envMap["LOG_REDACT_FIELDS"], ","),
+            // LOG_REDACT_HEADERS=X-Webhook-Signature
+            redactHeaders: splitList(envMap["LOG_REDACT_HEADERS"], ","),
+            // LOG_REDACT_ROUTES=POST /v1/users/signin=body;GET /v1/users/*/sessions=response|query
+            redactRoutes: splitList(envMap["LOG_REDACT_ROUTES"], ";"),
+            syslogTag: func() string {
+                if envMap["LOG_SYSLOG_TAG"] == "" {
+                    return envMap["APP_NAME"]
+                }
+                return envMap["LOG_SYSLOG_TAG"]
+            }(),
+        },
+        metrics: &metrics{
+            path: func() string {
+                if envMap["METRICS_PATH"] == "" {
+                    return "/metrics"
+                }
+                return envMap["METRICS_PATH"]
+            }(),
+            host: envMap["METRICS_HOST"],
+            port: func() int {
+                if envMap["METRICS_PORT"] == "" {
+                    return 0
+                }
+                p, err := strconv.Atoi(envMap["METRICS_PORT"])
+                if err != nil {
+                    log.Fatalf("convert metrics port to int error: %v", err)
+                }
+                return p
+            }(),
+            // METRICS_ALLOW=127.0.0.1,10.0.0.0/8, plain ip is one address
+            allowList: func() []*net.IPNet {
+                value := envMap["METRICS_ALLOW"]
+                if value == "" {
+                    value = "127.0.0.1,::1"
+                }
+                allowList := make([]*net.IPNet, 0)
+                for _, item := range splitList(value, ",") {
+                    if !strings.Contains(item, "/") {
+                        if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+                            item += "/32"
+                        } else {
+                            item += "/128"
+                        }
+                    }
+                    _, ipNet, err := net.ParseCIDR(item)
+                    if err != nil {
+                        log.Fatalf("METRICS_ALLOW is invalid: %v", err)
+                    }
+                    allowList = append(allowList, ipNet)
+                }
+                return allowList
+            }(),
+        },
+        tracing: &tracing{
+            exporter: func() string {
+                if envMap["TRACE_EXPORTER"] == "" {
+                    return "none"
+                }
+                return strings.ToLower(envMap["TRACE_EXPORTER"])
+            }(),
+            serviceName: func() string {
+                if envMap["TRACE_SERVICE_NAME"] == "" {
+                    return envMap["APP_NAME"]
+                }
+                return envMap["TRACE_SERVICE_NAME"]
+            }(),
+            otlpEndpoint: func() string {
+                if envMap["TRACE_OTLP_ENDPOINT"] == "" {
+                    return "localhost:4318"
+                }
+                return envMap["TRACE_OTLP_ENDPOINT"]
+            }(),
+            otlpInsecure: envMap["TRACE_OTLP_INSECURE"] == "true",
+            // TRACE_OTLP_HEADERS=api-key=secret,x-tenant=wymj
+            otlpHeaders: func() map[string]string {
+                headers := make(map[string]string)
+                for _, pair := range splitList(envMap["TRACE_OTLP_HEADERS"], ",") {
+                    key, value, ok := strings.Cut(pair, "=")
+                    if !ok {
+                        log.Fatalf("TRACE_OTLP_HEADERS expect key=value: %v", pair)
+                    }
+                    headers[strings.Trim(key, " ")] = strings.Trim(value, " ")
+                }
+                return headers
+            }(),
+            sampleRatio: func() float64 {
+                if envMap["TRACE_SAMPLE_RATIO"] == "" {
+                    return 1
+                }
+                r, err := strconv.ParseFloat(envMap["TRACE_SAMPLE_RATIO"], 64)
+                if err != nil {
+                    log.Fatalf("convert sampleRatio to float error: %v", err)
+                }
+                return r
+            }(),
+        },
         jwt: &jwt{
             adminKey: envMap["JWT_SECRET_KEY"],
             secretKey: envMap["JWT_ADMIN_KEY"],
-            apiKey: envMap["JWT_API_KEY"],
             accessExpireAt: func() int {
                 a, err := strconv.Atoi(envMap["JWT_ACCESS_EXPIRES"])
                 if err != nil {
@@ -96,6 +445,22 @@ func LoadConfig(path string) IConfig {
                 }
                 return r
             }(),
+            // JWT_KEY_FILES=kid1=/path/a.pem,kid2=/path/b.pem
+            keyFiles: func() map[string]string {
+                files := make(map[string]string)
+                for _, pair := range strings.Split(envMap["JWT_KEY_FILES"], ",") {
+                    if strings.Trim(pair, " ") == "" {
+                        continue
+                    }
+                    kid, path, ok := strings.Cut(pair, "=")
+                    if !ok {
+                        log.Fatalf("JWT_KEY_FILES expect kid=path: %v", pair)
+                    }
+                    files[strings.Trim(kid, " ")] = strings.Trim(path, " ")
+                }
+                return files
+            }(),
+            activeKid: envMap["JWT_ACTIVE_KID"],
         },
     }
 }
@@ -104,12 +469,28 @@ type IConfig interface {
     App() IAppconfig
     Db() IDbconfig
     Jwt() IJwtconfig
+    Storage() IStorageconfig
+    Mail() IMailconfig
+    Auth() IAuthconfig
+    Oidc() IOidcconfig
+    OAuth2() IOAuth2config
+    Log() ILogconfig
+    Tracing() ITracingconfig
+    Metrics() IMetricsconfig
 }
 
 type config struct {
     app *app
     db *db
     jwt *jwt
+    storage *storage
+    mail *mail
+    auth *auth
+    oidc *oidc
+    oauth2 *oauth2
+    log *logConfig
+    tracing *tracing
+    metrics *metrics
 }
 
 type IAppconfig interface {
@@ -184,10 +565,14 @@ func (d *db) MaxConnections() int { return d.maxConnections }
 type IJwtconfig interface {
     SecretKey() []byte
     AdminKey() []byte
-    ApiKey() []byte
     AccessExpireAt() int
     RefreshExpireAt() int
 
+    // kid -> pem file of private key, empty means HS256 with the keys above
+    KeyFiles() map[string]string
+    // kid of the key that sign new token, others are only used to verify
+    ActiveKid() string
+
     SetJwtAccessExpireAt(t int)
     SetJwtExpireAt(t int)
 }
@@ -195,9 +580,10 @@ type IJwtconfig interface {
 type jwt struct {
     adminKey string
     secretKey string
-    apiKey string
     accessExpireAt int //in seconds
     refreshExpireAt int //in seconds
+    keyFiles map[string]string
+    activeKid string
 }
 
 func (c *config) Jwt() IJwtconfig {
@@ -206,8 +592,326 @@ func (c *config) Jwt() IJwtconfig {
 
 func (j *jwt) SecretKey() []byte { return []byte(j.secretKey) }
 func (j *jwt) AdminKey() []byte { return []byte(j.adminKey) }
-func (j *jwt) ApiKey() []byte { return []byte(j.apiKey) }
 func (j *jwt) AccessExpireAt() int { return j.accessExpireAt }
 func (j *jwt) RefreshExpireAt() int { return j.refreshExpireAt }
+func (j *jwt) KeyFiles() map[string]string { return j.keyFiles }
+func (j *jwt) ActiveKid() string { return j.activeKid }
 func (j *jwt) SetJwtAccessExpireAt(t int) { j.accessExpireAt = t }
 func (j *jwt) SetJwtExpireAt(t int) { j.refreshExpireAt = t }
+
+type IStorageconfig interface {
+    // local | s3
+    Driver() string
+    LocalDir() string
+    PublicUrl() string
+    Endpoint() string
+    Region() string
+    Bucket() string
+    AccessKey() string
+    SecretKey() string
+}
+
+type storage struct {
+    driver string
+    localDir string
+    publicUrl string // base url of uploaded file
+    endpoint string // s3 compatible endpoint e.g. https://storage.googleapis.com
+    region string
+    bucket string
+    accessKey string
+    secretKey string
+}
+
+func (c *config) Storage() IStorageconfig {
+    return c.storage
+}
+
+func (s *storage) Driver() string { return s.driver }
+func (s *storage) LocalDir() string { return s.localDir }
+func (s *storage) PublicUrl() string { return s.publicUrl }
+func (s *storage) Endpoint() string { return s.endpoint }
+func (s *storage) Region() string { return s.region }
+func (s *storage) Bucket() string { return s.bucket }
+func (s *storage) AccessKey() string { return s.accessKey }
+func (s *storage) SecretKey() string { return s.secretKey }
+
+type IMailconfig interface {
+    // smtp | file | console
+    Driver() string
+    // host:port
+    Addr() string
+    Host() string
+    Username() string
+    Password() string
+    From() string
+    FileDir() string
+    LinkUrl() string
+}
+
+type mail struct {
+    driver string
+    host string
+    port int
+    username string
+    password string
+    from string
+    fileDir string // file driver write each mail as .eml here
+    linkUrl string // base url of link in mail
+}
+
+func (c *config) Mail() IMailconfig {
+    return c.mail
+}
+
+func (m *mail) Driver() string { return m.driver }
+func (m *mail) Addr() string { return fmt.Sprintf("%s:%d", m.host, m.port) }
+func (m *mail) Host() string { return m.host }
+func (m *mail) Username() string { return m.username }
+func (m *mail) Password() string { return m.password }
+func (m *mail) From() string { return m.from }
+func (m *mail) FileDir() string { return m.fileDir }
+func (m *mail) LinkUrl() string { return m.linkUrl }
+
+type IAuthconfig interface {
+    // deny | limited, limited sign in unverified user with token that can only verify email
+    UnverifiedSignIn() string
+    VerifyResendInterval() int
+    // failed sign in before account or ip is locked
+    LockoutThreshold() int
+    LockoutIpThreshold() int
+    LockoutDuration() int
+    // soft | hard, hard delete remove the user and every row that belong to the user
+    AccountDelete() string
+    // api key with every scope that is created at start when it is not stored yet, so first
+    // admin can sign in on new database. Remove it after real keys are created
+    BootstrapApiKey() string
+}
+
+type auth struct {
+    unverifiedSignIn string
+    verifyResendInterval int //in seconds
+    lockoutThreshold int
+    lockoutIpThreshold int
+    lockoutDuration int //in seconds, also window that failed count is kept
+    accountDelete string
+    bootstrapApiKey string
+}
+
+func (c *config) Auth() IAuthconfig {
+    return c.auth
+}
+
+func (a *auth) UnverifiedSignIn() string { return a.unverifiedSignIn }
+func (a *auth) VerifyResendInterval() int { return a.verifyResendInterval }
+func (a *auth) LockoutThreshold() int { return a.lockoutThreshold }
+func (a *auth) LockoutIpThreshold() int { return a.lockoutIpThreshold }
+func (a *auth) LockoutDuration() int { return a.lockoutDuration }
+func (a *auth) AccountDelete() string { return a.accountDelete }
+func (a *auth) BootstrapApiKey() string { return a.bootstrapApiKey }
+
+type IOidcconfig interface {
+    // name -> provider, empty when social login is disabled
+    Providers() map[string]IOidcProvider
+    // redirect uri registered at provider, {provider} is replaced by provider name
+    RedirectUrl(provider string) string
+    // create customer on first login of identity that is not linked
+    AutoProvision() bool
+}
+
+type IOidcProvider interface {
+    Name() string
+    // oidc | github
+    Type() string
+    Issuer() string
+    ClientId() string
+    ClientSecret() string
+    Scopes() []string
+}
+
+type oidc struct {
+    providers map[string]IOidcProvider
+    redirectUrl string
+    autoProvision bool
+}
+
+type oidcProvider struct {
+    name string
+    kind string
+    issuer string // github type use it as web base url, default https://github.com
+    clientId string
+    clientSecret string
+    scopes []string
+}
+
+func (c *config) Oidc() IOidcconfig {
+    return c.oidc
+}
+
+func (o *oidc) Providers() map[string]IOidcProvider { return o.providers }
+func (o *oidc) RedirectUrl(provider string) string { return strings.ReplaceAll(o.redirectUrl, "{provider}", provider) }
+func (o *oidc) AutoProvision() bool { return o.autoProvision }
+
+func (p *oidcProvider) Name() string { return p.name }
+func (p *oidcProvider) Type() string { return p.kind }
+func (p *oidcProvider) Issuer() string { return p.issuer }
+func (p *oidcProvider) ClientId() string { return p.clientId }
+func (p *oidcProvider) ClientSecret() string { return p.clientSecret }
+func (p *oidcProvider) Scopes() []string { return p.scopes }
+
+type IOAuth2config interface {
+    // public base url of this api, used in authorization server metadata
+    Issuer() string
+    // frontend page that sign user in and show consent, it calls /v1/oauth2/authorize
+    ConsentUrl() string
+    CodeExpireAt() int
+    // custom schemes that native app may use in redirect uri, ex. com.example.app
+    RedirectSchemes() []string
+}
+
+type oauth2 struct {
+    issuer string
+    consentUrl string
+    codeExpireAt int //in seconds
+    redirectSchemes []string
+}
+
+func (c *config) OAuth2() IOAuth2config {
+    return c.oauth2
+}
+
+func (o *oauth2) Issuer() string { return o.issuer }
+func (o *oauth2) ConsentUrl() string {
+    if o.consentUrl == "" {
+        return o.issuer + "/oauth2/authorize"
+    }
+    return o.consentUrl
+}
+func (o *oauth2) CodeExpireAt() int { return o.codeExpireAt }
+func (o *oauth2) RedirectSchemes() []string { return o.redirectSchemes }
+
+type ILogconfig interface {
+    // debug | info | warn | error
+    Level() string
+    // json | text
+    Format() string
+    // stdout | file | syslog
+    Sinks() []string
+    // lines waiting for sinks, line is dropped when it is full
+    BufferSize() int
+    FileDir() string
+    FileMaxSize() int
+    FileMaxAge() int
+    // gzip rotated files
+    FileCompress() bool
+    // udp://host:514 or tcp://host:514
+    SyslogAddr() string
+    SyslogTag() string
+    // added to built-in redaction of wymjlogger, field is glob like *_token
+    RedactFields() []string
+    RedactHeaders() []string
+    // METHOD /path=query|body|response|headers|all, whole part is hidden
+    RedactRoutes() []string
+}
+
+// logConfig is not named log because of log package
+type logConfig struct {
+    level string
+    format string
+    sinks []string
+    bufferSize int
+    fileDir string
+    fileMaxSize int //in MB
+    fileMaxAge int //in days
+    fileCompress bool
+    syslogAddr string
+    syslogTag string
+    redactFields []string
+    redactHeaders []string
+    redactRoutes []string
+}
+
+func (c *config) Log() ILogconfig {
+    return c.log
+}
+
+func (l *logConfig) Level() string { return l.level }
+func (l *logConfig) Format() string { return l.format }
+func (l *logConfig) Sinks() []string { return l.sinks }
+func (l *logConfig) BufferSize() int { return l.bufferSize }
+func (l *logConfig) FileDir() string { return l.fileDir }
+func (l *logConfig) FileMaxSize() int { return l.fileMaxSize }
+func (l *logConfig) FileMaxAge() int { return l.fileMaxAge }
+func (l *logConfig) FileCompress() bool { return l.fileCompress }
+func (l *logConfig) SyslogAddr() string { return l.syslogAddr }
+func (l *logConfig) SyslogTag() string { return l.syslogTag }
+func (l *logConfig) RedactFields() []string { return l.redactFields }
+func (l *logConfig) RedactHeaders() []string { return l.redactHeaders }
+func (l *logConfig) RedactRoutes() []string { return l.redactRoutes }
+
+// splitList split env value and drop empty item
+func splitList(value, sep string) []string {
+    items := make([]string, 0)
+    for _, item := range strings.Split(value, sep) {
+        if item = strings.Trim(item, " "); item != "" {
+            items = append(items, item)
+        }
+    }
+    return items
+}
+
+type ITracingconfig interface {
+    // none | stdout | memory | otlp, memory keep spans in process for tests
+    Exporter() string
+    ServiceName() string
+    // host:port of otlp http receiver, default localhost:4318
+    OtlpEndpoint() string
+    OtlpInsecure() bool
+    OtlpHeaders() map[string]string
+    // 0 to 1 of new traces that are recorded, trace started by caller follow caller
+    SampleRatio() float64
+}
+
+type tracing struct {
+    exporter string
+    serviceName string
+    otlpEndpoint string
+    otlpInsecure bool
+    otlpHeaders map[string]string
+    sampleRatio float64
+}
+
+func (c *config) Tracing() ITracingconfig {
+    return c.tracing
+}
+
+func (t *tracing) Exporter() string { return t.exporter }
+func (t *tracing) ServiceName() string { return t.serviceName }
+func (t *tracing) OtlpEndpoint() string { return t.otlpEndpoint }
+func (t *tracing) OtlpInsecure() bool { return t.otlpInsecure }
+func (t *tracing) OtlpHeaders() map[string]string { return t.otlpHeaders }
+func (t *tracing) SampleRatio() float64 { return t.sampleRatio }
+
+type IMetricsconfig interface {
+    Path() string
+    // Port 0 serve metrics on app port, otherwise on its own listener at host:port
+    Port() int
+    Url() string
+    // AllowList of client ip, it is checked on both app port and metrics port
+    AllowList() []*net.IPNet
+}
+
+type metrics struct {
+    path string
+    host string
+    port int
+    allowList []*net.IPNet
+}
+
+func (c *config) Metrics() IMetricsconfig {
+    return c.metrics
+}
+
+func (m *metrics) Path() string { return m.path }
+func (m *metrics) Port() int { return m.port }
+func (m *metrics) Url() string { return fmt.Sprintf("%s:%d", m.host, m.port) }
+func (m *metrics) AllowList() []*net.IPNet { return m.allowList }
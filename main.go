@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
+	"log"
 	"os"
+	"time"
 
 	"github.com/ppp3ppj/wymj/config"
 	"github.com/ppp3ppj/wymj/modules/servers"
 	"github.com/ppp3ppj/wymj/pkg/databases"
+	"github.com/ppp3ppj/wymj/pkg/wymjauth"
+	"github.com/ppp3ppj/wymj/pkg/wymjlogger"
+	"github.com/ppp3ppj/wymj/pkg/wymjtrace"
 )
 
 func envPath() string {
@@ -18,6 +24,29 @@ func envPath() string {
 
 func main() {
     cfg := config.LoadConfig(envPath())
+    logger, err := wymjlogger.NewWymjLogger(cfg.Log())
+    if err != nil {
+        log.Fatalf("init logger failed: %v", err)
+    }
+    // log package is also written to the logger
+    logger.SetDefault()
+    defer logger.Close()
+
+    tracer, err := wymjtrace.NewTracer(cfg.Tracing(), cfg.App().Version())
+    if err != nil {
+        wymjlogger.Fatalf("init tracer failed: %v", err)
+    }
+    defer func() {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        if err := tracer.Shutdown(ctx); err != nil {
+            log.Printf("shutdown tracer failed: %v", err)
+        }
+    }()
+
+    if err := wymjauth.LoadKeySet(cfg.Jwt()); err != nil {
+        wymjlogger.Fatalf("load jwt key failed: %v", err)
+    }
     db := databases.DbConnect(cfg.Db())
     servers.NewServer(cfg, db).Start()
 }
@@ -1 +1,46 @@
 package appinfo
+
+import "time"
+
+// scope of route group that api key can call, * is every group
+const (
+    AllScope = "*"
+    UsersScope = "users"
+)
+
+var ApiKeyScopes = []string{AllScope, UsersScope}
+
+type ApiKey struct {
+    Id string `db:"id" json:"id"`
+    Name string `db:"name" json:"name"`
+    Prefix string `db:"prefix" json:"prefix"`
+    UserId string `db:"user_id" json:"user_id"`
+    Scopes []string `db:"scopes" json:"scopes"`
+    ExpiredAt *time.Time `db:"expired_at" json:"expired_at"`
+    LastUsedAt *time.Time `db:"last_used_at" json:"last_used_at"`
+    RevokedAt *time.Time `db:"revoked_at" json:"revoked_at"`
+    CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// HasScope is true when key has scope or every scope
+func (obj *ApiKey) HasScope(scope string) bool {
+    for _, s := range obj.Scopes {
+        if s == AllScope || s == scope {
+            return true
+        }
+    }
+    return false
+}
+
+type ApiKeyReq struct {
+    Name string `json:"name" form:"name"`
+    Scopes []string `json:"scopes" form:"scopes"`
+    // 0 is never expire
+    ExpiresIn int `json:"expires_in" form:"expires_in"`
+}
+
+// ApiKeyRes has the key only in create response
+type ApiKeyRes struct {
+    *ApiKey
+    Key string `json:"key"`
+}
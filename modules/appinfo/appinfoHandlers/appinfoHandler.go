@@ -1,8 +1,12 @@
 package appinfohandlers
 
 import (
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/modules/appinfo"
 	"github.com/ppp3ppj/wymj/modules/appinfo/appinfoUsecases"
 	"github.com/ppp3ppj/wymj/modules/entities"
 	"github.com/ppp3ppj/wymj/pkg/wymjauth"
@@ -11,11 +15,17 @@ import (
 type appinfoHandlersErrorCode string
 
 const (
-    generateApiKeyError appinfoHandlersErrorCode = "appinfo-001"
+    findApiKeyErr appinfoHandlersErrorCode = "appinfo-001"
+    jwksError appinfoHandlersErrorCode = "appinfo-002"
+    insertApiKeyErr appinfoHandlersErrorCode = "appinfo-003"
+    revokeApiKeyErr appinfoHandlersErrorCode = "appinfo-004"
 )
 
 type IAppinfoHandler interface {
-    GenerateApiKey(c *fiber.Ctx) error
+    FindApiKey(c *fiber.Ctx) error
+    InsertApiKey(c *fiber.Ctx) error
+    RevokeApiKey(c *fiber.Ctx) error
+    Jwks(c *fiber.Ctx) error
 }
 
 type appinfoHandler struct {
@@ -30,27 +40,93 @@ func AppinfoHandler(cfg config.IConfig, appinfoUsecase appinfoUsecases.IAppinfoU
     }
 }
 
-func (h *appinfoHandler) GenerateApiKey(c *fiber.Ctx) error {
-    apiKey, err := wymjauth.NewWymjAuth(
-       wymjauth.ApiKey,
-       h.cfg.Jwt(),
-       nil,
-    )
-
+func (h *appinfoHandler) FindApiKey(c *fiber.Ctx) error {
+    apiKeys, err := h.appinfoUsecase.FindApiKey(c.UserContext())
     if err != nil {
         return entities.NewResponse(c).Error(
             fiber.ErrInternalServerError.Code,
-            string(generateApiKeyError),
+            string(findApiKeyErr),
             err.Error(),
         ).Res()
     }
+    return entities.NewResponse(c).Success(fiber.StatusOK, apiKeys).Res()
+}
 
-    return entities.NewResponse(c).Success(
-        fiber.StatusOK,
-        &struct {
-            Key string `json:"key"`
-        } {
-            Key: apiKey.SignToken(),
-        },
-    ).Res()
+// InsertApiKey response has the key, it can not be shown again
+func (h *appinfoHandler) InsertApiKey(c *fiber.Ctx) error {
+    req := new(appinfo.ApiKeyReq)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(insertApiKeyErr),
+            err.Error(),
+        ).Res()
+    }
+
+    userId, _ := c.Locals("userId").(string)
+    apiKey, err := h.appinfoUsecase.InsertApiKey(c.UserContext(), req, userId)
+    if err != nil {
+        switch {
+        case err.Error() == "name is required",
+            err.Error() == "scopes is required",
+            err.Error() == "expires_in is invalid",
+            strings.HasSuffix(err.Error(), "is invalid"):
+            return entities.NewResponse(c).Error(
+                fiber.ErrBadRequest.Code,
+                string(insertApiKeyErr),
+                err.Error(),
+            ).Res()
+        default:
+            return entities.NewResponse(c).Error(
+                fiber.ErrInternalServerError.Code,
+                string(insertApiKeyErr),
+                err.Error(),
+            ).Res()
+        }
+    }
+    return entities.NewResponse(c).Success(fiber.StatusCreated, apiKey).Res()
+}
+
+func (h *appinfoHandler) RevokeApiKey(c *fiber.Ctx) error {
+    apiKeyId := c.Params("apikey_id")
+    if _, err := uuid.Parse(apiKeyId); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(revokeApiKeyErr),
+            "apikey_id is invalid",
+        ).Res()
+    }
+
+    if err := h.appinfoUsecase.RevokeApiKey(c.UserContext(), apiKeyId); err != nil {
+        switch err.Error() {
+        case "api key not found":
+            return entities.NewResponse(c).Error(
+                fiber.ErrNotFound.Code,
+                string(revokeApiKeyErr),
+                err.Error(),
+            ).Res()
+        default:
+            return entities.NewResponse(c).Error(
+                fiber.ErrInternalServerError.Code,
+                string(revokeApiKeyErr),
+                err.Error(),
+            ).Res()
+        }
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+// Jwks publish public keys in RFC 7517 format, it is not wrapped in response entity
+// so any jwt library can read it
+func (h *appinfoHandler) Jwks(c *fiber.Ctx) error {
+    jwks, err := wymjauth.PublicJwks(h.cfg.Jwt())
+    if err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrInternalServerError.Code,
+            string(jwksError),
+            err.Error(),
+        ).Res()
+    }
+    c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+    return c.Status(fiber.StatusOK).JSON(jwks)
 }
@@ -1,11 +1,21 @@
 package appinfoRepositories
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
 	"github.com/jmoiron/sqlx"
+	"github.com/ppp3ppj/wymj/modules/appinfo"
 )
 
 type IAppinfoRepository interface {
-
+    InsertApiKey(ctx context.Context, req *appinfo.ApiKeyReq, userId, prefix, keyHash string, expiredAt *time.Time) (*appinfo.ApiKey, error)
+    FindOneApiKey(ctx context.Context, apiKeyId string) (*appinfo.ApiKey, error)
+    FindApiKey(ctx context.Context) ([]*appinfo.ApiKey, error)
+    RevokeApiKey(ctx context.Context, apiKeyId string) error
+    InsertBootstrapApiKey(ctx context.Context, permission, prefix, keyHash string) (bool, error)
 }
 
 type appinfoRepository struct {
@@ -17,3 +27,161 @@ func AppinfoRepository(db *sqlx.DB) IAppinfoRepository {
         db: db,
     }
 }
+
+func (r *appinfoRepository) InsertApiKey(ctx context.Context, req *appinfo.ApiKeyReq, userId, prefix, keyHash string, expiredAt *time.Time) (*appinfo.ApiKey, error) {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    scopes, err := json.Marshal(req.Scopes)
+    if err != nil {
+        return nil, fmt.Errorf("marshal scopes failed: %v", err)
+    }
+
+    query := `
+    INSERT INTO "api_keys" (
+        "name",
+        "prefix",
+        "key_hash",
+        "user_id",
+        "scopes",
+        "expired_at"
+    )
+    VALUES ($1, $2, $3, $4, $5, $6)
+    RETURNING "id";`
+
+    var apiKeyId string
+    if err := r.db.QueryRowContext(
+        ctx,
+        query,
+        req.Name,
+        prefix,
+        keyHash,
+        userId,
+        string(scopes),
+        expiredAt,
+    ).Scan(&apiKeyId); err != nil {
+        return nil, fmt.Errorf("insert api key failed: %v", err)
+    }
+    return r.FindOneApiKey(ctx, apiKeyId)
+}
+
+func (r *appinfoRepository) FindOneApiKey(ctx context.Context, apiKeyId string) (*appinfo.ApiKey, error) {
+    query := `
+    SELECT
+        row_to_json("k")
+    FROM (
+        SELECT
+            "id",
+            "name",
+            "prefix",
+            "user_id",
+            "scopes",
+            "expired_at",
+            "last_used_at",
+            "revoked_at",
+            "created_at"
+        FROM "api_keys"
+        WHERE "id" = $1
+    ) AS "k";`
+
+    data := make([]byte, 0)
+    if err := r.db.GetContext(ctx, &data, query, apiKeyId); err != nil {
+        return nil, fmt.Errorf("get api key failed: %v", err)
+    }
+    apiKey := new(appinfo.ApiKey)
+    if err := json.Unmarshal(data, apiKey); err != nil {
+        return nil, fmt.Errorf("unmarshal api key failed: %v", err)
+    }
+    return apiKey, nil
+}
+
+func (r *appinfoRepository) FindApiKey(ctx context.Context) ([]*appinfo.ApiKey, error) {
+    query := `
+    SELECT
+        COALESCE(array_to_json(array_agg("k")), '[]'::json)
+    FROM (
+        SELECT
+            "id",
+            "name",
+            "prefix",
+            "user_id",
+            "scopes",
+            "expired_at",
+            "last_used_at",
+            "revoked_at",
+            "created_at"
+        FROM "api_keys"
+        ORDER BY "created_at" DESC
+    ) AS "k";`
+
+    data := make([]byte, 0)
+    if err := r.db.GetContext(ctx, &data, query); err != nil {
+        return nil, fmt.Errorf("get api keys failed: %v", err)
+    }
+    apiKeys := make([]*appinfo.ApiKey, 0)
+    if err := json.Unmarshal(data, &apiKeys); err != nil {
+        return nil, fmt.Errorf("unmarshal api keys failed: %v", err)
+    }
+    return apiKeys, nil
+}
+
+func (r *appinfoRepository) RevokeApiKey(ctx context.Context, apiKeyId string) error {
+    query := `
+    UPDATE "api_keys" SET
+        "revoked_at" = NOW()
+    WHERE "id" = $1
+    AND "revoked_at" IS NULL;`
+
+    result, err := r.db.ExecContext(ctx, query, apiKeyId)
+    if err != nil {
+        return fmt.Errorf("revoke api key failed: %v", err)
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return fmt.Errorf("api key not found")
+    }
+    return nil
+}
+
+// InsertBootstrapApiKey store key with every scope for first user who has permission, false is
+// returned when the key is already stored, also when it has been revoked
+func (r *appinfoRepository) InsertBootstrapApiKey(ctx context.Context, permission, prefix, keyHash string) (bool, error) {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    query := `
+    INSERT INTO "api_keys" (
+        "name",
+        "prefix",
+        "key_hash",
+        "user_id",
+        "scopes"
+    )
+    SELECT 'bootstrap', $1, $2, "u"."id", '["*"]'::jsonb
+    FROM "users" "u"
+    JOIN "user_roles" "ur" ON "ur"."user_id" = "u"."id"
+    JOIN "role_permissions" "rp" ON "rp"."role_id" = "ur"."role_id"
+    JOIN "permissions" "p" ON "p"."id" = "rp"."permission_id"
+    WHERE "p"."name" = $3
+    AND "u"."deleted_at" IS NULL
+    AND "u"."disabled_at" IS NULL
+    ORDER BY "u"."id"
+    LIMIT 1
+    ON CONFLICT ("key_hash") DO NOTHING;`
+
+    result, err := r.db.ExecContext(ctx, query, prefix, keyHash, permission)
+    if err != nil {
+        return false, fmt.Errorf("insert api key failed: %v", err)
+    }
+    if rows, _ := result.RowsAffected(); rows == 1 {
+        return true, nil
+    }
+
+    var stored bool
+    if err := r.db.GetContext(ctx, &stored, `SELECT EXISTS (SELECT 1 FROM "api_keys" WHERE "key_hash" = $1);`, keyHash); err != nil {
+        return false, fmt.Errorf("get api key failed: %v", err)
+    }
+    if !stored {
+        return false, fmt.Errorf("no user has %s permission to own the key", permission)
+    }
+    return false, nil
+}
@@ -1,16 +1,121 @@
 package appinfoUsecases
 
-import "github.com/ppp3ppj/wymj/modules/appinfo/appinfoRepositories"
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ppp3ppj/wymj/modules/appinfo"
+	"github.com/ppp3ppj/wymj/modules/appinfo/appinfoRepositories"
+	"github.com/ppp3ppj/wymj/modules/roles"
+	"github.com/ppp3ppj/wymj/pkg/wymjauth"
+	"github.com/ppp3ppj/wymj/pkg/wymjtrace"
+)
 
 type IAppinfoUsecase interface {
+    InsertApiKey(ctx context.Context, req *appinfo.ApiKeyReq, userId string) (*appinfo.ApiKeyRes, error)
+    FindApiKey(ctx context.Context) ([]*appinfo.ApiKey, error)
+    RevokeApiKey(ctx context.Context, apiKeyId string) error
+    BootstrapApiKey(ctx context.Context, key string) error
+}
+
+// IApiKeyCache is cache of api keys in middleware, key is reset after it is revoked
+type IApiKeyCache interface {
+    ResetApiKeyCache(apiKeyId string)
 }
 
 type appinfoUsecase struct {
     appinfoRepository appinfoRepositories.IAppinfoRepository
+    apiKeyCache IApiKeyCache
 }
 
-func AppinfoUsecase(appinfoRepository appinfoRepositories.IAppinfoRepository) IAppinfoUsecase {
+func AppinfoUsecase(appinfoRepository appinfoRepositories.IAppinfoRepository, apiKeyCache IApiKeyCache) IAppinfoUsecase {
     return &appinfoUsecase{
         appinfoRepository: appinfoRepository,
+        apiKeyCache: apiKeyCache,
+    }
+}
+
+// InsertApiKey generate key as wymj_<random>, the key is returned only this time
+func (u *appinfoUsecase) InsertApiKey(ctx context.Context, req *appinfo.ApiKeyReq, userId string) (*appinfo.ApiKeyRes, error) {
+    ctx, span := wymjtrace.Start(ctx, "appinfoUsecase.InsertApiKey")
+    defer span.End()
+
+    req.Name = strings.Trim(req.Name, " ")
+    if req.Name == "" {
+        return nil, fmt.Errorf("name is required")
+    }
+    if len(req.Scopes) == 0 {
+        return nil, fmt.Errorf("scopes is required")
+    }
+    for _, scope := range req.Scopes {
+        if !slices.Contains(appinfo.ApiKeyScopes, scope) {
+            return nil, fmt.Errorf("scope %q is invalid", scope)
+        }
+    }
+    if req.ExpiresIn < 0 {
+        return nil, fmt.Errorf("expires_in is invalid")
+    }
+
+    token, err := wymjauth.RandomToken(32)
+    if err != nil {
+        return nil, err
+    }
+    key := "wymj_" + token
+    var expiredAt *time.Time
+    if req.ExpiresIn > 0 {
+        t := time.Now().Add(time.Duration(req.ExpiresIn) * time.Second)
+        expiredAt = &t
+    }
+
+    // prefix let admin recognize the key without storing it
+    apiKey, err := u.appinfoRepository.InsertApiKey(ctx, req, userId, key[:12], wymjauth.HashToken(key), expiredAt)
+    if err != nil {
+        return nil, err
+    }
+    return &appinfo.ApiKeyRes{
+        ApiKey: apiKey,
+        Key: key,
+    }, nil
+}
+
+func (u *appinfoUsecase) FindApiKey(ctx context.Context) ([]*appinfo.ApiKey, error) {
+    ctx, span := wymjtrace.Start(ctx, "appinfoUsecase.FindApiKey")
+    defer span.End()
+
+    apiKeys, err := u.appinfoRepository.FindApiKey(ctx)
+    if err != nil {
+        return nil, err
+    }
+    return apiKeys, nil
+}
+
+func (u *appinfoUsecase) RevokeApiKey(ctx context.Context, apiKeyId string) error {
+    ctx, span := wymjtrace.Start(ctx, "appinfoUsecase.RevokeApiKey")
+    defer span.End()
+
+    if err := u.appinfoRepository.RevokeApiKey(ctx, apiKeyId); err != nil {
+        return err
+    }
+    u.apiKeyCache.ResetApiKeyCache(apiKeyId)
+    return nil
+}
+
+// BootstrapApiKey create key from config on new database, signin need api key so without it
+// nobody can sign in to create the first one
+func (u *appinfoUsecase) BootstrapApiKey(ctx context.Context, key string) error {
+    if key == "" {
+        return nil
+    }
+    created, err := u.appinfoRepository.InsertBootstrapApiKey(ctx, roles.ApiKeysAdmin, key[:12], wymjauth.HashToken(key))
+    if err != nil {
+        return err
+    }
+    if created {
+        slog.WarnContext(ctx, "bootstrap api key is created, remove AUTH_BOOTSTRAP_API_KEY after real keys are created")
     }
+    return nil
 }
@@ -0,0 +1,67 @@
+package appinfoUsecases
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ppp3ppj/wymj/modules/appinfo/appinfoRepositories"
+	"github.com/ppp3ppj/wymj/modules/roles"
+	"github.com/ppp3ppj/wymj/pkg/wymjauth"
+)
+
+// testRepository has no user with apikeys:admin when hasAdmin is false
+type testRepository struct {
+    appinfoRepositories.IAppinfoRepository
+    hasAdmin bool
+    keys map[string]string
+}
+
+func (r *testRepository) InsertBootstrapApiKey(ctx context.Context, permission, prefix, keyHash string) (bool, error) {
+    if permission != roles.ApiKeysAdmin {
+        return false, fmt.Errorf("permission = %s", permission)
+    }
+    if _, ok := r.keys[keyHash]; ok {
+        return false, nil
+    }
+    if !r.hasAdmin {
+        return false, fmt.Errorf("no user has %s permission to own the key", permission)
+    }
+    r.keys[keyHash] = prefix
+    return true, nil
+}
+
+func TestBootstrapApiKey(t *testing.T) {
+    key := "wymj_bootstrap-0123456789abcdef0123456789"
+    tests := []struct {
+        name string
+        key string
+        hasAdmin bool
+        stored bool
+        wantErr bool
+        wantKeys int
+    }{
+        {"key is not set", "", true, false, false, 0},
+        {"key is created", key, true, false, false, 1},
+        {"key is stored already", key, true, true, false, 1},
+        {"no admin to own key", key, false, false, true, 0},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            repository := &testRepository{hasAdmin: tt.hasAdmin, keys: make(map[string]string)}
+            if tt.stored {
+                repository.keys[wymjauth.HashToken(key)] = key[:12]
+            }
+            err := AppinfoUsecase(repository, nil).BootstrapApiKey(context.Background(), tt.key)
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+            }
+            if len(repository.keys) != tt.wantKeys {
+                t.Errorf("keys = %v", repository.keys)
+            }
+            if prefix, ok := repository.keys[wymjauth.HashToken(key)]; ok && prefix != "wymj_bootstr" {
+                t.Errorf("prefix = %q", prefix)
+            }
+        })
+    }
+}
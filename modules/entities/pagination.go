@@ -0,0 +1,34 @@
+package entities
+
+type PaginationReq struct {
+    Page int `query:"page"`
+    Limit int `query:"limit"`
+    TotalPage int `query:"total_page" json:"total_page"`
+    TotalItem int `query:"total_item" json:"total_item"`
+}
+
+type SortReq struct {
+    OrderBy string `query:"order_by"`
+    Sort string `query:"sort"` // DESC | ASC
+}
+
+type PaginateRes struct {
+    Data any `json:"data"`
+    Page int `json:"page"`
+    Limit int `json:"limit"`
+    TotalPage int `json:"total_page"`
+    TotalItem int `json:"total_item"`
+}
+
+// CursorReq is keyset pagination, cursor is next_cursor of previous page
+type CursorReq struct {
+    Cursor string `query:"cursor"`
+    Limit int `query:"limit"`
+}
+
+// CursorRes NextCursor is empty on the last page
+type CursorRes struct {
+    Data any `json:"data"`
+    Limit int `json:"limit"`
+    NextCursor string `json:"next_cursor"`
+}
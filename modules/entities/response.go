@@ -3,11 +3,12 @@ package entities
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/ppp3ppj/wymj/pkg/wymjlogger"
+	"github.com/ppp3ppj/wymj/pkg/wymjtrace"
 )
 
 type IResponse interface {
     Success(code int, data any) IResponse
-    Error(code int, traceId, msg string) IResponse
+    Error(code int, errCode, msg string) IResponse
     Res() error
 }
 
@@ -19,8 +20,12 @@ type Response struct {
     IsError bool
 }
 
+// ErrorResponse Code is error code of handler like users-002, TraceId and RequestId tie
+// the error to one request in logs
 type ErrorResponse struct {
     TraceId string `json:"trace_id"`
+    RequestId string `json:"request_id"`
+    Code string `json:"code"`
     Msg string `json:"msg"`
 }
 
@@ -33,18 +38,24 @@ func NewResponse(c *fiber.Ctx) IResponse {
 func (r *Response) Success(code int, data any) IResponse {
     r.StatusCode = code
     r.Data = data
-    wymjlogger.InitWymjLogger(r.Context, &r.Data).Print().Save()
+    r.Context.Status(code)
+    wymjlogger.InitWymjLogger(r.Context, &r.Data).Save()
     return r
 }
 
-func (r *Response) Error(code int, traceId, msg string) IResponse {
+func (r *Response) Error(code int, errCode, msg string) IResponse {
     r.StatusCode = code
     r.ErrorRes = &ErrorResponse{
-        TraceId: traceId,
+        Code: errCode,
         Msg: msg,
     }
+    if trace := wymjtrace.FromContext(r.Context.UserContext()); trace != nil {
+        r.ErrorRes.TraceId = trace.TraceId
+        r.ErrorRes.RequestId = trace.RequestId
+    }
     r.IsError = true
-    wymjlogger.InitWymjLogger(r.Context, &r.ErrorRes).Print().Save()
+    r.Context.Status(code)
+    wymjlogger.InitWymjLogger(r.Context, &r.ErrorRes).Save()
     return r
 }
 
@@ -0,0 +1,23 @@
+package exports
+
+import "time"
+
+type ExportFilter struct {
+    Format string `query:"format"` // csv | xlsx | ics
+    UserId string `query:"user_id"`
+    ProjectId int `query:"project_id"`
+    From string `query:"from"` // YYYY-MM-DD, time entries only
+    To string `query:"to"` // YYYY-MM-DD inclusive, time entries only
+}
+
+type TimeEntryRow struct {
+    Id string `db:"id"`
+    UserId string `db:"user_id"`
+    Username string `db:"username"`
+    TaskId string `db:"task_id"`
+    TaskTitle string `db:"task_title"`
+    ProjectName string `db:"project_name"`
+    StartedAt time.Time `db:"started_at"`
+    StoppedAt *time.Time `db:"stopped_at"`
+    Duration int `db:"duration"` // in seconds
+}
@@ -0,0 +1,143 @@
+package exportsHandlers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/modules/entities"
+	"github.com/ppp3ppj/wymj/modules/exports"
+	"github.com/ppp3ppj/wymj/modules/exports/exportsUsecases"
+	"github.com/ppp3ppj/wymj/modules/roles"
+	"github.com/ppp3ppj/wymj/pkg/wymjexport"
+)
+
+type exportsHandlerErrCode string
+
+const (
+    exportTaskErr exportsHandlerErrCode = "exports-001"
+    exportTimeEntryErr exportsHandlerErrCode = "exports-002"
+)
+
+type IExportsHandler interface {
+    ExportTask(c *fiber.Ctx) error
+    ExportTimeEntry(c *fiber.Ctx) error
+}
+
+type exportsHandler struct {
+    cfg config.IConfig
+    exportsUsecase exportsUsecases.IExportsUsecase
+}
+
+func ExportsHandler(cfg config.IConfig, exportsUsecase exportsUsecases.IExportsUsecase) IExportsHandler {
+    return &exportsHandler{
+        cfg: cfg,
+        exportsUsecase: exportsUsecase,
+    }
+}
+
+// parseFilter apply same owner rule as json api, customer can export only own data
+func parseFilter(c *fiber.Ctx) (*exports.ExportFilter, error) {
+    req := new(exports.ExportFilter)
+    if err := c.QueryParser(req); err != nil {
+        return nil, err
+    }
+    if !roles.HasPermission(c, roles.ReportsAdmin) {
+        userId, _ := c.Locals("userId").(string)
+        if req.UserId != "" && req.UserId != userId {
+            return nil, fmt.Errorf("no permission to access")
+        }
+        req.UserId = userId
+    }
+    if req.Format == "" {
+        req.Format = string(wymjexport.Csv)
+    }
+    for _, date := range []string{req.From, req.To} {
+        if date == "" {
+            continue
+        }
+        if _, err := time.Parse("2006-01-02", date); err != nil {
+            return nil, fmt.Errorf("from and to must be YYYY-MM-DD")
+        }
+    }
+    return req, nil
+}
+
+// stream write file to client while rows are read, error after header is sent can only be logged
+// stream body is written after handler return, c can not be used in fn so ctx is passed
+func (h *exportsHandler) stream(c *fiber.Ctx, filename string, format wymjexport.Format, fn func(ctx context.Context, w *bufio.Writer) error) error {
+    ctx := c.UserContext()
+    c.Set(fiber.HeaderContentType, format.ContentType())
+    c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.%s"`, filename, format))
+    c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+        if err := fn(ctx, w); err != nil {
+            slog.ErrorContext(ctx, "export failed", slog.String("filename", filename), slog.String("error", err.Error()))
+        }
+        w.Flush()
+    })
+    return nil
+}
+
+func (h *exportsHandler) ExportTask(c *fiber.Ctx) error {
+    req, err := parseFilter(c)
+    if err != nil {
+        if err.Error() == "no permission to access" {
+            return entities.NewResponse(c).Error(
+                fiber.ErrUnauthorized.Code,
+                string(exportTaskErr),
+                err.Error(),
+            ).Res()
+        }
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(exportTaskErr),
+            err.Error(),
+        ).Res()
+    }
+    format := wymjexport.Format(req.Format)
+    if format != wymjexport.Csv && format != wymjexport.Xlsx {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(exportTaskErr),
+            "format is invalid, expect csv or xlsx",
+        ).Res()
+    }
+
+    return h.stream(c, "tasks", format, func(ctx context.Context, w *bufio.Writer) error {
+        return h.exportsUsecase.ExportTask(ctx, req, w)
+    })
+}
+
+func (h *exportsHandler) ExportTimeEntry(c *fiber.Ctx) error {
+    req, err := parseFilter(c)
+    if err != nil {
+        if err.Error() == "no permission to access" {
+            return entities.NewResponse(c).Error(
+                fiber.ErrUnauthorized.Code,
+                string(exportTimeEntryErr),
+                err.Error(),
+            ).Res()
+        }
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(exportTimeEntryErr),
+            err.Error(),
+        ).Res()
+    }
+    format := wymjexport.Format(req.Format)
+    if format != wymjexport.Csv && format != wymjexport.Xlsx && format != wymjexport.Ics {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(exportTimeEntryErr),
+            "format is invalid, expect csv, xlsx or ics",
+        ).Res()
+    }
+
+    return h.stream(c, "time_entries", format, func(ctx context.Context, w *bufio.Writer) error {
+        return h.exportsUsecase.ExportTimeEntry(ctx, req, w)
+    })
+}
@@ -0,0 +1,133 @@
+package exportsRepositories
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/ppp3ppj/wymj/modules/exports"
+	"github.com/ppp3ppj/wymj/modules/tasks"
+)
+
+type IExportsRepository interface {
+    // Stream call fn for each row, rows are read from database one by one
+    StreamTask(ctx context.Context, req *exports.ExportFilter, fn func(*tasks.Task) error) error
+    StreamTimeEntry(ctx context.Context, req *exports.ExportFilter, fn func(*exports.TimeEntryRow) error) error
+}
+
+type exportsRepository struct {
+    db *sqlx.DB
+}
+
+func ExportsRepository(db *sqlx.DB) IExportsRepository {
+    return &exportsRepository{
+        db: db,
+    }
+}
+
+func (r *exportsRepository) StreamTask(ctx context.Context, req *exports.ExportFilter, fn func(*tasks.Task) error) error {
+    whereStack := make([]string, 0)
+    values := make([]any, 0)
+    if req.UserId != "" {
+        values = append(values, req.UserId)
+        whereStack = append(whereStack, fmt.Sprintf(`
+    AND "user_id" = $%d`, len(values)))
+    }
+    if req.ProjectId != 0 {
+        values = append(values, req.ProjectId)
+        whereStack = append(whereStack, fmt.Sprintf(`
+    AND "project_id" = $%d`, len(values)))
+    }
+
+    query := fmt.Sprintf(`
+    SELECT
+        "id",
+        COALESCE("user_id", '') AS "user_id",
+        "title",
+        "description",
+        "duration",
+        "project_id",
+        "created_at",
+        "updated_at"
+    FROM "tasks"
+    WHERE 1 = 1%s
+    ORDER BY "id";`, strings.Join(whereStack, ""))
+
+    rows, err := r.db.QueryxContext(ctx, query, values...)
+    if err != nil {
+        return fmt.Errorf("get tasks failed: %v", err)
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        task := new(tasks.Task)
+        if err := rows.StructScan(task); err != nil {
+            return fmt.Errorf("scan task failed: %v", err)
+        }
+        if err := fn(task); err != nil {
+            return err
+        }
+    }
+    return rows.Err()
+}
+
+func (r *exportsRepository) StreamTimeEntry(ctx context.Context, req *exports.ExportFilter, fn func(*exports.TimeEntryRow) error) error {
+    whereStack := make([]string, 0)
+    values := make([]any, 0)
+    if req.UserId != "" {
+        values = append(values, req.UserId)
+        whereStack = append(whereStack, fmt.Sprintf(`
+    AND "te"."user_id" = $%d`, len(values)))
+    }
+    if req.ProjectId != 0 {
+        values = append(values, req.ProjectId)
+        whereStack = append(whereStack, fmt.Sprintf(`
+    AND "t"."project_id" = $%d`, len(values)))
+    }
+    if req.From != "" {
+        values = append(values, req.From)
+        whereStack = append(whereStack, fmt.Sprintf(`
+    AND "te"."started_at" >= $%d::date`, len(values)))
+    }
+    if req.To != "" {
+        values = append(values, req.To)
+        whereStack = append(whereStack, fmt.Sprintf(`
+    AND "te"."started_at" < ($%d::date + 1)`, len(values)))
+    }
+
+    query := fmt.Sprintf(`
+    SELECT
+        "te"."id",
+        "te"."user_id",
+        "u"."username",
+        "te"."task_id",
+        "t"."title" AS "task_title",
+        COALESCE("p"."name", '') AS "project_name",
+        "te"."started_at",
+        "te"."stopped_at",
+        "te"."duration"
+    FROM "time_entries" "te"
+    JOIN "tasks" "t" ON "t"."id" = "te"."task_id"
+    JOIN "users" "u" ON "u"."id" = "te"."user_id"
+    LEFT JOIN "projects" "p" ON "p"."id" = "t"."project_id"
+    WHERE "te"."stopped_at" IS NOT NULL%s
+    ORDER BY "te"."started_at";`, strings.Join(whereStack, ""))
+
+    rows, err := r.db.QueryxContext(ctx, query, values...)
+    if err != nil {
+        return fmt.Errorf("get time entries failed: %v", err)
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        entry := new(exports.TimeEntryRow)
+        if err := rows.StructScan(entry); err != nil {
+            return fmt.Errorf("scan time entry failed: %v", err)
+        }
+        if err := fn(entry); err != nil {
+            return err
+        }
+    }
+    return rows.Err()
+}
@@ -0,0 +1,145 @@
+package exportsUsecases
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/modules/exports"
+	"github.com/ppp3ppj/wymj/modules/exports/exportsRepositories"
+	"github.com/ppp3ppj/wymj/modules/tasks"
+	"github.com/ppp3ppj/wymj/pkg/wymjexport"
+	"github.com/ppp3ppj/wymj/pkg/wymjtrace"
+)
+
+type IExportsUsecase interface {
+    ExportTask(ctx context.Context, req *exports.ExportFilter, w io.Writer) error
+    ExportTimeEntry(ctx context.Context, req *exports.ExportFilter, w io.Writer) error
+}
+
+type exportsUsecase struct {
+    cfg config.IConfig
+    exportsRepository exportsRepositories.IExportsRepository
+}
+
+func ExportsUsecase(cfg config.IConfig, exportsRepository exportsRepositories.IExportsRepository) IExportsUsecase {
+    return &exportsUsecase{
+        cfg: cfg,
+        exportsRepository: exportsRepository,
+    }
+}
+
+func (u *exportsUsecase) ExportTask(ctx context.Context, req *exports.ExportFilter, w io.Writer) error {
+    ctx, span := wymjtrace.Start(ctx, "exportsUsecase.ExportTask")
+    defer span.End()
+
+    export, err := wymjexport.NewWymjExport(wymjexport.Format(req.Format), w, "Tasks")
+    if err != nil {
+        return err
+    }
+    if err := export.WriteHeader([]string{
+        "id",
+        "user_id",
+        "title",
+        "description",
+        "duration",
+        "project_id",
+        "created_at",
+        "updated_at",
+    }); err != nil {
+        return err
+    }
+
+    if err := u.exportsRepository.StreamTask(ctx, req, func(task *tasks.Task) error {
+        var projectId any
+        if task.ProjectId != nil {
+            projectId = *task.ProjectId
+        }
+        return export.WriteRow([]any{
+            task.Id,
+            task.UserId,
+            task.Title,
+            task.Description,
+            task.Duration,
+            projectId,
+            task.CreatedAt,
+            task.UpdatedAt,
+        })
+    }); err != nil {
+        return err
+    }
+    return export.Close()
+}
+
+func (u *exportsUsecase) ExportTimeEntry(ctx context.Context, req *exports.ExportFilter, w io.Writer) error {
+    ctx, span := wymjtrace.Start(ctx, "exportsUsecase.ExportTimeEntry")
+    defer span.End()
+
+    if wymjexport.Format(req.Format) == wymjexport.Ics {
+        return u.exportCalendar(ctx, req, w)
+    }
+
+    export, err := wymjexport.NewWymjExport(wymjexport.Format(req.Format), w, "Time entries")
+    if err != nil {
+        return err
+    }
+    if err := export.WriteHeader([]string{
+        "id",
+        "user_id",
+        "username",
+        "task_id",
+        "task_title",
+        "project",
+        "started_at",
+        "stopped_at",
+        "duration",
+    }); err != nil {
+        return err
+    }
+
+    if err := u.exportsRepository.StreamTimeEntry(ctx, req, func(entry *exports.TimeEntryRow) error {
+        var stoppedAt any
+        if entry.StoppedAt != nil {
+            stoppedAt = entry.StoppedAt.Format(time.RFC3339)
+        }
+        return export.WriteRow([]any{
+            entry.Id,
+            entry.UserId,
+            entry.Username,
+            entry.TaskId,
+            entry.TaskTitle,
+            entry.ProjectName,
+            entry.StartedAt.Format(time.RFC3339),
+            stoppedAt,
+            entry.Duration,
+        })
+    }); err != nil {
+        return err
+    }
+    return export.Close()
+}
+
+// exportCalendar write each tracked interval as a VEVENT
+func (u *exportsUsecase) exportCalendar(ctx context.Context, req *exports.ExportFilter, w io.Writer) error {
+    calendar := wymjexport.NewWymjCalendar(w, fmt.Sprintf("%s time entries", u.cfg.App().Name()))
+
+    if err := u.exportsRepository.StreamTimeEntry(ctx, req, func(entry *exports.TimeEntryRow) error {
+        return calendar.WriteEvent(&wymjexport.CalendarEvent{
+            Uid: fmt.Sprintf("%s@%s", entry.Id, u.cfg.App().Name()),
+            Summary: entry.TaskTitle,
+            Description: func() string {
+                if entry.ProjectName == "" {
+                    return fmt.Sprintf("%s (%s)", entry.TaskId, entry.Username)
+                }
+                return fmt.Sprintf("%s - %s (%s)", entry.ProjectName, entry.TaskId, entry.Username)
+            }(),
+            Start: entry.StartedAt,
+            End: *entry.StoppedAt,
+        })
+    }); err != nil {
+        return err
+    }
+    return calendar.Close()
+}
@@ -0,0 +1,17 @@
+package images
+
+import "mime/multipart"
+
+type Image struct {
+    Id string `db:"id" json:"id"`
+    // Filename is storage key of the file e.g. tasks/T0000001/<uuid>.png
+    Filename string `db:"filename" json:"filename"`
+    Url string `db:"url" json:"url"`
+    TaskId string `db:"task_id" json:"task_id"`
+    CreatedAt string `db:"created_at" json:"created_at"`
+}
+
+type ImageUploadReq struct {
+    TaskId string
+    Files []*multipart.FileHeader
+}
@@ -0,0 +1,149 @@
+package imagesHandlers
+
+import (
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/modules/entities"
+	"github.com/ppp3ppj/wymj/modules/images"
+	"github.com/ppp3ppj/wymj/modules/images/imagesUsecases"
+	"github.com/ppp3ppj/wymj/modules/roles"
+)
+
+type imagesHandlerErrCode string
+
+const (
+    findImageErr imagesHandlerErrCode = "images-001"
+    uploadImageErr imagesHandlerErrCode = "images-002"
+    deleteImageErr imagesHandlerErrCode = "images-003"
+    openImageErr imagesHandlerErrCode = "images-004"
+)
+
+type IImagesHandler interface {
+    FindImage(c *fiber.Ctx) error
+    UploadImage(c *fiber.Ctx) error
+    DeleteImage(c *fiber.Ctx) error
+    OpenImage(c *fiber.Ctx) error
+}
+
+type imagesHandler struct {
+    cfg config.IConfig
+    imagesUsecase imagesUsecases.IImagesUsecase
+}
+
+func ImagesHandler(cfg config.IConfig, imagesUsecase imagesUsecases.IImagesUsecase) IImagesHandler {
+    return &imagesHandler{
+        cfg: cfg,
+        imagesUsecase: imagesUsecase,
+    }
+}
+
+func (h *imagesHandler) imageErrRes(c *fiber.Ctx, code imagesHandlerErrCode, err error) error {
+    switch {
+    case strings.HasSuffix(err.Error(), "sql: no rows in result set"),
+        err.Error() == "image not found":
+        return entities.NewResponse(c).Error(
+            fiber.ErrNotFound.Code,
+            string(code),
+            "not found",
+        ).Res()
+    case err.Error() == "no permission to access":
+        return entities.NewResponse(c).Error(
+            fiber.ErrUnauthorized.Code,
+            string(code),
+            err.Error(),
+        ).Res()
+    case err.Error() == "file is too large":
+        return entities.NewResponse(c).Error(
+            fiber.ErrRequestEntityTooLarge.Code,
+            string(code),
+            err.Error(),
+        ).Res()
+    case err.Error() == "file type is not allowed":
+        return entities.NewResponse(c).Error(
+            fiber.ErrUnsupportedMediaType.Code,
+            string(code),
+            err.Error(),
+        ).Res()
+    default:
+        return entities.NewResponse(c).Error(
+            fiber.ErrInternalServerError.Code,
+            string(code),
+            err.Error(),
+        ).Res()
+    }
+}
+
+func (h *imagesHandler) FindImage(c *fiber.Ctx) error {
+    taskId := strings.Trim(c.Params("task_id"), " ")
+    userId, _ := c.Locals("userId").(string)
+
+    result, err := h.imagesUsecase.FindImage(c.UserContext(), taskId, userId, roles.HasPermission(c, roles.TasksAdmin))
+    if err != nil {
+        return h.imageErrRes(c, findImageErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+func (h *imagesHandler) UploadImage(c *fiber.Ctx) error {
+    form, err := c.MultipartForm()
+    if err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(uploadImageErr),
+            err.Error(),
+        ).Res()
+    }
+    files := form.File["files"]
+    if len(files) == 0 {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(uploadImageErr),
+            "files are required",
+        ).Res()
+    }
+
+    req := &images.ImageUploadReq{
+        TaskId: strings.Trim(c.Params("task_id"), " "),
+        Files: files,
+    }
+    userId, _ := c.Locals("userId").(string)
+
+    result, err := h.imagesUsecase.UploadImage(c.UserContext(), req, userId, roles.HasPermission(c, roles.TasksAdmin))
+    if err != nil {
+        return h.imageErrRes(c, uploadImageErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusCreated, result).Res()
+}
+
+func (h *imagesHandler) DeleteImage(c *fiber.Ctx) error {
+    taskId := strings.Trim(c.Params("task_id"), " ")
+    imageId := strings.Trim(c.Params("image_id"), " ")
+    userId, _ := c.Locals("userId").(string)
+
+    if err := h.imagesUsecase.DeleteImage(c.UserContext(), taskId, imageId, userId, roles.HasPermission(c, roles.TasksAdmin)); err != nil {
+        return h.imageErrRes(c, deleteImageErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+// OpenImage stream file of the image, content type come from extension that was set by
+// sniffing at upload so browser can not be tricked to run it
+func (h *imagesHandler) OpenImage(c *fiber.Ctx) error {
+    taskId := strings.Trim(c.Params("task_id"), " ")
+    imageId := strings.Trim(c.Params("image_id"), " ")
+    userId, _ := c.Locals("userId").(string)
+
+    image, file, err := h.imagesUsecase.OpenImage(c.UserContext(), taskId, imageId, userId, roles.HasPermission(c, roles.TasksAdmin))
+    if err != nil {
+        return h.imageErrRes(c, openImageErr, err)
+    }
+    c.Set(fiber.HeaderContentType, mime.TypeByExtension(path.Ext(image.Filename)))
+    c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+    c.Set(fiber.HeaderCacheControl, "private, max-age=3600")
+    // file is closed by fiber after it is sent
+    return c.Status(fiber.StatusOK).SendStream(file)
+}
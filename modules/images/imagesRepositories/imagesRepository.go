@@ -0,0 +1,99 @@
+package imagesRepositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/ppp3ppj/wymj/modules/images"
+)
+
+type IImagesRepository interface {
+    FindImage(ctx context.Context, taskId string) ([]*images.Image, error)
+    FindOneImage(ctx context.Context, imageId string) (*images.Image, error)
+    InsertImage(ctx context.Context, req *images.Image) (*images.Image, error)
+    DeleteImage(ctx context.Context, imageId string) error
+}
+
+type imagesRepository struct {
+    db *sqlx.DB
+}
+
+func ImagesRepository(db *sqlx.DB) IImagesRepository {
+    return &imagesRepository{
+        db: db,
+    }
+}
+
+func (r *imagesRepository) FindImage(ctx context.Context, taskId string) ([]*images.Image, error) {
+    query := `
+    SELECT
+        "id",
+        "filename",
+        "url",
+        "task_id",
+        "created_at"
+    FROM "images"
+    WHERE "task_id" = $1
+    ORDER BY "created_at";`
+
+    imagesData := make([]*images.Image, 0)
+    if err := r.db.SelectContext(ctx, &imagesData, query, taskId); err != nil {
+        return nil, fmt.Errorf("get images failed: %v", err)
+    }
+    return imagesData, nil
+}
+
+func (r *imagesRepository) FindOneImage(ctx context.Context, imageId string) (*images.Image, error) {
+    query := `
+    SELECT
+        "id",
+        "filename",
+        "url",
+        "task_id",
+        "created_at"
+    FROM "images"
+    WHERE "id" = $1;`
+
+    image := new(images.Image)
+    if err := r.db.GetContext(ctx, image, query, imageId); err != nil {
+        return nil, fmt.Errorf("get image failed: %v", err)
+    }
+    return image, nil
+}
+
+func (r *imagesRepository) InsertImage(ctx context.Context, req *images.Image) (*images.Image, error) {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    query := `
+    INSERT INTO "images" (
+        "filename",
+        "url",
+        "task_id"
+    )
+    VALUES ($1, $2, $3)
+    RETURNING "id", "created_at";`
+
+    if err := r.db.QueryRowxContext(
+        ctx,
+        query,
+        req.Filename,
+        req.Url,
+        req.TaskId,
+    ).Scan(&req.Id, &req.CreatedAt); err != nil {
+        return nil, fmt.Errorf("insert image failed: %v", err)
+    }
+    return req, nil
+}
+
+func (r *imagesRepository) DeleteImage(ctx context.Context, imageId string) error {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    if _, err := r.db.ExecContext(ctx, `DELETE FROM "images" WHERE "id" = $1;`, imageId); err != nil {
+        return fmt.Errorf("delete image failed: %v", err)
+    }
+    return nil
+}
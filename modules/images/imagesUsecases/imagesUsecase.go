@@ -0,0 +1,224 @@
+package imagesUsecases
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/modules/images"
+	"github.com/ppp3ppj/wymj/modules/images/imagesRepositories"
+	"github.com/ppp3ppj/wymj/modules/tasks/tasksUsecases"
+	"github.com/ppp3ppj/wymj/pkg/wymjstorage"
+	"github.com/ppp3ppj/wymj/pkg/wymjtrace"
+)
+
+// content type from sniffing -> file extension
+var allowedImageTypes = map[string]string{
+    "image/jpeg": ".jpg",
+    "image/png": ".png",
+    "image/gif": ".gif",
+    "image/webp": ".webp",
+}
+
+type IImagesUsecase interface {
+    FindImage(ctx context.Context, taskId, userId string, isAdmin bool) ([]*images.Image, error)
+    UploadImage(ctx context.Context, req *images.ImageUploadReq, userId string, isAdmin bool) ([]*images.Image, error)
+    DeleteImage(ctx context.Context, taskId, imageId, userId string, isAdmin bool) error
+    OpenImage(ctx context.Context, taskId, imageId, userId string, isAdmin bool) (*images.Image, io.ReadCloser, error)
+}
+
+type imagesUsecase struct {
+    cfg config.IConfig
+    imagesRepository imagesRepositories.IImagesRepository
+    tasksUsecase tasksUsecases.ITasksUsecase
+    storage wymjstorage.IWymjStorage
+}
+
+func ImagesUsecase(cfg config.IConfig, imagesRepository imagesRepositories.IImagesRepository, tasksUsecase tasksUsecases.ITasksUsecase, storage wymjstorage.IWymjStorage) IImagesUsecase {
+    return &imagesUsecase{
+        cfg: cfg,
+        imagesRepository: imagesRepository,
+        tasksUsecase: tasksUsecase,
+        storage: storage,
+    }
+}
+
+func (u *imagesUsecase) FindImage(ctx context.Context, taskId, userId string, isAdmin bool) ([]*images.Image, error) {
+    ctx, span := wymjtrace.Start(ctx, "imagesUsecase.FindImage")
+    defer span.End()
+
+    // check task owner
+    if _, err := u.tasksUsecase.FindOneTask(ctx, taskId, userId, isAdmin); err != nil {
+        return nil, err
+    }
+    result, err := u.imagesRepository.FindImage(ctx, taskId)
+    if err != nil {
+        return nil, err
+    }
+    for _, image := range result {
+        image.Url = fileUrl(image)
+    }
+    return result, nil
+}
+
+// fileUrl is image file endpoint, storage url is never given to client because file is
+// only served after owner is checked
+func fileUrl(image *images.Image) string {
+    return fmt.Sprintf("/v1/tasks/%s/images/%s/file", image.TaskId, image.Id)
+}
+
+// sniffImage read first 512 bytes to detect real content type, header from client can not be trusted
+func sniffImage(file *multipart.FileHeader) (string, error) {
+    f, err := file.Open()
+    if err != nil {
+        return "", fmt.Errorf("open file failed: %v", err)
+    }
+    defer f.Close()
+
+    buf := make([]byte, 512)
+    n, err := f.Read(buf)
+    if err != nil && n == 0 {
+        return "", fmt.Errorf("read file failed: %v", err)
+    }
+    contentType := http.DetectContentType(buf[:n])
+    if _, ok := allowedImageTypes[contentType]; !ok {
+        return "", fmt.Errorf("file type is not allowed")
+    }
+    return contentType, nil
+}
+
+func (u *imagesUsecase) UploadImage(ctx context.Context, req *images.ImageUploadReq, userId string, isAdmin bool) ([]*images.Image, error) {
+    ctx, span := wymjtrace.Start(ctx, "imagesUsecase.UploadImage")
+    defer span.End()
+
+    if _, err := u.tasksUsecase.FindOneTask(ctx, req.TaskId, userId, isAdmin); err != nil {
+        return nil, err
+    }
+
+    // validate every file before upload anything
+    contentTypes := make([]string, len(req.Files))
+    for i, file := range req.Files {
+        if file.Size > int64(u.cfg.App().FileLimit()) {
+            return nil, fmt.Errorf("file is too large")
+        }
+        contentType, err := sniffImage(file)
+        if err != nil {
+            return nil, err
+        }
+        contentTypes[i] = contentType
+    }
+
+    ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+    defer cancel()
+
+    result := make([]*images.Image, 0)
+    for i, file := range req.Files {
+        f, err := file.Open()
+        if err != nil {
+            u.rollbackUpload(ctx, result)
+            return nil, fmt.Errorf("open file failed: %v", err)
+        }
+
+        key := fmt.Sprintf("tasks/%s/%s%s", req.TaskId, uuid.NewString(), allowedImageTypes[contentTypes[i]])
+        url, err := u.storage.Upload(ctx, key, contentTypes[i], f, file.Size)
+        f.Close()
+        if err != nil {
+            u.rollbackUpload(ctx, result)
+            return nil, err
+        }
+
+        image, err := u.imagesRepository.InsertImage(ctx, &images.Image{
+            Filename: key,
+            Url: url,
+            TaskId: req.TaskId,
+        })
+        if err != nil {
+            u.rollbackUpload(ctx, append(result, &images.Image{Filename: key}))
+            return nil, err
+        }
+        result = append(result, image)
+    }
+    for _, image := range result {
+        image.Url = fileUrl(image)
+    }
+    return result, nil
+}
+
+// rollbackUpload delete rows and files of images already written by a failed upload, it run
+// even when ctx is timed out. Image without id has file but no row
+func (u *imagesUsecase) rollbackUpload(ctx context.Context, written []*images.Image) {
+    ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+    defer cancel()
+
+    for _, image := range written {
+        if image.Id != "" {
+            if err := u.imagesRepository.DeleteImage(ctx, image.Id); err != nil {
+                slog.ErrorContext(ctx, "rollback image upload", slog.String("image_id", image.Id), slog.String("error", err.Error()))
+            }
+        }
+        if err := u.storage.Delete(ctx, image.Filename); err != nil {
+            slog.ErrorContext(ctx, "rollback image upload", slog.String("key", image.Filename), slog.String("error", err.Error()))
+        }
+    }
+}
+
+// OpenImage check task owner same as FindImage then open the file, caller must close it
+func (u *imagesUsecase) OpenImage(ctx context.Context, taskId, imageId, userId string, isAdmin bool) (*images.Image, io.ReadCloser, error) {
+    ctx, span := wymjtrace.Start(ctx, "imagesUsecase.OpenImage")
+    defer span.End()
+
+    if _, err := u.tasksUsecase.FindOneTask(ctx, taskId, userId, isAdmin); err != nil {
+        return nil, nil, err
+    }
+
+    image, err := u.imagesRepository.FindOneImage(ctx, imageId)
+    if err != nil {
+        return nil, nil, err
+    }
+    if image.TaskId != taskId {
+        return nil, nil, fmt.Errorf("image not found")
+    }
+
+    file, err := u.storage.Open(ctx, image.Filename)
+    if err != nil {
+        if err.Error() == "file not found" {
+            return nil, nil, fmt.Errorf("image not found")
+        }
+        return nil, nil, err
+    }
+    return image, file, nil
+}
+
+func (u *imagesUsecase) DeleteImage(ctx context.Context, taskId, imageId, userId string, isAdmin bool) error {
+    ctx, span := wymjtrace.Start(ctx, "imagesUsecase.DeleteImage")
+    defer span.End()
+
+    if _, err := u.tasksUsecase.FindOneTask(ctx, taskId, userId, isAdmin); err != nil {
+        return err
+    }
+
+    image, err := u.imagesRepository.FindOneImage(ctx, imageId)
+    if err != nil {
+        return err
+    }
+    if image.TaskId != taskId {
+        return fmt.Errorf("image not found")
+    }
+
+    ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+    defer cancel()
+
+    if err := u.storage.Delete(ctx, image.Filename); err != nil {
+        return err
+    }
+    if err := u.imagesRepository.DeleteImage(ctx, imageId); err != nil {
+        return err
+    }
+    return nil
+}
@@ -0,0 +1,165 @@
+package imagesUsecases
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/modules/images"
+	"github.com/ppp3ppj/wymj/modules/images/imagesRepositories"
+	"github.com/ppp3ppj/wymj/modules/tasks"
+	"github.com/ppp3ppj/wymj/modules/tasks/tasksUsecases"
+)
+
+const pngData = "\x89PNG\r\n\x1a\n0000000000000000"
+
+type testConfig struct {
+    config.IConfig
+}
+
+type testAppConfig struct {
+    config.IAppconfig
+}
+
+func (testConfig) App() config.IAppconfig { return testAppConfig{} }
+func (testAppConfig) FileLimit() int { return 1 << 20 }
+
+type testTasksUsecase struct {
+    tasksUsecases.ITasksUsecase
+}
+
+func (testTasksUsecase) FindOneTask(ctx context.Context, taskId, userId string, isAdmin bool) (*tasks.Task, error) {
+    return &tasks.Task{Id: taskId}, nil
+}
+
+// testRepository fail InsertImage after failAfter rows are inserted
+type testRepository struct {
+    imagesRepositories.IImagesRepository
+    failAfter int
+    rows map[string]*images.Image
+}
+
+func (r *testRepository) InsertImage(ctx context.Context, req *images.Image) (*images.Image, error) {
+    if len(r.rows) >= r.failAfter {
+        return nil, fmt.Errorf("insert image failed: connection reset")
+    }
+    req.Id = fmt.Sprintf("I%07d", len(r.rows)+1)
+    r.rows[req.Id] = req
+    return req, nil
+}
+
+func (r *testRepository) DeleteImage(ctx context.Context, imageId string) error {
+    delete(r.rows, imageId)
+    return nil
+}
+
+// testStorage fail Upload after failAfter files are stored
+type testStorage struct {
+    mu sync.Mutex
+    failAfter int
+    files map[string][]byte
+}
+
+func (s *testStorage) Upload(ctx context.Context, key, contentType string, file io.Reader, size int64) (string, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if len(s.files) >= s.failAfter {
+        return "", fmt.Errorf("upload file failed: 503 Service Unavailable")
+    }
+    body, _ := io.ReadAll(file)
+    s.files[key] = body
+    return "s3://" + key, nil
+}
+
+func (s *testStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    body, ok := s.files[key]
+    if !ok {
+        return nil, fmt.Errorf("file not found")
+    }
+    return io.NopCloser(bytes.NewReader(body)), nil
+}
+
+func (s *testStorage) Delete(ctx context.Context, key string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    delete(s.files, key)
+    return nil
+}
+
+func fileHeaders(t *testing.T, n int) []*multipart.FileHeader {
+    body := new(bytes.Buffer)
+    writer := multipart.NewWriter(body)
+    for i := 0; i < n; i++ {
+        part, err := writer.CreateFormFile("files", fmt.Sprintf("%d.png", i))
+        if err != nil {
+            t.Fatal(err)
+        }
+        part.Write([]byte(pngData))
+    }
+    writer.Close()
+
+    form, err := multipart.NewReader(body, writer.Boundary()).ReadForm(1 << 20)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { form.RemoveAll() })
+    return form.File["files"]
+}
+
+func TestUploadImage(t *testing.T) {
+    tests := []struct {
+        name string
+        repositoryFailAfter int
+        storageFailAfter int
+        wantErr bool
+    }{
+        {"all files are stored", 3, 3, false},
+        {"insert of third row fail", 2, 3, true},
+        {"insert of first row fail", 0, 3, true},
+        {"upload of second file fail", 3, 1, true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            repository := &testRepository{failAfter: tt.repositoryFailAfter, rows: make(map[string]*images.Image)}
+            storage := &testStorage{failAfter: tt.storageFailAfter, files: make(map[string][]byte)}
+            usecase := ImagesUsecase(testConfig{}, repository, testTasksUsecase{}, storage)
+
+            result, err := usecase.UploadImage(context.Background(), &images.ImageUploadReq{
+                TaskId: "T0000001",
+                Files: fileHeaders(t, 3),
+            }, "U000001", false)
+            if tt.wantErr {
+                if err == nil {
+                    t.Fatalf("error is expected")
+                }
+                if len(repository.rows) != 0 || len(storage.files) != 0 {
+                    t.Errorf("upload is not rolled back: %d rows, %d files", len(repository.rows), len(storage.files))
+                }
+                return
+            }
+
+            if err != nil {
+                t.Fatalf("upload: %v", err)
+            }
+            if len(result) != 3 || len(repository.rows) != 3 || len(storage.files) != 3 {
+                t.Fatalf("got %d images, %d rows, %d files", len(result), len(repository.rows), len(storage.files))
+            }
+            for _, image := range result {
+                if image.Url != "/v1/tasks/T0000001/images/"+image.Id+"/file" {
+                    t.Errorf("url = %q, storage url must not be given to client", image.Url)
+                }
+                if !strings.HasPrefix(image.Filename, "tasks/T0000001/") || !strings.HasSuffix(image.Filename, ".png") {
+                    t.Errorf("filename = %q", image.Filename)
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,40 @@
+package imports
+
+import "time"
+
+type ImportReq struct {
+    Source string `query:"source"` // toggl | clockify
+    CategoryId int `query:"category_id"` // category of new projects
+    Timezone string `query:"tz"` // timezone of date and time in file, default is UTC
+    DateFormat string `query:"date_format"` // date format of clockify workspace e.g. DD/MM/YYYY
+    DryRun bool `query:"dry_run"`
+    UserId string `query:"user_id"` // owner of imported entries, admin only
+}
+
+// ImportRow is one time entry parsed from file
+type ImportRow struct {
+    Row int
+    ProjectName string
+    TaskTitle string
+    StartedAt time.Time
+    StoppedAt time.Time
+    Duration int // in seconds
+}
+
+type ImportRowError struct {
+    Row int `json:"row"`
+    Msg string `json:"msg"`
+}
+
+type ImportReport struct {
+    DryRun bool `json:"dry_run"`
+    Source string `json:"source"`
+    TotalRows int `json:"total_rows"`
+    ImportedRows int `json:"imported_rows"`
+    SkippedRows int `json:"skipped_rows"`
+    Duration int `json:"duration"` // in seconds
+    NewProjects []string `json:"new_projects"`
+    NewTasks int `json:"new_tasks"`
+    Conflicts []*ImportRowError `json:"conflicts"`
+    Errors []*ImportRowError `json:"errors"`
+}
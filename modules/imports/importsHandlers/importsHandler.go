@@ -0,0 +1,100 @@
+package importsHandlers
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/modules/entities"
+	"github.com/ppp3ppj/wymj/modules/imports"
+	"github.com/ppp3ppj/wymj/modules/imports/importsUsecases"
+	"github.com/ppp3ppj/wymj/modules/roles"
+)
+
+type importsHandlerErrCode string
+
+const (
+    importTimeEntryErr importsHandlerErrCode = "imports-001"
+)
+
+type IImportsHandler interface {
+    ImportTimeEntry(c *fiber.Ctx) error
+}
+
+type importsHandler struct {
+    cfg config.IConfig
+    importsUsecase importsUsecases.IImportsUsecase
+}
+
+func ImportsHandler(cfg config.IConfig, importsUsecase importsUsecases.IImportsUsecase) IImportsHandler {
+    return &importsHandler{
+        cfg: cfg,
+        importsUsecase: importsUsecase,
+    }
+}
+
+func (h *importsHandler) ImportTimeEntry(c *fiber.Ctx) error {
+    req := new(imports.ImportReq)
+    if err := c.QueryParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(importTimeEntryErr),
+            err.Error(),
+        ).Res()
+    }
+
+    // Customer can import only for themselves
+    userId, _ := c.Locals("userId").(string)
+    if !roles.HasPermission(c, roles.TimersAdmin) && req.UserId != "" && req.UserId != userId {
+        return entities.NewResponse(c).Error(
+            fiber.ErrUnauthorized.Code,
+            string(importTimeEntryErr),
+            "no permission to access",
+        ).Res()
+    }
+    if req.UserId == "" {
+        req.UserId = userId
+    }
+
+    fileHeader, err := c.FormFile("file")
+    if err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(importTimeEntryErr),
+            "file is required",
+        ).Res()
+    }
+    file, err := fileHeader.Open()
+    if err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(importTimeEntryErr),
+            err.Error(),
+        ).Res()
+    }
+    defer file.Close()
+
+    report, err := h.importsUsecase.ImportTimeEntry(c.UserContext(), req, file, roles.HasPermission(c, roles.TimersAdmin))
+    if err != nil {
+        // report is returned with row errors, so client can fix the file
+        if report != nil {
+            return entities.NewResponse(c).Success(fiber.StatusUnprocessableEntity, report).Res()
+        }
+        if strings.HasPrefix(err.Error(), "row ") {
+            return entities.NewResponse(c).Error(
+                fiber.ErrInternalServerError.Code,
+                string(importTimeEntryErr),
+                err.Error(),
+            ).Res()
+        }
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(importTimeEntryErr),
+            err.Error(),
+        ).Res()
+    }
+    if req.DryRun {
+        return entities.NewResponse(c).Success(fiber.StatusOK, report).Res()
+    }
+    return entities.NewResponse(c).Success(fiber.StatusCreated, report).Res()
+}
@@ -0,0 +1,242 @@
+package importsPatterns
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ppp3ppj/wymj/modules/imports"
+)
+
+// use Factory pattern to parse csv export from other time trackers
+type ITimeEntryParser interface {
+    Parse(file io.Reader) ([]*imports.ImportRow, []*imports.ImportRowError, error)
+}
+
+type parser struct {
+    loc *time.Location
+    // column name (lower case) of each field
+    project string
+    task string
+    description string
+    startDate string
+    startTime string
+    endDate string
+    endTime string
+    duration string
+    dateLayouts []string
+    timeLayouts []string
+}
+
+type toggl struct {
+    *parser
+}
+
+type clockify struct {
+    *parser
+}
+
+// date format name as shown in clockify settings -> go layout
+var dateFormats = map[string]string{
+    "MM/DD/YYYY": "01/02/2006",
+    "DD/MM/YYYY": "02/01/2006",
+    "MM-DD-YYYY": "01-02-2006",
+    "DD-MM-YYYY": "02-01-2006",
+    "YYYY-MM-DD": "2006-01-02",
+    "DD.MM.YYYY": "02.01.2006",
+}
+
+// TimeEntryParser dateFormat is optional, without it a date that match more than one
+// layout is rejected instead of guessing
+func TimeEntryParser(source string, loc *time.Location, dateFormat string) (ITimeEntryParser, error) {
+    var layout string
+    if dateFormat != "" {
+        var ok bool
+        if layout, ok = dateFormats[strings.ToUpper(dateFormat)]; !ok {
+            return nil, fmt.Errorf("date_format is invalid, expect MM/DD/YYYY, DD/MM/YYYY, MM-DD-YYYY, DD-MM-YYYY, YYYY-MM-DD or DD.MM.YYYY")
+        }
+    }
+
+    switch source {
+        case "toggl":
+            return newToggl(loc, layout), nil
+        case "clockify":
+            return newClockify(loc, layout), nil
+        default:
+            return nil, fmt.Errorf("source is invalid, expect toggl or clockify")
+    }
+}
+
+// dateLayouts is layout from date_format or defaults of the source
+func dateLayouts(layout string, defaults ...string) []string {
+    if layout != "" {
+        return []string{layout}
+    }
+    return defaults
+}
+
+// Toggl Track detailed report: Start date 2024-01-31, Start time 13:04:05, Duration 01:30:00
+func newToggl(loc *time.Location, dateLayout string) ITimeEntryParser {
+    return &toggl{
+        parser: &parser{
+            loc: loc,
+            project: "project",
+            task: "task",
+            description: "description",
+            startDate: "start date",
+            startTime: "start time",
+            endDate: "end date",
+            endTime: "end time",
+            duration: "duration",
+            dateLayouts: dateLayouts(dateLayout, "2006-01-02"),
+            timeLayouts: []string{"15:04:05", "15:04"},
+        },
+    }
+}
+
+// Clockify detailed report: date and time format follow workspace setting
+func newClockify(loc *time.Location, dateLayout string) ITimeEntryParser {
+    return &clockify{
+        parser: &parser{
+            loc: loc,
+            project: "project",
+            task: "task",
+            description: "description",
+            startDate: "start date",
+            startTime: "start time",
+            endDate: "end date",
+            endTime: "end time",
+            duration: "duration (h)",
+            dateLayouts: dateLayouts(dateLayout, "01/02/2006", "02/01/2006", "01-02-2006", "02-01-2006", "2006-01-02", "02.01.2006"),
+            timeLayouts: []string{"03:04:05 PM", "03:04 PM", "15:04:05", "15:04"},
+        },
+    }
+}
+
+// parseDateTime fail when date can be read by more than one layout as different days,
+// e.g. 03/04/2024 is March 4 or April 3
+func (p *parser) parseDateTime(date, clock string) (time.Time, error) {
+    var result time.Time
+    found := false
+    for _, dateLayout := range p.dateLayouts {
+        for _, timeLayout := range p.timeLayouts {
+            t, err := time.ParseInLocation(dateLayout+" "+timeLayout, date+" "+clock, p.loc)
+            if err != nil {
+                continue
+            }
+            if found && !t.Equal(result) {
+                return time.Time{}, fmt.Errorf("date %q is ambiguous, set date_format", date)
+            }
+            result, found = t, true
+            break
+        }
+    }
+    if !found {
+        return time.Time{}, fmt.Errorf("date time %q is invalid", date+" "+clock)
+    }
+    return result, nil
+}
+
+// parseDuration read HH:MM:SS
+func parseDuration(s string) (int, error) {
+    parts := strings.Split(s, ":")
+    if len(parts) != 3 {
+        return 0, fmt.Errorf("duration %q is invalid", s)
+    }
+    total := 0
+    for _, part := range parts {
+        n, err := strconv.Atoi(part)
+        if err != nil || n < 0 {
+            return 0, fmt.Errorf("duration %q is invalid", s)
+        }
+        total = total*60 + n
+    }
+    return total, nil
+}
+
+func (p *parser) Parse(file io.Reader) ([]*imports.ImportRow, []*imports.ImportRowError, error) {
+    r := csv.NewReader(file)
+    r.FieldsPerRecord = -1
+
+    header, err := r.Read()
+    if err != nil {
+        return nil, nil, fmt.Errorf("read csv header failed: %v", err)
+    }
+    columns := make(map[string]int)
+    for i, name := range header {
+        // excel may add byte order mark to first column
+        name = strings.TrimPrefix(name, "\ufeff")
+        columns[strings.ToLower(strings.Trim(name, " "))] = i
+    }
+    for _, required := range []string{p.project, p.startDate, p.startTime} {
+        if _, ok := columns[required]; !ok {
+            return nil, nil, fmt.Errorf("csv column %q is required", required)
+        }
+    }
+
+    rows := make([]*imports.ImportRow, 0)
+    rowErrors := make([]*imports.ImportRowError, 0)
+    // row 1 is header
+    for line := 2; ; line++ {
+        record, err := r.Read()
+        if errors.Is(err, io.EOF) {
+            break
+        }
+        if err != nil {
+            rowErrors = append(rowErrors, &imports.ImportRowError{Row: line, Msg: err.Error()})
+            continue
+        }
+        get := func(name string) string {
+            i, ok := columns[name]
+            if !ok || i >= len(record) {
+                return ""
+            }
+            return strings.Trim(record[i], " ")
+        }
+
+        row := &imports.ImportRow{
+            Row: line,
+            ProjectName: get(p.project),
+            TaskTitle: get(p.task),
+        }
+        if row.TaskTitle == "" {
+            row.TaskTitle = get(p.description)
+        }
+        if row.TaskTitle == "" {
+            row.TaskTitle = "Untitled"
+        }
+
+        row.StartedAt, err = p.parseDateTime(get(p.startDate), get(p.startTime))
+        if err != nil {
+            rowErrors = append(rowErrors, &imports.ImportRowError{Row: line, Msg: err.Error()})
+            continue
+        }
+
+        // end time is preferred, duration column is used when end time is empty
+        if get(p.endDate) != "" && get(p.endTime) != "" {
+            row.StoppedAt, err = p.parseDateTime(get(p.endDate), get(p.endTime))
+            if err != nil {
+                rowErrors = append(rowErrors, &imports.ImportRowError{Row: line, Msg: err.Error()})
+                continue
+            }
+            row.Duration = int(row.StoppedAt.Sub(row.StartedAt).Seconds())
+        } else {
+            row.Duration, err = parseDuration(get(p.duration))
+            if err != nil {
+                rowErrors = append(rowErrors, &imports.ImportRowError{Row: line, Msg: err.Error()})
+                continue
+            }
+            row.StoppedAt = row.StartedAt.Add(time.Duration(row.Duration) * time.Second)
+        }
+        if row.Duration <= 0 {
+            rowErrors = append(rowErrors, &imports.ImportRowError{Row: line, Msg: "end time must be after start time"})
+            continue
+        }
+        rows = append(rows, row)
+    }
+    return rows, rowErrors, nil
+}
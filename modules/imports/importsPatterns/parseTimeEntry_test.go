@@ -0,0 +1,56 @@
+package importsPatterns
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClockifyDate(t *testing.T) {
+    header := "Project,Description,Start Date,Start Time,End Date,End Time,Duration (h)\n"
+    tests := []struct {
+        name string
+        dateFormat string
+        date string
+        want string
+        wantErr string
+    }{
+        {"ambiguous date is rejected", "", "03/04/2024", "", `date "03/04/2024" is ambiguous, set date_format`},
+        {"day over 12 is not ambiguous", "", "13/04/2024", "2024-04-13", ""},
+        {"iso date", "", "2024-04-03", "2024-04-03", ""},
+        {"us format", "MM/DD/YYYY", "03/04/2024", "2024-03-04", ""},
+        {"european format", "dd/mm/yyyy", "03/04/2024", "2024-04-03", ""},
+        {"date does not match format", "MM/DD/YYYY", "13/04/2024", "", `date time "13/04/2024 09:00" is invalid`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            p, err := TimeEntryParser("clockify", time.UTC, tt.dateFormat)
+            if err != nil {
+                t.Fatal(err)
+            }
+            line := "Wymj,Write test," + tt.date + ",09:00," + tt.date + ",10:00,01:00:00\n"
+            rows, rowErrors, err := p.Parse(strings.NewReader(header + line))
+            if err != nil {
+                t.Fatal(err)
+            }
+            if tt.wantErr != "" {
+                if len(rowErrors) != 1 || rowErrors[0].Msg != tt.wantErr {
+                    t.Fatalf("row errors = %+v, want %q", rowErrors, tt.wantErr)
+                }
+                return
+            }
+            if len(rows) != 1 {
+                t.Fatalf("rows = %d, row errors = %+v", len(rows), rowErrors)
+            }
+            if got := rows[0].StartedAt.Format("2006-01-02"); got != tt.want {
+                t.Errorf("started at = %s, want %s", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestInvalidDateFormat(t *testing.T) {
+    if _, err := TimeEntryParser("clockify", time.UTC, "YYYY/DD/MM"); err == nil {
+        t.Fatal("error is expected")
+    }
+}
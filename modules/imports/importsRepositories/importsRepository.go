@@ -0,0 +1,193 @@
+package importsRepositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/ppp3ppj/wymj/modules/imports"
+)
+
+type IImportsRepository interface {
+    FindProjectIdByName(ctx context.Context, name string) (int, error)
+    IsTaskExist(ctx context.Context, userId, title string, projectId int) bool
+    IsOverlapTimeEntry(ctx context.Context, userId string, startedAt, stoppedAt time.Time) (bool, error)
+    ImportTimeEntry(ctx context.Context, userId string, categoryId int, rows []*imports.ImportRow) (int, error)
+}
+
+type importsRepository struct {
+    db *sqlx.DB
+}
+
+func ImportsRepository(db *sqlx.DB) IImportsRepository {
+    return &importsRepository{
+        db: db,
+    }
+}
+
+// FindProjectIdByName return 0 without error when project does not exist
+func (r *importsRepository) FindProjectIdByName(ctx context.Context, name string) (int, error) {
+    query := `
+    SELECT
+        "id"
+    FROM "projects"
+    WHERE LOWER("name") = LOWER($1)
+    ORDER BY "id"
+    LIMIT 1;`
+
+    var id int
+    if err := r.db.GetContext(ctx, &id, query, name); err != nil {
+        if errors.Is(err, sql.ErrNoRows) {
+            return 0, nil
+        }
+        return 0, fmt.Errorf("get project failed: %v", err)
+    }
+    return id, nil
+}
+
+// projectId 0 is mean task without project
+func (r *importsRepository) IsTaskExist(ctx context.Context, userId, title string, projectId int) bool {
+    query := `
+    SELECT
+        (CASE WHEN COUNT(*) > 0 THEN TRUE ELSE FALSE END)
+    FROM "tasks"
+    WHERE "user_id" = $1
+    AND "title" = $2
+    AND COALESCE("project_id", 0) = $3;`
+
+    var check bool
+    if err := r.db.GetContext(ctx, &check, query, userId, title, projectId); err != nil {
+        return false
+    }
+    return check
+}
+
+// IsOverlapTimeEntry return error instead of false, otherwise failed query would let overlapping rows in
+func (r *importsRepository) IsOverlapTimeEntry(ctx context.Context, userId string, startedAt, stoppedAt time.Time) (bool, error) {
+    query := `
+    SELECT
+        (CASE WHEN COUNT(*) > 0 THEN TRUE ELSE FALSE END)
+    FROM "time_entries"
+    WHERE "user_id" = $1
+    AND "started_at" < $3
+    AND COALESCE("stopped_at", NOW()) > $2;`
+
+    var check bool
+    if err := r.db.GetContext(ctx, &check, query, userId, startedAt, stoppedAt); err != nil {
+        return false, fmt.Errorf("get overlap time entry failed: %v", err)
+    }
+    return check, nil
+}
+
+// ImportTimeEntry write all rows in one transaction and return number of new tasks,
+// missing projects are created under categoryId and the user is added as member
+func (r *importsRepository) ImportTimeEntry(ctx context.Context, userId string, categoryId int, rows []*imports.ImportRow) (int, error) {
+    ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return 0, err
+    }
+
+    projectIds := make(map[string]*int)
+    taskIds := make(map[string]string)
+    newTasks := 0
+    for _, row := range rows {
+        // Find or create project
+        projectId, ok := projectIds[row.ProjectName]
+        if !ok && row.ProjectName != "" {
+            id := 0
+            if err := tx.GetContext(ctx, &id, `
+            SELECT "id" FROM "projects" WHERE LOWER("name") = LOWER($1) ORDER BY "id" LIMIT 1;`,
+                row.ProjectName,
+            ); err != nil && !errors.Is(err, sql.ErrNoRows) {
+                tx.Rollback()
+                return 0, fmt.Errorf("row %d: get project failed: %v", row.Row, err)
+            }
+            if id == 0 {
+                if err := tx.QueryRowContext(ctx, `
+                INSERT INTO "projects" ("name", "category_id") VALUES ($1, $2) RETURNING "id";`,
+                    row.ProjectName,
+                    categoryId,
+                ).Scan(&id); err != nil {
+                    tx.Rollback()
+                    return 0, fmt.Errorf("row %d: insert project failed: %v", row.Row, err)
+                }
+            }
+            if _, err := tx.ExecContext(ctx, `
+            INSERT INTO "user_projects" ("user_id", "project_id") VALUES ($1, $2)
+            ON CONFLICT ("user_id", "project_id") DO NOTHING;`,
+                userId,
+                id,
+            ); err != nil {
+                tx.Rollback()
+                return 0, fmt.Errorf("row %d: insert project member failed: %v", row.Row, err)
+            }
+            projectId = &id
+            projectIds[row.ProjectName] = projectId
+        }
+
+        // Find or create task by title in the project
+        taskKey := row.ProjectName + "/" + row.TaskTitle
+        taskId, ok := taskIds[taskKey]
+        if !ok {
+            if err := tx.GetContext(ctx, &taskId, `
+            SELECT "id" FROM "tasks"
+            WHERE "user_id" = $1
+            AND "title" = $2
+            AND "project_id" IS NOT DISTINCT FROM $3
+            ORDER BY "id" LIMIT 1;`,
+                userId,
+                row.TaskTitle,
+                projectId,
+            ); err != nil && !errors.Is(err, sql.ErrNoRows) {
+                tx.Rollback()
+                return 0, fmt.Errorf("row %d: get task failed: %v", row.Row, err)
+            }
+            if taskId == "" {
+                if err := tx.QueryRowContext(ctx, `
+                INSERT INTO "tasks" ("user_id", "title", "project_id") VALUES ($1, $2, $3) RETURNING "id";`,
+                    userId,
+                    row.TaskTitle,
+                    projectId,
+                ).Scan(&taskId); err != nil {
+                    tx.Rollback()
+                    return 0, fmt.Errorf("row %d: insert task failed: %v", row.Row, err)
+                }
+                newTasks++
+            }
+            taskIds[taskKey] = taskId
+        }
+
+        // Insert time entry and roll up duration
+        if _, err := tx.ExecContext(ctx, `
+        INSERT INTO "time_entries" ("user_id", "task_id", "started_at", "stopped_at", "duration")
+        VALUES ($1, $2, $3, $4, $5);`,
+            userId,
+            taskId,
+            row.StartedAt,
+            row.StoppedAt,
+            row.Duration,
+        ); err != nil {
+            tx.Rollback()
+            return 0, fmt.Errorf("row %d: insert time entry failed: %v", row.Row, err)
+        }
+        if _, err := tx.ExecContext(ctx, `
+        UPDATE "tasks" SET "duration" = "duration" + $1 WHERE "id" = $2;`,
+            row.Duration,
+            taskId,
+        ); err != nil {
+            tx.Rollback()
+            return 0, fmt.Errorf("row %d: update task duration failed: %v", row.Row, err)
+        }
+    }
+
+    if err := tx.Commit(); err != nil {
+        return 0, err
+    }
+    return newTasks, nil
+}
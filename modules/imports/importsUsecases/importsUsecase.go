@@ -0,0 +1,145 @@
+package importsUsecases
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/modules/imports"
+	"github.com/ppp3ppj/wymj/modules/imports/importsPatterns"
+	"github.com/ppp3ppj/wymj/modules/imports/importsRepositories"
+	"github.com/ppp3ppj/wymj/modules/projects/projectsRepositories"
+	"github.com/ppp3ppj/wymj/pkg/wymjtrace"
+)
+
+type IImportsUsecase interface {
+    ImportTimeEntry(ctx context.Context, req *imports.ImportReq, file io.Reader, isAdmin bool) (*imports.ImportReport, error)
+}
+
+type importsUsecase struct {
+    cfg config.IConfig
+    importsRepository importsRepositories.IImportsRepository
+    projectsRepository projectsRepositories.IProjectsRepository
+}
+
+func ImportsUsecase(cfg config.IConfig, importsRepository importsRepositories.IImportsRepository, projectsRepository projectsRepositories.IProjectsRepository) IImportsUsecase {
+    return &importsUsecase{
+        cfg: cfg,
+        importsRepository: importsRepository,
+        projectsRepository: projectsRepository,
+    }
+}
+
+// ImportTimeEntry check every row first, nothing is written when dry run or any row has error
+func (u *importsUsecase) ImportTimeEntry(ctx context.Context, req *imports.ImportReq, file io.Reader, isAdmin bool) (*imports.ImportReport, error) {
+    ctx, span := wymjtrace.Start(ctx, "importsUsecase.ImportTimeEntry")
+    defer span.End()
+
+    if req.Timezone == "" {
+        req.Timezone = "UTC"
+    }
+    loc, err := time.LoadLocation(req.Timezone)
+    if err != nil {
+        return nil, fmt.Errorf("tz is invalid")
+    }
+
+    parser, err := importsPatterns.TimeEntryParser(strings.ToLower(req.Source), loc, req.DateFormat)
+    if err != nil {
+        return nil, err
+    }
+    rows, rowErrors, err := parser.Parse(file)
+    if err != nil {
+        return nil, err
+    }
+
+    report := &imports.ImportReport{
+        DryRun: req.DryRun,
+        Source: strings.ToLower(req.Source),
+        TotalRows: len(rows) + len(rowErrors),
+        NewProjects: make([]string, 0),
+        Conflicts: make([]*imports.ImportRowError, 0),
+        Errors: rowErrors,
+    }
+
+    // Project check, key is lower case name same as repository lookup
+    projectIds := make(map[string]int)
+    for _, row := range rows {
+        key := strings.ToLower(row.ProjectName)
+        if _, ok := projectIds[key]; ok || row.ProjectName == "" {
+            continue
+        }
+        id, err := u.importsRepository.FindProjectIdByName(ctx, row.ProjectName)
+        if err != nil {
+            return nil, err
+        }
+        projectIds[key] = id
+        if id == 0 {
+            report.NewProjects = append(report.NewProjects, row.ProjectName)
+        }
+    }
+    if len(report.NewProjects) > 0 && req.CategoryId < 1 {
+        return nil, fmt.Errorf("category_id is required to create new projects")
+    }
+
+    // Row check
+    validRows := make([]*imports.ImportRow, 0)
+    newTasks := make(map[string]bool)
+    for _, row := range rows {
+        projectId := projectIds[strings.ToLower(row.ProjectName)]
+        if projectId != 0 && !isAdmin && !u.projectsRepository.IsMember(ctx, projectId, req.UserId) {
+            report.Errors = append(report.Errors, &imports.ImportRowError{
+                Row: row.Row,
+                Msg: fmt.Sprintf("you are not a member of project %q", row.ProjectName),
+            })
+            continue
+        }
+
+        // overlap with entry in database or previous row of this file that will be imported
+        conflict, err := u.importsRepository.IsOverlapTimeEntry(ctx, req.UserId, row.StartedAt, row.StoppedAt)
+        if err != nil {
+            return nil, err
+        }
+        for _, prev := range validRows {
+            if prev.StartedAt.Before(row.StoppedAt) && row.StartedAt.Before(prev.StoppedAt) {
+                conflict = true
+                break
+            }
+        }
+        if conflict {
+            report.Conflicts = append(report.Conflicts, &imports.ImportRowError{
+                Row: row.Row,
+                Msg: "time entry overlaps with an existing entry",
+            })
+            continue
+        }
+
+        taskKey := strings.ToLower(row.ProjectName) + "/" + row.TaskTitle
+        if !newTasks[taskKey] && (projectId == 0 && row.ProjectName != "" || !u.importsRepository.IsTaskExist(ctx, req.UserId, row.TaskTitle, projectId)) {
+            newTasks[taskKey] = true
+        }
+        validRows = append(validRows, row)
+        report.Duration += row.Duration
+    }
+    report.NewTasks = len(newTasks)
+    report.SkippedRows = report.TotalRows - len(validRows)
+
+    if req.DryRun {
+        return report, nil
+    }
+    if len(report.Errors) > 0 {
+        return report, fmt.Errorf("import has errors, nothing is imported")
+    }
+
+    if len(validRows) > 0 {
+        newTaskCount, err := u.importsRepository.ImportTimeEntry(ctx, req.UserId, req.CategoryId, validRows)
+        if err != nil {
+            return nil, err
+        }
+        report.NewTasks = newTaskCount
+    }
+    report.ImportedRows = len(validRows)
+    return report, nil
+}
@@ -0,0 +1,87 @@
+package importsUsecases
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ppp3ppj/wymj/modules/imports"
+	"github.com/ppp3ppj/wymj/modules/imports/importsRepositories"
+	"github.com/ppp3ppj/wymj/modules/projects/projectsRepositories"
+)
+
+// testRepository has project Wymj (1) and Secret (2), user has entry at 2024-04-03 12:00 - 13:00
+type testRepository struct {
+    importsRepositories.IImportsRepository
+    overlapErr error
+}
+
+func (r *testRepository) FindProjectIdByName(ctx context.Context, name string) (int, error) {
+    return map[string]int{"wymj": 1, "secret": 2}[strings.ToLower(name)], nil
+}
+
+func (r *testRepository) IsTaskExist(ctx context.Context, userId, title string, projectId int) bool {
+    return true
+}
+
+func (r *testRepository) IsOverlapTimeEntry(ctx context.Context, userId string, startedAt, stoppedAt time.Time) (bool, error) {
+    if r.overlapErr != nil {
+        return false, r.overlapErr
+    }
+    noon := time.Date(2024, 4, 3, 12, 0, 0, 0, time.UTC)
+    return startedAt.Before(noon.Add(time.Hour)) && stoppedAt.After(noon), nil
+}
+
+// testProjectsRepository has user as member of project 1 only
+type testProjectsRepository struct {
+    projectsRepositories.IProjectsRepository
+}
+
+func (r *testProjectsRepository) IsMember(ctx context.Context, projectId int, userId string) bool {
+    return projectId == 1
+}
+
+func rowNumbers(rowErrors []*imports.ImportRowError) []int {
+    result := make([]int, 0)
+    for _, rowError := range rowErrors {
+        result = append(result, rowError.Row)
+    }
+    return result
+}
+
+func TestImportTimeEntryOverlap(t *testing.T) {
+    file := "Project,Task,Start date,Start time,End date,End time,Duration\n" +
+        "Secret,Plan,2024-04-03,09:00:00,2024-04-03,10:00:00,01:00:00\n" +
+        "Wymj,Write test,2024-04-03,09:30:00,2024-04-03,10:30:00,01:00:00\n" +
+        "Wymj,Review,2024-04-03,10:00:00,2024-04-03,11:00:00,01:00:00\n" +
+        "Wymj,Deploy,2024-04-03,12:30:00,2024-04-03,13:30:00,01:00:00\n"
+
+    usecase := ImportsUsecase(nil, &testRepository{}, &testProjectsRepository{})
+    report, err := usecase.ImportTimeEntry(context.Background(), &imports.ImportReq{Source: "toggl", DryRun: true, UserId: "U000001"}, strings.NewReader(file), false)
+    if err != nil {
+        t.Fatalf("import: %v", err)
+    }
+    // row 3 does not conflict with row 2 because row 2 is rejected
+    if got := fmt.Sprint(rowNumbers(report.Errors)); got != "[2]" {
+        t.Errorf("errors = %s, want [2]", got)
+    }
+    if got := fmt.Sprint(rowNumbers(report.Conflicts)); got != "[4 5]" {
+        t.Errorf("conflicts = %s, want [4 5]", got)
+    }
+    if report.SkippedRows != 3 || report.Duration != 3600 {
+        t.Errorf("report = %+v", report)
+    }
+}
+
+func TestImportTimeEntryOverlapError(t *testing.T) {
+    file := "Project,Task,Start date,Start time,End date,End time,Duration\n" +
+        "Wymj,Write test,2024-04-03,09:30:00,2024-04-03,10:30:00,01:00:00\n"
+
+    usecase := ImportsUsecase(nil, &testRepository{overlapErr: fmt.Errorf("get overlap time entry failed: timeout")}, &testProjectsRepository{})
+    report, err := usecase.ImportTimeEntry(context.Background(), &imports.ImportReq{Source: "toggl", UserId: "U000001"}, strings.NewReader(file), false)
+    if err == nil || err.Error() != "get overlap time entry failed: timeout" {
+        t.Fatalf("error = %v, report = %+v", err, report)
+    }
+}
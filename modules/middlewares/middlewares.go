@@ -1,6 +1,15 @@
 package middlewares
 
-type Role struct {
-    Id int `db:"id"`
-    Title string `db:"title"`
+type RolePermission struct {
+    RoleId int `db:"role_id"`
+    Permission string `db:"permission"`
+}
+
+// ClientToken is oauth2 access token row that is not revoked
+type ClientToken struct {
+    Id string `db:"id"`
+    ClientId string `db:"client_id"`
+    UserId string `db:"user_id"`
+    RoleId int `db:"role_id"`
+    Scope string `db:"scope"`
 }
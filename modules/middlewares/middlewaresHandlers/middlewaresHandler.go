@@ -1,16 +1,27 @@
 package middlewaresHandlers
 
 import (
+	"log/slog"
+	"net"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/utils"
 	"github.com/ppp3ppj/wymj/config"
 	"github.com/ppp3ppj/wymj/modules/entities"
 	"github.com/ppp3ppj/wymj/modules/middlewares/middlewaresUsecases"
-	"github.com/ppp3ppj/wymj/pkg/utils"
+	"github.com/ppp3ppj/wymj/modules/roles"
+	"github.com/ppp3ppj/wymj/modules/users"
 	"github.com/ppp3ppj/wymj/pkg/wymjauth"
+	"github.com/ppp3ppj/wymj/pkg/wymjmetrics"
+	"github.com/ppp3ppj/wymj/pkg/wymjtrace"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type middlewaresHandlerErrCode string
@@ -19,18 +30,27 @@ const (
 	routerCheckErr middlewaresHandlerErrCode = "middleware-001"
 	jwtAuthErr     middlewaresHandlerErrCode = "middleware-002"
     paramsCheckErr middlewaresHandlerErrCode = "middleware-003"
-    authorizeErr   middlewaresHandlerErrCode = "middleware-004"
+    permissionErr  middlewaresHandlerErrCode = "middleware-004"
     apiKeyErr   middlewaresHandlerErrCode = "middleware-005"
+    metricsAllowErr middlewaresHandlerErrCode = "middleware-006"
 )
 
 type IMiddlewaresHandler interface {
 	Cors() fiber.Handler
 	RouterCheck() fiber.Handler
 	Logger() fiber.Handler
+	RequestId() fiber.Handler
+	Tracing() fiber.Handler
+	Metrics() fiber.Handler
+	MetricsAllow() fiber.Handler
 	JwtAuth() fiber.Handler
+	JwtAuthScope(allowScopes ...string) fiber.Handler
     ParamsCheck() fiber.Handler
-    Authorize(expectReleId ...int) fiber.Handler
-    ApiKeyAuth() fiber.Handler
+    RequirePermission(permissions ...string) fiber.Handler
+    ResetRoleCache()
+    ResetApiKeyCache(apiKeyId string)
+    ApiKeyAuth(scopes ...string) fiber.Handler
+    JwtAuthClient(scopes ...string) fiber.Handler
 }
 
 type middlewaresHandler struct {
@@ -52,7 +72,7 @@ func (h *middlewaresHandler) Cors() fiber.Handler {
 		AllowMethods:     "GET,POST,HEAD,PUT,DELETE,PATCH",
 		AllowHeaders:     "",
 		AllowCredentials: false,
-		ExposeHeaders:    "",
+		ExposeHeaders:    wymjtrace.RequestIdHeader + "," + wymjtrace.TraceparentHeader,
 		MaxAge:           0,
 	})
 }
@@ -67,18 +87,158 @@ func (h *middlewaresHandler) RouterCheck() fiber.Handler {
 	}
 }
 
+// fiberCarrier let otel propagator read and write fiber headers
+type fiberCarrier struct {
+    c *fiber.Ctx
+}
+
+func (f fiberCarrier) Get(key string) string { return f.c.Get(key) }
+func (f fiberCarrier) Set(key, value string) { f.c.Set(key, value) }
+func (f fiberCarrier) Keys() []string {
+    keys := make([]string, 0)
+    f.c.Request().Header.VisitAll(func(key, _ []byte) {
+        keys = append(keys, string(key))
+    })
+    return keys
+}
+
+// Tracing start server span of the request as child of traceparent from caller, span name is
+// renamed to the matched route after handler so path params do not make new names.
+// It must run before RequestId so request id and log use ids of this span
+func (h *middlewaresHandler) Tracing() fiber.Handler {
+    return func(c *fiber.Ctx) error {
+        ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), fiberCarrier{c: c})
+        ctx, span := wymjtrace.Tracer().Start(ctx, c.Method(),
+            trace.WithSpanKind(trace.SpanKindServer),
+            trace.WithAttributes(
+                attribute.String("http.request.method", c.Method()),
+                attribute.String("url.path", c.Path()),
+                attribute.String("client.address", c.IP()),
+                attribute.String("user_agent.original", c.Get(fiber.HeaderUserAgent)),
+            ),
+        )
+        defer span.End()
+        c.SetUserContext(ctx)
+
+        err := c.Next()
+        if err != nil {
+            // let fiber error handler set status before it is recorded
+            if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+                c.Status(fiber.StatusInternalServerError)
+            }
+            span.RecordError(err)
+        }
+
+        status := c.Response().StatusCode()
+        span.SetName(c.Method() + " " + c.Route().Path)
+        span.SetAttributes(
+            attribute.String("http.route", c.Route().Path),
+            attribute.Int("http.response.status_code", status),
+        )
+        if status >= fiber.StatusInternalServerError {
+            span.SetStatus(codes.Error, utils.StatusMessage(status))
+        }
+        return nil
+    }
+}
+
+// RequestId accept X-Request-Id and traceparent from caller or generate them, trace is put
+// in user context so logger and repositories get it, it must run before Logger
+func (h *middlewaresHandler) RequestId() fiber.Handler {
+    return func(c *fiber.Ctx) error {
+        trace := wymjtrace.NewTrace(c.UserContext(), c.Get(wymjtrace.RequestIdHeader), c.Get(wymjtrace.TraceparentHeader))
+        c.Locals("requestId", trace.RequestId)
+        c.Locals("traceId", trace.TraceId)
+        c.SetUserContext(wymjtrace.NewContext(c.UserContext(), trace))
+
+        c.Set(wymjtrace.RequestIdHeader, trace.RequestId)
+        c.Set(wymjtrace.TraceparentHeader, trace.Traceparent())
+        return c.Next()
+    }
+}
+
+// Metrics count request and latency by matched route, it must run before Logger so
+// error is already turned into status
+func (h *middlewaresHandler) Metrics() fiber.Handler {
+    return func(c *fiber.Ctx) error {
+        start := time.Now()
+        err := c.Next()
+        status := c.Response().StatusCode()
+        if err != nil {
+            status = fiber.StatusInternalServerError
+            if e, ok := err.(*fiber.Error); ok {
+                status = e.Code
+            }
+        }
+        wymjmetrics.ObserveHttp(c.Route().Path, c.Method(), status, time.Since(start))
+        return err
+    }
+}
+
+// MetricsAllow reject client whose ip is not in metrics allow list
+func (h *middlewaresHandler) MetricsAllow() fiber.Handler {
+    allowList := h.cfg.Metrics().AllowList()
+    return func(c *fiber.Ctx) error {
+        ip := net.ParseIP(c.IP())
+        for _, ipNet := range allowList {
+            if ip != nil && ipNet.Contains(ip) {
+                return c.Next()
+            }
+        }
+        return entities.NewResponse(c).Error(
+            fiber.ErrForbidden.Code,
+            string(metricsAllowErr),
+            "no permission to access",
+        ).Res()
+    }
+}
+
+// Logger write access log, level follow status code so error can be found by level
 func (h *middlewaresHandler) Logger() fiber.Handler {
-	return logger.New(logger.Config{
-		Format:     "${time} [${ip}] ${status} - ${method} ${path}\n",
-		TimeFormat: "01/02/2006",
-		TimeZone:   "Bangkok/Asia",
-	})
+    return func(c *fiber.Ctx) error {
+        start := time.Now()
+        if err := c.Next(); err != nil {
+            // let fiber error handler set status before it is logged
+            if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+                c.Status(fiber.StatusInternalServerError)
+            }
+        }
+
+        status := c.Response().StatusCode()
+        level := slog.LevelInfo
+        switch {
+            case status >= fiber.StatusInternalServerError:
+                level = slog.LevelError
+            case status >= fiber.StatusBadRequest:
+                level = slog.LevelWarn
+        }
+        slog.LogAttrs(c.UserContext(), level, "http request",
+            slog.String("ip", c.IP()),
+            slog.String("method", c.Method()),
+            slog.String("path", c.Path()),
+            slog.Int("status", status),
+            slog.Duration("latency", time.Since(start)),
+            slog.String("user_agent", c.Get(fiber.HeaderUserAgent)),
+        )
+        return nil
+    }
 }
 
+// JwtAuth accept only token with full scope
 func (h *middlewaresHandler) JwtAuth() fiber.Handler {
+	return h.jwtAuth()
+}
+
+// JwtAuthScope also accept limited token with one of allowScopes
+// e.g. user who has not verified email or has to enroll totp
+func (h *middlewaresHandler) JwtAuthScope(allowScopes ...string) fiber.Handler {
+	return h.jwtAuth(allowScopes...)
+}
+
+func (h *middlewaresHandler) jwtAuth(allowScopes ...string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		token := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
-		result, err := wymjauth.ParseToken(h.cfg.Jwt(), token)
+		result, err := wymjauth.ParseAccessToken(h.cfg.Jwt(), token)
 		if err != nil {
 			return entities.NewResponse(c).Error(
 				fiber.ErrUnauthorized.Code,
@@ -88,16 +248,39 @@ func (h *middlewaresHandler) JwtAuth() fiber.Handler {
 		}
 
 		claims := result.Claims
-		if !h.middlewaresUsecase.FindAccessToken(claims.Id, token) {
+		if !h.middlewaresUsecase.FindAccessToken(c.UserContext(), claims.Id, token) {
 			return entities.NewResponse(c).Error(
 				fiber.ErrUnauthorized.Code,
 				string(jwtAuthErr),
 				"no permission to access",
 			).Res()
 		}
+		if claims.Scope != "" && !slices.Contains(allowScopes, claims.Scope) {
+			msg := "no permission to access"
+			switch claims.Scope {
+			case users.UnverifiedScope:
+				msg = "email is not verified"
+			case users.TotpEnrollScope:
+				msg = "two-factor authentication is required, please enroll"
+			}
+			return entities.NewResponse(c).Error(
+				fiber.ErrForbidden.Code,
+				string(jwtAuthErr),
+				msg,
+			).Res()
+		}
+		permissions, err := h.middlewaresUsecase.FindPermission(c.UserContext(), claims.Id)
+		if err != nil {
+			return entities.NewResponse(c).Error(
+				fiber.ErrInternalServerError.Code,
+				string(jwtAuthErr),
+				err.Error(),
+			).Res()
+		}
 		// Set UserId
 		c.Locals("userId", claims.Id)
 		c.Locals("userRoleId", claims.RoleId)
+		c.Locals("userPermissions", permissions)
 		return c.Next()
 	}
 }
@@ -116,56 +299,132 @@ func (h *middlewaresHandler) ParamsCheck() fiber.Handler {
     }
 }
 
-func (h *middlewaresHandler) Authorize(expectReleId ...int) fiber.Handler {
+// RequirePermission must be after JwtAuth, user must have every permission
+func (h *middlewaresHandler) RequirePermission(permissions ...string) fiber.Handler {
     return func(c *fiber.Ctx) error {
-        userRoleId, ok := c.Locals("userRoleId").(int)
-        if !ok {
+        for _, permission := range permissions {
+            if !roles.HasPermission(c, permission) {
+                return entities.NewResponse(c).Error(
+                    fiber.ErrForbidden.Code,
+                    string(permissionErr),
+                    "no permission to access",
+                ).Res()
+            }
+        }
+        return c.Next()
+    }
+}
+
+// ResetRoleCache is called by roles module after role or permission is changed
+func (h *middlewaresHandler) ResetRoleCache() {
+    h.middlewaresUsecase.ResetRoleCache()
+}
+
+// ResetApiKeyCache is called by appinfo module after api key is revoked
+func (h *middlewaresHandler) ResetApiKeyCache(apiKeyId string) {
+    h.middlewaresUsecase.ResetApiKeyCache(apiKeyId)
+}
+
+// ApiKeyAuth accept key that is not revoked, not expired and has every scope
+func (h *middlewaresHandler) ApiKeyAuth(scopes ...string) fiber.Handler {
+    return func(c *fiber.Ctx) error {
+        key := c.Get("X-Api-Key")
+        if key == "" {
+            wymjmetrics.ApiKeyRejected("missing")
             return entities.NewResponse(c).Error(
                 fiber.ErrUnauthorized.Code,
-                string(authorizeErr),
-                "user_id is not int type",
+                string(apiKeyErr),
+                "apikey is invalid or required",
             ).Res()
         }
-        roles, err := h.middlewaresUsecase.FindRole()
+        apiKey, err := h.middlewaresUsecase.FindApiKey(c.UserContext(), key)
         if err != nil {
             return entities.NewResponse(c).Error(
                 fiber.ErrInternalServerError.Code,
-                string(authorizeErr),
+                string(apiKeyErr),
                 err.Error(),
             ).Res()
         }
-
-        sum := 0
-        for _, roleId := range expectReleId {
-            sum += roleId
+        if apiKey == nil || (apiKey.ExpiredAt != nil && apiKey.ExpiredAt.Before(time.Now())) {
+            wymjmetrics.ApiKeyRejected("invalid")
+            return entities.NewResponse(c).Error(
+                fiber.ErrUnauthorized.Code,
+                string(apiKeyErr),
+                "apikey is invalid or required",
+            ).Res()
         }
-
-        expectedVauleBinary := utils.BinaryConverter(sum, len(roles))
-        userVauleBinary := utils.BinaryConverter(userRoleId, len(roles))
-        // loop compare bitwise 
-        for i := range expectedVauleBinary {
-            if userVauleBinary[i]&expectedVauleBinary[i] == 1 {
-                return c.Next()
+        for _, scope := range scopes {
+            if !apiKey.HasScope(scope) {
+                wymjmetrics.ApiKeyRejected("scope")
+                return entities.NewResponse(c).Error(
+                    fiber.ErrForbidden.Code,
+                    string(apiKeyErr),
+                    "apikey has no permission to access",
+                ).Res()
             }
         }
-        return entities.NewResponse(c).Error(
-            fiber.ErrUnauthorized.Code,
-            string(authorizeErr),
-            "no permission to access",
-        ).Res()
+        c.Locals("apiKeyId", apiKey.Id)
+        return c.Next()
     }
 }
 
-func (h *middlewaresHandler) ApiKeyAuth() fiber.Handler {
+// JwtAuthClient also accept oauth2 access token of third party app that has every scope,
+// app can use only permissions of user that are also granted scopes. Other tokens are
+// checked as JwtAuth
+func (h *middlewaresHandler) JwtAuthClient(scopes ...string) fiber.Handler {
+    jwtAuth := h.jwtAuth()
     return func(c *fiber.Ctx) error {
-        key := c.Get("X-Api-Key")
-        if _, err := wymjauth.ParseApiKey(h.cfg.Jwt(), key); err != nil {
+        token := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+        result, err := wymjauth.ParseClientToken(h.cfg.Jwt(), token)
+        if err != nil {
+            return jwtAuth(c)
+        }
+
+        clientToken, err := h.middlewaresUsecase.FindClientToken(c.UserContext(), result.ID)
+        if err != nil {
+            return entities.NewResponse(c).Error(
+                fiber.ErrInternalServerError.Code,
+                string(jwtAuthErr),
+                err.Error(),
+            ).Res()
+        }
+        if clientToken == nil {
             return entities.NewResponse(c).Error(
                 fiber.ErrUnauthorized.Code,
-                string(apiKeyErr),
-                "apikey is invalid or required",
+                string(jwtAuthErr),
+                "no permission to access",
             ).Res()
         }
+        granted := strings.Fields(clientToken.Scope)
+        for _, scope := range scopes {
+            if !slices.Contains(granted, scope) {
+                c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+                return entities.NewResponse(c).Error(
+                    fiber.ErrForbidden.Code,
+                    string(jwtAuthErr),
+                    "insufficient scope",
+                ).Res()
+            }
+        }
+
+        userPermissions, err := h.middlewaresUsecase.FindPermission(c.UserContext(), clientToken.UserId)
+        if err != nil {
+            return entities.NewResponse(c).Error(
+                fiber.ErrInternalServerError.Code,
+                string(jwtAuthErr),
+                err.Error(),
+            ).Res()
+        }
+        permissions := make([]string, 0)
+        for _, p := range userPermissions {
+            if slices.Contains(granted, p) {
+                permissions = append(permissions, p)
+            }
+        }
+        c.Locals("userId", clientToken.UserId)
+        c.Locals("userRoleId", clientToken.RoleId)
+        c.Locals("userPermissions", permissions)
+        c.Locals("clientId", clientToken.ClientId)
         return c.Next()
     }
 }
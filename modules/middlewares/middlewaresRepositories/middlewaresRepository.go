@@ -1,15 +1,24 @@
 package middlewaresRepositories
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/ppp3ppj/wymj/modules/appinfo"
 	"github.com/ppp3ppj/wymj/modules/middlewares"
 )
 
 type IMiddlewaresRepository interface {
-    FindAccessToken(userId, accessToken string) bool
-    FindRole() ([]*middlewares.Role, error)
+    FindAccessToken(ctx context.Context, userId, accessToken string) bool
+    FindUserRoleId(ctx context.Context, userId string) ([]int, error)
+    FindRolePermission(ctx context.Context) ([]*middlewares.RolePermission, error)
+    FindApiKey(ctx context.Context, keyHash string) (*appinfo.ApiKey, error)
+    UpdateApiKeyLastUsed(ctx context.Context, apiKeyId string) error
+    FindClientToken(ctx context.Context, tokenId string) (*middlewares.ClientToken, error)
 }
 
 type middlewaresRepository struct {
@@ -22,34 +31,128 @@ func MiddlewaresRepository(db *sqlx.DB) IMiddlewaresRepository {
     }
 }
 
-func (r *middlewaresRepository) FindAccessToken(userId, accessToken string) bool {
+// FindAccessToken is false when session is revoked or user is disabled or deleted
+func (r *middlewaresRepository) FindAccessToken(ctx context.Context, userId, accessToken string) bool {
     query := `
     SELECT 
         (CASE WHEN COUNT(*) = 1 THEN TRUE ELSE FALSE END)
-    FROM "oauth"
-    WHERE "user_id" = $1
-    AND "access_token" = $2;
+    FROM "oauth" "o"
+    JOIN "users" "u" ON "u"."id" = "o"."user_id"
+    WHERE "o"."user_id" = $1
+    AND "o"."access_token" = $2
+    AND "o"."revoked_at" IS NULL
+    AND "u"."disabled_at" IS NULL
+    AND "u"."deleted_at" IS NULL;
     `
     var check bool 
-    if err := r.db.Get(&check, query, userId, accessToken); err != nil {
+    if err := r.db.GetContext(ctx, &check, query, userId, accessToken); err != nil {
         return false
     }
-    return true
+    return check
 }
 
-func (r *middlewaresRepository) FindRole() ([]*middlewares.Role, error) {
+func (r *middlewaresRepository) FindUserRoleId(ctx context.Context, userId string) ([]int, error) {
+    query := `
+    SELECT
+        "role_id"
+    FROM "user_roles"
+    WHERE "user_id" = $1;`
+
+    roleIds := make([]int, 0)
+    if err := r.db.SelectContext(ctx, &roleIds, query, userId); err != nil {
+        return nil, fmt.Errorf("get user roles failed: %v", err)
+    }
+    return roleIds, nil
+}
+
+func (r *middlewaresRepository) FindRolePermission(ctx context.Context) ([]*middlewares.RolePermission, error) {
+    query := `
+    SELECT
+        "rp"."role_id",
+        "p"."name" AS "permission"
+    FROM "role_permissions" "rp"
+    JOIN "permissions" "p" ON "p"."id" = "rp"."permission_id";`
+
+    rolePermissions := make([]*middlewares.RolePermission, 0)
+    if err := r.db.SelectContext(ctx, &rolePermissions, query); err != nil {
+        return nil, fmt.Errorf("get role permissions failed: %v", err)
+    }
+    return rolePermissions, nil
+}
 
+// FindApiKey return nil without error when key does not exist or is revoked
+func (r *middlewaresRepository) FindApiKey(ctx context.Context, keyHash string) (*appinfo.ApiKey, error) {
     query := `
     SELECT
-        "id",
-        "title"
-    FROM "roles"
-    ORDER BY "id" DESC;`
+        row_to_json("k")
+    FROM (
+        SELECT
+            "id",
+            "name",
+            "prefix",
+            "user_id",
+            "scopes",
+            "expired_at",
+            "last_used_at",
+            "revoked_at",
+            "created_at"
+        FROM "api_keys"
+        WHERE "key_hash" = $1
+        AND "revoked_at" IS NULL
+    ) AS "k";`
 
-    roles := make([]*middlewares.Role, 0)
-    if err := r.db.Select(&roles, query); err != nil {
-        return nil, fmt.Errorf("roles are empty")
+    data := make([]byte, 0)
+    if err := r.db.GetContext(ctx, &data, query, keyHash); err != nil {
+        if errors.Is(err, sql.ErrNoRows) {
+            return nil, nil
+        }
+        return nil, fmt.Errorf("get api key failed: %v", err)
     }
+    apiKey := new(appinfo.ApiKey)
+    if err := json.Unmarshal(data, apiKey); err != nil {
+        return nil, fmt.Errorf("unmarshal api key failed: %v", err)
+    }
+    return apiKey, nil
+}
+
+func (r *middlewaresRepository) UpdateApiKeyLastUsed(ctx context.Context, apiKeyId string) error {
+    query := `
+    UPDATE "api_keys" SET
+        "last_used_at" = NOW()
+    WHERE "id" = $1;`
 
-    return roles, nil
+    if _, err := r.db.ExecContext(ctx, query, apiKeyId); err != nil {
+        return fmt.Errorf("update api key last used failed: %v", err)
+    }
+    return nil
+}
+
+// FindClientToken return nil without error when token is unknown, revoked, expired,
+// client is revoked or user is disabled or deleted
+func (r *middlewaresRepository) FindClientToken(ctx context.Context, tokenId string) (*middlewares.ClientToken, error) {
+    query := `
+    SELECT
+        "t"."id",
+        "t"."client_id",
+        "t"."user_id",
+        "u"."role_id",
+        "t"."scope"
+    FROM "oauth2_tokens" "t"
+    JOIN "oauth2_clients" "c" ON "c"."id" = "t"."client_id"
+    JOIN "users" "u" ON "u"."id" = "t"."user_id"
+    WHERE "t"."id" = $1
+    AND "t"."revoked_at" IS NULL
+    AND "t"."expired_at" > NOW()
+    AND "c"."revoked_at" IS NULL
+    AND "u"."disabled_at" IS NULL
+    AND "u"."deleted_at" IS NULL;`
+
+    token := new(middlewares.ClientToken)
+    if err := r.db.GetContext(ctx, token, query, tokenId); err != nil {
+        if errors.Is(err, sql.ErrNoRows) {
+            return nil, nil
+        }
+        return nil, fmt.Errorf("get client token failed: %v", err)
+    }
+    return token, nil
 }
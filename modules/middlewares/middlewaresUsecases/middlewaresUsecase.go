@@ -1,35 +1,175 @@
 package middlewaresUsecases
 
 import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ppp3ppj/wymj/modules/appinfo"
 	"github.com/ppp3ppj/wymj/modules/middlewares"
 	"github.com/ppp3ppj/wymj/modules/middlewares/middlewaresRepositories"
+	"github.com/ppp3ppj/wymj/pkg/wymjauth"
+	"github.com/ppp3ppj/wymj/pkg/wymjtrace"
 )
 
+// apiKeyCacheTTL is how long a revoked key can still be used on other instances, this
+// instance reset cache of the key on revoke
+const apiKeyCacheTTL = 30 * time.Second
 
+// roleCacheTTL let other instances see role change, this instance reset cache on change
+const roleCacheTTL = 60 * time.Second
 
 type IMiddlewaresUsecase interface {
-    FindAccessToken(userId, accessToken string) bool
-    FindRole() ([]*middlewares.Role, error)
+    FindAccessToken(ctx context.Context, userId, accessToken string) bool
+    FindPermission(ctx context.Context, userId string) ([]string, error)
+    ResetRoleCache()
+    FindApiKey(ctx context.Context, key string) (*appinfo.ApiKey, error)
+    ResetApiKeyCache(apiKeyId string)
+    FindClientToken(ctx context.Context, tokenId string) (*middlewares.ClientToken, error)
+}
+
+type apiKeyCacheItem struct {
+    apiKey *appinfo.ApiKey
+    cachedAt time.Time
 }
 
 type middlewaresUsecase struct {
     middlewaresRepository middlewaresRepositories.IMiddlewaresRepository
+    apiKeyMu sync.Mutex
+    apiKeyCache map[string]*apiKeyCacheItem
+    roleMu sync.Mutex
+    // role id -> permission names
+    roleCache map[int][]string
+    roleCachedAt time.Time
 }
 
 func MiddlewaresUsecase(middlewaresRepository middlewaresRepositories.IMiddlewaresRepository) IMiddlewaresUsecase {
     return &middlewaresUsecase{
         middlewaresRepository: middlewaresRepository,
+        apiKeyCache: make(map[string]*apiKeyCacheItem),
     }
 }
 
-func (u *middlewaresUsecase) FindAccessToken(userId, accessToken string) bool {
-    return u.middlewaresRepository.FindAccessToken(userId, accessToken)
+func (u *middlewaresUsecase) FindAccessToken(ctx context.Context, userId, accessToken string) bool {
+    ctx, span := wymjtrace.Start(ctx, "middlewaresUsecase.FindAccessToken")
+    defer span.End()
+
+    return u.middlewaresRepository.FindAccessToken(ctx, userId, accessToken)
+}
+
+// FindPermission merge permissions of every role of user, role table is cached
+func (u *middlewaresUsecase) FindPermission(ctx context.Context, userId string) ([]string, error) {
+    ctx, span := wymjtrace.Start(ctx, "middlewaresUsecase.FindPermission")
+    defer span.End()
+
+    roleIds, err := u.middlewaresRepository.FindUserRoleId(ctx, userId)
+    if err != nil {
+        return nil, err
+    }
+    rolePermissions, err := u.findRolePermission(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    permissions := make([]string, 0)
+    for _, roleId := range roleIds {
+        for _, p := range rolePermissions[roleId] {
+            if !slices.Contains(permissions, p) {
+                permissions = append(permissions, p)
+            }
+        }
+    }
+    return permissions, nil
 }
 
-func (u *middlewaresUsecase) FindRole() ([]*middlewares.Role, error) {
-    roles, err := u.middlewaresRepository.FindRole()
+func (u *middlewaresUsecase) findRolePermission(ctx context.Context) (map[int][]string, error) {
+    u.roleMu.Lock()
+    defer u.roleMu.Unlock()
+    if u.roleCache != nil && time.Since(u.roleCachedAt) < roleCacheTTL {
+        return u.roleCache, nil
+    }
+
+    rows, err := u.middlewaresRepository.FindRolePermission(ctx)
     if err != nil {
         return nil, err
     }
-    return roles, nil
+    roleCache := make(map[int][]string)
+    for _, row := range rows {
+        roleCache[row.RoleId] = append(roleCache[row.RoleId], row.Permission)
+    }
+    u.roleCache = roleCache
+    u.roleCachedAt = time.Now()
+    return u.roleCache, nil
+}
+
+func (u *middlewaresUsecase) ResetRoleCache() {
+    u.roleMu.Lock()
+    defer u.roleMu.Unlock()
+    u.roleCache = nil
+}
+
+// FindApiKey return nil when key is unknown or revoked, result (also unknown key) is cached
+// for apiKeyCacheTTL so database is not queried on every request
+func (u *middlewaresUsecase) FindApiKey(ctx context.Context, key string) (*appinfo.ApiKey, error) {
+    ctx, span := wymjtrace.Start(ctx, "middlewaresUsecase.FindApiKey")
+    defer span.End()
+
+    keyHash := wymjauth.HashToken(key)
+
+    u.apiKeyMu.Lock()
+    item, ok := u.apiKeyCache[keyHash]
+    u.apiKeyMu.Unlock()
+    if ok && time.Since(item.cachedAt) < apiKeyCacheTTL {
+        return item.apiKey, nil
+    }
+
+    apiKey, err := u.middlewaresRepository.FindApiKey(ctx, keyHash)
+    if err != nil {
+        return nil, err
+    }
+    if apiKey != nil {
+        // last used is updated at most once per ttl for each key
+        if err := u.middlewaresRepository.UpdateApiKeyLastUsed(ctx, apiKey.Id); err != nil {
+            slog.ErrorContext(ctx, "update api key last used failed", slog.String("prefix", apiKey.Prefix), slog.String("error", err.Error()))
+        }
+    }
+
+    u.apiKeyMu.Lock()
+    defer u.apiKeyMu.Unlock()
+    // drop stale items so random invalid keys can not grow the cache forever
+    if len(u.apiKeyCache) >= 1000 {
+        for k, v := range u.apiKeyCache {
+            if time.Since(v.cachedAt) >= apiKeyCacheTTL {
+                delete(u.apiKeyCache, k)
+            }
+        }
+    }
+    if len(u.apiKeyCache) < 1000 {
+        u.apiKeyCache[keyHash] = &apiKeyCacheItem{
+            apiKey: apiKey,
+            cachedAt: time.Now(),
+        }
+    }
+    return apiKey, nil
+}
+
+// ResetApiKeyCache drop cached key by id, cache is keyed by hash so every item is checked
+func (u *middlewaresUsecase) ResetApiKeyCache(apiKeyId string) {
+    u.apiKeyMu.Lock()
+    defer u.apiKeyMu.Unlock()
+    for k, v := range u.apiKeyCache {
+        if v.apiKey != nil && v.apiKey.Id == apiKeyId {
+            delete(u.apiKeyCache, k)
+        }
+    }
+}
+
+// FindClientToken is not cached, revoked token must stop working at once
+func (u *middlewaresUsecase) FindClientToken(ctx context.Context, tokenId string) (*middlewares.ClientToken, error) {
+    ctx, span := wymjtrace.Start(ctx, "middlewaresUsecase.FindClientToken")
+    defer span.End()
+
+    return u.middlewaresRepository.FindClientToken(ctx, tokenId)
 }
@@ -0,0 +1,56 @@
+package middlewaresUsecases
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ppp3ppj/wymj/modules/appinfo"
+	"github.com/ppp3ppj/wymj/modules/middlewares/middlewaresRepositories"
+	"github.com/ppp3ppj/wymj/pkg/wymjauth"
+)
+
+// testRepository has one api key, revoked key is not found same as the real query
+type testRepository struct {
+    middlewaresRepositories.IMiddlewaresRepository
+    apiKey *appinfo.ApiKey
+    keyHash string
+    revoked bool
+    queries int
+}
+
+func (r *testRepository) FindApiKey(ctx context.Context, keyHash string) (*appinfo.ApiKey, error) {
+    r.queries++
+    if r.revoked || keyHash != r.keyHash {
+        return nil, nil
+    }
+    return r.apiKey, nil
+}
+
+func (r *testRepository) UpdateApiKeyLastUsed(ctx context.Context, apiKeyId string) error {
+    return nil
+}
+
+func TestRevokedApiKeyIsNotCached(t *testing.T) {
+    key := "wymj_test-key"
+    repository := &testRepository{
+        apiKey: &appinfo.ApiKey{Id: "K1", Scopes: []string{"*"}},
+        keyHash: wymjauth.HashToken(key),
+    }
+    usecase := MiddlewaresUsecase(repository)
+    ctx := context.Background()
+
+    for i := 0; i < 2; i++ {
+        if apiKey, err := usecase.FindApiKey(ctx, key); err != nil || apiKey == nil {
+            t.Fatalf("find api key = %v, %v", apiKey, err)
+        }
+    }
+    if repository.queries != 1 {
+        t.Fatalf("queries = %d, second call should be cached", repository.queries)
+    }
+
+    repository.revoked = true
+    usecase.ResetApiKeyCache("K1")
+    if apiKey, err := usecase.FindApiKey(ctx, key); err != nil || apiKey != nil {
+        t.Fatalf("revoked key is still accepted: %v, %v", apiKey, err)
+    }
+}
@@ -2,22 +2,27 @@ package monitorHandlers
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/ppp3ppj/wymj/config"
 	"github.com/ppp3ppj/wymj/modules/entities"
 	"github.com/ppp3ppj/wymj/modules/monitor"
+	"github.com/ppp3ppj/wymj/pkg/wymjmetrics"
 )
 
 type IMonitorHandler interface {
     HealthCheck(c *fiber.Ctx) error 
+    Metrics(c *fiber.Ctx) error
 }
 
 type monitorHandler struct {
     cfg config.IConfig
+    metrics fiber.Handler
 }
 
 func MonitorHandler(cfg config.IConfig) IMonitorHandler {
     return &monitorHandler{
         cfg: cfg,
+        metrics: adaptor.HTTPHandler(wymjmetrics.Handler()),
     }
 }
 
@@ -29,3 +34,8 @@ func (h *monitorHandler) HealthCheck(c *fiber.Ctx) error {
     //return c.Status(fiber.StatusOK).JSON(res)
     return entities.NewResponse(c).Success(fiber.StatusOK, res).Res()
 }
+
+// Metrics write metrics in Prometheus text format, it is not wrapped in response
+func (h *monitorHandler) Metrics(c *fiber.Ctx) error {
+    return h.metrics(c)
+}
@@ -0,0 +1,180 @@
+package oauth2
+
+import (
+	"fmt"
+	"time"
+)
+
+// scope that third party app can ask for, write scope has the same name as permission
+const (
+    TasksRead = "tasks:read"
+    TasksWrite = "tasks:write"
+    TimersRead = "timers:read"
+    TimersWrite = "timers:write"
+    ProjectsRead = "projects:read"
+)
+
+var Scopes = []string{TasksRead, TasksWrite, TimersRead, TimersWrite, ProjectsRead}
+
+const (
+    AuthorizationCodeGrant = "authorization_code"
+    RefreshTokenGrant = "refresh_token"
+    ClientCredentialsGrant = "client_credentials"
+)
+
+var GrantTypes = []string{AuthorizationCodeGrant, RefreshTokenGrant, ClientCredentialsGrant}
+
+type Client struct {
+    Id string `db:"id" json:"client_id"`
+    Name string `db:"name" json:"name"`
+    UserId string `db:"user_id" json:"user_id"`
+    Confidential bool `db:"confidential" json:"confidential"`
+    RedirectUris []string `db:"redirect_uris" json:"redirect_uris"`
+    Scopes []string `db:"scopes" json:"scopes"`
+    GrantTypes []string `db:"grant_types" json:"grant_types"`
+    RevokedAt *time.Time `db:"revoked_at" json:"revoked_at"`
+    CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// ClientReq Confidential is true by default, public client has no secret and must use pkce
+type ClientReq struct {
+    Name string `json:"name" form:"name"`
+    RedirectUris []string `json:"redirect_uris" form:"redirect_uris"`
+    Scopes []string `json:"scopes" form:"scopes"`
+    GrantTypes []string `json:"grant_types" form:"grant_types"`
+    Confidential *bool `json:"confidential" form:"confidential"`
+}
+
+// ClientRes has the secret only in create response
+type ClientRes struct {
+    *Client
+    ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// AuthorizeReq is query of authorization request, Approve is answer of the user on consent page
+type AuthorizeReq struct {
+    ResponseType string `query:"response_type" json:"response_type" form:"response_type"`
+    ClientId string `query:"client_id" json:"client_id" form:"client_id"`
+    RedirectUri string `query:"redirect_uri" json:"redirect_uri" form:"redirect_uri"`
+    Scope string `query:"scope" json:"scope" form:"scope"`
+    State string `query:"state" json:"state" form:"state"`
+    CodeChallenge string `query:"code_challenge" json:"code_challenge" form:"code_challenge"`
+    CodeChallengeMethod string `query:"code_challenge_method" json:"code_challenge_method" form:"code_challenge_method"`
+    Approve bool `json:"approve" form:"approve"`
+}
+
+// AuthorizeInfo is shown on consent page, Consented is true when user already granted every scope
+type AuthorizeInfo struct {
+    ClientId string `json:"client_id"`
+    ClientName string `json:"client_name"`
+    RedirectUri string `json:"redirect_uri"`
+    Scopes []string `json:"scopes"`
+    Consented bool `json:"consented"`
+}
+
+// AuthorizeRes is where frontend send the browser, it carry code or error
+type AuthorizeRes struct {
+    RedirectUri string `json:"redirect_uri"`
+}
+
+type Consent struct {
+    ClientId string `db:"client_id" json:"client_id"`
+    ClientName string `db:"client_name" json:"client_name"`
+    Scope string `db:"scope" json:"scope"`
+    CreatedAt time.Time `db:"created_at" json:"created_at"`
+    UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// Code RedirectUriSent is false when authorize request omit redirect_uri and the registered one is used
+type Code struct {
+    CodeHash string `db:"code_hash"`
+    ClientId string `db:"client_id"`
+    UserId string `db:"user_id"`
+    RedirectUri string `db:"redirect_uri"`
+    RedirectUriSent bool `db:"redirect_uri_sent"`
+    Scope string `db:"scope"`
+    CodeChallenge string `db:"code_challenge"`
+}
+
+type Token struct {
+    Id string `db:"id"`
+    ClientId string `db:"client_id"`
+    UserId string `db:"user_id"`
+    Scope string `db:"scope"`
+    GrantType string `db:"grant_type"`
+    CodeHash *string `db:"code_hash"`
+    ExpiredAt time.Time `db:"expired_at"`
+    RefreshExpiredAt *time.Time `db:"refresh_expired_at"`
+    RevokedAt *time.Time `db:"revoked_at"`
+    CreatedAt time.Time `db:"created_at"`
+}
+
+// TokenReq is form of token endpoint, client can also authenticate with http basic
+type TokenReq struct {
+    GrantType string `form:"grant_type"`
+    Code string `form:"code"`
+    RedirectUri string `form:"redirect_uri"`
+    CodeVerifier string `form:"code_verifier"`
+    RefreshToken string `form:"refresh_token"`
+    Scope string `form:"scope"`
+    ClientId string `form:"client_id"`
+    ClientSecret string `form:"client_secret"`
+}
+
+type TokenRes struct {
+    AccessToken string `json:"access_token"`
+    TokenType string `json:"token_type"`
+    ExpiresIn int `json:"expires_in"`
+    RefreshToken string `json:"refresh_token,omitempty"`
+    Scope string `json:"scope"`
+}
+
+// TokenHintReq is form of introspection (RFC 7662) and revocation (RFC 7009)
+type TokenHintReq struct {
+    Token string `form:"token"`
+    TokenTypeHint string `form:"token_type_hint"`
+    ClientId string `form:"client_id"`
+    ClientSecret string `form:"client_secret"`
+}
+
+type IntrospectRes struct {
+    Active bool `json:"active"`
+    Scope string `json:"scope,omitempty"`
+    ClientId string `json:"client_id,omitempty"`
+    Sub string `json:"sub,omitempty"`
+    TokenType string `json:"token_type,omitempty"`
+    Exp int64 `json:"exp,omitempty"`
+    Iat int64 `json:"iat,omitempty"`
+}
+
+// Error is error response of RFC 6749 section 5.2
+type Error struct {
+    Code string `json:"error"`
+    Description string `json:"error_description,omitempty"`
+}
+
+func (e *Error) Error() string {
+    return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+func NewError(code, description string) *Error {
+    return &Error{
+        Code: code,
+        Description: description,
+    }
+}
+
+// Metadata is authorization server metadata of RFC 8414
+type Metadata struct {
+    Issuer string `json:"issuer"`
+    AuthorizationEndpoint string `json:"authorization_endpoint"`
+    TokenEndpoint string `json:"token_endpoint"`
+    IntrospectionEndpoint string `json:"introspection_endpoint"`
+    RevocationEndpoint string `json:"revocation_endpoint"`
+    JwksUri string `json:"jwks_uri"`
+    ScopesSupported []string `json:"scopes_supported"`
+    ResponseTypesSupported []string `json:"response_types_supported"`
+    GrantTypesSupported []string `json:"grant_types_supported"`
+    TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+    CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported"`
+}
@@ -0,0 +1,341 @@
+package oauth2Handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/modules/entities"
+	"github.com/ppp3ppj/wymj/modules/oauth2"
+	"github.com/ppp3ppj/wymj/modules/oauth2/oauth2Usecases"
+)
+
+type oauth2HandlersErrCode string
+
+const (
+    insertClientErr oauth2HandlersErrCode = "oauth2-001"
+    findClientErr oauth2HandlersErrCode = "oauth2-002"
+    revokeClientErr oauth2HandlersErrCode = "oauth2-003"
+    findConsentErr oauth2HandlersErrCode = "oauth2-004"
+    deleteConsentErr oauth2HandlersErrCode = "oauth2-005"
+    findAuthorizeErr oauth2HandlersErrCode = "oauth2-006"
+    authorizeErr oauth2HandlersErrCode = "oauth2-007"
+)
+
+type IOAuth2Handler interface {
+    InsertClient(c *fiber.Ctx) error
+    FindClient(c *fiber.Ctx) error
+    RevokeClient(c *fiber.Ctx) error
+    FindConsent(c *fiber.Ctx) error
+    DeleteConsent(c *fiber.Ctx) error
+    FindAuthorize(c *fiber.Ctx) error
+    Authorize(c *fiber.Ctx) error
+    Token(c *fiber.Ctx) error
+    Introspect(c *fiber.Ctx) error
+    Revoke(c *fiber.Ctx) error
+    Metadata(c *fiber.Ctx) error
+}
+
+type oauth2Handler struct {
+    cfg config.IConfig
+    oauth2Usecase oauth2Usecases.IOAuth2Usecase
+}
+
+func OAuth2Handler(cfg config.IConfig, oauth2Usecase oauth2Usecases.IOAuth2Usecase) IOAuth2Handler {
+    return &oauth2Handler{
+        cfg: cfg,
+        oauth2Usecase: oauth2Usecase,
+    }
+}
+
+// InsertClient response has the client secret, it can not be shown again
+func (h *oauth2Handler) InsertClient(c *fiber.Ctx) error {
+    req := new(oauth2.ClientReq)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(insertClientErr),
+            err.Error(),
+        ).Res()
+    }
+
+    userId, _ := c.Locals("userId").(string)
+    client, err := h.oauth2Usecase.InsertClient(c.UserContext(), req, userId)
+    if err != nil {
+        switch {
+        case err.Error() == "name is required",
+            err.Error() == "redirect_uris is required",
+            err.Error() == "public client can not use client_credentials",
+            strings.HasSuffix(err.Error(), "is invalid"):
+            return entities.NewResponse(c).Error(
+                fiber.ErrBadRequest.Code,
+                string(insertClientErr),
+                err.Error(),
+            ).Res()
+        default:
+            return entities.NewResponse(c).Error(
+                fiber.ErrInternalServerError.Code,
+                string(insertClientErr),
+                err.Error(),
+            ).Res()
+        }
+    }
+    return entities.NewResponse(c).Success(fiber.StatusCreated, client).Res()
+}
+
+// FindClient return clients that user owns
+func (h *oauth2Handler) FindClient(c *fiber.Ctx) error {
+    userId, _ := c.Locals("userId").(string)
+    clients, err := h.oauth2Usecase.FindClient(c.UserContext(), userId)
+    if err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrInternalServerError.Code,
+            string(findClientErr),
+            err.Error(),
+        ).Res()
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, clients).Res()
+}
+
+func (h *oauth2Handler) RevokeClient(c *fiber.Ctx) error {
+    userId, _ := c.Locals("userId").(string)
+    if err := h.oauth2Usecase.RevokeClient(c.UserContext(), c.Params("client_id"), userId); err != nil {
+        switch err.Error() {
+        case "client not found":
+            return entities.NewResponse(c).Error(
+                fiber.ErrNotFound.Code,
+                string(revokeClientErr),
+                err.Error(),
+            ).Res()
+        default:
+            return entities.NewResponse(c).Error(
+                fiber.ErrInternalServerError.Code,
+                string(revokeClientErr),
+                err.Error(),
+            ).Res()
+        }
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+// FindConsent return apps that user has given access to
+func (h *oauth2Handler) FindConsent(c *fiber.Ctx) error {
+    userId, _ := c.Locals("userId").(string)
+    consents, err := h.oauth2Usecase.FindConsent(c.UserContext(), userId)
+    if err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrInternalServerError.Code,
+            string(findConsentErr),
+            err.Error(),
+        ).Res()
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, consents).Res()
+}
+
+// DeleteConsent take back access of the app, its tokens stop working
+func (h *oauth2Handler) DeleteConsent(c *fiber.Ctx) error {
+    userId, _ := c.Locals("userId").(string)
+    if err := h.oauth2Usecase.DeleteConsent(c.UserContext(), userId, c.Params("client_id")); err != nil {
+        switch err.Error() {
+        case "consent not found":
+            return entities.NewResponse(c).Error(
+                fiber.ErrNotFound.Code,
+                string(deleteConsentErr),
+                err.Error(),
+            ).Res()
+        default:
+            return entities.NewResponse(c).Error(
+                fiber.ErrInternalServerError.Code,
+                string(deleteConsentErr),
+                err.Error(),
+            ).Res()
+        }
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+func authorizeErrRes(c *fiber.Ctx, code oauth2HandlersErrCode, err error) error {
+    switch {
+    case err.Error() == "client not found":
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(code),
+            "client_id is invalid",
+        ).Res()
+    case err.Error() == "response_type is not supported",
+        err.Error() == "client is not allowed to use authorization_code",
+        err.Error() == "code_challenge_method must be S256",
+        err.Error() == "code_challenge is required for public client",
+        strings.HasSuffix(err.Error(), "is invalid"):
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(code),
+            err.Error(),
+        ).Res()
+    default:
+        return entities.NewResponse(c).Error(
+            fiber.ErrInternalServerError.Code,
+            string(code),
+            err.Error(),
+        ).Res()
+    }
+}
+
+// FindAuthorize is called by consent page with query of authorization request
+func (h *oauth2Handler) FindAuthorize(c *fiber.Ctx) error {
+    req := new(oauth2.AuthorizeReq)
+    if err := c.QueryParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(findAuthorizeErr),
+            err.Error(),
+        ).Res()
+    }
+
+    userId, _ := c.Locals("userId").(string)
+    info, err := h.oauth2Usecase.FindAuthorize(c.UserContext(), req, userId)
+    if err != nil {
+        return authorizeErrRes(c, findAuthorizeErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, info).Res()
+}
+
+// Authorize is called when user approve or deny, consent page redirect browser to redirect_uri
+func (h *oauth2Handler) Authorize(c *fiber.Ctx) error {
+    req := new(oauth2.AuthorizeReq)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(authorizeErr),
+            err.Error(),
+        ).Res()
+    }
+
+    userId, _ := c.Locals("userId").(string)
+    res, err := h.oauth2Usecase.Authorize(c.UserContext(), req, userId)
+    if err != nil {
+        return authorizeErrRes(c, authorizeErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, res).Res()
+}
+
+// clientCredentials read client from http basic (RFC 6749 section 2.3.1) or from form
+func clientCredentials(c *fiber.Ctx, clientId, clientSecret string) (string, string, bool) {
+    auth := c.Get(fiber.HeaderAuthorization)
+    if !strings.HasPrefix(auth, "Basic ") {
+        return clientId, clientSecret, false
+    }
+    data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(auth, "Basic "))
+    if err != nil {
+        return "", "", true
+    }
+    id, secret, _ := strings.Cut(string(data), ":")
+    // id and secret are form url encoded before base64
+    if id, err = url.QueryUnescape(id); err != nil {
+        return "", "", true
+    }
+    if secret, err = url.QueryUnescape(secret); err != nil {
+        return "", "", true
+    }
+    return id, secret, true
+}
+
+// errorRes write RFC 6749 section 5.2 error, token endpoints are not wrapped in response entity
+// so standard oauth client can read it
+func errorRes(c *fiber.Ctx, err error, basic bool) error {
+    var e *oauth2.Error
+    if !errors.As(err, &e) {
+        e = oauth2.NewError("server_error", err.Error())
+        return c.Status(fiber.StatusInternalServerError).JSON(e)
+    }
+    if e.Code == "invalid_client" {
+        if basic {
+            c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="wymj"`)
+        }
+        return c.Status(fiber.StatusUnauthorized).JSON(e)
+    }
+    return c.Status(fiber.StatusBadRequest).JSON(e)
+}
+
+func (h *oauth2Handler) Token(c *fiber.Ctx) error {
+    c.Set(fiber.HeaderCacheControl, "no-store")
+    c.Set(fiber.HeaderPragma, "no-cache")
+
+    req := new(oauth2.TokenReq)
+    if err := c.BodyParser(req); err != nil {
+        return errorRes(c, oauth2.NewError("invalid_request", err.Error()), false)
+    }
+    clientId, clientSecret, basic := clientCredentials(c, req.ClientId, req.ClientSecret)
+    client, err := h.oauth2Usecase.AuthenticateClient(c.UserContext(), clientId, clientSecret)
+    if err != nil {
+        return errorRes(c, err, basic)
+    }
+
+    token, err := h.oauth2Usecase.Token(c.UserContext(), req, client)
+    if err != nil {
+        return errorRes(c, err, basic)
+    }
+    return c.Status(fiber.StatusOK).JSON(token)
+}
+
+// Introspect is RFC 7662, client must authenticate
+func (h *oauth2Handler) Introspect(c *fiber.Ctx) error {
+    c.Set(fiber.HeaderCacheControl, "no-store")
+
+    req := new(oauth2.TokenHintReq)
+    if err := c.BodyParser(req); err != nil {
+        return errorRes(c, oauth2.NewError("invalid_request", err.Error()), false)
+    }
+    clientId, clientSecret, basic := clientCredentials(c, req.ClientId, req.ClientSecret)
+    client, err := h.oauth2Usecase.AuthenticateClient(c.UserContext(), clientId, clientSecret)
+    if err != nil {
+        return errorRes(c, err, basic)
+    }
+
+    res, err := h.oauth2Usecase.Introspect(c.UserContext(), req, client)
+    if err != nil {
+        return errorRes(c, err, basic)
+    }
+    return c.Status(fiber.StatusOK).JSON(res)
+}
+
+// Revoke is RFC 7009, response is 200 with empty body also when token is unknown
+func (h *oauth2Handler) Revoke(c *fiber.Ctx) error {
+    req := new(oauth2.TokenHintReq)
+    if err := c.BodyParser(req); err != nil {
+        return errorRes(c, oauth2.NewError("invalid_request", err.Error()), false)
+    }
+    clientId, clientSecret, basic := clientCredentials(c, req.ClientId, req.ClientSecret)
+    client, err := h.oauth2Usecase.AuthenticateClient(c.UserContext(), clientId, clientSecret)
+    if err != nil {
+        return errorRes(c, err, basic)
+    }
+
+    if err := h.oauth2Usecase.Revoke(c.UserContext(), req, client); err != nil {
+        return errorRes(c, err, basic)
+    }
+    return c.SendStatus(fiber.StatusOK)
+}
+
+// Metadata is RFC 8414 so client library can discover endpoints, authorization endpoint
+// is consent page of frontend because browser can not send bearer token
+func (h *oauth2Handler) Metadata(c *fiber.Ctx) error {
+    issuer := h.cfg.OAuth2().Issuer()
+    c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+    return c.Status(fiber.StatusOK).JSON(&oauth2.Metadata{
+        Issuer: issuer,
+        AuthorizationEndpoint: h.cfg.OAuth2().ConsentUrl(),
+        TokenEndpoint: issuer + "/v1/oauth2/token",
+        IntrospectionEndpoint: issuer + "/v1/oauth2/introspect",
+        RevocationEndpoint: issuer + "/v1/oauth2/revoke",
+        JwksUri: issuer + "/.well-known/jwks.json",
+        ScopesSupported: oauth2.Scopes,
+        ResponseTypesSupported: []string{"code"},
+        GrantTypesSupported: oauth2.GrantTypes,
+        TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+        CodeChallengeMethodsSupported: []string{"S256"},
+    })
+}
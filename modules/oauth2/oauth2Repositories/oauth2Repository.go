@@ -0,0 +1,513 @@
+package oauth2Repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/ppp3ppj/wymj/modules/oauth2"
+	"github.com/ppp3ppj/wymj/pkg/wymjauth"
+)
+
+type IOAuth2Repository interface {
+    InsertClient(ctx context.Context, req *oauth2.ClientReq, clientId, userId, secret string) (*oauth2.Client, error)
+    FindOneClient(ctx context.Context, clientId string) (*oauth2.Client, error)
+    FindClient(ctx context.Context, userId string) ([]*oauth2.Client, error)
+    FindClientSecretHash(ctx context.Context, clientId string) (string, error)
+    RevokeClient(ctx context.Context, clientId, userId string) error
+    FindConsent(ctx context.Context, userId string) ([]*oauth2.Consent, error)
+    FindOneConsent(ctx context.Context, userId, clientId string) (string, error)
+    UpsertConsent(ctx context.Context, userId, clientId, scope string) error
+    DeleteConsent(ctx context.Context, userId, clientId string) error
+    InsertCode(ctx context.Context, code string, req *oauth2.Code, expiredAt time.Time) error
+    UseCode(ctx context.Context, code string) (*oauth2.Code, error)
+    InsertToken(ctx context.Context, req *oauth2.Token, refreshToken string) error
+    FindRefreshToken(ctx context.Context, refreshToken string) (*oauth2.Token, error)
+    FindOneToken(ctx context.Context, tokenId string) (*oauth2.Token, error)
+    RevokeToken(ctx context.Context, tokenId string) error
+    RevokeTokenByCode(ctx context.Context, code string) error
+}
+
+type oauth2Repository struct {
+    db *sqlx.DB
+}
+
+func OAuth2Repository(db *sqlx.DB) IOAuth2Repository {
+    return &oauth2Repository{
+        db: db,
+    }
+}
+
+// clientQuery is columns of client without secret, confidential is client that has secret
+const clientQuery = `
+        SELECT
+            "id",
+            "name",
+            "user_id",
+            ("secret_hash" IS NOT NULL) AS "confidential",
+            "redirect_uris",
+            "scopes",
+            "grant_types",
+            "revoked_at",
+            "created_at"
+        FROM "oauth2_clients"`
+
+// InsertClient store hash of secret, secret is empty for public client
+func (r *oauth2Repository) InsertClient(ctx context.Context, req *oauth2.ClientReq, clientId, userId, secret string) (*oauth2.Client, error) {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    redirectUris, err := json.Marshal(req.RedirectUris)
+    if err != nil {
+        return nil, fmt.Errorf("marshal redirect_uris failed: %v", err)
+    }
+    scopes, err := json.Marshal(req.Scopes)
+    if err != nil {
+        return nil, fmt.Errorf("marshal scopes failed: %v", err)
+    }
+    grantTypes, err := json.Marshal(req.GrantTypes)
+    if err != nil {
+        return nil, fmt.Errorf("marshal grant_types failed: %v", err)
+    }
+    var secretHash *string
+    if secret != "" {
+        hash := wymjauth.HashToken(secret)
+        secretHash = &hash
+    }
+
+    query := `
+    INSERT INTO "oauth2_clients" (
+        "id",
+        "name",
+        "secret_hash",
+        "user_id",
+        "redirect_uris",
+        "scopes",
+        "grant_types"
+    )
+    VALUES ($1, $2, $3, $4, $5, $6, $7);`
+
+    if _, err := r.db.ExecContext(
+        ctx,
+        query,
+        clientId,
+        req.Name,
+        secretHash,
+        userId,
+        string(redirectUris),
+        string(scopes),
+        string(grantTypes),
+    ); err != nil {
+        return nil, fmt.Errorf("insert client failed: %v", err)
+    }
+    return r.FindOneClient(ctx, clientId)
+}
+
+// FindOneClient return "client not found" when client does not exist or is revoked
+func (r *oauth2Repository) FindOneClient(ctx context.Context, clientId string) (*oauth2.Client, error) {
+    query := `
+    SELECT
+        row_to_json("c")
+    FROM (` + clientQuery + `
+        WHERE "id" = $1
+        AND "revoked_at" IS NULL
+    ) AS "c";`
+
+    data := make([]byte, 0)
+    if err := r.db.GetContext(ctx, &data, query, clientId); err != nil {
+        if errors.Is(err, sql.ErrNoRows) {
+            return nil, fmt.Errorf("client not found")
+        }
+        return nil, fmt.Errorf("get client failed: %v", err)
+    }
+    client := new(oauth2.Client)
+    if err := json.Unmarshal(data, client); err != nil {
+        return nil, fmt.Errorf("unmarshal client failed: %v", err)
+    }
+    return client, nil
+}
+
+func (r *oauth2Repository) FindClient(ctx context.Context, userId string) ([]*oauth2.Client, error) {
+    query := `
+    SELECT
+        COALESCE(array_to_json(array_agg("c")), '[]'::json)
+    FROM (` + clientQuery + `
+        WHERE "user_id" = $1
+        AND "revoked_at" IS NULL
+        ORDER BY "created_at" DESC
+    ) AS "c";`
+
+    data := make([]byte, 0)
+    if err := r.db.GetContext(ctx, &data, query, userId); err != nil {
+        return nil, fmt.Errorf("get clients failed: %v", err)
+    }
+    clients := make([]*oauth2.Client, 0)
+    if err := json.Unmarshal(data, &clients); err != nil {
+        return nil, fmt.Errorf("unmarshal clients failed: %v", err)
+    }
+    return clients, nil
+}
+
+// FindClientSecretHash return empty string for public client
+func (r *oauth2Repository) FindClientSecretHash(ctx context.Context, clientId string) (string, error) {
+    query := `
+    SELECT
+        COALESCE("secret_hash", '')
+    FROM "oauth2_clients"
+    WHERE "id" = $1
+    AND "revoked_at" IS NULL;`
+
+    var secretHash string
+    if err := r.db.GetContext(ctx, &secretHash, query, clientId); err != nil {
+        if errors.Is(err, sql.ErrNoRows) {
+            return "", fmt.Errorf("client not found")
+        }
+        return "", fmt.Errorf("get client failed: %v", err)
+    }
+    return secretHash, nil
+}
+
+// RevokeClient also revoke every token of the client, only owner can revoke
+func (r *oauth2Repository) RevokeClient(ctx context.Context, clientId, userId string) error {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return err
+    }
+
+    result, err := tx.ExecContext(ctx, `
+    UPDATE "oauth2_clients" SET
+        "revoked_at" = NOW()
+    WHERE "id" = $1
+    AND "user_id" = $2
+    AND "revoked_at" IS NULL;`,
+        clientId,
+        userId,
+    )
+    if err != nil {
+        tx.Rollback()
+        return fmt.Errorf("revoke client failed: %v", err)
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        tx.Rollback()
+        return fmt.Errorf("client not found")
+    }
+    if _, err := tx.ExecContext(ctx, `
+    UPDATE "oauth2_tokens" SET
+        "revoked_at" = NOW()
+    WHERE "client_id" = $1
+    AND "revoked_at" IS NULL;`,
+        clientId,
+    ); err != nil {
+        tx.Rollback()
+        return fmt.Errorf("revoke client tokens failed: %v", err)
+    }
+
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    return nil
+}
+
+func (r *oauth2Repository) FindConsent(ctx context.Context, userId string) ([]*oauth2.Consent, error) {
+    query := `
+    SELECT
+        "cs"."client_id",
+        "c"."name" AS "client_name",
+        "cs"."scope",
+        "cs"."created_at",
+        "cs"."updated_at"
+    FROM "oauth2_consents" "cs"
+    JOIN "oauth2_clients" "c" ON "c"."id" = "cs"."client_id"
+    WHERE "cs"."user_id" = $1
+    AND "c"."revoked_at" IS NULL
+    ORDER BY "cs"."updated_at" DESC;`
+
+    consents := make([]*oauth2.Consent, 0)
+    if err := r.db.SelectContext(ctx, &consents, query, userId); err != nil {
+        return nil, fmt.Errorf("get consents failed: %v", err)
+    }
+    return consents, nil
+}
+
+// FindOneConsent return granted scope, empty when user has not consented
+func (r *oauth2Repository) FindOneConsent(ctx context.Context, userId, clientId string) (string, error) {
+    query := `
+    SELECT
+        "scope"
+    FROM "oauth2_consents"
+    WHERE "user_id" = $1
+    AND "client_id" = $2;`
+
+    var scope string
+    if err := r.db.GetContext(ctx, &scope, query, userId, clientId); err != nil {
+        if errors.Is(err, sql.ErrNoRows) {
+            return "", nil
+        }
+        return "", fmt.Errorf("get consent failed: %v", err)
+    }
+    return scope, nil
+}
+
+func (r *oauth2Repository) UpsertConsent(ctx context.Context, userId, clientId, scope string) error {
+    query := `
+    INSERT INTO "oauth2_consents" (
+        "user_id",
+        "client_id",
+        "scope"
+    )
+    VALUES ($1, $2, $3)
+    ON CONFLICT ("user_id", "client_id") DO UPDATE SET
+        "scope" = EXCLUDED."scope",
+        "updated_at" = NOW();`
+
+    if _, err := r.db.ExecContext(ctx, query, userId, clientId, scope); err != nil {
+        return fmt.Errorf("upsert consent failed: %v", err)
+    }
+    return nil
+}
+
+// DeleteConsent also revoke every token that user gave to the client
+func (r *oauth2Repository) DeleteConsent(ctx context.Context, userId, clientId string) error {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return err
+    }
+
+    result, err := tx.ExecContext(ctx, `
+    DELETE FROM "oauth2_consents"
+    WHERE "user_id" = $1
+    AND "client_id" = $2;`,
+        userId,
+        clientId,
+    )
+    if err != nil {
+        tx.Rollback()
+        return fmt.Errorf("delete consent failed: %v", err)
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        tx.Rollback()
+        return fmt.Errorf("consent not found")
+    }
+    if _, err := tx.ExecContext(ctx, `
+    UPDATE "oauth2_tokens" SET
+        "revoked_at" = NOW()
+    WHERE "user_id" = $1
+    AND "client_id" = $2
+    AND "grant_type" <> 'client_credentials'
+    AND "revoked_at" IS NULL;`,
+        userId,
+        clientId,
+    ); err != nil {
+        tx.Rollback()
+        return fmt.Errorf("revoke consent tokens failed: %v", err)
+    }
+
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    return nil
+}
+
+// InsertCode also clean code that expired
+func (r *oauth2Repository) InsertCode(ctx context.Context, code string, req *oauth2.Code, expiredAt time.Time) error {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    if _, err := r.db.ExecContext(ctx, `
+    DELETE FROM "oauth2_codes" WHERE "expired_at" < NOW() - INTERVAL '1 day';`,
+    ); err != nil {
+        return fmt.Errorf("delete expired codes failed: %v", err)
+    }
+
+    query := `
+    INSERT INTO "oauth2_codes" (
+        "code_hash",
+        "client_id",
+        "user_id",
+        "redirect_uri",
+        "redirect_uri_sent",
+        "scope",
+        "code_challenge",
+        "expired_at"
+    )
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`
+
+    if _, err := r.db.ExecContext(
+        ctx,
+        query,
+        wymjauth.HashToken(code),
+        req.ClientId,
+        req.UserId,
+        req.RedirectUri,
+        req.RedirectUriSent,
+        req.Scope,
+        req.CodeChallenge,
+        expiredAt,
+    ); err != nil {
+        return fmt.Errorf("insert code failed: %v", err)
+    }
+    return nil
+}
+
+// UseCode mark code as used and return it, code can be used once.
+// It return "code has been used" when code is replayed and "code is invalid" when unknown or expired
+func (r *oauth2Repository) UseCode(ctx context.Context, code string) (*oauth2.Code, error) {
+    codeHash := wymjauth.HashToken(code)
+    query := `
+    UPDATE "oauth2_codes" SET
+        "used_at" = NOW()
+    WHERE "code_hash" = $1
+    AND "used_at" IS NULL
+    AND "expired_at" > NOW()
+    RETURNING
+        "code_hash",
+        "client_id",
+        "user_id",
+        "redirect_uri",
+        "redirect_uri_sent",
+        "scope",
+        "code_challenge";`
+
+    result := new(oauth2.Code)
+    if err := r.db.GetContext(ctx, result, query, codeHash); err != nil {
+        if !errors.Is(err, sql.ErrNoRows) {
+            return nil, fmt.Errorf("use code failed: %v", err)
+        }
+        var used bool
+        if err := r.db.GetContext(ctx, &used, `
+        SELECT ("used_at" IS NOT NULL) FROM "oauth2_codes" WHERE "code_hash" = $1;`,
+            codeHash,
+        ); err == nil && used {
+            return nil, fmt.Errorf("code has been used")
+        }
+        return nil, fmt.Errorf("code is invalid")
+    }
+    return result, nil
+}
+
+// InsertToken store access token row, refresh token is stored as hash when it is issued
+func (r *oauth2Repository) InsertToken(ctx context.Context, req *oauth2.Token, refreshToken string) error {
+    var refreshHash *string
+    if refreshToken != "" {
+        hash := wymjauth.HashToken(refreshToken)
+        refreshHash = &hash
+    }
+
+    query := `
+    INSERT INTO "oauth2_tokens" (
+        "id",
+        "client_id",
+        "user_id",
+        "scope",
+        "grant_type",
+        "code_hash",
+        "refresh_hash",
+        "expired_at",
+        "refresh_expired_at"
+    )
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);`
+
+    if _, err := r.db.ExecContext(
+        ctx,
+        query,
+        req.Id,
+        req.ClientId,
+        req.UserId,
+        req.Scope,
+        req.GrantType,
+        req.CodeHash,
+        refreshHash,
+        req.ExpiredAt,
+        req.RefreshExpiredAt,
+    ); err != nil {
+        return fmt.Errorf("insert token failed: %v", err)
+    }
+    return nil
+}
+
+// tokenQuery is columns of token row
+const tokenQuery = `
+    SELECT
+        "id",
+        "client_id",
+        "user_id",
+        "scope",
+        "grant_type",
+        "code_hash",
+        "expired_at",
+        "refresh_expired_at",
+        "revoked_at",
+        "created_at"
+    FROM "oauth2_tokens"`
+
+// FindRefreshToken return "token not found" when refresh token is unknown
+func (r *oauth2Repository) FindRefreshToken(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+    query := tokenQuery + `
+    WHERE "refresh_hash" = $1;`
+
+    token := new(oauth2.Token)
+    if err := r.db.GetContext(ctx, token, query, wymjauth.HashToken(refreshToken)); err != nil {
+        if errors.Is(err, sql.ErrNoRows) {
+            return nil, fmt.Errorf("token not found")
+        }
+        return nil, fmt.Errorf("get token failed: %v", err)
+    }
+    return token, nil
+}
+
+func (r *oauth2Repository) FindOneToken(ctx context.Context, tokenId string) (*oauth2.Token, error) {
+    query := tokenQuery + `
+    WHERE "id" = $1;`
+
+    token := new(oauth2.Token)
+    if err := r.db.GetContext(ctx, token, query, tokenId); err != nil {
+        if errors.Is(err, sql.ErrNoRows) {
+            return nil, fmt.Errorf("token not found")
+        }
+        return nil, fmt.Errorf("get token failed: %v", err)
+    }
+    return token, nil
+}
+
+// RevokeToken return "token has been revoked" when token is already revoked so refresh
+// token can not be rotated twice
+func (r *oauth2Repository) RevokeToken(ctx context.Context, tokenId string) error {
+    query := `
+    UPDATE "oauth2_tokens" SET
+        "revoked_at" = NOW()
+    WHERE "id" = $1
+    AND "revoked_at" IS NULL;`
+
+    result, err := r.db.ExecContext(ctx, query, tokenId)
+    if err != nil {
+        return fmt.Errorf("revoke token failed: %v", err)
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return fmt.Errorf("token has been revoked")
+    }
+    return nil
+}
+
+// RevokeTokenByCode revoke every token that came from the code, it is called when code is replayed
+func (r *oauth2Repository) RevokeTokenByCode(ctx context.Context, code string) error {
+    query := `
+    UPDATE "oauth2_tokens" SET
+        "revoked_at" = NOW()
+    WHERE "code_hash" = $1
+    AND "revoked_at" IS NULL;`
+
+    if _, err := r.db.ExecContext(ctx, query, wymjauth.HashToken(code)); err != nil {
+        return fmt.Errorf("revoke code tokens failed: %v", err)
+    }
+    return nil
+}
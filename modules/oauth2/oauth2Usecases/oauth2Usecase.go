@@ -0,0 +1,586 @@
+package oauth2Usecases
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/modules/oauth2"
+	"github.com/ppp3ppj/wymj/modules/oauth2/oauth2Repositories"
+	"github.com/ppp3ppj/wymj/modules/users"
+	"github.com/ppp3ppj/wymj/pkg/wymjauth"
+	"github.com/ppp3ppj/wymj/pkg/wymjmetrics"
+	"github.com/ppp3ppj/wymj/pkg/wymjoidc"
+	"github.com/ppp3ppj/wymj/pkg/wymjtrace"
+)
+
+type IOAuth2Usecase interface {
+    InsertClient(ctx context.Context, req *oauth2.ClientReq, userId string) (*oauth2.ClientRes, error)
+    FindClient(ctx context.Context, userId string) ([]*oauth2.Client, error)
+    RevokeClient(ctx context.Context, clientId, userId string) error
+    FindConsent(ctx context.Context, userId string) ([]*oauth2.Consent, error)
+    DeleteConsent(ctx context.Context, userId, clientId string) error
+    FindAuthorize(ctx context.Context, req *oauth2.AuthorizeReq, userId string) (*oauth2.AuthorizeInfo, error)
+    Authorize(ctx context.Context, req *oauth2.AuthorizeReq, userId string) (*oauth2.AuthorizeRes, error)
+    AuthenticateClient(ctx context.Context, clientId, clientSecret string) (*oauth2.Client, error)
+    Token(ctx context.Context, req *oauth2.TokenReq, client *oauth2.Client) (*oauth2.TokenRes, error)
+    Introspect(ctx context.Context, req *oauth2.TokenHintReq, client *oauth2.Client) (*oauth2.IntrospectRes, error)
+    Revoke(ctx context.Context, req *oauth2.TokenHintReq, client *oauth2.Client) error
+}
+
+type oauth2Usecase struct {
+    cfg config.IConfig
+    oauth2Repository oauth2Repositories.IOAuth2Repository
+}
+
+func OAuth2Usecase(cfg config.IConfig, oauth2Repository oauth2Repositories.IOAuth2Repository) IOAuth2Usecase {
+    return &oauth2Usecase{
+        cfg: cfg,
+        oauth2Repository: oauth2Repository,
+    }
+}
+
+// InsertClient generate client id and secret, secret is returned only this time.
+// Client is confidential by default, public client (spa, mobile app) must use pkce
+func (u *oauth2Usecase) InsertClient(ctx context.Context, req *oauth2.ClientReq, userId string) (*oauth2.ClientRes, error) {
+    ctx, span := wymjtrace.Start(ctx, "oauth2Usecase.InsertClient")
+    defer span.End()
+
+    req.Name = strings.Trim(req.Name, " ")
+    if req.Name == "" {
+        return nil, fmt.Errorf("name is required")
+    }
+    confidential := req.Confidential == nil || *req.Confidential
+    if len(req.GrantTypes) == 0 {
+        req.GrantTypes = []string{oauth2.AuthorizationCodeGrant, oauth2.RefreshTokenGrant}
+    }
+    for _, grantType := range req.GrantTypes {
+        if !slices.Contains(oauth2.GrantTypes, grantType) {
+            return nil, fmt.Errorf("grant type %q is invalid", grantType)
+        }
+    }
+    if slices.Contains(req.GrantTypes, oauth2.ClientCredentialsGrant) && !confidential {
+        return nil, fmt.Errorf("public client can not use client_credentials")
+    }
+    if len(req.Scopes) == 0 {
+        req.Scopes = oauth2.Scopes
+    }
+    for _, scope := range req.Scopes {
+        if !slices.Contains(oauth2.Scopes, scope) {
+            return nil, fmt.Errorf("scope %q is invalid", scope)
+        }
+    }
+    if slices.Contains(req.GrantTypes, oauth2.AuthorizationCodeGrant) && len(req.RedirectUris) == 0 {
+        return nil, fmt.Errorf("redirect_uris is required")
+    }
+    if req.RedirectUris == nil {
+        req.RedirectUris = make([]string, 0)
+    }
+    for _, redirectUri := range req.RedirectUris {
+        if !u.validRedirectUri(redirectUri) {
+            return nil, fmt.Errorf("redirect uri %q is invalid", redirectUri)
+        }
+    }
+
+    clientId, err := wymjauth.RandomToken(16)
+    if err != nil {
+        return nil, err
+    }
+    secret := ""
+    if confidential {
+        if secret, err = wymjauth.RandomToken(32); err != nil {
+            return nil, err
+        }
+    }
+    client, err := u.oauth2Repository.InsertClient(ctx, req, clientId, userId, secret)
+    if err != nil {
+        return nil, err
+    }
+    return &oauth2.ClientRes{
+        Client: client,
+        ClientSecret: secret,
+    }, nil
+}
+
+// validRedirectUri allow https, http only for loopback (RFC 8252 7.3) and custom scheme
+// in config for native app, javascript: and data: are never allowed.
+// Uri must be absolute and is compared exactly, fragment is not allowed by RFC 6749 3.1.2
+func (u *oauth2Usecase) validRedirectUri(redirectUri string) bool {
+    uri, err := url.Parse(redirectUri)
+    if err != nil || !uri.IsAbs() || uri.Fragment != "" || strings.Contains(redirectUri, "#") {
+        return false
+    }
+    switch uri.Scheme {
+    case "https":
+        return uri.Host != ""
+    case "http":
+        host := uri.Hostname()
+        if host == "localhost" {
+            return true
+        }
+        ip := net.ParseIP(host)
+        return ip != nil && ip.IsLoopback()
+    default:
+        return slices.Contains(u.cfg.OAuth2().RedirectSchemes(), uri.Scheme)
+    }
+}
+
+func (u *oauth2Usecase) FindClient(ctx context.Context, userId string) ([]*oauth2.Client, error) {
+    ctx, span := wymjtrace.Start(ctx, "oauth2Usecase.FindClient")
+    defer span.End()
+
+    clients, err := u.oauth2Repository.FindClient(ctx, userId)
+    if err != nil {
+        return nil, err
+    }
+    return clients, nil
+}
+
+func (u *oauth2Usecase) RevokeClient(ctx context.Context, clientId, userId string) error {
+    ctx, span := wymjtrace.Start(ctx, "oauth2Usecase.RevokeClient")
+    defer span.End()
+
+    if err := u.oauth2Repository.RevokeClient(ctx, clientId, userId); err != nil {
+        return err
+    }
+    return nil
+}
+
+func (u *oauth2Usecase) FindConsent(ctx context.Context, userId string) ([]*oauth2.Consent, error) {
+    ctx, span := wymjtrace.Start(ctx, "oauth2Usecase.FindConsent")
+    defer span.End()
+
+    consents, err := u.oauth2Repository.FindConsent(ctx, userId)
+    if err != nil {
+        return nil, err
+    }
+    return consents, nil
+}
+
+func (u *oauth2Usecase) DeleteConsent(ctx context.Context, userId, clientId string) error {
+    ctx, span := wymjtrace.Start(ctx, "oauth2Usecase.DeleteConsent")
+    defer span.End()
+
+    if err := u.oauth2Repository.DeleteConsent(ctx, userId, clientId); err != nil {
+        return err
+    }
+    return nil
+}
+
+// validateAuthorize check authorization request and fill default redirect uri and scope
+func (u *oauth2Usecase) validateAuthorize(ctx context.Context, req *oauth2.AuthorizeReq) (*oauth2.Client, []string, error) {
+    if req.ResponseType != "code" {
+        return nil, nil, fmt.Errorf("response_type is not supported")
+    }
+    client, err := u.oauth2Repository.FindOneClient(ctx, req.ClientId)
+    if err != nil {
+        return nil, nil, err
+    }
+    if !slices.Contains(client.GrantTypes, oauth2.AuthorizationCodeGrant) {
+        return nil, nil, fmt.Errorf("client is not allowed to use authorization_code")
+    }
+    if req.RedirectUri == "" && len(client.RedirectUris) == 1 {
+        req.RedirectUri = client.RedirectUris[0]
+    }
+    if !slices.Contains(client.RedirectUris, req.RedirectUri) {
+        return nil, nil, fmt.Errorf("redirect_uri is invalid")
+    }
+
+    scopes := strings.Fields(req.Scope)
+    if len(scopes) == 0 {
+        scopes = client.Scopes
+    }
+    for _, scope := range scopes {
+        if !slices.Contains(client.Scopes, scope) {
+            return nil, nil, fmt.Errorf("scope %q is invalid", scope)
+        }
+    }
+    req.Scope = strings.Join(scopes, " ")
+
+    // only S256 is accepted, plain challenge does not protect the code
+    if req.CodeChallenge != "" && req.CodeChallengeMethod != "S256" {
+        return nil, nil, fmt.Errorf("code_challenge_method must be S256")
+    }
+    if req.CodeChallenge == "" && !client.Confidential {
+        return nil, nil, fmt.Errorf("code_challenge is required for public client")
+    }
+    return client, scopes, nil
+}
+
+// FindAuthorize is used by consent page to show client and requested scopes
+func (u *oauth2Usecase) FindAuthorize(ctx context.Context, req *oauth2.AuthorizeReq, userId string) (*oauth2.AuthorizeInfo, error) {
+    ctx, span := wymjtrace.Start(ctx, "oauth2Usecase.FindAuthorize")
+    defer span.End()
+
+    client, scopes, err := u.validateAuthorize(ctx, req)
+    if err != nil {
+        return nil, err
+    }
+    consent, err := u.oauth2Repository.FindOneConsent(ctx, userId, client.Id)
+    if err != nil {
+        return nil, err
+    }
+    granted := strings.Fields(consent)
+    consented := true
+    for _, scope := range scopes {
+        if !slices.Contains(granted, scope) {
+            consented = false
+            break
+        }
+    }
+    return &oauth2.AuthorizeInfo{
+        ClientId: client.Id,
+        ClientName: client.Name,
+        RedirectUri: req.RedirectUri,
+        Scopes: scopes,
+        Consented: consented,
+    }, nil
+}
+
+// Authorize record consent and issue code when user approve, redirect uri carry
+// code or access_denied error and state back to client
+func (u *oauth2Usecase) Authorize(ctx context.Context, req *oauth2.AuthorizeReq, userId string) (*oauth2.AuthorizeRes, error) {
+    ctx, span := wymjtrace.Start(ctx, "oauth2Usecase.Authorize")
+    defer span.End()
+
+    // validateAuthorize fill redirect_uri, token request must repeat it only when client sent it
+    redirectUriSent := req.RedirectUri != ""
+    client, scopes, err := u.validateAuthorize(ctx, req)
+    if err != nil {
+        return nil, err
+    }
+
+    query := url.Values{}
+    if req.State != "" {
+        query.Set("state", req.State)
+    }
+    if !req.Approve {
+        query.Set("error", "access_denied")
+        query.Set("error_description", "user denied the request")
+        return &oauth2.AuthorizeRes{
+            RedirectUri: withQuery(req.RedirectUri, query),
+        }, nil
+    }
+
+    // consent keep scopes that were granted before so user is not asked again
+    consent, err := u.oauth2Repository.FindOneConsent(ctx, userId, client.Id)
+    if err != nil {
+        return nil, err
+    }
+    granted := strings.Fields(consent)
+    for _, scope := range scopes {
+        if !slices.Contains(granted, scope) {
+            granted = append(granted, scope)
+        }
+    }
+    if err := u.oauth2Repository.UpsertConsent(ctx, userId, client.Id, strings.Join(granted, " ")); err != nil {
+        return nil, err
+    }
+
+    code, err := wymjauth.RandomToken(32)
+    if err != nil {
+        return nil, err
+    }
+    if err := u.oauth2Repository.InsertCode(ctx, code, &oauth2.Code{
+        ClientId: client.Id,
+        UserId: userId,
+        RedirectUri: req.RedirectUri,
+        RedirectUriSent: redirectUriSent,
+        Scope: req.Scope,
+        CodeChallenge: req.CodeChallenge,
+    }, time.Now().Add(time.Duration(u.cfg.OAuth2().CodeExpireAt())*time.Second)); err != nil {
+        return nil, err
+    }
+    query.Set("code", code)
+    return &oauth2.AuthorizeRes{
+        RedirectUri: withQuery(req.RedirectUri, query),
+    }, nil
+}
+
+func withQuery(rawUrl string, query url.Values) string {
+    uri, err := url.Parse(rawUrl)
+    if err != nil {
+        return rawUrl
+    }
+    values := uri.Query()
+    for k, v := range query {
+        values[k] = v
+    }
+    uri.RawQuery = values.Encode()
+    return uri.String()
+}
+
+// AuthenticateClient check secret of confidential client, public client send only client id
+func (u *oauth2Usecase) AuthenticateClient(ctx context.Context, clientId, clientSecret string) (*oauth2.Client, error) {
+    ctx, span := wymjtrace.Start(ctx, "oauth2Usecase.AuthenticateClient")
+    defer span.End()
+
+    if clientId == "" {
+        return nil, oauth2.NewError("invalid_client", "client authentication is required")
+    }
+    secretHash, err := u.oauth2Repository.FindClientSecretHash(ctx, clientId)
+    if err != nil {
+        if err.Error() == "client not found" {
+            return nil, oauth2.NewError("invalid_client", "client authentication failed")
+        }
+        return nil, err
+    }
+    if secretHash != "" && subtle.ConstantTimeCompare([]byte(secretHash), []byte(wymjauth.HashToken(clientSecret))) != 1 {
+        return nil, oauth2.NewError("invalid_client", "client authentication failed")
+    }
+    if secretHash == "" && clientSecret != "" {
+        return nil, oauth2.NewError("invalid_client", "client authentication failed")
+    }
+    return u.oauth2Repository.FindOneClient(ctx, clientId)
+}
+
+// Token is token endpoint (RFC 6749 section 4.1.3, 4.4 and 6), error is *oauth2.Error
+// when request is rejected
+func (u *oauth2Usecase) Token(ctx context.Context, req *oauth2.TokenReq, client *oauth2.Client) (*oauth2.TokenRes, error) {
+    ctx, span := wymjtrace.Start(ctx, "oauth2Usecase.Token")
+    defer span.End()
+
+    if !slices.Contains(oauth2.GrantTypes, req.GrantType) {
+        return nil, oauth2.NewError("unsupported_grant_type", "grant_type is not supported")
+    }
+    if !slices.Contains(client.GrantTypes, req.GrantType) {
+        return nil, oauth2.NewError("unauthorized_client", "client is not allowed to use "+req.GrantType)
+    }
+
+    switch req.GrantType {
+    case oauth2.AuthorizationCodeGrant:
+        return u.authorizationCodeToken(ctx, req, client)
+    case oauth2.RefreshTokenGrant:
+        token, err := u.refreshToken(ctx, req, client)
+        wymjmetrics.TokenRefreshed(wymjmetrics.OAuth2Client, err == nil)
+        return token, err
+    default:
+        return u.clientCredentialsToken(ctx, req, client)
+    }
+}
+
+func (u *oauth2Usecase) authorizationCodeToken(ctx context.Context, req *oauth2.TokenReq, client *oauth2.Client) (*oauth2.TokenRes, error) {
+    if req.Code == "" {
+        return nil, oauth2.NewError("invalid_request", "code is required")
+    }
+    code, err := u.oauth2Repository.UseCode(ctx, req.Code)
+    if err != nil {
+        switch err.Error() {
+        case "code has been used":
+            // code may be stolen, tokens that came from it are revoked (RFC 6749 section 4.1.2)
+            if err := u.oauth2Repository.RevokeTokenByCode(ctx, req.Code); err != nil {
+                return nil, err
+            }
+            return nil, oauth2.NewError("invalid_grant", err.Error())
+        case "code is invalid":
+            return nil, oauth2.NewError("invalid_grant", err.Error())
+        default:
+            return nil, err
+        }
+    }
+    if code.ClientId != client.Id {
+        return nil, oauth2.NewError("invalid_grant", "code is invalid")
+    }
+    // redirect_uri must be sent again when it was included in authorize (RFC 6749 4.1.3),
+    // one that is sent anyway must still match
+    if (code.RedirectUriSent || req.RedirectUri != "") && req.RedirectUri != code.RedirectUri {
+        return nil, oauth2.NewError("invalid_grant", "redirect_uri does not match")
+    }
+    if code.CodeChallenge != "" {
+        if req.CodeVerifier == "" {
+            return nil, oauth2.NewError("invalid_grant", "code_verifier is required")
+        }
+        if subtle.ConstantTimeCompare([]byte(wymjoidc.CodeChallenge(req.CodeVerifier)), []byte(code.CodeChallenge)) != 1 {
+            return nil, oauth2.NewError("invalid_grant", "code_verifier is invalid")
+        }
+    }
+    return u.issueToken(ctx, client, code.UserId, code.Scope, oauth2.AuthorizationCodeGrant, &code.CodeHash)
+}
+
+// refreshToken rotate refresh token, old one is revoked and can not be used again
+func (u *oauth2Usecase) refreshToken(ctx context.Context, req *oauth2.TokenReq, client *oauth2.Client) (*oauth2.TokenRes, error) {
+    if req.RefreshToken == "" {
+        return nil, oauth2.NewError("invalid_request", "refresh_token is required")
+    }
+    token, err := u.oauth2Repository.FindRefreshToken(ctx, req.RefreshToken)
+    if err != nil {
+        if err.Error() == "token not found" {
+            return nil, oauth2.NewError("invalid_grant", "refresh_token is invalid")
+        }
+        return nil, err
+    }
+    if token.ClientId != client.Id || token.RevokedAt != nil ||
+        token.RefreshExpiredAt == nil || token.RefreshExpiredAt.Before(time.Now()) {
+        return nil, oauth2.NewError("invalid_grant", "refresh_token is invalid")
+    }
+
+    // scope can only be narrowed (RFC 6749 section 6)
+    granted := strings.Fields(token.Scope)
+    scope := token.Scope
+    if req.Scope != "" {
+        for _, s := range strings.Fields(req.Scope) {
+            if !slices.Contains(granted, s) {
+                return nil, oauth2.NewError("invalid_scope", fmt.Sprintf("scope %q is not granted", s))
+            }
+        }
+        scope = strings.Join(strings.Fields(req.Scope), " ")
+    }
+
+    if err := u.oauth2Repository.RevokeToken(ctx, token.Id); err != nil {
+        if err.Error() == "token has been revoked" {
+            return nil, oauth2.NewError("invalid_grant", "refresh_token is invalid")
+        }
+        return nil, err
+    }
+    return u.issueToken(ctx, client, token.UserId, scope, token.GrantType, token.CodeHash)
+}
+
+// clientCredentialsToken act as owner of the client, no refresh token is issued
+func (u *oauth2Usecase) clientCredentialsToken(ctx context.Context, req *oauth2.TokenReq, client *oauth2.Client) (*oauth2.TokenRes, error) {
+    if !client.Confidential {
+        return nil, oauth2.NewError("unauthorized_client", "public client can not use client_credentials")
+    }
+    scopes := strings.Fields(req.Scope)
+    if len(scopes) == 0 {
+        scopes = client.Scopes
+    }
+    for _, scope := range scopes {
+        if !slices.Contains(client.Scopes, scope) {
+            return nil, oauth2.NewError("invalid_scope", fmt.Sprintf("scope %q is invalid", scope))
+        }
+    }
+    return u.issueToken(ctx, client, client.UserId, strings.Join(scopes, " "), oauth2.ClientCredentialsGrant, nil)
+}
+
+// issueToken sign access token with jti of new token row, refresh token is opaque
+func (u *oauth2Usecase) issueToken(ctx context.Context, client *oauth2.Client, userId, scope, grantType string, codeHash *string) (*oauth2.TokenRes, error) {
+    now := time.Now()
+    token := &oauth2.Token{
+        Id: uuid.NewString(),
+        ClientId: client.Id,
+        UserId: userId,
+        Scope: scope,
+        GrantType: grantType,
+        CodeHash: codeHash,
+        ExpiredAt: now.Add(time.Duration(u.cfg.Jwt().AccessExpireAt()) * time.Second),
+    }
+
+    refreshToken := ""
+    if grantType != oauth2.ClientCredentialsGrant && slices.Contains(client.GrantTypes, oauth2.RefreshTokenGrant) {
+        var err error
+        if refreshToken, err = wymjauth.RandomToken(32); err != nil {
+            return nil, err
+        }
+        refreshExpiredAt := now.Add(time.Duration(u.cfg.Jwt().RefreshExpireAt()) * time.Second)
+        token.RefreshExpiredAt = &refreshExpiredAt
+    }
+    if err := u.oauth2Repository.InsertToken(ctx, token, refreshToken); err != nil {
+        return nil, err
+    }
+
+    return &oauth2.TokenRes{
+        AccessToken: wymjauth.ClientToken(u.cfg.Jwt(), &users.UserClaims{
+            Id: userId,
+            Scope: scope,
+            ClientId: client.Id,
+        }, token.Id),
+        TokenType: "Bearer",
+        ExpiresIn: u.cfg.Jwt().AccessExpireAt(),
+        RefreshToken: refreshToken,
+        Scope: scope,
+    }, nil
+}
+
+// findToken find row of access or refresh token, nil when token is unknown or is not of client.
+// isAccess is true when token is access token
+func (u *oauth2Usecase) findToken(ctx context.Context, req *oauth2.TokenHintReq, client *oauth2.Client) (*oauth2.Token, bool, error) {
+    var token *oauth2.Token
+    var err error
+    // hint is only an optimization, the other type is also checked (RFC 7009 section 2.1)
+    claims, parseErr := wymjauth.ParseClientToken(u.cfg.Jwt(), req.Token)
+    isAccess := parseErr == nil
+    if isAccess {
+        token, err = u.oauth2Repository.FindOneToken(ctx, claims.ID)
+    } else {
+        token, err = u.oauth2Repository.FindRefreshToken(ctx, req.Token)
+    }
+    if err != nil {
+        if err.Error() == "token not found" {
+            return nil, false, nil
+        }
+        return nil, false, err
+    }
+    if token.ClientId != client.Id {
+        return nil, false, nil
+    }
+    return token, isAccess, nil
+}
+
+// Introspect is RFC 7662, client can only introspect its own tokens
+func (u *oauth2Usecase) Introspect(ctx context.Context, req *oauth2.TokenHintReq, client *oauth2.Client) (*oauth2.IntrospectRes, error) {
+    ctx, span := wymjtrace.Start(ctx, "oauth2Usecase.Introspect")
+    defer span.End()
+
+    if req.Token == "" {
+        return nil, oauth2.NewError("invalid_request", "token is required")
+    }
+    token, isAccess, err := u.findToken(ctx, req, client)
+    if err != nil {
+        return nil, err
+    }
+    if token == nil || token.RevokedAt != nil {
+        return &oauth2.IntrospectRes{Active: false}, nil
+    }
+
+    // access token expire before refresh token, report expiry of the token that was sent
+    expiredAt := token.ExpiredAt
+    tokenType := "access_token"
+    if !isAccess {
+        if token.RefreshExpiredAt == nil {
+            return &oauth2.IntrospectRes{Active: false}, nil
+        }
+        expiredAt = *token.RefreshExpiredAt
+        tokenType = "refresh_token"
+    }
+    if expiredAt.Before(time.Now()) {
+        return &oauth2.IntrospectRes{Active: false}, nil
+    }
+    return &oauth2.IntrospectRes{
+        Active: true,
+        Scope: token.Scope,
+        ClientId: token.ClientId,
+        Sub: token.UserId,
+        TokenType: tokenType,
+        Exp: expiredAt.Unix(),
+        Iat: token.CreatedAt.Unix(),
+    }, nil
+}
+
+// Revoke is RFC 7009, unknown token is not an error. Access and refresh token share
+// one row so revoking either revoke both
+func (u *oauth2Usecase) Revoke(ctx context.Context, req *oauth2.TokenHintReq, client *oauth2.Client) error {
+    ctx, span := wymjtrace.Start(ctx, "oauth2Usecase.Revoke")
+    defer span.End()
+
+    if req.Token == "" {
+        return oauth2.NewError("invalid_request", "token is required")
+    }
+    token, _, err := u.findToken(ctx, req, client)
+    if err != nil {
+        return err
+    }
+    if token == nil || token.RevokedAt != nil {
+        return nil
+    }
+    if err := u.oauth2Repository.RevokeToken(ctx, token.Id); err != nil && err.Error() != "token has been revoked" {
+        return err
+    }
+    return nil
+}
@@ -0,0 +1,180 @@
+package oauth2Usecases
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/modules/oauth2"
+	"github.com/ppp3ppj/wymj/modules/oauth2/oauth2Repositories"
+)
+
+type testConfig struct {
+    config.IConfig
+}
+
+type testOAuth2Config struct {
+    config.IOAuth2config
+}
+
+type testJwtConfig struct {
+    config.IJwtconfig
+}
+
+func (testConfig) OAuth2() config.IOAuth2config { return testOAuth2Config{} }
+func (testConfig) Jwt() config.IJwtconfig { return testJwtConfig{} }
+func (testOAuth2Config) RedirectSchemes() []string { return []string{"com.example.app"} }
+func (testOAuth2Config) CodeExpireAt() int { return 60 }
+func (testJwtConfig) SecretKey() []byte { return []byte("secret") }
+func (testJwtConfig) AccessExpireAt() int { return 60 }
+func (testJwtConfig) RefreshExpireAt() int { return 60 }
+func (testJwtConfig) KeyFiles() map[string]string { return nil }
+func (testJwtConfig) ActiveKid() string { return "" }
+
+type testRepository struct {
+    oauth2Repositories.IOAuth2Repository
+    code *oauth2.Code
+}
+
+func (r *testRepository) InsertClient(ctx context.Context, req *oauth2.ClientReq, clientId, userId, secret string) (*oauth2.Client, error) {
+    return &oauth2.Client{Id: clientId, RedirectUris: req.RedirectUris}, nil
+}
+
+func (r *testRepository) FindOneClient(ctx context.Context, clientId string) (*oauth2.Client, error) {
+    return &oauth2.Client{
+        Id: clientId,
+        GrantTypes: []string{oauth2.AuthorizationCodeGrant},
+        RedirectUris: []string{"https://app.example.com/callback"},
+        Scopes: []string{"profile"},
+        Confidential: true,
+    }, nil
+}
+
+func (r *testRepository) FindOneConsent(ctx context.Context, userId, clientId string) (string, error) {
+    return "", nil
+}
+
+func (r *testRepository) UpsertConsent(ctx context.Context, userId, clientId, scope string) error {
+    return nil
+}
+
+func (r *testRepository) InsertCode(ctx context.Context, code string, req *oauth2.Code, expiredAt time.Time) error {
+    r.code = req
+    return nil
+}
+
+func (r *testRepository) UseCode(ctx context.Context, code string) (*oauth2.Code, error) {
+    return r.code, nil
+}
+
+func (r *testRepository) InsertToken(ctx context.Context, token *oauth2.Token, refreshToken string) error {
+    return nil
+}
+
+func TestInsertClientRedirectUri(t *testing.T) {
+    tests := []struct {
+        redirectUri string
+        valid bool
+    }{
+        {"https://app.example.com/callback", true},
+        {"http://localhost:8080/callback", true},
+        {"http://127.0.0.1:53111/callback", true},
+        {"http://[::1]/callback", true},
+        {"com.example.app:/callback", true},
+        {"http://app.example.com/callback", false},
+        {"http://localhost.example.com/callback", false},
+        {"https:///callback", false},
+        {"https://app.example.com/callback#", false},
+        {"https://app.example.com/callback#token", false},
+        {"javascript:alert(document.cookie)", false},
+        {"JavaScript://app.example.com/%0aalert(1)", false},
+        {"data:text/html,<script>alert(1)</script>", false},
+        {"com.other.app:/callback", false},
+        {"/callback", false},
+    }
+    usecase := OAuth2Usecase(testConfig{}, &testRepository{})
+    for _, tt := range tests {
+        t.Run(tt.redirectUri, func(t *testing.T) {
+            _, err := usecase.InsertClient(context.Background(), &oauth2.ClientReq{
+                Name: "client",
+                RedirectUris: []string{tt.redirectUri},
+            }, "U000001")
+            if tt.valid && err != nil {
+                t.Errorf("insert client: %v", err)
+            }
+            if !tt.valid && err == nil {
+                t.Errorf("redirect uri %q is accepted", tt.redirectUri)
+            }
+        })
+    }
+}
+
+func TestAuthorizationCodeRedirectUri(t *testing.T) {
+    tests := []struct {
+        name string
+        redirectUriSent bool
+        reqRedirectUri string
+        valid bool
+    }{
+        {"same redirect uri", true, "https://app.example.com/callback", true},
+        {"redirect uri is missing", true, "", false},
+        {"other redirect uri", true, "https://app.example.com/other", false},
+        {"redirect uri was not sent in authorize", false, "", true},
+        {"registered redirect uri when it was not sent", false, "https://app.example.com/callback", true},
+        {"other redirect uri when it was not sent", false, "https://app.example.com/other", false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            client := &oauth2.Client{Id: "C1", GrantTypes: []string{oauth2.AuthorizationCodeGrant}}
+            repository := &testRepository{code: &oauth2.Code{ClientId: "C1", UserId: "U000001", RedirectUri: "https://app.example.com/callback", RedirectUriSent: tt.redirectUriSent}}
+            usecase := OAuth2Usecase(testConfig{}, repository)
+
+            _, err := usecase.Token(context.Background(), &oauth2.TokenReq{
+                GrantType: oauth2.AuthorizationCodeGrant,
+                Code: "code",
+                RedirectUri: tt.reqRedirectUri,
+            }, client)
+            if tt.valid {
+                if err != nil {
+                    t.Fatalf("token: %v", err)
+                }
+                return
+            }
+            var oauth2Err *oauth2.Error
+            if !errors.As(err, &oauth2Err) || oauth2Err.Code != "invalid_grant" {
+                t.Errorf("error = %v, want invalid_grant", err)
+            }
+        })
+    }
+}
+
+func TestAuthorizeRedirectUriSent(t *testing.T) {
+    tests := []struct {
+        name string
+        redirectUri string
+        wantSent bool
+    }{
+        {"redirect uri is sent", "https://app.example.com/callback", true},
+        {"registered redirect uri is used", "", false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            repository := &testRepository{}
+            usecase := OAuth2Usecase(testConfig{}, repository)
+
+            if _, err := usecase.Authorize(context.Background(), &oauth2.AuthorizeReq{
+                ResponseType: "code",
+                ClientId: "C1",
+                RedirectUri: tt.redirectUri,
+                Approve: true,
+            }, "U000001"); err != nil {
+                t.Fatalf("authorize: %v", err)
+            }
+            if repository.code.RedirectUri != "https://app.example.com/callback" || repository.code.RedirectUriSent != tt.wantSent {
+                t.Errorf("code = %+v", repository.code)
+            }
+        })
+    }
+}
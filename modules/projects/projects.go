@@ -0,0 +1,29 @@
+package projects
+
+type Category struct {
+    Id int `db:"id" json:"id"`
+    Name string `db:"name" json:"name" form:"name"`
+}
+
+type Project struct {
+    Id int `db:"id" json:"id"`
+    Name string `db:"name" json:"name"`
+    Category *Category `db:"category" json:"category"`
+}
+
+type ProjectReq struct {
+    Id int `db:"id" json:"-"`
+    Name string `db:"name" json:"name" form:"name"`
+    CategoryId int `db:"category_id" json:"category_id" form:"category_id"`
+}
+
+type ProjectMember struct {
+    UserId string `db:"user_id" json:"user_id"`
+    Username string `db:"username" json:"username"`
+    Email string `db:"email" json:"email"`
+}
+
+type ProjectMemberReq struct {
+    ProjectId int `db:"project_id" json:"-"`
+    UserId string `db:"user_id" json:"user_id" form:"user_id"`
+}
@@ -0,0 +1,346 @@
+package projectsHandlers
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/modules/entities"
+	"github.com/ppp3ppj/wymj/modules/projects"
+	"github.com/ppp3ppj/wymj/modules/projects/projectsUsecases"
+	"github.com/ppp3ppj/wymj/modules/roles"
+)
+
+type projectsHandlerErrCode string
+
+const (
+    findCategoryErr projectsHandlerErrCode = "projects-001"
+    insertCategoryErr projectsHandlerErrCode = "projects-002"
+    updateCategoryErr projectsHandlerErrCode = "projects-003"
+    deleteCategoryErr projectsHandlerErrCode = "projects-004"
+    findOneProjectErr projectsHandlerErrCode = "projects-005"
+    findProjectErr projectsHandlerErrCode = "projects-006"
+    findMyProjectErr projectsHandlerErrCode = "projects-007"
+    insertProjectErr projectsHandlerErrCode = "projects-008"
+    updateProjectErr projectsHandlerErrCode = "projects-009"
+    deleteProjectErr projectsHandlerErrCode = "projects-010"
+    findMemberErr projectsHandlerErrCode = "projects-011"
+    insertMemberErr projectsHandlerErrCode = "projects-012"
+    deleteMemberErr projectsHandlerErrCode = "projects-013"
+)
+
+type IProjectsHandler interface {
+    FindCategory(c *fiber.Ctx) error
+    InsertCategory(c *fiber.Ctx) error
+    UpdateCategory(c *fiber.Ctx) error
+    DeleteCategory(c *fiber.Ctx) error
+    FindOneProject(c *fiber.Ctx) error
+    FindProject(c *fiber.Ctx) error
+    FindMyProject(c *fiber.Ctx) error
+    InsertProject(c *fiber.Ctx) error
+    UpdateProject(c *fiber.Ctx) error
+    DeleteProject(c *fiber.Ctx) error
+    FindMember(c *fiber.Ctx) error
+    InsertMember(c *fiber.Ctx) error
+    DeleteMember(c *fiber.Ctx) error
+}
+
+type projectsHandler struct {
+    cfg config.IConfig
+    projectsUsecase projectsUsecases.IProjectsUsecase
+}
+
+func ProjectsHandler(cfg config.IConfig, projectsUsecase projectsUsecases.IProjectsUsecase) IProjectsHandler {
+    return &projectsHandler{
+        cfg: cfg,
+        projectsUsecase: projectsUsecase,
+    }
+}
+
+func (h *projectsHandler) projectErrRes(c *fiber.Ctx, code projectsHandlerErrCode, err error) error {
+    switch {
+    case strings.HasSuffix(err.Error(), "sql: no rows in result set"),
+        strings.HasSuffix(err.Error(), "not found"):
+        return entities.NewResponse(c).Error(
+            fiber.ErrNotFound.Code,
+            string(code),
+            err.Error(),
+        ).Res()
+    case err.Error() == "no permission to access":
+        return entities.NewResponse(c).Error(
+            fiber.ErrUnauthorized.Code,
+            string(code),
+            err.Error(),
+        ).Res()
+    case err.Error() == "category name has been used",
+        err.Error() == "category is used by projects",
+        err.Error() == "user is already a member":
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(code),
+            err.Error(),
+        ).Res()
+    default:
+        return entities.NewResponse(c).Error(
+            fiber.ErrInternalServerError.Code,
+            string(code),
+            err.Error(),
+        ).Res()
+    }
+}
+
+func (h *projectsHandler) FindCategory(c *fiber.Ctx) error {
+    categories, err := h.projectsUsecase.FindCategory(c.UserContext())
+    if err != nil {
+        return h.projectErrRes(c, findCategoryErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, categories).Res()
+}
+
+func (h *projectsHandler) InsertCategory(c *fiber.Ctx) error {
+    req := new(projects.Category)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(insertCategoryErr),
+            err.Error(),
+        ).Res()
+    }
+    if strings.Trim(req.Name, " ") == "" {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(insertCategoryErr),
+            "name is required",
+        ).Res()
+    }
+
+    category, err := h.projectsUsecase.InsertCategory(c.UserContext(), req)
+    if err != nil {
+        return h.projectErrRes(c, insertCategoryErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusCreated, category).Res()
+}
+
+func (h *projectsHandler) UpdateCategory(c *fiber.Ctx) error {
+    categoryId, err := c.ParamsInt("category_id")
+    if err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(updateCategoryErr),
+            "category_id is invalid",
+        ).Res()
+    }
+    req := new(projects.Category)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(updateCategoryErr),
+            err.Error(),
+        ).Res()
+    }
+    if strings.Trim(req.Name, " ") == "" {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(updateCategoryErr),
+            "name is required",
+        ).Res()
+    }
+    req.Id = categoryId
+
+    category, err := h.projectsUsecase.UpdateCategory(c.UserContext(), req)
+    if err != nil {
+        return h.projectErrRes(c, updateCategoryErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, category).Res()
+}
+
+func (h *projectsHandler) DeleteCategory(c *fiber.Ctx) error {
+    categoryId, err := c.ParamsInt("category_id")
+    if err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(deleteCategoryErr),
+            "category_id is invalid",
+        ).Res()
+    }
+
+    if err := h.projectsUsecase.DeleteCategory(c.UserContext(), categoryId); err != nil {
+        return h.projectErrRes(c, deleteCategoryErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+func (h *projectsHandler) FindOneProject(c *fiber.Ctx) error {
+    projectId, err := c.ParamsInt("project_id")
+    if err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(findOneProjectErr),
+            "project_id is invalid",
+        ).Res()
+    }
+    userId, _ := c.Locals("userId").(string)
+
+    project, err := h.projectsUsecase.FindOneProject(c.UserContext(), projectId, userId, roles.HasPermission(c, roles.ProjectsAdmin))
+    if err != nil {
+        return h.projectErrRes(c, findOneProjectErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, project).Res()
+}
+
+func (h *projectsHandler) FindProject(c *fiber.Ctx) error {
+    projectsData, err := h.projectsUsecase.FindProject(c.UserContext())
+    if err != nil {
+        return h.projectErrRes(c, findProjectErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, projectsData).Res()
+}
+
+func (h *projectsHandler) FindMyProject(c *fiber.Ctx) error {
+    userId, _ := c.Locals("userId").(string)
+
+    projectsData, err := h.projectsUsecase.FindMyProject(c.UserContext(), userId)
+    if err != nil {
+        return h.projectErrRes(c, findMyProjectErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, projectsData).Res()
+}
+
+func (h *projectsHandler) InsertProject(c *fiber.Ctx) error {
+    req := new(projects.ProjectReq)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(insertProjectErr),
+            err.Error(),
+        ).Res()
+    }
+    if strings.Trim(req.Name, " ") == "" {
+        req.Name = "Untitled"
+    }
+    if req.CategoryId < 1 {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(insertProjectErr),
+            "category_id is required",
+        ).Res()
+    }
+
+    project, err := h.projectsUsecase.InsertProject(c.UserContext(), req)
+    if err != nil {
+        return h.projectErrRes(c, insertProjectErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusCreated, project).Res()
+}
+
+func (h *projectsHandler) UpdateProject(c *fiber.Ctx) error {
+    projectId, err := c.ParamsInt("project_id")
+    if err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(updateProjectErr),
+            "project_id is invalid",
+        ).Res()
+    }
+    req := new(projects.ProjectReq)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(updateProjectErr),
+            err.Error(),
+        ).Res()
+    }
+    req.Id = projectId
+
+    project, err := h.projectsUsecase.UpdateProject(c.UserContext(), req)
+    if err != nil {
+        return h.projectErrRes(c, updateProjectErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, project).Res()
+}
+
+func (h *projectsHandler) DeleteProject(c *fiber.Ctx) error {
+    projectId, err := c.ParamsInt("project_id")
+    if err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(deleteProjectErr),
+            "project_id is invalid",
+        ).Res()
+    }
+
+    if err := h.projectsUsecase.DeleteProject(c.UserContext(), projectId); err != nil {
+        return h.projectErrRes(c, deleteProjectErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+func (h *projectsHandler) FindMember(c *fiber.Ctx) error {
+    projectId, err := c.ParamsInt("project_id")
+    if err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(findMemberErr),
+            "project_id is invalid",
+        ).Res()
+    }
+
+    members, err := h.projectsUsecase.FindMember(c.UserContext(), projectId)
+    if err != nil {
+        return h.projectErrRes(c, findMemberErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, members).Res()
+}
+
+func (h *projectsHandler) InsertMember(c *fiber.Ctx) error {
+    projectId, err := c.ParamsInt("project_id")
+    if err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(insertMemberErr),
+            "project_id is invalid",
+        ).Res()
+    }
+    req := new(projects.ProjectMemberReq)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(insertMemberErr),
+            err.Error(),
+        ).Res()
+    }
+    if strings.Trim(req.UserId, " ") == "" {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(insertMemberErr),
+            "user_id is required",
+        ).Res()
+    }
+    req.ProjectId = projectId
+
+    members, err := h.projectsUsecase.InsertMember(c.UserContext(), req)
+    if err != nil {
+        return h.projectErrRes(c, insertMemberErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusCreated, members).Res()
+}
+
+func (h *projectsHandler) DeleteMember(c *fiber.Ctx) error {
+    projectId, err := c.ParamsInt("project_id")
+    if err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(deleteMemberErr),
+            "project_id is invalid",
+        ).Res()
+    }
+    req := &projects.ProjectMemberReq{
+        ProjectId: projectId,
+        UserId: strings.Trim(c.Params("user_id"), " "),
+    }
+
+    if err := h.projectsUsecase.DeleteMember(c.UserContext(), req); err != nil {
+        return h.projectErrRes(c, deleteMemberErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
@@ -0,0 +1,348 @@
+package projectsRepositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/ppp3ppj/wymj/modules/projects"
+)
+
+type IProjectsRepository interface {
+    FindCategory(ctx context.Context) ([]*projects.Category, error)
+    InsertCategory(ctx context.Context, req *projects.Category) (*projects.Category, error)
+    UpdateCategory(ctx context.Context, req *projects.Category) (*projects.Category, error)
+    DeleteCategory(ctx context.Context, categoryId int) error
+    FindOneProject(ctx context.Context, projectId int) (*projects.Project, error)
+    FindProject(ctx context.Context, userId string) ([]*projects.Project, error)
+    InsertProject(ctx context.Context, req *projects.ProjectReq) (*projects.Project, error)
+    UpdateProject(ctx context.Context, req *projects.ProjectReq) (*projects.Project, error)
+    DeleteProject(ctx context.Context, projectId int) error
+    FindMember(ctx context.Context, projectId int) ([]*projects.ProjectMember, error)
+    InsertMember(ctx context.Context, req *projects.ProjectMemberReq) error
+    DeleteMember(ctx context.Context, req *projects.ProjectMemberReq) error
+    IsMember(ctx context.Context, projectId int, userId string) bool
+}
+
+type projectsRepository struct {
+    db *sqlx.DB
+}
+
+func ProjectsRepository(db *sqlx.DB) IProjectsRepository {
+    return &projectsRepository{
+        db: db,
+    }
+}
+
+func (r *projectsRepository) FindCategory(ctx context.Context) ([]*projects.Category, error) {
+    query := `
+    SELECT
+        "id",
+        "name"
+    FROM "categories"
+    ORDER BY "id";`
+
+    categories := make([]*projects.Category, 0)
+    if err := r.db.SelectContext(ctx, &categories, query); err != nil {
+        return nil, fmt.Errorf("get categories failed: %v", err)
+    }
+    return categories, nil
+}
+
+func (r *projectsRepository) InsertCategory(ctx context.Context, req *projects.Category) (*projects.Category, error) {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    query := `
+    INSERT INTO "categories" (
+        "name"
+    )
+    VALUES ($1)
+    RETURNING "id";`
+
+    if err := r.db.QueryRowContext(ctx, query, req.Name).Scan(&req.Id); err != nil {
+        switch err.Error() {
+            case "ERROR: duplicate key value violates unique constraint \"categories_name_key\" (SQLSTATE 23505)":
+                return nil, fmt.Errorf("category name has been used")
+            default:
+                return nil, fmt.Errorf("insert category failed: %v", err)
+        }
+    }
+    return req, nil
+}
+
+func (r *projectsRepository) UpdateCategory(ctx context.Context, req *projects.Category) (*projects.Category, error) {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    query := `
+    UPDATE "categories" SET
+        "name" = :name
+    WHERE "id" = :id;`
+
+    result, err := r.db.NamedExecContext(ctx, query, req)
+    if err != nil {
+        switch err.Error() {
+            case "ERROR: duplicate key value violates unique constraint \"categories_name_key\" (SQLSTATE 23505)":
+                return nil, fmt.Errorf("category name has been used")
+            default:
+                return nil, fmt.Errorf("update category failed: %v", err)
+        }
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return nil, fmt.Errorf("category not found")
+    }
+    return req, nil
+}
+
+func (r *projectsRepository) DeleteCategory(ctx context.Context, categoryId int) error {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    var count int
+    if err := r.db.GetContext(ctx, &count, `SELECT COUNT(*) FROM "projects" WHERE "category_id" = $1;`, categoryId); err != nil {
+        return fmt.Errorf("delete category failed: %v", err)
+    }
+    if count > 0 {
+        return fmt.Errorf("category is used by projects")
+    }
+
+    result, err := r.db.ExecContext(ctx, `DELETE FROM "categories" WHERE "id" = $1;`, categoryId)
+    if err != nil {
+        return fmt.Errorf("delete category failed: %v", err)
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return fmt.Errorf("category not found")
+    }
+    return nil
+}
+
+func (r *projectsRepository) FindOneProject(ctx context.Context, projectId int) (*projects.Project, error) {
+    query := `
+    SELECT
+        row_to_json("t")
+    FROM (
+        SELECT
+            "p"."id",
+            "p"."name",
+            json_build_object(
+                'id', "c"."id",
+                'name', "c"."name"
+            ) AS "category"
+        FROM "projects" "p"
+        LEFT JOIN "categories" "c" ON "c"."id" = "p"."category_id"
+        WHERE "p"."id" = $1
+    ) AS "t";`
+
+    data := make([]byte, 0)
+    if err := r.db.GetContext(ctx, &data, query, projectId); err != nil {
+        return nil, fmt.Errorf("get project failed: %v", err)
+    }
+
+    project := new(projects.Project)
+    if err := json.Unmarshal(data, &project); err != nil {
+        return nil, fmt.Errorf("unmarshal project failed: %v", err)
+    }
+    return project, nil
+}
+
+// userId is empty string will find all projects
+func (r *projectsRepository) FindProject(ctx context.Context, userId string) ([]*projects.Project, error) {
+    query := `
+    SELECT
+        COALESCE(array_to_json(array_agg("t")), '[]'::json)
+    FROM (
+        SELECT
+            "p"."id",
+            "p"."name",
+            json_build_object(
+                'id', "c"."id",
+                'name', "c"."name"
+            ) AS "category"
+        FROM "projects" "p"
+        LEFT JOIN "categories" "c" ON "c"."id" = "p"."category_id"
+        WHERE $1 = ''
+        OR "p"."id" IN (
+            SELECT
+                "up"."project_id"
+            FROM "user_projects" "up"
+            WHERE "up"."user_id" = $1
+        )
+        ORDER BY "p"."id"
+    ) AS "t";`
+
+    data := make([]byte, 0)
+    if err := r.db.GetContext(ctx, &data, query, userId); err != nil {
+        return nil, fmt.Errorf("get projects failed: %v", err)
+    }
+
+    projectsData := make([]*projects.Project, 0)
+    if err := json.Unmarshal(data, &projectsData); err != nil {
+        return nil, fmt.Errorf("unmarshal projects failed: %v", err)
+    }
+    return projectsData, nil
+}
+
+func (r *projectsRepository) InsertProject(ctx context.Context, req *projects.ProjectReq) (*projects.Project, error) {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    query := `
+    INSERT INTO "projects" (
+        "name",
+        "category_id"
+    )
+    VALUES ($1, $2)
+    RETURNING "id";`
+
+    if err := r.db.QueryRowContext(ctx, query, req.Name, req.CategoryId).Scan(&req.Id); err != nil {
+        switch err.Error() {
+            case "ERROR: insert or update on table \"projects\" violates foreign key constraint \"projects_category_id_fkey\" (SQLSTATE 23503)":
+                return nil, fmt.Errorf("category not found")
+            default:
+                return nil, fmt.Errorf("insert project failed: %v", err)
+        }
+    }
+    return r.FindOneProject(ctx, req.Id)
+}
+
+func (r *projectsRepository) UpdateProject(ctx context.Context, req *projects.ProjectReq) (*projects.Project, error) {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    query := `
+    UPDATE "projects" SET
+        "name" = COALESCE(NULLIF(:name, ''), "name"),
+        "category_id" = COALESCE(NULLIF(:category_id, 0), "category_id")
+    WHERE "id" = :id;`
+
+    result, err := r.db.NamedExecContext(ctx, query, req)
+    if err != nil {
+        switch err.Error() {
+            case "ERROR: insert or update on table \"projects\" violates foreign key constraint \"projects_category_id_fkey\" (SQLSTATE 23503)":
+                return nil, fmt.Errorf("category not found")
+            default:
+                return nil, fmt.Errorf("update project failed: %v", err)
+        }
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return nil, fmt.Errorf("project not found")
+    }
+    return r.FindOneProject(ctx, req.Id)
+}
+
+func (r *projectsRepository) DeleteProject(ctx context.Context, projectId int) error {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return err
+    }
+
+    // tasks keep living without project
+    if _, err := tx.ExecContext(ctx, `UPDATE "tasks" SET "project_id" = NULL WHERE "project_id" = $1;`, projectId); err != nil {
+        tx.Rollback()
+        return fmt.Errorf("detach project tasks failed: %v", err)
+    }
+
+    if _, err := tx.ExecContext(ctx, `DELETE FROM "user_projects" WHERE "project_id" = $1;`, projectId); err != nil {
+        tx.Rollback()
+        return fmt.Errorf("delete project members failed: %v", err)
+    }
+
+    result, err := tx.ExecContext(ctx, `DELETE FROM "projects" WHERE "id" = $1;`, projectId)
+    if err != nil {
+        tx.Rollback()
+        return fmt.Errorf("delete project failed: %v", err)
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        tx.Rollback()
+        return fmt.Errorf("project not found")
+    }
+
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    return nil
+}
+
+func (r *projectsRepository) FindMember(ctx context.Context, projectId int) ([]*projects.ProjectMember, error) {
+    query := `
+    SELECT
+        "u"."id" AS "user_id",
+        "u"."username",
+        COALESCE("u"."email", '') AS "email"
+    FROM "user_projects" "up"
+    JOIN "users" "u" ON "u"."id" = "up"."user_id"
+    WHERE "up"."project_id" = $1
+    ORDER BY "u"."id";`
+
+    members := make([]*projects.ProjectMember, 0)
+    if err := r.db.SelectContext(ctx, &members, query, projectId); err != nil {
+        return nil, fmt.Errorf("get project members failed: %v", err)
+    }
+    return members, nil
+}
+
+func (r *projectsRepository) InsertMember(ctx context.Context, req *projects.ProjectMemberReq) error {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    query := `
+    INSERT INTO "user_projects" (
+        "user_id",
+        "project_id"
+    )
+    VALUES (:user_id, :project_id);`
+
+    if _, err := r.db.NamedExecContext(ctx, query, req); err != nil {
+        switch err.Error() {
+            case "ERROR: duplicate key value violates unique constraint \"user_projects_user_id_project_id_key\" (SQLSTATE 23505)":
+                return fmt.Errorf("user is already a member")
+            case "ERROR: insert or update on table \"user_projects\" violates foreign key constraint \"user_projects_user_id_fkey\" (SQLSTATE 23503)":
+                return fmt.Errorf("user not found")
+            case "ERROR: insert or update on table \"user_projects\" violates foreign key constraint \"user_projects_project_id_fkey\" (SQLSTATE 23503)":
+                return fmt.Errorf("project not found")
+            default:
+                return fmt.Errorf("insert project member failed: %v", err)
+        }
+    }
+    return nil
+}
+
+func (r *projectsRepository) DeleteMember(ctx context.Context, req *projects.ProjectMemberReq) error {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    query := `
+    DELETE FROM "user_projects"
+    WHERE "user_id" = :user_id
+    AND "project_id" = :project_id;`
+
+    result, err := r.db.NamedExecContext(ctx, query, req)
+    if err != nil {
+        return fmt.Errorf("delete project member failed: %v", err)
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return fmt.Errorf("member not found")
+    }
+    return nil
+}
+
+func (r *projectsRepository) IsMember(ctx context.Context, projectId int, userId string) bool {
+    query := `
+    SELECT
+        (CASE WHEN COUNT(*) > 0 THEN TRUE ELSE FALSE END)
+    FROM "user_projects"
+    WHERE "project_id" = $1
+    AND "user_id" = $2;`
+
+    var check bool
+    if err := r.db.GetContext(ctx, &check, query, projectId, userId); err != nil {
+        return false
+    }
+    return check
+}
@@ -0,0 +1,170 @@
+package projectsUsecases
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/modules/projects"
+	"github.com/ppp3ppj/wymj/modules/projects/projectsRepositories"
+	"github.com/ppp3ppj/wymj/pkg/wymjtrace"
+)
+
+type IProjectsUsecase interface {
+    FindCategory(ctx context.Context) ([]*projects.Category, error)
+    InsertCategory(ctx context.Context, req *projects.Category) (*projects.Category, error)
+    UpdateCategory(ctx context.Context, req *projects.Category) (*projects.Category, error)
+    DeleteCategory(ctx context.Context, categoryId int) error
+    FindOneProject(ctx context.Context, projectId int, userId string, isAdmin bool) (*projects.Project, error)
+    FindProject(ctx context.Context) ([]*projects.Project, error)
+    FindMyProject(ctx context.Context, userId string) ([]*projects.Project, error)
+    InsertProject(ctx context.Context, req *projects.ProjectReq) (*projects.Project, error)
+    UpdateProject(ctx context.Context, req *projects.ProjectReq) (*projects.Project, error)
+    DeleteProject(ctx context.Context, projectId int) error
+    FindMember(ctx context.Context, projectId int) ([]*projects.ProjectMember, error)
+    InsertMember(ctx context.Context, req *projects.ProjectMemberReq) ([]*projects.ProjectMember, error)
+    DeleteMember(ctx context.Context, req *projects.ProjectMemberReq) error
+}
+
+type projectsUsecase struct {
+    cfg config.IConfig
+    projectsRepository projectsRepositories.IProjectsRepository
+}
+
+func ProjectsUsecase(cfg config.IConfig, projectsRepository projectsRepositories.IProjectsRepository) IProjectsUsecase {
+    return &projectsUsecase{
+        cfg: cfg,
+        projectsRepository: projectsRepository,
+    }
+}
+
+func (u *projectsUsecase) FindCategory(ctx context.Context) ([]*projects.Category, error) {
+    ctx, span := wymjtrace.Start(ctx, "projectsUsecase.FindCategory")
+    defer span.End()
+
+    return u.projectsRepository.FindCategory(ctx)
+}
+
+func (u *projectsUsecase) InsertCategory(ctx context.Context, req *projects.Category) (*projects.Category, error) {
+    ctx, span := wymjtrace.Start(ctx, "projectsUsecase.InsertCategory")
+    defer span.End()
+
+    category, err := u.projectsRepository.InsertCategory(ctx, req)
+    if err != nil {
+        return nil, err
+    }
+    return category, nil
+}
+
+func (u *projectsUsecase) UpdateCategory(ctx context.Context, req *projects.Category) (*projects.Category, error) {
+    ctx, span := wymjtrace.Start(ctx, "projectsUsecase.UpdateCategory")
+    defer span.End()
+
+    category, err := u.projectsRepository.UpdateCategory(ctx, req)
+    if err != nil {
+        return nil, err
+    }
+    return category, nil
+}
+
+func (u *projectsUsecase) DeleteCategory(ctx context.Context, categoryId int) error {
+    ctx, span := wymjtrace.Start(ctx, "projectsUsecase.DeleteCategory")
+    defer span.End()
+
+    if err := u.projectsRepository.DeleteCategory(ctx, categoryId); err != nil {
+        return err
+    }
+    return nil
+}
+
+func (u *projectsUsecase) FindOneProject(ctx context.Context, projectId int, userId string, isAdmin bool) (*projects.Project, error) {
+    ctx, span := wymjtrace.Start(ctx, "projectsUsecase.FindOneProject")
+    defer span.End()
+
+    // customer can see only project that is a member
+    if !isAdmin && !u.projectsRepository.IsMember(ctx, projectId, userId) {
+        return nil, fmt.Errorf("no permission to access")
+    }
+
+    project, err := u.projectsRepository.FindOneProject(ctx, projectId)
+    if err != nil {
+        return nil, err
+    }
+    return project, nil
+}
+
+func (u *projectsUsecase) FindProject(ctx context.Context) ([]*projects.Project, error) {
+    ctx, span := wymjtrace.Start(ctx, "projectsUsecase.FindProject")
+    defer span.End()
+
+    return u.projectsRepository.FindProject(ctx, "")
+}
+
+func (u *projectsUsecase) FindMyProject(ctx context.Context, userId string) ([]*projects.Project, error) {
+    ctx, span := wymjtrace.Start(ctx, "projectsUsecase.FindMyProject")
+    defer span.End()
+
+    return u.projectsRepository.FindProject(ctx, userId)
+}
+
+func (u *projectsUsecase) InsertProject(ctx context.Context, req *projects.ProjectReq) (*projects.Project, error) {
+    ctx, span := wymjtrace.Start(ctx, "projectsUsecase.InsertProject")
+    defer span.End()
+
+    project, err := u.projectsRepository.InsertProject(ctx, req)
+    if err != nil {
+        return nil, err
+    }
+    return project, nil
+}
+
+func (u *projectsUsecase) UpdateProject(ctx context.Context, req *projects.ProjectReq) (*projects.Project, error) {
+    ctx, span := wymjtrace.Start(ctx, "projectsUsecase.UpdateProject")
+    defer span.End()
+
+    project, err := u.projectsRepository.UpdateProject(ctx, req)
+    if err != nil {
+        return nil, err
+    }
+    return project, nil
+}
+
+func (u *projectsUsecase) DeleteProject(ctx context.Context, projectId int) error {
+    ctx, span := wymjtrace.Start(ctx, "projectsUsecase.DeleteProject")
+    defer span.End()
+
+    if err := u.projectsRepository.DeleteProject(ctx, projectId); err != nil {
+        return err
+    }
+    return nil
+}
+
+func (u *projectsUsecase) FindMember(ctx context.Context, projectId int) ([]*projects.ProjectMember, error) {
+    ctx, span := wymjtrace.Start(ctx, "projectsUsecase.FindMember")
+    defer span.End()
+
+    if _, err := u.projectsRepository.FindOneProject(ctx, projectId); err != nil {
+        return nil, err
+    }
+    return u.projectsRepository.FindMember(ctx, projectId)
+}
+
+func (u *projectsUsecase) InsertMember(ctx context.Context, req *projects.ProjectMemberReq) ([]*projects.ProjectMember, error) {
+    ctx, span := wymjtrace.Start(ctx, "projectsUsecase.InsertMember")
+    defer span.End()
+
+    if err := u.projectsRepository.InsertMember(ctx, req); err != nil {
+        return nil, err
+    }
+    return u.projectsRepository.FindMember(ctx, req.ProjectId)
+}
+
+func (u *projectsUsecase) DeleteMember(ctx context.Context, req *projects.ProjectMemberReq) error {
+    ctx, span := wymjtrace.Start(ctx, "projectsUsecase.DeleteMember")
+    defer span.End()
+
+    if err := u.projectsRepository.DeleteMember(ctx, req); err != nil {
+        return err
+    }
+    return nil
+}
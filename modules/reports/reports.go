@@ -0,0 +1,46 @@
+package reports
+
+type ReportFilter struct {
+    From string `query:"from"` // YYYY-MM-DD in caller timezone
+    To string `query:"to"` // YYYY-MM-DD in caller timezone, inclusive
+    Timezone string `query:"tz"` // IANA name e.g. Asia/Bangkok
+    GroupBy string `query:"group_by"` // comma separated: user,project,category
+    Period string `query:"period"` // day | week | month, empty is mean whole range
+    UserId string `query:"user_id"`
+    ProjectId int `query:"project_id"`
+    CategoryId int `query:"category_id"`
+}
+
+type Report struct {
+    From string `json:"from"`
+    To string `json:"to"`
+    Timezone string `json:"timezone"`
+    GroupBy []string `json:"group_by"`
+    Period string `json:"period"`
+    Total int `json:"total"` // in seconds
+    Rows []*ReportRow `json:"rows"`
+}
+
+type ReportRow struct {
+    Period *string `json:"period,omitempty"`
+    User *ReportUser `json:"user,omitempty"`
+    Project *ReportProject `json:"project,omitempty"`
+    Category *ReportCategory `json:"category,omitempty"`
+    Duration int `json:"duration"` // in seconds
+    Entries int `json:"entries"`
+}
+
+type ReportUser struct {
+    Id string `json:"id"`
+    Username string `json:"username"`
+}
+
+type ReportProject struct {
+    Id int `json:"id"`
+    Name string `json:"name"`
+}
+
+type ReportCategory struct {
+    Id int `json:"id"`
+    Name string `json:"name"`
+}
@@ -0,0 +1,76 @@
+package reportsHandlers
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/modules/entities"
+	"github.com/ppp3ppj/wymj/modules/reports"
+	"github.com/ppp3ppj/wymj/modules/reports/reportsUsecases"
+	"github.com/ppp3ppj/wymj/modules/roles"
+)
+
+type reportsHandlerErrCode string
+
+const (
+    findReportErr reportsHandlerErrCode = "reports-001"
+)
+
+type IReportsHandler interface {
+    FindReport(c *fiber.Ctx) error
+}
+
+type reportsHandler struct {
+    cfg config.IConfig
+    reportsUsecase reportsUsecases.IReportsUsecase
+}
+
+func ReportsHandler(cfg config.IConfig, reportsUsecase reportsUsecases.IReportsUsecase) IReportsHandler {
+    return &reportsHandler{
+        cfg: cfg,
+        reportsUsecase: reportsUsecase,
+    }
+}
+
+func (h *reportsHandler) FindReport(c *fiber.Ctx) error {
+    req := new(reports.ReportFilter)
+    if err := c.QueryParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(findReportErr),
+            err.Error(),
+        ).Res()
+    }
+
+    // Customer can report only on themselves
+    if !roles.HasPermission(c, roles.ReportsAdmin) {
+        userId, _ := c.Locals("userId").(string)
+        if req.UserId != "" && req.UserId != userId {
+            return entities.NewResponse(c).Error(
+                fiber.ErrUnauthorized.Code,
+                string(findReportErr),
+                "no permission to access",
+            ).Res()
+        }
+        req.UserId = userId
+    }
+
+    report, err := h.reportsUsecase.FindReport(c.UserContext(), req)
+    if err != nil {
+        if strings.HasPrefix(err.Error(), "get report failed") ||
+            strings.HasPrefix(err.Error(), "unmarshal report failed") {
+            return entities.NewResponse(c).Error(
+                fiber.ErrInternalServerError.Code,
+                string(findReportErr),
+                err.Error(),
+            ).Res()
+        }
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(findReportErr),
+            err.Error(),
+        ).Res()
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, report).Res()
+}
@@ -0,0 +1,125 @@
+package reportsRepositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/ppp3ppj/wymj/modules/reports"
+)
+
+type IReportsRepository interface {
+    FindReport(ctx context.Context, req *reports.ReportFilter, groupBy []string) ([]*reports.ReportRow, error)
+}
+
+type reportsRepository struct {
+    db *sqlx.DB
+}
+
+func ReportsRepository(db *sqlx.DB) IReportsRepository {
+    return &reportsRepository{
+        db: db,
+    }
+}
+
+// groupBy and req.Period must be validated by usecase, they are put into query directly
+func (r *reportsRepository) FindReport(ctx context.Context, req *reports.ReportFilter, groupBy []string) ([]*reports.ReportRow, error) {
+    selectStack := make([]string, 0)
+    groupStack := make([]string, 0)
+    orderStack := make([]string, 0)
+
+    if req.Period != "" {
+        selectStack = append(selectStack, fmt.Sprintf(`
+            to_char(date_trunc('%s', "te"."started_at" AT TIME ZONE $3), 'YYYY-MM-DD') AS "period"`, req.Period))
+        groupStack = append(groupStack, `"period"`)
+        orderStack = append(orderStack, `"period"`)
+    }
+    for _, group := range groupBy {
+        switch group {
+        case "user":
+            selectStack = append(selectStack, `
+            json_build_object(
+                'id', "u"."id",
+                'username', "u"."username"
+            ) AS "user"`)
+            groupStack = append(groupStack, `"u"."id"`, `"u"."username"`)
+            orderStack = append(orderStack, `"u"."id"`)
+        case "project":
+            selectStack = append(selectStack, `
+            (CASE WHEN "p"."id" IS NULL THEN NULL ELSE json_build_object(
+                'id', "p"."id",
+                'name', "p"."name"
+            ) END) AS "project"`)
+            groupStack = append(groupStack, `"p"."id"`, `"p"."name"`)
+            orderStack = append(orderStack, `"p"."id"`)
+        case "category":
+            selectStack = append(selectStack, `
+            (CASE WHEN "c"."id" IS NULL THEN NULL ELSE json_build_object(
+                'id', "c"."id",
+                'name', "c"."name"
+            ) END) AS "category"`)
+            groupStack = append(groupStack, `"c"."id"`, `"c"."name"`)
+            orderStack = append(orderStack, `"c"."id"`)
+        }
+    }
+    selectStack = append(selectStack, `
+            SUM("te"."duration")::int AS "duration"`, `
+            COUNT(*)::int AS "entries"`)
+
+    // $1 from, $2 to are date in caller timezone ($3), to is inclusive
+    values := []any{req.From, req.To, req.Timezone}
+    whereStack := []string{`
+        AND "te"."stopped_at" IS NOT NULL`, `
+        AND "te"."started_at" >= ($1::date::timestamp AT TIME ZONE $3)`, `
+        AND "te"."started_at" < (($2::date + 1)::timestamp AT TIME ZONE $3)`}
+    if req.UserId != "" {
+        values = append(values, req.UserId)
+        whereStack = append(whereStack, fmt.Sprintf(`
+        AND "te"."user_id" = $%d`, len(values)))
+    }
+    if req.ProjectId != 0 {
+        values = append(values, req.ProjectId)
+        whereStack = append(whereStack, fmt.Sprintf(`
+        AND "t"."project_id" = $%d`, len(values)))
+    }
+    if req.CategoryId != 0 {
+        values = append(values, req.CategoryId)
+        whereStack = append(whereStack, fmt.Sprintf(`
+        AND "p"."category_id" = $%d`, len(values)))
+    }
+
+    query := fmt.Sprintf(`
+    SELECT
+        COALESCE(array_to_json(array_agg("r")), '[]'::json)
+    FROM (
+        SELECT%s
+        FROM "time_entries" "te"
+        JOIN "tasks" "t" ON "t"."id" = "te"."task_id"
+        JOIN "users" "u" ON "u"."id" = "te"."user_id"
+        LEFT JOIN "projects" "p" ON "p"."id" = "t"."project_id"
+        LEFT JOIN "categories" "c" ON "c"."id" = "p"."category_id"
+        WHERE 1 = 1%s`,
+        strings.Join(selectStack, ","),
+        strings.Join(whereStack, ""),
+    )
+    if len(groupStack) > 0 {
+        query += fmt.Sprintf(`
+        GROUP BY %s
+        ORDER BY %s`, strings.Join(groupStack, ", "), strings.Join(orderStack, ", "))
+    }
+    query += `
+    ) AS "r";`
+
+    data := make([]byte, 0)
+    if err := r.db.GetContext(ctx, &data, query, values...); err != nil {
+        return nil, fmt.Errorf("get report failed: %v", err)
+    }
+
+    rows := make([]*reports.ReportRow, 0)
+    if err := json.Unmarshal(data, &rows); err != nil {
+        return nil, fmt.Errorf("unmarshal report failed: %v", err)
+    }
+    return rows, nil
+}
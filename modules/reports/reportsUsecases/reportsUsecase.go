@@ -0,0 +1,95 @@
+package reportsUsecases
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/modules/reports"
+	"github.com/ppp3ppj/wymj/modules/reports/reportsRepositories"
+	"github.com/ppp3ppj/wymj/pkg/wymjtrace"
+)
+
+type IReportsUsecase interface {
+    FindReport(ctx context.Context, req *reports.ReportFilter) (*reports.Report, error)
+}
+
+type reportsUsecase struct {
+    cfg config.IConfig
+    reportsRepository reportsRepositories.IReportsRepository
+}
+
+func ReportsUsecase(cfg config.IConfig, reportsRepository reportsRepositories.IReportsRepository) IReportsUsecase {
+    return &reportsUsecase{
+        cfg: cfg,
+        reportsRepository: reportsRepository,
+    }
+}
+
+func (u *reportsUsecase) FindReport(ctx context.Context, req *reports.ReportFilter) (*reports.Report, error) {
+    ctx, span := wymjtrace.Start(ctx, "reportsUsecase.FindReport")
+    defer span.End()
+
+    // Timezone check, default is UTC
+    if req.Timezone == "" {
+        req.Timezone = "UTC"
+    }
+    if _, err := time.LoadLocation(req.Timezone); err != nil {
+        return nil, fmt.Errorf("tz is invalid")
+    }
+
+    // Date range check
+    from, err := time.Parse("2006-01-02", req.From)
+    if err != nil {
+        return nil, fmt.Errorf("from is invalid, expect YYYY-MM-DD")
+    }
+    to, err := time.Parse("2006-01-02", req.To)
+    if err != nil {
+        return nil, fmt.Errorf("to is invalid, expect YYYY-MM-DD")
+    }
+    if to.Before(from) {
+        return nil, fmt.Errorf("to must not be before from")
+    }
+
+    // Period check
+    req.Period = strings.ToLower(req.Period)
+    switch req.Period {
+        case "", "day", "week", "month":
+        default:
+            return nil, fmt.Errorf("period is invalid, expect day, week or month")
+    }
+
+    // Group check
+    groupBy := make([]string, 0)
+    for _, group := range strings.Split(req.GroupBy, ",") {
+        group = strings.ToLower(strings.Trim(group, " "))
+        switch group {
+            case "":
+            case "user", "project", "category":
+                groupBy = append(groupBy, group)
+            default:
+                return nil, fmt.Errorf("group_by is invalid, expect user, project or category")
+        }
+    }
+
+    rows, err := u.reportsRepository.FindReport(ctx, req, groupBy)
+    if err != nil {
+        return nil, err
+    }
+
+    total := 0
+    for _, row := range rows {
+        total += row.Duration
+    }
+    return &reports.Report{
+        From: req.From,
+        To: req.To,
+        Timezone: req.Timezone,
+        GroupBy: groupBy,
+        Period: req.Period,
+        Total: total,
+        Rows: rows,
+    }, nil
+}
@@ -0,0 +1,71 @@
+package roles
+
+import (
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// permission that routes and handlers check, named as <resource>:<action>
+const (
+    TasksWrite = "tasks:write"
+    TasksAdmin = "tasks:admin"
+    TimersWrite = "timers:write"
+    TimersAdmin = "timers:admin"
+    ProjectsAdmin = "projects:admin"
+    ReportsAdmin = "reports:admin"
+    UsersAdmin = "users:admin"
+    RolesAdmin = "roles:admin"
+    ApiKeysAdmin = "apikeys:admin"
+)
+
+// BuiltinPermissions are used by code so they can not be deleted
+var BuiltinPermissions = []string{
+    TasksWrite,
+    TasksAdmin,
+    TimersWrite,
+    TimersAdmin,
+    ProjectsAdmin,
+    ReportsAdmin,
+    UsersAdmin,
+    RolesAdmin,
+    ApiKeysAdmin,
+}
+
+// role id 1 is customer and 2 is admin, sign up depends on them
+const (
+    CustomerRoleId = 1
+    AdminRoleId = 2
+)
+
+type Permission struct {
+    Id int `db:"id" json:"id"`
+    Name string `db:"name" json:"name" form:"name"`
+    Description string `db:"description" json:"description" form:"description"`
+}
+
+type Role struct {
+    Id int `db:"id" json:"id"`
+    Title string `db:"title" json:"title"`
+    RequireTotp bool `db:"require_totp" json:"require_totp"`
+    Permissions []string `db:"permissions" json:"permissions"`
+}
+
+// RoleReq Permissions is list of permission name, nil on update is mean unchanged
+type RoleReq struct {
+    Id int `json:"-"`
+    Title string `json:"title" form:"title"`
+    Permissions []string `json:"permissions" form:"permissions"`
+}
+
+// UserRoleReq replace every role of user, first role is the primary role in token
+type UserRoleReq struct {
+    UserId string `json:"-"`
+    RoleIds []int `json:"role_ids" form:"role_ids"`
+}
+
+// HasPermission read permissions that JwtAuth set to locals
+func HasPermission(c *fiber.Ctx, permission string) bool {
+    permissions, _ := c.Locals("userPermissions").([]string)
+    return slices.Contains(permissions, permission)
+}
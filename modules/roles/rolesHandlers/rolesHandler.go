@@ -0,0 +1,236 @@
+package rolesHandlers
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/modules/entities"
+	"github.com/ppp3ppj/wymj/modules/roles"
+	"github.com/ppp3ppj/wymj/modules/roles/rolesUsecases"
+)
+
+type rolesHandlerErrCode string
+
+const (
+    findRoleErr rolesHandlerErrCode = "roles-001"
+    findOneRoleErr rolesHandlerErrCode = "roles-002"
+    insertRoleErr rolesHandlerErrCode = "roles-003"
+    updateRoleErr rolesHandlerErrCode = "roles-004"
+    deleteRoleErr rolesHandlerErrCode = "roles-005"
+    findPermissionErr rolesHandlerErrCode = "roles-006"
+    insertPermissionErr rolesHandlerErrCode = "roles-007"
+    deletePermissionErr rolesHandlerErrCode = "roles-008"
+    findUserRoleErr rolesHandlerErrCode = "roles-009"
+    updateUserRoleErr rolesHandlerErrCode = "roles-010"
+)
+
+type IRolesHandler interface {
+    FindRole(c *fiber.Ctx) error
+    FindOneRole(c *fiber.Ctx) error
+    InsertRole(c *fiber.Ctx) error
+    UpdateRole(c *fiber.Ctx) error
+    DeleteRole(c *fiber.Ctx) error
+    FindPermission(c *fiber.Ctx) error
+    InsertPermission(c *fiber.Ctx) error
+    DeletePermission(c *fiber.Ctx) error
+    FindUserRole(c *fiber.Ctx) error
+    UpdateUserRole(c *fiber.Ctx) error
+}
+
+type rolesHandler struct {
+    cfg config.IConfig
+    rolesUsecase rolesUsecases.IRolesUsecase
+}
+
+func RolesHandler(cfg config.IConfig, rolesUsecase rolesUsecases.IRolesUsecase) IRolesHandler {
+    return &rolesHandler{
+        cfg: cfg,
+        rolesUsecase: rolesUsecase,
+    }
+}
+
+func (h *rolesHandler) roleErrRes(c *fiber.Ctx, code rolesHandlerErrCode, err error) error {
+    switch {
+    case strings.HasSuffix(err.Error(), "sql: no rows in result set"),
+        strings.HasSuffix(err.Error(), "not found"):
+        return entities.NewResponse(c).Error(
+            fiber.ErrNotFound.Code,
+            string(code),
+            err.Error(),
+        ).Res()
+    case err.Error() == "title is required",
+        err.Error() == "role_ids is required",
+        err.Error() == "role title has been used",
+        err.Error() == "role is used by users",
+        err.Error() == "permission name has been used",
+        err.Error() == "permission name must be <resource>:<action>",
+        strings.HasPrefix(err.Error(), "built-in"),
+        strings.HasPrefix(err.Error(), "admin role must have"),
+        strings.HasPrefix(err.Error(), "can not remove"),
+        strings.HasPrefix(err.Error(), "at least one user must have"):
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(code),
+            err.Error(),
+        ).Res()
+    default:
+        return entities.NewResponse(c).Error(
+            fiber.ErrInternalServerError.Code,
+            string(code),
+            err.Error(),
+        ).Res()
+    }
+}
+
+func (h *rolesHandler) FindRole(c *fiber.Ctx) error {
+    rolesData, err := h.rolesUsecase.FindRole(c.UserContext())
+    if err != nil {
+        return h.roleErrRes(c, findRoleErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, rolesData).Res()
+}
+
+func (h *rolesHandler) FindOneRole(c *fiber.Ctx) error {
+    roleId, err := c.ParamsInt("role_id")
+    if err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(findOneRoleErr),
+            "role_id is invalid",
+        ).Res()
+    }
+
+    role, err := h.rolesUsecase.FindOneRole(c.UserContext(), roleId)
+    if err != nil {
+        return h.roleErrRes(c, findOneRoleErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, role).Res()
+}
+
+func (h *rolesHandler) InsertRole(c *fiber.Ctx) error {
+    req := new(roles.RoleReq)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(insertRoleErr),
+            err.Error(),
+        ).Res()
+    }
+
+    role, err := h.rolesUsecase.InsertRole(c.UserContext(), req)
+    if err != nil {
+        return h.roleErrRes(c, insertRoleErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusCreated, role).Res()
+}
+
+func (h *rolesHandler) UpdateRole(c *fiber.Ctx) error {
+    roleId, err := c.ParamsInt("role_id")
+    if err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(updateRoleErr),
+            "role_id is invalid",
+        ).Res()
+    }
+    req := new(roles.RoleReq)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(updateRoleErr),
+            err.Error(),
+        ).Res()
+    }
+    req.Id = roleId
+
+    role, err := h.rolesUsecase.UpdateRole(c.UserContext(), req)
+    if err != nil {
+        return h.roleErrRes(c, updateRoleErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, role).Res()
+}
+
+func (h *rolesHandler) DeleteRole(c *fiber.Ctx) error {
+    roleId, err := c.ParamsInt("role_id")
+    if err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(deleteRoleErr),
+            "role_id is invalid",
+        ).Res()
+    }
+
+    if err := h.rolesUsecase.DeleteRole(c.UserContext(), roleId); err != nil {
+        return h.roleErrRes(c, deleteRoleErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+func (h *rolesHandler) FindPermission(c *fiber.Ctx) error {
+    permissions, err := h.rolesUsecase.FindPermission(c.UserContext())
+    if err != nil {
+        return h.roleErrRes(c, findPermissionErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, permissions).Res()
+}
+
+func (h *rolesHandler) InsertPermission(c *fiber.Ctx) error {
+    req := new(roles.Permission)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(insertPermissionErr),
+            err.Error(),
+        ).Res()
+    }
+
+    permission, err := h.rolesUsecase.InsertPermission(c.UserContext(), req)
+    if err != nil {
+        return h.roleErrRes(c, insertPermissionErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusCreated, permission).Res()
+}
+
+func (h *rolesHandler) DeletePermission(c *fiber.Ctx) error {
+    permissionId, err := c.ParamsInt("permission_id")
+    if err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(deletePermissionErr),
+            "permission_id is invalid",
+        ).Res()
+    }
+
+    if err := h.rolesUsecase.DeletePermission(c.UserContext(), permissionId); err != nil {
+        return h.roleErrRes(c, deletePermissionErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+func (h *rolesHandler) FindUserRole(c *fiber.Ctx) error {
+    rolesData, err := h.rolesUsecase.FindUserRole(c.UserContext(), strings.Trim(c.Params("user_id"), " "))
+    if err != nil {
+        return h.roleErrRes(c, findUserRoleErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, rolesData).Res()
+}
+
+func (h *rolesHandler) UpdateUserRole(c *fiber.Ctx) error {
+    req := new(roles.UserRoleReq)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(updateUserRoleErr),
+            err.Error(),
+        ).Res()
+    }
+    req.UserId = strings.Trim(c.Params("user_id"), " ")
+    adminId, _ := c.Locals("userId").(string)
+
+    rolesData, err := h.rolesUsecase.UpdateUserRole(c.UserContext(), adminId, req)
+    if err != nil {
+        return h.roleErrRes(c, updateUserRoleErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, rolesData).Res()
+}
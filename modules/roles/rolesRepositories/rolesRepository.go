@@ -0,0 +1,362 @@
+package rolesRepositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/ppp3ppj/wymj/modules/roles"
+)
+
+type IRolesRepository interface {
+    FindRole(ctx context.Context) ([]*roles.Role, error)
+    FindOneRole(ctx context.Context, roleId int) (*roles.Role, error)
+    InsertRole(ctx context.Context, req *roles.RoleReq) (*roles.Role, error)
+    UpdateRole(ctx context.Context, req *roles.RoleReq) (*roles.Role, error)
+    DeleteRole(ctx context.Context, roleId int) error
+    FindPermission(ctx context.Context) ([]*roles.Permission, error)
+    InsertPermission(ctx context.Context, req *roles.Permission) (*roles.Permission, error)
+    DeletePermission(ctx context.Context, permissionId int) error
+    FindUserRole(ctx context.Context, userId string) ([]*roles.Role, error)
+    UpdateUserRole(ctx context.Context, req *roles.UserRoleReq) error
+}
+
+type rolesRepository struct {
+    db *sqlx.DB
+}
+
+func RolesRepository(db *sqlx.DB) IRolesRepository {
+    return &rolesRepository{
+        db: db,
+    }
+}
+
+// roleQuery select role with permission names, filter is appended as WHERE of "r"
+const roleQuery = `
+    SELECT
+        "r"."id",
+        "r"."title",
+        "r"."require_totp",
+        COALESCE((
+            SELECT
+                array_to_json(array_agg("p"."name" ORDER BY "p"."name"))
+            FROM "role_permissions" "rp"
+            JOIN "permissions" "p" ON "p"."id" = "rp"."permission_id"
+            WHERE "rp"."role_id" = "r"."id"
+        ), '[]'::json) AS "permissions"
+    FROM "roles" "r"`
+
+func (r *rolesRepository) FindRole(ctx context.Context) ([]*roles.Role, error) {
+    query := `
+    SELECT
+        COALESCE(array_to_json(array_agg("t")), '[]'::json)
+    FROM (` + roleQuery + `
+        ORDER BY "r"."id"
+    ) AS "t";`
+
+    data := make([]byte, 0)
+    if err := r.db.GetContext(ctx, &data, query); err != nil {
+        return nil, fmt.Errorf("get roles failed: %v", err)
+    }
+    rolesData := make([]*roles.Role, 0)
+    if err := json.Unmarshal(data, &rolesData); err != nil {
+        return nil, fmt.Errorf("unmarshal roles failed: %v", err)
+    }
+    return rolesData, nil
+}
+
+func (r *rolesRepository) FindOneRole(ctx context.Context, roleId int) (*roles.Role, error) {
+    query := `
+    SELECT
+        row_to_json("t")
+    FROM (` + roleQuery + `
+        WHERE "r"."id" = $1
+    ) AS "t";`
+
+    data := make([]byte, 0)
+    if err := r.db.GetContext(ctx, &data, query, roleId); err != nil {
+        return nil, fmt.Errorf("get role failed: %v", err)
+    }
+    role := new(roles.Role)
+    if err := json.Unmarshal(data, role); err != nil {
+        return nil, fmt.Errorf("unmarshal role failed: %v", err)
+    }
+    return role, nil
+}
+
+// setRolePermission replace permissions of role by name, every name must exist
+func setRolePermission(ctx context.Context, tx *sqlx.Tx, roleId int, permissions []string) error {
+    if _, err := tx.ExecContext(ctx, `DELETE FROM "role_permissions" WHERE "role_id" = $1;`, roleId); err != nil {
+        return fmt.Errorf("delete role permissions failed: %v", err)
+    }
+    for _, name := range permissions {
+        result, err := tx.ExecContext(ctx, `
+        INSERT INTO "role_permissions" ("role_id", "permission_id")
+        SELECT $1, "id" FROM "permissions" WHERE "name" = $2
+        ON CONFLICT DO NOTHING;`,
+            roleId,
+            name,
+        )
+        if err != nil {
+            return fmt.Errorf("insert role permission failed: %v", err)
+        }
+        if rows, _ := result.RowsAffected(); rows == 0 {
+            var exist bool
+            if err := tx.GetContext(ctx, &exist, `SELECT EXISTS (SELECT 1 FROM "permissions" WHERE "name" = $1);`, name); err != nil || !exist {
+                return fmt.Errorf("permission %q not found", name)
+            }
+        }
+    }
+    return nil
+}
+
+func (r *rolesRepository) InsertRole(ctx context.Context, req *roles.RoleReq) (*roles.Role, error) {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := tx.QueryRowContext(ctx, `
+    INSERT INTO "roles" ("title") VALUES ($1) RETURNING "id";`,
+        req.Title,
+    ).Scan(&req.Id); err != nil {
+        tx.Rollback()
+        switch err.Error() {
+            case "ERROR: duplicate key value violates unique constraint \"roles_title_key\" (SQLSTATE 23505)":
+                return nil, fmt.Errorf("role title has been used")
+            default:
+                return nil, fmt.Errorf("insert role failed: %v", err)
+        }
+    }
+    if err := setRolePermission(ctx, tx, req.Id, req.Permissions); err != nil {
+        tx.Rollback()
+        return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+    return r.FindOneRole(ctx, req.Id)
+}
+
+func (r *rolesRepository) UpdateRole(ctx context.Context, req *roles.RoleReq) (*roles.Role, error) {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return nil, err
+    }
+
+    result, err := tx.ExecContext(ctx, `
+    UPDATE "roles" SET
+        "title" = COALESCE(NULLIF($1, ''), "title")
+    WHERE "id" = $2;`,
+        req.Title,
+        req.Id,
+    )
+    if err != nil {
+        tx.Rollback()
+        switch err.Error() {
+            case "ERROR: duplicate key value violates unique constraint \"roles_title_key\" (SQLSTATE 23505)":
+                return nil, fmt.Errorf("role title has been used")
+            default:
+                return nil, fmt.Errorf("update role failed: %v", err)
+        }
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        tx.Rollback()
+        return nil, fmt.Errorf("role not found")
+    }
+    if req.Permissions != nil {
+        if err := setRolePermission(ctx, tx, req.Id, req.Permissions); err != nil {
+            tx.Rollback()
+            return nil, err
+        }
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+    return r.FindOneRole(ctx, req.Id)
+}
+
+func (r *rolesRepository) DeleteRole(ctx context.Context, roleId int) error {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    var count int
+    if err := r.db.GetContext(ctx, &count, `SELECT COUNT(*) FROM "users" WHERE "role_id" = $1;`, roleId); err != nil {
+        return fmt.Errorf("delete role failed: %v", err)
+    }
+    if count > 0 {
+        return fmt.Errorf("role is used by users")
+    }
+
+    result, err := r.db.ExecContext(ctx, `DELETE FROM "roles" WHERE "id" = $1;`, roleId)
+    if err != nil {
+        return fmt.Errorf("delete role failed: %v", err)
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return fmt.Errorf("role not found")
+    }
+    return nil
+}
+
+func (r *rolesRepository) FindPermission(ctx context.Context) ([]*roles.Permission, error) {
+    query := `
+    SELECT
+        "id",
+        "name",
+        "description"
+    FROM "permissions"
+    ORDER BY "name";`
+
+    permissions := make([]*roles.Permission, 0)
+    if err := r.db.SelectContext(ctx, &permissions, query); err != nil {
+        return nil, fmt.Errorf("get permissions failed: %v", err)
+    }
+    return permissions, nil
+}
+
+func (r *rolesRepository) InsertPermission(ctx context.Context, req *roles.Permission) (*roles.Permission, error) {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    query := `
+    INSERT INTO "permissions" (
+        "name",
+        "description"
+    )
+    VALUES ($1, $2)
+    RETURNING "id";`
+
+    if err := r.db.QueryRowContext(ctx, query, req.Name, req.Description).Scan(&req.Id); err != nil {
+        switch err.Error() {
+            case "ERROR: duplicate key value violates unique constraint \"permissions_name_key\" (SQLSTATE 23505)":
+                return nil, fmt.Errorf("permission name has been used")
+            default:
+                return nil, fmt.Errorf("insert permission failed: %v", err)
+        }
+    }
+    return req, nil
+}
+
+func (r *rolesRepository) DeletePermission(ctx context.Context, permissionId int) error {
+    result, err := r.db.ExecContext(ctx, `DELETE FROM "permissions" WHERE "id" = $1;`, permissionId)
+    if err != nil {
+        return fmt.Errorf("delete permission failed: %v", err)
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return fmt.Errorf("permission not found")
+    }
+    return nil
+}
+
+func (r *rolesRepository) FindUserRole(ctx context.Context, userId string) ([]*roles.Role, error) {
+    query := `
+    SELECT
+        COALESCE(array_to_json(array_agg("t")), '[]'::json)
+    FROM (` + roleQuery + `
+        JOIN "user_roles" "ur" ON "ur"."role_id" = "r"."id"
+        WHERE "ur"."user_id" = $1
+        ORDER BY "r"."id"
+    ) AS "t";`
+
+    data := make([]byte, 0)
+    if err := r.db.GetContext(ctx, &data, query, userId); err != nil {
+        return nil, fmt.Errorf("get user roles failed: %v", err)
+    }
+    rolesData := make([]*roles.Role, 0)
+    if err := json.Unmarshal(data, &rolesData); err != nil {
+        return nil, fmt.Errorf("unmarshal user roles failed: %v", err)
+    }
+    return rolesData, nil
+}
+
+// UpdateUserRole replace roles of user and set first role as users.role_id
+func (r *rolesRepository) UpdateUserRole(ctx context.Context, req *roles.UserRoleReq) error {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return err
+    }
+
+    result, err := tx.ExecContext(ctx, `
+    UPDATE "users" SET
+        "role_id" = $1
+    WHERE "id" = $2
+    AND "deleted_at" IS NULL;`,
+        req.RoleIds[0],
+        req.UserId,
+    )
+    if err != nil {
+        tx.Rollback()
+        switch err.Error() {
+            case "ERROR: insert or update on table \"users\" violates foreign key constraint \"users_role_id_fkey\" (SQLSTATE 23503)":
+                return fmt.Errorf("role not found")
+            default:
+                return fmt.Errorf("update user role failed: %v", err)
+        }
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        tx.Rollback()
+        return fmt.Errorf("user not found")
+    }
+
+    if _, err := tx.ExecContext(ctx, `DELETE FROM "user_roles" WHERE "user_id" = $1;`, req.UserId); err != nil {
+        tx.Rollback()
+        return fmt.Errorf("delete user roles failed: %v", err)
+    }
+    for _, roleId := range req.RoleIds {
+        if _, err := tx.ExecContext(ctx, `
+        INSERT INTO "user_roles" ("user_id", "role_id") VALUES ($1, $2)
+        ON CONFLICT DO NOTHING;`,
+            req.UserId,
+            roleId,
+        ); err != nil {
+            tx.Rollback()
+            switch err.Error() {
+                case "ERROR: insert or update on table \"user_roles\" violates foreign key constraint \"user_roles_role_id_fkey\" (SQLSTATE 23503)":
+                    return fmt.Errorf("role not found")
+                default:
+                    return fmt.Errorf("insert user role failed: %v", err)
+            }
+        }
+    }
+
+    // someone must still be able to manage roles after the change
+    var hasAdmin bool
+    if err := tx.GetContext(ctx, &hasAdmin, `
+    SELECT EXISTS (
+        SELECT 1
+        FROM "users" "u"
+        JOIN "user_roles" "ur" ON "ur"."user_id" = "u"."id"
+        JOIN "role_permissions" "rp" ON "rp"."role_id" = "ur"."role_id"
+        JOIN "permissions" "p" ON "p"."id" = "rp"."permission_id"
+        WHERE "p"."name" = $1
+        AND "u"."deleted_at" IS NULL
+        AND "u"."disabled_at" IS NULL
+    );`,
+        roles.RolesAdmin,
+    ); err != nil {
+        tx.Rollback()
+        return fmt.Errorf("get admin user failed: %v", err)
+    }
+    if !hasAdmin {
+        tx.Rollback()
+        return fmt.Errorf("at least one user must have %s permission", roles.RolesAdmin)
+    }
+
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    return nil
+}
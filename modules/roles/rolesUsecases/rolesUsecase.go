@@ -0,0 +1,186 @@
+package rolesUsecases
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ppp3ppj/wymj/modules/roles"
+	"github.com/ppp3ppj/wymj/modules/roles/rolesRepositories"
+	"github.com/ppp3ppj/wymj/pkg/wymjtrace"
+)
+
+type IRolesUsecase interface {
+    FindRole(ctx context.Context) ([]*roles.Role, error)
+    FindOneRole(ctx context.Context, roleId int) (*roles.Role, error)
+    InsertRole(ctx context.Context, req *roles.RoleReq) (*roles.Role, error)
+    UpdateRole(ctx context.Context, req *roles.RoleReq) (*roles.Role, error)
+    DeleteRole(ctx context.Context, roleId int) error
+    FindPermission(ctx context.Context) ([]*roles.Permission, error)
+    InsertPermission(ctx context.Context, req *roles.Permission) (*roles.Permission, error)
+    DeletePermission(ctx context.Context, permissionId int) error
+    FindUserRole(ctx context.Context, userId string) ([]*roles.Role, error)
+    UpdateUserRole(ctx context.Context, adminId string, req *roles.UserRoleReq) ([]*roles.Role, error)
+}
+
+// IRoleCache is cache of role permissions in middleware, it is reset after any change
+type IRoleCache interface {
+    ResetRoleCache()
+}
+
+type rolesUsecase struct {
+    rolesRepository rolesRepositories.IRolesRepository
+    roleCache IRoleCache
+}
+
+func RolesUsecase(rolesRepository rolesRepositories.IRolesRepository, roleCache IRoleCache) IRolesUsecase {
+    return &rolesUsecase{
+        rolesRepository: rolesRepository,
+        roleCache: roleCache,
+    }
+}
+
+var permissionNameRegex = regexp.MustCompile(`^[a-z0-9_-]+:[a-z0-9_-]+$`)
+
+func (u *rolesUsecase) FindRole(ctx context.Context) ([]*roles.Role, error) {
+    ctx, span := wymjtrace.Start(ctx, "rolesUsecase.FindRole")
+    defer span.End()
+
+    return u.rolesRepository.FindRole(ctx)
+}
+
+func (u *rolesUsecase) FindOneRole(ctx context.Context, roleId int) (*roles.Role, error) {
+    ctx, span := wymjtrace.Start(ctx, "rolesUsecase.FindOneRole")
+    defer span.End()
+
+    return u.rolesRepository.FindOneRole(ctx, roleId)
+}
+
+func (u *rolesUsecase) InsertRole(ctx context.Context, req *roles.RoleReq) (*roles.Role, error) {
+    ctx, span := wymjtrace.Start(ctx, "rolesUsecase.InsertRole")
+    defer span.End()
+
+    req.Title = strings.Trim(req.Title, " ")
+    if req.Title == "" {
+        return nil, fmt.Errorf("title is required")
+    }
+    role, err := u.rolesRepository.InsertRole(ctx, req)
+    if err != nil {
+        return nil, err
+    }
+    u.roleCache.ResetRoleCache()
+    return role, nil
+}
+
+func (u *rolesUsecase) UpdateRole(ctx context.Context, req *roles.RoleReq) (*roles.Role, error) {
+    ctx, span := wymjtrace.Start(ctx, "rolesUsecase.UpdateRole")
+    defer span.End()
+
+    req.Title = strings.Trim(req.Title, " ")
+    // admin must keep roles:admin, otherwise nobody can manage roles anymore
+    if req.Id == roles.AdminRoleId && req.Permissions != nil && !slices.Contains(req.Permissions, roles.RolesAdmin) {
+        return nil, fmt.Errorf("admin role must have %s permission", roles.RolesAdmin)
+    }
+    role, err := u.rolesRepository.UpdateRole(ctx, req)
+    if err != nil {
+        return nil, err
+    }
+    u.roleCache.ResetRoleCache()
+    return role, nil
+}
+
+func (u *rolesUsecase) DeleteRole(ctx context.Context, roleId int) error {
+    ctx, span := wymjtrace.Start(ctx, "rolesUsecase.DeleteRole")
+    defer span.End()
+
+    if roleId == roles.CustomerRoleId || roleId == roles.AdminRoleId {
+        return fmt.Errorf("built-in role can not be deleted")
+    }
+    if err := u.rolesRepository.DeleteRole(ctx, roleId); err != nil {
+        return err
+    }
+    u.roleCache.ResetRoleCache()
+    return nil
+}
+
+func (u *rolesUsecase) FindPermission(ctx context.Context) ([]*roles.Permission, error) {
+    ctx, span := wymjtrace.Start(ctx, "rolesUsecase.FindPermission")
+    defer span.End()
+
+    return u.rolesRepository.FindPermission(ctx)
+}
+
+func (u *rolesUsecase) InsertPermission(ctx context.Context, req *roles.Permission) (*roles.Permission, error) {
+    ctx, span := wymjtrace.Start(ctx, "rolesUsecase.InsertPermission")
+    defer span.End()
+
+    req.Name = strings.ToLower(strings.Trim(req.Name, " "))
+    if !permissionNameRegex.MatchString(req.Name) {
+        return nil, fmt.Errorf("permission name must be <resource>:<action>")
+    }
+    permission, err := u.rolesRepository.InsertPermission(ctx, req)
+    if err != nil {
+        return nil, err
+    }
+    return permission, nil
+}
+
+func (u *rolesUsecase) DeletePermission(ctx context.Context, permissionId int) error {
+    ctx, span := wymjtrace.Start(ctx, "rolesUsecase.DeletePermission")
+    defer span.End()
+
+    permissions, err := u.rolesRepository.FindPermission(ctx)
+    if err != nil {
+        return err
+    }
+    for _, p := range permissions {
+        if p.Id == permissionId && slices.Contains(roles.BuiltinPermissions, p.Name) {
+            return fmt.Errorf("built-in permission can not be deleted")
+        }
+    }
+    if err := u.rolesRepository.DeletePermission(ctx, permissionId); err != nil {
+        return err
+    }
+    u.roleCache.ResetRoleCache()
+    return nil
+}
+
+func (u *rolesUsecase) FindUserRole(ctx context.Context, userId string) ([]*roles.Role, error) {
+    ctx, span := wymjtrace.Start(ctx, "rolesUsecase.FindUserRole")
+    defer span.End()
+
+    return u.rolesRepository.FindUserRole(ctx, userId)
+}
+
+// UpdateUserRole admin can not remove roles:admin from own account, repository also reject
+// change that leave no active user with it
+func (u *rolesUsecase) UpdateUserRole(ctx context.Context, adminId string, req *roles.UserRoleReq) ([]*roles.Role, error) {
+    ctx, span := wymjtrace.Start(ctx, "rolesUsecase.UpdateUserRole")
+    defer span.End()
+
+    if len(req.RoleIds) == 0 {
+        return nil, fmt.Errorf("role_ids is required")
+    }
+    if req.UserId == adminId {
+        keepAdmin := false
+        for _, roleId := range req.RoleIds {
+            role, err := u.rolesRepository.FindOneRole(ctx, roleId)
+            if err != nil {
+                return nil, err
+            }
+            if slices.Contains(role.Permissions, roles.RolesAdmin) {
+                keepAdmin = true
+            }
+        }
+        if !keepAdmin {
+            return nil, fmt.Errorf("can not remove %s from your own account", roles.RolesAdmin)
+        }
+    }
+    // user roles are read on every request, so cache does not need reset
+    if err := u.rolesRepository.UpdateUserRole(ctx, req); err != nil {
+        return nil, err
+    }
+    return u.rolesRepository.FindUserRole(ctx, req.UserId)
+}
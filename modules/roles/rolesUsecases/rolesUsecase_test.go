@@ -0,0 +1,78 @@
+package rolesUsecases
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ppp3ppj/wymj/modules/roles"
+	"github.com/ppp3ppj/wymj/modules/roles/rolesRepositories"
+)
+
+// testRepository has customer, admin and auditor roles, auditor also has roles:admin
+type testRepository struct {
+    rolesRepositories.IRolesRepository
+    updated *roles.UserRoleReq
+}
+
+func (r *testRepository) FindOneRole(ctx context.Context, roleId int) (*roles.Role, error) {
+    switch roleId {
+    case roles.CustomerRoleId:
+        return &roles.Role{Id: roleId, Permissions: []string{roles.TasksWrite}}, nil
+    case roles.AdminRoleId:
+        return &roles.Role{Id: roleId, Permissions: []string{roles.RolesAdmin, roles.UsersAdmin}}, nil
+    case 3:
+        return &roles.Role{Id: roleId, Permissions: []string{roles.RolesAdmin}}, nil
+    }
+    return nil, fmt.Errorf("get role failed: sql: no rows in result set")
+}
+
+func (r *testRepository) UpdateUserRole(ctx context.Context, req *roles.UserRoleReq) error {
+    r.updated = req
+    return nil
+}
+
+func (r *testRepository) FindUserRole(ctx context.Context, userId string) ([]*roles.Role, error) {
+    return nil, nil
+}
+
+func TestUpdateUserRole(t *testing.T) {
+    tests := []struct {
+        name string
+        userId string
+        roleIds []int
+        wantErr string
+    }{
+        {"admin change other user", "U000002", []int{roles.CustomerRoleId}, ""},
+        {"admin keep own admin role", "U000001", []int{roles.AdminRoleId, roles.CustomerRoleId}, ""},
+        {"admin keep roles:admin from other role", "U000001", []int{roles.CustomerRoleId, 3}, ""},
+        {"admin remove own roles:admin", "U000001", []int{roles.CustomerRoleId}, "can not remove roles:admin from your own account"},
+        {"unknown role of own account", "U000001", []int{99}, "get role failed: sql: no rows in result set"},
+        {"no role", "U000002", []int{}, "role_ids is required"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            repository := &testRepository{}
+            _, err := RolesUsecase(repository, nil).UpdateUserRole(
+                context.Background(),
+                "U000001",
+                &roles.UserRoleReq{UserId: tt.userId, RoleIds: tt.roleIds},
+            )
+            if tt.wantErr != "" {
+                if err == nil || err.Error() != tt.wantErr {
+                    t.Fatalf("error = %v, want %q", err, tt.wantErr)
+                }
+                if repository.updated != nil {
+                    t.Errorf("roles are updated: %+v", repository.updated)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("update user role: %v", err)
+            }
+            if repository.updated == nil || repository.updated.UserId != tt.userId {
+                t.Errorf("updated = %+v", repository.updated)
+            }
+        })
+    }
+}
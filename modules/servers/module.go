@@ -1,36 +1,88 @@
 package servers
 
 import (
+	"context"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/ppp3ppj/wymj/modules/appinfo"
 	appinfohandlers "github.com/ppp3ppj/wymj/modules/appinfo/appinfoHandlers"
 	"github.com/ppp3ppj/wymj/modules/appinfo/appinfoRepositories"
 	"github.com/ppp3ppj/wymj/modules/appinfo/appinfoUsecases"
+	"github.com/ppp3ppj/wymj/modules/exports/exportsHandlers"
+	"github.com/ppp3ppj/wymj/modules/exports/exportsRepositories"
+	"github.com/ppp3ppj/wymj/modules/exports/exportsUsecases"
+	"github.com/ppp3ppj/wymj/modules/images/imagesHandlers"
+	"github.com/ppp3ppj/wymj/modules/images/imagesRepositories"
+	"github.com/ppp3ppj/wymj/modules/images/imagesUsecases"
+	"github.com/ppp3ppj/wymj/modules/imports/importsHandlers"
+	"github.com/ppp3ppj/wymj/modules/imports/importsRepositories"
+	"github.com/ppp3ppj/wymj/modules/imports/importsUsecases"
 	"github.com/ppp3ppj/wymj/modules/middlewares/middlewaresHandlers"
 	"github.com/ppp3ppj/wymj/modules/middlewares/middlewaresRepositories"
 	"github.com/ppp3ppj/wymj/modules/middlewares/middlewaresUsecases"
+	"github.com/ppp3ppj/wymj/modules/oauth2"
+	"github.com/ppp3ppj/wymj/modules/oauth2/oauth2Handlers"
+	"github.com/ppp3ppj/wymj/modules/oauth2/oauth2Repositories"
+	"github.com/ppp3ppj/wymj/modules/oauth2/oauth2Usecases"
 	"github.com/ppp3ppj/wymj/modules/monitor/monitorHandlers"
+	"github.com/ppp3ppj/wymj/modules/projects/projectsHandlers"
+	"github.com/ppp3ppj/wymj/modules/projects/projectsRepositories"
+	"github.com/ppp3ppj/wymj/modules/projects/projectsUsecases"
+	"github.com/ppp3ppj/wymj/modules/reports/reportsHandlers"
+	"github.com/ppp3ppj/wymj/modules/reports/reportsRepositories"
+	"github.com/ppp3ppj/wymj/modules/reports/reportsUsecases"
+	"github.com/ppp3ppj/wymj/modules/roles"
+	"github.com/ppp3ppj/wymj/modules/roles/rolesHandlers"
+	"github.com/ppp3ppj/wymj/modules/roles/rolesRepositories"
+	"github.com/ppp3ppj/wymj/modules/roles/rolesUsecases"
+	"github.com/ppp3ppj/wymj/modules/tasks/tasksHandlers"
+	"github.com/ppp3ppj/wymj/modules/tasks/tasksRepositories"
+	"github.com/ppp3ppj/wymj/modules/tasks/tasksUsecases"
+	"github.com/ppp3ppj/wymj/modules/timers/timersHandlers"
+	"github.com/ppp3ppj/wymj/modules/timers/timersRepositories"
+	"github.com/ppp3ppj/wymj/modules/timers/timersUsecases"
+	"github.com/ppp3ppj/wymj/modules/users"
 	"github.com/ppp3ppj/wymj/modules/users/usersHandlers"
 	"github.com/ppp3ppj/wymj/modules/users/usersRepositories"
 	"github.com/ppp3ppj/wymj/modules/users/usersUsecases"
+	"github.com/ppp3ppj/wymj/pkg/wymjlogger"
+	"github.com/ppp3ppj/wymj/pkg/wymjmailer"
+	"github.com/ppp3ppj/wymj/pkg/wymjoidc"
+	"github.com/ppp3ppj/wymj/pkg/wymjstorage"
 )
 
 type IModuleFactory interface {
     MonitorModule()
     UserModule()
     AppinfoModule()
+    RoleModule()
+    OAuth2Module()
+    TaskModule()
+    ProjectModule()
+    ImageModule()
+    TimerModule()
+    ReportModule()
+    ExportModule()
+    ImportModule()
 }
 
 type moduleFactory struct {
     r fiber.Router // r is router
     s *server // s is server
     mid middlewaresHandlers.IMiddlewaresHandler // mid is middlewaresHandlers
+    storage wymjstorage.IWymjStorage // storage of image files, shared by modules that delete them
 }
 
 func InitModule(r fiber.Router, s *server, mid middlewaresHandlers.IMiddlewaresHandler) IModuleFactory {
+    storage, err := wymjstorage.NewWymjStorage(s.cfg.Storage())
+    if err != nil {
+        wymjlogger.Fatalf("init storage failed: %v", err)
+    }
     return &moduleFactory{
         r: r,
         s: s,
         mid: mid,
+        storage: storage,
     }
 }
 
@@ -48,28 +100,236 @@ func (m *moduleFactory) MonitorModule() {
 }
 
 func (m *moduleFactory) UserModule() {
+    mailer, err := wymjmailer.NewWymjMailer(m.s.cfg.Mail())
+    if err != nil {
+        wymjlogger.Fatalf("init mailer failed: %v", err)
+    }
+    oidc, err := wymjoidc.NewWymjOidcProviders(m.s.cfg.Oidc())
+    if err != nil {
+        wymjlogger.Fatalf("init oidc failed: %v", err)
+    }
     repository := usersRepositories.UsersRepository(m.s.db)
-    usecase := usersUsecases.UsersUsecase(m.s.cfg, repository)
+    usecase := usersUsecases.UsersUsecase(m.s.cfg, repository, mailer, oidc, m.storage)
     handler := usersHandlers.UsersHandler(m.s.cfg, usecase)
+    // role change of user directory is the same as /v1/roles/users/:user_id
+    rolesHandler := rolesHandlers.RolesHandler(
+        m.s.cfg,
+        rolesUsecases.RolesUsecase(rolesRepositories.RolesRepository(m.s.db), m.mid),
+    )
 
     // Group routes to user = /v1/users/signup
     router := m.r.Group("/users")
 
-    router.Post("/signup", m.mid.ApiKeyAuth(), handler.SignUpCustomer)
-    router.Post("/signin", m.mid.ApiKeyAuth(), handler.SignIn)
-    router.Post("/refresh", m.mid.ApiKeyAuth(), handler.RefreshPassport)
-    router.Post("/signout", m.mid.ApiKeyAuth(), handler.SignOut)
-    router.Post("/signup-admin", m.mid.JwtAuth(), m.mid.Authorize(2), handler.SignUpAdmin)
+    router.Post("/signup", m.mid.ApiKeyAuth(appinfo.UsersScope), handler.SignUpCustomer)
+    router.Post("/signin", m.mid.ApiKeyAuth(appinfo.UsersScope), handler.SignIn)
+    router.Post("/refresh", m.mid.ApiKeyAuth(appinfo.UsersScope), handler.RefreshPassport)
+    router.Post("/signout", m.mid.ApiKeyAuth(appinfo.UsersScope), m.mid.JwtAuthScope(users.UnverifiedScope, users.TotpEnrollScope), handler.SignOut)
+    router.Post("/forgot-password", m.mid.ApiKeyAuth(appinfo.UsersScope), handler.ForgotPassword)
+    router.Post("/reset-password", m.mid.ApiKeyAuth(appinfo.UsersScope), handler.ResetPassword)
+    router.Post("/verify-email", m.mid.ApiKeyAuth(appinfo.UsersScope), handler.VerifyEmail)
+    router.Post("/resend-verification", m.mid.ApiKeyAuth(appinfo.UsersScope), handler.ResendVerification)
+    router.Post("/signin/totp", m.mid.ApiKeyAuth(appinfo.UsersScope), handler.VerifyTotp)
+    router.Get("/oidc/:provider/authorize", m.mid.ApiKeyAuth(appinfo.UsersScope), handler.OidcAuthorize)
+    router.Post("/oidc/:provider/callback", m.mid.ApiKeyAuth(appinfo.UsersScope), handler.OidcSignIn)
 
-    router.Get("/:user_id", m.mid.JwtAuth(), m.mid.ParamsCheck(), handler.GetUserProfile)
-    router.Get("/admin/secret", m.mid.JwtAuth(), m.mid.Authorize(2), handler.GenerateAdminToken)
+    router.Post("/totp/enroll", m.mid.JwtAuthScope(users.TotpEnrollScope), handler.EnrollTotp)
+    router.Post("/totp/enable", m.mid.JwtAuthScope(users.TotpEnrollScope), handler.EnableTotp)
+    router.Post("/totp/disable", m.mid.JwtAuth(), handler.DisableTotp)
+    router.Patch("/admin/roles/:role_id/totp", m.mid.JwtAuth(), m.mid.RequirePermission(roles.RolesAdmin), handler.UpdateRoleTotp)
+    router.Post("/signup-admin", m.mid.JwtAuth(), m.mid.RequirePermission(roles.UsersAdmin), handler.SignUpAdmin)
+
+    router.Get("/sessions", m.mid.JwtAuth(), handler.FindSession)
+    router.Delete("/sessions", m.mid.JwtAuth(), handler.RevokeAllSession)
+    router.Delete("/sessions/:oauth_id", m.mid.JwtAuth(), handler.RevokeSession)
+    router.Delete("/:user_id/sessions", m.mid.JwtAuth(), m.mid.RequirePermission(roles.UsersAdmin), handler.ForceSignOut)
+    router.Post("/:user_id/unlock", m.mid.JwtAuth(), m.mid.RequirePermission(roles.UsersAdmin), handler.UnlockUser)
+    router.Get("/", m.mid.JwtAuth(), m.mid.RequirePermission(roles.UsersAdmin), handler.FindUser)
+    router.Put("/:user_id/role", m.mid.JwtAuth(), m.mid.RequirePermission(roles.UsersAdmin), rolesHandler.UpdateUserRole)
+    router.Post("/:user_id/disable", m.mid.JwtAuth(), m.mid.RequirePermission(roles.UsersAdmin), handler.DisableUser)
+    router.Post("/:user_id/enable", m.mid.JwtAuth(), m.mid.RequirePermission(roles.UsersAdmin), handler.EnableUser)
+
+    router.Get("/:user_id", m.mid.JwtAuthScope(users.UnverifiedScope, users.TotpEnrollScope), m.mid.ParamsCheck(), handler.GetUserProfile)
+    router.Patch("/:user_id", m.mid.JwtAuth(), m.mid.ParamsCheck(), handler.UpdateUserProfile)
+    router.Put("/:user_id/password", m.mid.JwtAuth(), m.mid.ParamsCheck(), handler.ChangePassword)
+    router.Delete("/:user_id", m.mid.JwtAuth(), m.mid.ParamsCheck(), handler.DeleteUser)
+    router.Get("/admin/secret", m.mid.JwtAuth(), m.mid.RequirePermission(roles.UsersAdmin), handler.GenerateAdminToken)
 }
 
 func (m *moduleFactory) AppinfoModule() {
     repository := appinfoRepositories.AppinfoRepository(m.s.db)
-    usecase := appinfoUsecases.AppinfoUsecase(repository)
+    usecase := appinfoUsecases.AppinfoUsecase(repository, m.mid)
+    if err := usecase.BootstrapApiKey(context.Background(), m.s.cfg.Auth().BootstrapApiKey()); err != nil {
+        wymjlogger.Fatalf("bootstrap api key failed: %v", err)
+    }
     handler := appinfohandlers.AppinfoHandler(m.s.cfg, usecase)
 
     router := m.r.Group("/appinfo")
-    router.Get("/apikey", m.mid.JwtAuth(), m.mid.Authorize(2), handler.GenerateApiKey)
+    router.Get("/apikeys", m.mid.JwtAuth(), m.mid.RequirePermission(roles.ApiKeysAdmin), handler.FindApiKey)
+    router.Post("/apikeys", m.mid.JwtAuth(), m.mid.RequirePermission(roles.ApiKeysAdmin), handler.InsertApiKey)
+    router.Delete("/apikeys/:apikey_id", m.mid.JwtAuth(), m.mid.RequirePermission(roles.ApiKeysAdmin), handler.RevokeApiKey)
+
+    // well-known path is at root, not under /v1
+    m.s.app.Get("/.well-known/jwks.json", handler.Jwks)
+}
+
+func (m *moduleFactory) RoleModule() {
+    repository := rolesRepositories.RolesRepository(m.s.db)
+    usecase := rolesUsecases.RolesUsecase(repository, m.mid)
+    handler := rolesHandlers.RolesHandler(m.s.cfg, usecase)
+
+    router := m.r.Group("/roles")
+
+    router.Get("/", m.mid.JwtAuth(), m.mid.RequirePermission(roles.RolesAdmin), handler.FindRole)
+    router.Post("/", m.mid.JwtAuth(), m.mid.RequirePermission(roles.RolesAdmin), handler.InsertRole)
+    router.Get("/permissions", m.mid.JwtAuth(), m.mid.RequirePermission(roles.RolesAdmin), handler.FindPermission)
+    router.Post("/permissions", m.mid.JwtAuth(), m.mid.RequirePermission(roles.RolesAdmin), handler.InsertPermission)
+    router.Delete("/permissions/:permission_id", m.mid.JwtAuth(), m.mid.RequirePermission(roles.RolesAdmin), handler.DeletePermission)
+    router.Get("/users/:user_id", m.mid.JwtAuth(), m.mid.RequirePermission(roles.RolesAdmin), handler.FindUserRole)
+    router.Put("/users/:user_id", m.mid.JwtAuth(), m.mid.RequirePermission(roles.RolesAdmin), handler.UpdateUserRole)
+    router.Get("/:role_id", m.mid.JwtAuth(), m.mid.RequirePermission(roles.RolesAdmin), handler.FindOneRole)
+    router.Patch("/:role_id", m.mid.JwtAuth(), m.mid.RequirePermission(roles.RolesAdmin), handler.UpdateRole)
+    router.Delete("/:role_id", m.mid.JwtAuth(), m.mid.RequirePermission(roles.RolesAdmin), handler.DeleteRole)
+}
+
+func (m *moduleFactory) OAuth2Module() {
+    repository := oauth2Repositories.OAuth2Repository(m.s.db)
+    usecase := oauth2Usecases.OAuth2Usecase(m.s.cfg, repository)
+    handler := oauth2Handlers.OAuth2Handler(m.s.cfg, usecase)
+
+    router := m.r.Group("/oauth2")
+
+    // app owned by user
+    router.Get("/clients", m.mid.JwtAuth(), handler.FindClient)
+    router.Post("/clients", m.mid.JwtAuth(), handler.InsertClient)
+    router.Delete("/clients/:client_id", m.mid.JwtAuth(), handler.RevokeClient)
+
+    // app that user has given access to
+    router.Get("/consents", m.mid.JwtAuth(), handler.FindConsent)
+    router.Delete("/consents/:client_id", m.mid.JwtAuth(), handler.DeleteConsent)
+
+    // called by consent page, /v1/oauth2/authorize?response_type=code&client_id=xxx&redirect_uri=xxx&scope=tasks:read&state=xxx
+    router.Get("/authorize", m.mid.JwtAuth(), handler.FindAuthorize)
+    router.Post("/authorize", m.mid.JwtAuth(), handler.Authorize)
+
+    // called by client with client authentication, no api key so standard oauth library can use it
+    router.Post("/token", handler.Token)
+    router.Post("/introspect", handler.Introspect)
+    router.Post("/revoke", handler.Revoke)
+
+    m.s.app.Get("/.well-known/oauth-authorization-server", handler.Metadata)
+}
+
+func (m *moduleFactory) TaskModule() {
+    repository := tasksRepositories.TasksRepository(m.s.db)
+    projectsRepository := projectsRepositories.ProjectsRepository(m.s.db)
+    usecase := tasksUsecases.TasksUsecase(m.s.cfg, repository, projectsRepository, m.storage)
+    handler := tasksHandlers.TasksHandler(m.s.cfg, usecase)
+
+    router := m.r.Group("/tasks")
+
+    // also called by third party app with oauth2 token
+    router.Post("/", m.mid.JwtAuthClient(oauth2.TasksWrite), m.mid.RequirePermission(roles.TasksWrite), handler.InsertTask)
+    router.Get("/", m.mid.JwtAuthClient(oauth2.TasksRead), handler.FindTask)
+    router.Get("/:task_id", m.mid.JwtAuthClient(oauth2.TasksRead), handler.FindOneTask)
+    router.Patch("/:task_id", m.mid.JwtAuthClient(oauth2.TasksWrite), m.mid.RequirePermission(roles.TasksWrite), handler.UpdateTask)
+    router.Delete("/:task_id", m.mid.JwtAuthClient(oauth2.TasksWrite), m.mid.RequirePermission(roles.TasksWrite), handler.DeleteTask)
+}
+
+func (m *moduleFactory) ProjectModule() {
+    repository := projectsRepositories.ProjectsRepository(m.s.db)
+    usecase := projectsUsecases.ProjectsUsecase(m.s.cfg, repository)
+    handler := projectsHandlers.ProjectsHandler(m.s.cfg, usecase)
+
+    router := m.r.Group("/projects")
+
+    router.Get("/categories", m.mid.JwtAuth(), handler.FindCategory)
+    router.Post("/categories", m.mid.JwtAuth(), m.mid.RequirePermission(roles.ProjectsAdmin), handler.InsertCategory)
+    router.Patch("/categories/:category_id", m.mid.JwtAuth(), m.mid.RequirePermission(roles.ProjectsAdmin), handler.UpdateCategory)
+    router.Delete("/categories/:category_id", m.mid.JwtAuth(), m.mid.RequirePermission(roles.ProjectsAdmin), handler.DeleteCategory)
+
+    router.Get("/", m.mid.JwtAuth(), m.mid.RequirePermission(roles.ProjectsAdmin), handler.FindProject)
+    router.Get("/me", m.mid.JwtAuthClient(oauth2.ProjectsRead), handler.FindMyProject)
+    router.Post("/", m.mid.JwtAuth(), m.mid.RequirePermission(roles.ProjectsAdmin), handler.InsertProject)
+    router.Get("/:project_id", m.mid.JwtAuth(), handler.FindOneProject)
+    router.Patch("/:project_id", m.mid.JwtAuth(), m.mid.RequirePermission(roles.ProjectsAdmin), handler.UpdateProject)
+    router.Delete("/:project_id", m.mid.JwtAuth(), m.mid.RequirePermission(roles.ProjectsAdmin), handler.DeleteProject)
+
+    router.Get("/:project_id/members", m.mid.JwtAuth(), m.mid.RequirePermission(roles.ProjectsAdmin), handler.FindMember)
+    router.Post("/:project_id/members", m.mid.JwtAuth(), m.mid.RequirePermission(roles.ProjectsAdmin), handler.InsertMember)
+    router.Delete("/:project_id/members/:user_id", m.mid.JwtAuth(), m.mid.RequirePermission(roles.ProjectsAdmin), handler.DeleteMember)
+}
+
+func (m *moduleFactory) ImageModule() {
+    tasksUsecase := tasksUsecases.TasksUsecase(
+        m.s.cfg,
+        tasksRepositories.TasksRepository(m.s.db),
+        projectsRepositories.ProjectsRepository(m.s.db),
+        m.storage,
+    )
+    repository := imagesRepositories.ImagesRepository(m.s.db)
+    usecase := imagesUsecases.ImagesUsecase(m.s.cfg, repository, tasksUsecase, m.storage)
+    handler := imagesHandlers.ImagesHandler(m.s.cfg, usecase)
+
+    router := m.r.Group("/tasks/:task_id/images")
+
+    router.Get("/", m.mid.JwtAuth(), handler.FindImage)
+    router.Post("/", m.mid.JwtAuth(), m.mid.RequirePermission(roles.TasksWrite), handler.UploadImage)
+    router.Delete("/:image_id", m.mid.JwtAuth(), m.mid.RequirePermission(roles.TasksWrite), handler.DeleteImage)
+    router.Get("/:image_id/file", m.mid.JwtAuth(), handler.OpenImage)
+}
+
+func (m *moduleFactory) TimerModule() {
+    tasksUsecase := tasksUsecases.TasksUsecase(
+        m.s.cfg,
+        tasksRepositories.TasksRepository(m.s.db),
+        projectsRepositories.ProjectsRepository(m.s.db),
+        m.storage,
+    )
+    repository := timersRepositories.TimersRepository(m.s.db)
+    usecase := timersUsecases.TimersUsecase(m.s.cfg, repository, tasksUsecase)
+    handler := timersHandlers.TimersHandler(m.s.cfg, usecase)
+
+    router := m.r.Group("/timers")
+
+    // also called by third party app with oauth2 token
+    router.Get("/current", m.mid.JwtAuthClient(oauth2.TimersRead), handler.FindRunningTimer)
+    router.Post("/start", m.mid.JwtAuthClient(oauth2.TimersWrite), m.mid.RequirePermission(roles.TimersWrite), handler.StartTimer)
+    router.Post("/stop", m.mid.JwtAuthClient(oauth2.TimersWrite), m.mid.RequirePermission(roles.TimersWrite), handler.StopTimer)
+    router.Get("/entries", m.mid.JwtAuthClient(oauth2.TimersRead), handler.FindTimeEntry)
+}
+
+func (m *moduleFactory) ReportModule() {
+    repository := reportsRepositories.ReportsRepository(m.s.db)
+    usecase := reportsUsecases.ReportsUsecase(m.s.cfg, repository)
+    handler := reportsHandlers.ReportsHandler(m.s.cfg, usecase)
+
+    router := m.r.Group("/reports")
+
+    // /v1/reports?from=2024-01-01&to=2024-01-31&tz=Asia/Bangkok&group_by=user,project&period=week
+    router.Get("/", m.mid.JwtAuth(), handler.FindReport)
+}
+
+func (m *moduleFactory) ExportModule() {
+    repository := exportsRepositories.ExportsRepository(m.s.db)
+    usecase := exportsUsecases.ExportsUsecase(m.s.cfg, repository)
+    handler := exportsHandlers.ExportsHandler(m.s.cfg, usecase)
+
+    router := m.r.Group("/exports")
+
+    // /v1/exports/tasks?format=xlsx&project_id=1
+    router.Get("/tasks", m.mid.JwtAuth(), handler.ExportTask)
+    // /v1/exports/time-entries?format=ics&from=2024-01-01&to=2024-01-31
+    router.Get("/time-entries", m.mid.JwtAuth(), handler.ExportTimeEntry)
+}
+
+func (m *moduleFactory) ImportModule() {
+    repository := importsRepositories.ImportsRepository(m.s.db)
+    projectsRepository := projectsRepositories.ProjectsRepository(m.s.db)
+    usecase := importsUsecases.ImportsUsecase(m.s.cfg, repository, projectsRepository)
+    handler := importsHandlers.ImportsHandler(m.s.cfg, usecase)
+
+    router := m.r.Group("/imports")
+
+    // /v1/imports/time-entries?source=toggl&category_id=1&tz=Asia/Bangkok&dry_run=true
+    router.Post("/time-entries", m.mid.JwtAuth(), m.mid.RequirePermission(roles.TimersWrite), handler.ImportTimeEntry)
 }
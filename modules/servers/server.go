@@ -9,6 +9,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/jmoiron/sqlx"
 	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/modules/monitor/monitorHandlers"
 )
 
 type IServer interface {
@@ -40,6 +41,9 @@ func NewServer(cfg config.IConfig, db *sqlx.DB) IServer {
 func (s *server) Start() {
     // Middlewares
     middlewares := InitMiddleware(s)
+    s.app.Use(middlewares.Tracing())
+    s.app.Use(middlewares.RequestId())
+    s.app.Use(middlewares.Metrics())
     s.app.Use(middlewares.Logger())
     s.app.Use(middlewares.Cors())
     // Modules
@@ -49,6 +53,26 @@ func (s *server) Start() {
     modules.MonitorModule()
     modules.UserModule()
     modules.AppinfoModule()
+    modules.RoleModule()
+    modules.OAuth2Module()
+    modules.TaskModule()
+    modules.ProjectModule()
+    modules.ImageModule()
+    modules.TimerModule()
+    modules.ReportModule()
+    modules.ExportModule()
+    modules.ImportModule()
+
+    // Metrics, own port keep it away from public traffic
+    metricsApp := s.app
+    if s.cfg.Metrics().Port() != 0 {
+        metricsApp = fiber.New(fiber.Config{
+            AppName: s.cfg.App().Name(),
+            DisableStartupMessage: true,
+        })
+    }
+    monitorHandler := monitorHandlers.MonitorHandler(s.cfg)
+    metricsApp.Get(s.cfg.Metrics().Path(), middlewares.MetricsAllow(), monitorHandler.Metrics)
 
     s.app.Use(middlewares.RouterCheck())
     // Graceful shutdown
@@ -56,10 +80,22 @@ func (s *server) Start() {
     signal.Notify(c, os.Interrupt)
     go func() {
         _ = <-c
-        log.Panicln("Shutting down server...")
+        log.Println("Shutting down server...")
+        if metricsApp != s.app {
+            _ = metricsApp.Shutdown()
+        }
         _ = s.app.Shutdown()
     }()
 
+    if metricsApp != s.app {
+        go func() {
+            log.Printf("Metrics is running on %v", s.cfg.Metrics().Url())
+            if err := metricsApp.Listen(s.cfg.Metrics().Url()); err != nil {
+                log.Printf("metrics server failed: %v", err)
+            }
+        }()
+    }
+
     // Listen to host:port
     log.Printf("Server is running on %v", s.cfg.App().Url())
     s.app.Listen(s.cfg.App().Url())
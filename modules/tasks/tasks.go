@@ -0,0 +1,33 @@
+package tasks
+
+import "github.com/ppp3ppj/wymj/modules/entities"
+
+type Task struct {
+    Id string `db:"id" json:"id"`
+    UserId string `db:"user_id" json:"user_id"`
+    Title string `db:"title" json:"title" form:"title"`
+    Description string `db:"description" json:"description" form:"description"`
+    Duration int `db:"duration" json:"duration" form:"duration"` // in seconds
+    ProjectId *int `db:"project_id" json:"project_id" form:"project_id"`
+    CreatedAt string `db:"created_at" json:"created_at"`
+    UpdatedAt string `db:"updated_at" json:"updated_at"`
+}
+
+// nil field is mean not update
+type TaskUpdateReq struct {
+    Id string `json:"-"`
+    Title *string `json:"title" form:"title"`
+    Description *string `json:"description" form:"description"`
+    Duration *int `json:"duration" form:"duration"`
+    ProjectId *int `json:"project_id" form:"project_id"`
+}
+
+type TaskFilter struct {
+    Id string `query:"id"`
+    // UserId is set by handler, customer can see only own tasks
+    UserId string `query:"user_id"`
+    ProjectId int `query:"project_id"`
+    Search string `query:"search"` // title & description
+    *entities.PaginationReq
+    *entities.SortReq
+}
@@ -0,0 +1,186 @@
+package tasksHandlers
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/modules/entities"
+	"github.com/ppp3ppj/wymj/modules/roles"
+	"github.com/ppp3ppj/wymj/modules/tasks"
+	"github.com/ppp3ppj/wymj/modules/tasks/tasksUsecases"
+)
+
+type tasksHandlerErrCode string
+
+const (
+    findOneTaskErr tasksHandlerErrCode = "tasks-001"
+    findTaskErr tasksHandlerErrCode = "tasks-002"
+    insertTaskErr tasksHandlerErrCode = "tasks-003"
+    updateTaskErr tasksHandlerErrCode = "tasks-004"
+    deleteTaskErr tasksHandlerErrCode = "tasks-005"
+)
+
+type ITasksHandler interface {
+    FindOneTask(c *fiber.Ctx) error
+    FindTask(c *fiber.Ctx) error
+    InsertTask(c *fiber.Ctx) error
+    UpdateTask(c *fiber.Ctx) error
+    DeleteTask(c *fiber.Ctx) error
+}
+
+type tasksHandler struct {
+    cfg config.IConfig
+    tasksUsecase tasksUsecases.ITasksUsecase
+}
+
+func TasksHandler(cfg config.IConfig, tasksUsecase tasksUsecases.ITasksUsecase) ITasksHandler {
+    return &tasksHandler{
+        cfg: cfg,
+        tasksUsecase: tasksUsecase,
+    }
+}
+
+func (h *tasksHandler) taskErrRes(c *fiber.Ctx, code tasksHandlerErrCode, err error) error {
+    switch {
+    case strings.HasSuffix(err.Error(), "sql: no rows in result set"), err.Error() == "task not found":
+        return entities.NewResponse(c).Error(
+            fiber.ErrNotFound.Code,
+            string(code),
+            "task not found",
+        ).Res()
+    case err.Error() == "no permission to access",
+        err.Error() == "you are not a member of this project":
+        return entities.NewResponse(c).Error(
+            fiber.ErrUnauthorized.Code,
+            string(code),
+            err.Error(),
+        ).Res()
+    default:
+        return entities.NewResponse(c).Error(
+            fiber.ErrInternalServerError.Code,
+            string(code),
+            err.Error(),
+        ).Res()
+    }
+}
+
+func (h *tasksHandler) FindOneTask(c *fiber.Ctx) error {
+    taskId := strings.Trim(c.Params("task_id"), " ")
+    userId, _ := c.Locals("userId").(string)
+
+    task, err := h.tasksUsecase.FindOneTask(c.UserContext(), taskId, userId, roles.HasPermission(c, roles.TasksAdmin))
+    if err != nil {
+        return h.taskErrRes(c, findOneTaskErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, task).Res()
+}
+
+func (h *tasksHandler) FindTask(c *fiber.Ctx) error {
+    req := &tasks.TaskFilter{
+        PaginationReq: &entities.PaginationReq{},
+        SortReq: &entities.SortReq{},
+    }
+    if err := c.QueryParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(findTaskErr),
+            err.Error(),
+        ).Res()
+    }
+
+    // Paginate
+    if req.Page < 1 {
+        req.Page = 1
+    }
+    if req.Limit < 5 {
+        req.Limit = 5
+    }
+    if req.Limit > 100 {
+        req.Limit = 100
+    }
+
+    // Customer can list only own tasks, admin can filter by any user_id
+    if !roles.HasPermission(c, roles.TasksAdmin) {
+        req.UserId, _ = c.Locals("userId").(string)
+    }
+
+    tasksData := h.tasksUsecase.FindTask(c.UserContext(), req)
+    return entities.NewResponse(c).Success(fiber.StatusOK, tasksData).Res()
+}
+
+func (h *tasksHandler) InsertTask(c *fiber.Ctx) error {
+    req := new(tasks.Task)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(insertTaskErr),
+            err.Error(),
+        ).Res()
+    }
+    if strings.Trim(req.Title, " ") == "" {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(insertTaskErr),
+            "title is required",
+        ).Res()
+    }
+    if req.Duration < 0 {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(insertTaskErr),
+            "duration must not be negative",
+        ).Res()
+    }
+    // Owner is always the caller
+    req.UserId, _ = c.Locals("userId").(string)
+
+    task, err := h.tasksUsecase.InsertTask(c.UserContext(), req, roles.HasPermission(c, roles.TasksAdmin))
+    if err != nil {
+        return h.taskErrRes(c, insertTaskErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusCreated, task).Res()
+}
+
+func (h *tasksHandler) UpdateTask(c *fiber.Ctx) error {
+    req := new(tasks.TaskUpdateReq)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(updateTaskErr),
+            err.Error(),
+        ).Res()
+    }
+    if req.Title != nil && strings.Trim(*req.Title, " ") == "" {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(updateTaskErr),
+            "title is required",
+        ).Res()
+    }
+    if req.Duration != nil && *req.Duration < 0 {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(updateTaskErr),
+            "duration must not be negative",
+        ).Res()
+    }
+    req.Id = strings.Trim(c.Params("task_id"), " ")
+    userId, _ := c.Locals("userId").(string)
+
+    task, err := h.tasksUsecase.UpdateTask(c.UserContext(), req, userId, roles.HasPermission(c, roles.TasksAdmin))
+    if err != nil {
+        return h.taskErrRes(c, updateTaskErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, task).Res()
+}
+
+func (h *tasksHandler) DeleteTask(c *fiber.Ctx) error {
+    taskId := strings.Trim(c.Params("task_id"), " ")
+    userId, _ := c.Locals("userId").(string)
+
+    if err := h.tasksUsecase.DeleteTask(c.UserContext(), taskId, userId, roles.HasPermission(c, roles.TasksAdmin)); err != nil {
+        return h.taskErrRes(c, deleteTaskErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
@@ -0,0 +1,218 @@
+package tasksPatterns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/ppp3ppj/wymj/modules/tasks"
+)
+
+// use Builder pattern to build find task query
+type IFindTaskBuilder interface {
+    openJsonQuery()
+    initQuery()
+    countQuery()
+    whereQuery()
+    sort()
+    paginate()
+    closeJsonQuery()
+    resetQuery()
+    Result(ctx context.Context) []*tasks.Task
+    Count(ctx context.Context) int
+}
+
+type findTaskBuilder struct {
+    db *sqlx.DB
+    req *tasks.TaskFilter
+    query string
+    lastStackIndex int
+    values []any
+}
+
+func FindTaskBuilder(db *sqlx.DB, req *tasks.TaskFilter) IFindTaskBuilder {
+    return &findTaskBuilder{
+        db: db,
+        req: req,
+    }
+}
+
+func (b *findTaskBuilder) openJsonQuery() {
+    b.query += `
+    SELECT
+        array_to_json(array_agg("t"))
+    FROM (`
+}
+
+func (b *findTaskBuilder) initQuery() {
+    b.query += `
+        SELECT
+            "t"."id",
+            "t"."user_id",
+            "t"."title",
+            "t"."description",
+            "t"."duration",
+            "t"."project_id",
+            "t"."created_at",
+            "t"."updated_at"
+        FROM "tasks" "t"
+        WHERE 1 = 1`
+}
+
+func (b *findTaskBuilder) countQuery() {
+    b.query += `
+        SELECT
+            COUNT(*) AS "count"
+        FROM "tasks" "t"
+        WHERE 1 = 1`
+}
+
+func (b *findTaskBuilder) whereQuery() {
+    var queryWhere string
+    queryWhereStack := make([]string, 0)
+
+    // Id check
+    if b.req.Id != "" {
+        b.values = append(b.values, b.req.Id)
+        queryWhereStack = append(queryWhereStack, `
+        AND "t"."id" = ?`)
+    }
+
+    // Owner check
+    if b.req.UserId != "" {
+        b.values = append(b.values, b.req.UserId)
+        queryWhereStack = append(queryWhereStack, `
+        AND "t"."user_id" = ?`)
+    }
+
+    // Project check
+    if b.req.ProjectId != 0 {
+        b.values = append(b.values, b.req.ProjectId)
+        queryWhereStack = append(queryWhereStack, `
+        AND "t"."project_id" = ?`)
+    }
+
+    // Search check
+    if b.req.Search != "" {
+        b.values = append(
+            b.values,
+            "%"+strings.ToLower(b.req.Search)+"%",
+            "%"+strings.ToLower(b.req.Search)+"%",
+        )
+        queryWhereStack = append(queryWhereStack, `
+        AND (LOWER("t"."title") LIKE ? OR LOWER("t"."description") LIKE ?)`)
+    }
+
+    // Replace ? with $1, $2, ... in order
+    index := 0
+    for _, stack := range queryWhereStack {
+        for strings.Contains(stack, "?") {
+            index++
+            stack = strings.Replace(stack, "?", "$"+fmt.Sprint(index), 1)
+        }
+        queryWhere += stack
+    }
+    // Last stack record
+    b.lastStackIndex = len(b.values)
+
+    b.query += queryWhere
+}
+
+func (b *findTaskBuilder) sort() {
+    orderByMap := map[string]string{
+        "id": "\"t\".\"id\"",
+        "title": "\"t\".\"title\"",
+        "duration": "\"t\".\"duration\"",
+        "created_at": "\"t\".\"created_at\"",
+    }
+    if orderByMap[b.req.OrderBy] == "" {
+        b.req.OrderBy = orderByMap["id"]
+    } else {
+        b.req.OrderBy = orderByMap[b.req.OrderBy]
+    }
+
+    sortMap := map[string]string{
+        "DESC": "DESC",
+        "ASC": "ASC",
+    }
+    if sortMap[strings.ToUpper(b.req.Sort)] == "" {
+        b.req.Sort = sortMap["DESC"]
+    } else {
+        b.req.Sort = sortMap[strings.ToUpper(b.req.Sort)]
+    }
+
+    // order by column can not be a placeholder, it is safe because mapping above
+    b.query += fmt.Sprintf(`
+        ORDER BY %s %s`, b.req.OrderBy, b.req.Sort)
+}
+
+func (b *findTaskBuilder) paginate() {
+    // offset (page - 1) * limit
+    b.values = append(b.values, (b.req.Page-1)*b.req.Limit, b.req.Limit)
+
+    b.query += fmt.Sprintf(`
+        OFFSET $%d LIMIT $%d`, b.lastStackIndex+1, b.lastStackIndex+2)
+    b.lastStackIndex = len(b.values)
+}
+
+func (b *findTaskBuilder) closeJsonQuery() {
+    b.query += `
+    ) AS "t";`
+}
+
+func (b *findTaskBuilder) resetQuery() {
+    b.query = ""
+    b.values = make([]any, 0)
+    b.lastStackIndex = 0
+}
+
+func (b *findTaskBuilder) Result(ctx context.Context) []*tasks.Task {
+    bytes := make([]byte, 0)
+    tasksData := make([]*tasks.Task, 0)
+    defer b.resetQuery()
+
+    if err := b.db.GetContext(ctx, &bytes, b.query, b.values...); err != nil {
+        return make([]*tasks.Task, 0)
+    }
+
+    if err := json.Unmarshal(bytes, &tasksData); err != nil {
+        return make([]*tasks.Task, 0)
+    }
+    return tasksData
+}
+
+func (b *findTaskBuilder) Count(ctx context.Context) int {
+    var count int
+    defer b.resetQuery()
+
+    if err := b.db.GetContext(ctx, &count, b.query, b.values...); err != nil {
+        return 0
+    }
+    return count
+}
+
+type findTaskEngineer struct {
+    builder IFindTaskBuilder
+}
+
+func FindTaskEngineer(builder IFindTaskBuilder) *findTaskEngineer {
+    return &findTaskEngineer{builder: builder}
+}
+
+func (en *findTaskEngineer) FindTask() IFindTaskBuilder {
+    en.builder.openJsonQuery()
+    en.builder.initQuery()
+    en.builder.whereQuery()
+    en.builder.sort()
+    en.builder.paginate()
+    en.builder.closeJsonQuery()
+    return en.builder
+}
+
+func (en *findTaskEngineer) CountTask() IFindTaskBuilder {
+    en.builder.countQuery()
+    en.builder.whereQuery()
+    return en.builder
+}
@@ -0,0 +1,166 @@
+package tasksRepositories
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/ppp3ppj/wymj/modules/tasks"
+	"github.com/ppp3ppj/wymj/modules/tasks/tasksPatterns"
+)
+
+type ITasksRepository interface {
+    FindOneTask(ctx context.Context, taskId string) (*tasks.Task, error)
+    FindTask(ctx context.Context, req *tasks.TaskFilter) ([]*tasks.Task, int)
+    InsertTask(ctx context.Context, req *tasks.Task) (*tasks.Task, error)
+    UpdateTask(ctx context.Context, req *tasks.TaskUpdateReq) (*tasks.Task, error)
+    DeleteTask(ctx context.Context, taskId string) ([]string, error)
+}
+
+type tasksRepository struct {
+    db *sqlx.DB
+}
+
+func TasksRepository(db *sqlx.DB) ITasksRepository {
+    return &tasksRepository{
+        db: db,
+    }
+}
+
+func (r *tasksRepository) FindOneTask(ctx context.Context, taskId string) (*tasks.Task, error) {
+    query := `
+    SELECT
+        "id",
+        COALESCE("user_id", '') AS "user_id",
+        "title",
+        "description",
+        "duration",
+        "project_id",
+        "created_at",
+        "updated_at"
+    FROM "tasks"
+    WHERE "id" = $1;`
+
+    task := new(tasks.Task)
+    if err := r.db.GetContext(ctx, task, query, taskId); err != nil {
+        return nil, fmt.Errorf("get task failed: %v", err)
+    }
+    return task, nil
+}
+
+func (r *tasksRepository) FindTask(ctx context.Context, req *tasks.TaskFilter) ([]*tasks.Task, int) {
+    builder := tasksPatterns.FindTaskBuilder(r.db, req)
+    engineer := tasksPatterns.FindTaskEngineer(builder)
+
+    result := engineer.FindTask().Result(ctx)
+    count := engineer.CountTask().Count(ctx)
+    return result, count
+}
+
+func (r *tasksRepository) InsertTask(ctx context.Context, req *tasks.Task) (*tasks.Task, error) {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    query := `
+    INSERT INTO "tasks" (
+        "user_id",
+        "title",
+        "description",
+        "duration",
+        "project_id"
+    )
+    VALUES ($1, $2, $3, $4, $5)
+    RETURNING "id";`
+
+    if err := r.db.QueryRowContext(
+        ctx,
+        query,
+        req.UserId,
+        req.Title,
+        req.Description,
+        req.Duration,
+        req.ProjectId,
+    ).Scan(&req.Id); err != nil {
+        return nil, fmt.Errorf("insert task failed: %v", err)
+    }
+    return r.FindOneTask(ctx, req.Id)
+}
+
+func (r *tasksRepository) UpdateTask(ctx context.Context, req *tasks.TaskUpdateReq) (*tasks.Task, error) {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    // build set statement from not nil fields only
+    setStack := make([]string, 0)
+    values := make([]any, 0)
+    if req.Title != nil {
+        values = append(values, *req.Title)
+        setStack = append(setStack, fmt.Sprintf(`"title" = $%d`, len(values)))
+    }
+    if req.Description != nil {
+        values = append(values, *req.Description)
+        setStack = append(setStack, fmt.Sprintf(`"description" = $%d`, len(values)))
+    }
+    if req.Duration != nil {
+        values = append(values, *req.Duration)
+        setStack = append(setStack, fmt.Sprintf(`"duration" = $%d`, len(values)))
+    }
+    if req.ProjectId != nil {
+        values = append(values, *req.ProjectId)
+        setStack = append(setStack, fmt.Sprintf(`"project_id" = $%d`, len(values)))
+    }
+    if len(setStack) == 0 {
+        return r.FindOneTask(ctx, req.Id)
+    }
+
+    values = append(values, req.Id)
+    query := fmt.Sprintf(`
+    UPDATE "tasks" SET
+        %s
+    WHERE "id" = $%d;`, strings.Join(setStack, ",\n        "), len(values))
+
+    if _, err := r.db.ExecContext(ctx, query, values...); err != nil {
+        return nil, fmt.Errorf("update task failed: %v", err)
+    }
+    return r.FindOneTask(ctx, req.Id)
+}
+
+// DeleteTask return storage key of images of the task, files are not removed by the database
+func (r *tasksRepository) DeleteTask(ctx context.Context, taskId string) ([]string, error) {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return nil, err
+    }
+
+    // images and time entries reference tasks, remove them first
+    keys := make([]string, 0)
+    if err := tx.SelectContext(ctx, &keys, `DELETE FROM "images" WHERE "task_id" = $1 RETURNING "filename";`, taskId); err != nil {
+        tx.Rollback()
+        return nil, fmt.Errorf("delete task images failed: %v", err)
+    }
+
+    if _, err := tx.ExecContext(ctx, `DELETE FROM "time_entries" WHERE "task_id" = $1;`, taskId); err != nil {
+        tx.Rollback()
+        return nil, fmt.Errorf("delete task time entries failed: %v", err)
+    }
+
+    result, err := tx.ExecContext(ctx, `DELETE FROM "tasks" WHERE "id" = $1;`, taskId)
+    if err != nil {
+        tx.Rollback()
+        return nil, fmt.Errorf("delete task failed: %v", err)
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        tx.Rollback()
+        return nil, fmt.Errorf("task not found")
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+    return keys, nil
+}
@@ -0,0 +1,144 @@
+package tasksUsecases
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/modules/entities"
+	"github.com/ppp3ppj/wymj/modules/projects/projectsRepositories"
+	"github.com/ppp3ppj/wymj/modules/tasks"
+	"github.com/ppp3ppj/wymj/modules/tasks/tasksRepositories"
+	"github.com/ppp3ppj/wymj/pkg/wymjstorage"
+	"github.com/ppp3ppj/wymj/pkg/wymjtrace"
+)
+
+type ITasksUsecase interface {
+    FindOneTask(ctx context.Context, taskId, userId string, isAdmin bool) (*tasks.Task, error)
+    FindTask(ctx context.Context, req *tasks.TaskFilter) *entities.PaginateRes
+    InsertTask(ctx context.Context, req *tasks.Task, isAdmin bool) (*tasks.Task, error)
+    UpdateTask(ctx context.Context, req *tasks.TaskUpdateReq, userId string, isAdmin bool) (*tasks.Task, error)
+    DeleteTask(ctx context.Context, taskId, userId string, isAdmin bool) error
+}
+
+type tasksUsecase struct {
+    cfg config.IConfig
+    tasksRepository tasksRepositories.ITasksRepository
+    projectsRepository projectsRepositories.IProjectsRepository
+    storage wymjstorage.IWymjStorage
+}
+
+func TasksUsecase(cfg config.IConfig, tasksRepository tasksRepositories.ITasksRepository, projectsRepository projectsRepositories.IProjectsRepository, storage wymjstorage.IWymjStorage) ITasksUsecase {
+    return &tasksUsecase{
+        cfg: cfg,
+        tasksRepository: tasksRepository,
+        projectsRepository: projectsRepository,
+        storage: storage,
+    }
+}
+
+// caller must be a member of the project that task belongs to
+func (u *tasksUsecase) checkProjectMember(ctx context.Context, projectId *int, userId string, isAdmin bool) error {
+    if projectId == nil || isAdmin {
+        return nil
+    }
+    if !u.projectsRepository.IsMember(ctx, *projectId, userId) {
+        return fmt.Errorf("you are not a member of this project")
+    }
+    return nil
+}
+
+func (u *tasksUsecase) FindOneTask(ctx context.Context, taskId, userId string, isAdmin bool) (*tasks.Task, error) {
+    ctx, span := wymjtrace.Start(ctx, "tasksUsecase.FindOneTask")
+    defer span.End()
+
+    task, err := u.tasksRepository.FindOneTask(ctx, taskId)
+    if err != nil {
+        return nil, err
+    }
+    // customer can see only own task
+    if !isAdmin && task.UserId != userId {
+        return nil, fmt.Errorf("no permission to access")
+    }
+    return task, nil
+}
+
+func (u *tasksUsecase) FindTask(ctx context.Context, req *tasks.TaskFilter) *entities.PaginateRes {
+    ctx, span := wymjtrace.Start(ctx, "tasksUsecase.FindTask")
+    defer span.End()
+
+    result, count := u.tasksRepository.FindTask(ctx, req)
+
+    return &entities.PaginateRes{
+        Data: result,
+        Page: req.Page,
+        Limit: req.Limit,
+        TotalItem: count,
+        TotalPage: int(math.Ceil(float64(count) / float64(req.Limit))),
+    }
+}
+
+func (u *tasksUsecase) InsertTask(ctx context.Context, req *tasks.Task, isAdmin bool) (*tasks.Task, error) {
+    ctx, span := wymjtrace.Start(ctx, "tasksUsecase.InsertTask")
+    defer span.End()
+
+    if err := u.checkProjectMember(ctx, req.ProjectId, req.UserId, isAdmin); err != nil {
+        return nil, err
+    }
+
+    task, err := u.tasksRepository.InsertTask(ctx, req)
+    if err != nil {
+        return nil, err
+    }
+    return task, nil
+}
+
+func (u *tasksUsecase) UpdateTask(ctx context.Context, req *tasks.TaskUpdateReq, userId string, isAdmin bool) (*tasks.Task, error) {
+    ctx, span := wymjtrace.Start(ctx, "tasksUsecase.UpdateTask")
+    defer span.End()
+
+    if _, err := u.FindOneTask(ctx, req.Id, userId, isAdmin); err != nil {
+        return nil, err
+    }
+    if err := u.checkProjectMember(ctx, req.ProjectId, userId, isAdmin); err != nil {
+        return nil, err
+    }
+
+    task, err := u.tasksRepository.UpdateTask(ctx, req)
+    if err != nil {
+        return nil, err
+    }
+    return task, nil
+}
+
+func (u *tasksUsecase) DeleteTask(ctx context.Context, taskId, userId string, isAdmin bool) error {
+    ctx, span := wymjtrace.Start(ctx, "tasksUsecase.DeleteTask")
+    defer span.End()
+
+    if _, err := u.FindOneTask(ctx, taskId, userId, isAdmin); err != nil {
+        return err
+    }
+
+    keys, err := u.tasksRepository.DeleteTask(ctx, taskId)
+    if err != nil {
+        return err
+    }
+    u.deleteFiles(ctx, keys)
+    return nil
+}
+
+// deleteFiles remove image files after rows are gone, file that fail is only logged
+// because the task can not be deleted again
+func (u *tasksUsecase) deleteFiles(ctx context.Context, keys []string) {
+    ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+    defer cancel()
+
+    for _, key := range keys {
+        if err := u.storage.Delete(ctx, key); err != nil {
+            slog.ErrorContext(ctx, "delete task file failed", slog.String("key", key), slog.String("error", err.Error()))
+        }
+    }
+}
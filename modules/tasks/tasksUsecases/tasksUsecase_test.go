@@ -0,0 +1,83 @@
+package tasksUsecases
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ppp3ppj/wymj/modules/tasks"
+	"github.com/ppp3ppj/wymj/modules/tasks/tasksRepositories"
+	"github.com/ppp3ppj/wymj/pkg/wymjstorage"
+)
+
+// testRepository has one task of U000001 with images
+type testRepository struct {
+    tasksRepositories.ITasksRepository
+    images []string
+    deleted bool
+}
+
+func (r *testRepository) FindOneTask(ctx context.Context, taskId string) (*tasks.Task, error) {
+    if taskId != "T0000001" || r.deleted {
+        return nil, fmt.Errorf("task not found")
+    }
+    return &tasks.Task{Id: taskId, UserId: "U000001"}, nil
+}
+
+func (r *testRepository) DeleteTask(ctx context.Context, taskId string) ([]string, error) {
+    r.deleted = true
+    return r.images, nil
+}
+
+type testStorage struct {
+    wymjstorage.IWymjStorage
+    files map[string]bool
+}
+
+func (s *testStorage) Delete(ctx context.Context, key string) error {
+    if key == "tasks/T0000001/broken.png" {
+        return fmt.Errorf("delete file failed: 503 Service Unavailable")
+    }
+    delete(s.files, key)
+    return nil
+}
+
+func TestDeleteTaskFiles(t *testing.T) {
+    tests := []struct {
+        name string
+        userId string
+        isAdmin bool
+        wantErr string
+        wantFiles int
+    }{
+        {"owner delete task", "U000001", false, "", 1},
+        {"admin delete task", "U000002", true, "", 1},
+        {"other user can not delete task", "U000002", false, "no permission to access", 3},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            repository := &testRepository{
+                images: []string{"tasks/T0000001/a.png", "tasks/T0000001/broken.png", "tasks/T0000001/b.png"},
+            }
+            storage := &testStorage{files: map[string]bool{
+                "tasks/T0000001/a.png": true,
+                "tasks/T0000001/b.png": true,
+                "tasks/T0000002/other-task.png": true,
+            }}
+            usecase := TasksUsecase(nil, repository, nil, storage)
+
+            err := usecase.DeleteTask(context.Background(), "T0000001", tt.userId, tt.isAdmin)
+            if tt.wantErr != "" {
+                if err == nil || err.Error() != tt.wantErr {
+                    t.Fatalf("error = %v, want %q", err, tt.wantErr)
+                }
+            } else if err != nil {
+                t.Fatalf("delete task: %v", err)
+            }
+            // file that fail to delete does not stop the others
+            if len(storage.files) != tt.wantFiles || !storage.files["tasks/T0000002/other-task.png"] {
+                t.Errorf("files left = %v", storage.files)
+            }
+        })
+    }
+}
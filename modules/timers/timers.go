@@ -0,0 +1,21 @@
+package timers
+
+import "time"
+
+type TimeEntry struct {
+    Id string `db:"id" json:"id"`
+    UserId string `db:"user_id" json:"user_id"`
+    TaskId string `db:"task_id" json:"task_id"`
+    StartedAt time.Time `db:"started_at" json:"started_at"`
+    StoppedAt *time.Time `db:"stopped_at" json:"stopped_at"` // nil is mean timer is running
+    Duration int `db:"duration" json:"duration"` // in seconds
+}
+
+type TimerStartReq struct {
+    TaskId string `json:"task_id" form:"task_id"`
+}
+
+type TimeEntryFilter struct {
+    TaskId string `query:"task_id"`
+    UserId string `query:"user_id"`
+}
@@ -0,0 +1,141 @@
+package timersHandlers
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/modules/entities"
+	"github.com/ppp3ppj/wymj/modules/roles"
+	"github.com/ppp3ppj/wymj/modules/timers"
+	"github.com/ppp3ppj/wymj/modules/timers/timersUsecases"
+)
+
+type timersHandlerErrCode string
+
+const (
+    findRunningTimerErr timersHandlerErrCode = "timers-001"
+    startTimerErr timersHandlerErrCode = "timers-002"
+    stopTimerErr timersHandlerErrCode = "timers-003"
+    findTimeEntryErr timersHandlerErrCode = "timers-004"
+)
+
+type ITimersHandler interface {
+    FindRunningTimer(c *fiber.Ctx) error
+    StartTimer(c *fiber.Ctx) error
+    StopTimer(c *fiber.Ctx) error
+    FindTimeEntry(c *fiber.Ctx) error
+}
+
+type timersHandler struct {
+    cfg config.IConfig
+    timersUsecase timersUsecases.ITimersUsecase
+}
+
+func TimersHandler(cfg config.IConfig, timersUsecase timersUsecases.ITimersUsecase) ITimersHandler {
+    return &timersHandler{
+        cfg: cfg,
+        timersUsecase: timersUsecase,
+    }
+}
+
+func (h *timersHandler) timerErrRes(c *fiber.Ctx, code timersHandlerErrCode, err error) error {
+    switch {
+    case strings.HasSuffix(err.Error(), "sql: no rows in result set"):
+        return entities.NewResponse(c).Error(
+            fiber.ErrNotFound.Code,
+            string(code),
+            "task not found",
+        ).Res()
+    case err.Error() == "no permission to access":
+        return entities.NewResponse(c).Error(
+            fiber.ErrUnauthorized.Code,
+            string(code),
+            err.Error(),
+        ).Res()
+    case err.Error() == "timer is already running",
+        err.Error() == "timer is not running":
+        return entities.NewResponse(c).Error(
+            fiber.ErrConflict.Code,
+            string(code),
+            err.Error(),
+        ).Res()
+    default:
+        return entities.NewResponse(c).Error(
+            fiber.ErrInternalServerError.Code,
+            string(code),
+            err.Error(),
+        ).Res()
+    }
+}
+
+func (h *timersHandler) FindRunningTimer(c *fiber.Ctx) error {
+    userId, _ := c.Locals("userId").(string)
+
+    // data is null when no timer is running
+    entry, err := h.timersUsecase.FindRunningTimer(c.UserContext(), userId)
+    if err != nil {
+        return h.timerErrRes(c, findRunningTimerErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, entry).Res()
+}
+
+func (h *timersHandler) StartTimer(c *fiber.Ctx) error {
+    req := new(timers.TimerStartReq)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(startTimerErr),
+            err.Error(),
+        ).Res()
+    }
+    if strings.Trim(req.TaskId, " ") == "" {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(startTimerErr),
+            "task_id is required",
+        ).Res()
+    }
+    userId, _ := c.Locals("userId").(string)
+
+    entry, err := h.timersUsecase.StartTimer(c.UserContext(), req, userId, roles.HasPermission(c, roles.TimersAdmin))
+    if err != nil {
+        return h.timerErrRes(c, startTimerErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusCreated, entry).Res()
+}
+
+func (h *timersHandler) StopTimer(c *fiber.Ctx) error {
+    userId, _ := c.Locals("userId").(string)
+
+    entry, err := h.timersUsecase.StopTimer(c.UserContext(), userId)
+    if err != nil {
+        return h.timerErrRes(c, stopTimerErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, entry).Res()
+}
+
+func (h *timersHandler) FindTimeEntry(c *fiber.Ctx) error {
+    req := new(timers.TimeEntryFilter)
+    if err := c.QueryParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(findTimeEntryErr),
+            err.Error(),
+        ).Res()
+    }
+    if strings.Trim(req.TaskId, " ") == "" {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(findTimeEntryErr),
+            "task_id is required",
+        ).Res()
+    }
+    userId, _ := c.Locals("userId").(string)
+
+    entries, err := h.timersUsecase.FindTimeEntry(c.UserContext(), req, userId, roles.HasPermission(c, roles.TimersAdmin))
+    if err != nil {
+        return h.timerErrRes(c, findTimeEntryErr, err)
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, entries).Res()
+}
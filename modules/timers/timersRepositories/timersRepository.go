@@ -0,0 +1,156 @@
+package timersRepositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/ppp3ppj/wymj/modules/timers"
+)
+
+type ITimersRepository interface {
+    FindRunningTimer(ctx context.Context, userId string) (*timers.TimeEntry, error)
+    StartTimer(ctx context.Context, userId, taskId string) (*timers.TimeEntry, error)
+    StopTimer(ctx context.Context, userId string) (*timers.TimeEntry, error)
+    FindTimeEntry(ctx context.Context, req *timers.TimeEntryFilter) ([]*timers.TimeEntry, error)
+}
+
+type timersRepository struct {
+    db *sqlx.DB
+}
+
+func TimersRepository(db *sqlx.DB) ITimersRepository {
+    return &timersRepository{
+        db: db,
+    }
+}
+
+// FindRunningTimer return nil without error when user has no running timer
+func (r *timersRepository) FindRunningTimer(ctx context.Context, userId string) (*timers.TimeEntry, error) {
+    query := `
+    SELECT
+        "id",
+        "user_id",
+        "task_id",
+        "started_at",
+        "stopped_at",
+        EXTRACT(EPOCH FROM (NOW() - "started_at"))::int AS "duration"
+    FROM "time_entries"
+    WHERE "user_id" = $1
+    AND "stopped_at" IS NULL;`
+
+    entry := new(timers.TimeEntry)
+    if err := r.db.GetContext(ctx, entry, query, userId); err != nil {
+        if errors.Is(err, sql.ErrNoRows) {
+            return nil, nil
+        }
+        return nil, fmt.Errorf("get running timer failed: %v", err)
+    }
+    return entry, nil
+}
+
+func (r *timersRepository) StartTimer(ctx context.Context, userId, taskId string) (*timers.TimeEntry, error) {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    query := `
+    INSERT INTO "time_entries" (
+        "user_id",
+        "task_id"
+    )
+    VALUES ($1, $2)
+    RETURNING
+        "id",
+        "user_id",
+        "task_id",
+        "started_at",
+        "stopped_at",
+        "duration";`
+
+    entry := new(timers.TimeEntry)
+    if err := r.db.QueryRowxContext(ctx, query, userId, taskId).StructScan(entry); err != nil {
+        switch err.Error() {
+            case "ERROR: duplicate key value violates unique constraint \"time_entries_running_user_id_key\" (SQLSTATE 23505)":
+                return nil, fmt.Errorf("timer is already running")
+            default:
+                return nil, fmt.Errorf("start timer failed: %v", err)
+        }
+    }
+    return entry, nil
+}
+
+// StopTimer close running entry and add its duration to the task in one transaction
+func (r *timersRepository) StopTimer(ctx context.Context, userId string) (*timers.TimeEntry, error) {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return nil, err
+    }
+
+    query := `
+    UPDATE "time_entries" SET
+        "stopped_at" = NOW(),
+        "duration" = EXTRACT(EPOCH FROM (NOW() - "started_at"))::int
+    WHERE "user_id" = $1
+    AND "stopped_at" IS NULL
+    RETURNING
+        "id",
+        "user_id",
+        "task_id",
+        "started_at",
+        "stopped_at",
+        "duration";`
+
+    entry := new(timers.TimeEntry)
+    if err := tx.QueryRowxContext(ctx, query, userId).StructScan(entry); err != nil {
+        tx.Rollback()
+        if errors.Is(err, sql.ErrNoRows) {
+            return nil, fmt.Errorf("timer is not running")
+        }
+        return nil, fmt.Errorf("stop timer failed: %v", err)
+    }
+
+    if _, err := tx.ExecContext(
+        ctx,
+        `UPDATE "tasks" SET "duration" = "duration" + $1 WHERE "id" = $2;`,
+        entry.Duration,
+        entry.TaskId,
+    ); err != nil {
+        tx.Rollback()
+        return nil, fmt.Errorf("update task duration failed: %v", err)
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+    return entry, nil
+}
+
+func (r *timersRepository) FindTimeEntry(ctx context.Context, req *timers.TimeEntryFilter) ([]*timers.TimeEntry, error) {
+    query := `
+    SELECT
+        "id",
+        "user_id",
+        "task_id",
+        "started_at",
+        "stopped_at",
+        (CASE WHEN "stopped_at" IS NULL
+            THEN EXTRACT(EPOCH FROM (NOW() - "started_at"))::int
+            ELSE "duration"
+        END) AS "duration"
+    FROM "time_entries"
+    WHERE "task_id" = $1
+    AND ($2 = '' OR "user_id" = $2)
+    ORDER BY "started_at" DESC;`
+
+    entries := make([]*timers.TimeEntry, 0)
+    if err := r.db.SelectContext(ctx, &entries, query, req.TaskId, req.UserId); err != nil {
+        return nil, fmt.Errorf("get time entries failed: %v", err)
+    }
+    return entries, nil
+}
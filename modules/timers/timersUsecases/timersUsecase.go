@@ -0,0 +1,75 @@
+package timersUsecases
+
+import (
+	"context"
+	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/modules/tasks/tasksUsecases"
+	"github.com/ppp3ppj/wymj/modules/timers"
+	"github.com/ppp3ppj/wymj/modules/timers/timersRepositories"
+	"github.com/ppp3ppj/wymj/pkg/wymjtrace"
+)
+
+type ITimersUsecase interface {
+    FindRunningTimer(ctx context.Context, userId string) (*timers.TimeEntry, error)
+    StartTimer(ctx context.Context, req *timers.TimerStartReq, userId string, isAdmin bool) (*timers.TimeEntry, error)
+    StopTimer(ctx context.Context, userId string) (*timers.TimeEntry, error)
+    FindTimeEntry(ctx context.Context, req *timers.TimeEntryFilter, userId string, isAdmin bool) ([]*timers.TimeEntry, error)
+}
+
+type timersUsecase struct {
+    cfg config.IConfig
+    timersRepository timersRepositories.ITimersRepository
+    tasksUsecase tasksUsecases.ITasksUsecase
+}
+
+func TimersUsecase(cfg config.IConfig, timersRepository timersRepositories.ITimersRepository, tasksUsecase tasksUsecases.ITasksUsecase) ITimersUsecase {
+    return &timersUsecase{
+        cfg: cfg,
+        timersRepository: timersRepository,
+        tasksUsecase: tasksUsecase,
+    }
+}
+
+func (u *timersUsecase) FindRunningTimer(ctx context.Context, userId string) (*timers.TimeEntry, error) {
+    ctx, span := wymjtrace.Start(ctx, "timersUsecase.FindRunningTimer")
+    defer span.End()
+
+    return u.timersRepository.FindRunningTimer(ctx, userId)
+}
+
+func (u *timersUsecase) StartTimer(ctx context.Context, req *timers.TimerStartReq, userId string, isAdmin bool) (*timers.TimeEntry, error) {
+    ctx, span := wymjtrace.Start(ctx, "timersUsecase.StartTimer")
+    defer span.End()
+
+    // check task owner
+    if _, err := u.tasksUsecase.FindOneTask(ctx, req.TaskId, userId, isAdmin); err != nil {
+        return nil, err
+    }
+
+    entry, err := u.timersRepository.StartTimer(ctx, userId, req.TaskId)
+    if err != nil {
+        return nil, err
+    }
+    return entry, nil
+}
+
+func (u *timersUsecase) StopTimer(ctx context.Context, userId string) (*timers.TimeEntry, error) {
+    ctx, span := wymjtrace.Start(ctx, "timersUsecase.StopTimer")
+    defer span.End()
+
+    entry, err := u.timersRepository.StopTimer(ctx, userId)
+    if err != nil {
+        return nil, err
+    }
+    return entry, nil
+}
+
+func (u *timersUsecase) FindTimeEntry(ctx context.Context, req *timers.TimeEntryFilter, userId string, isAdmin bool) ([]*timers.TimeEntry, error) {
+    ctx, span := wymjtrace.Start(ctx, "timersUsecase.FindTimeEntry")
+    defer span.End()
+
+    if _, err := u.tasksUsecase.FindOneTask(ctx, req.TaskId, userId, isAdmin); err != nil {
+        return nil, err
+    }
+    return u.timersRepository.FindTimeEntry(ctx, req)
+}
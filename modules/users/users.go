@@ -3,7 +3,9 @@ package users
 import (
 	"fmt"
 	"regexp"
+	"time"
 
+	"github.com/ppp3ppj/wymj/modules/entities"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -12,6 +14,11 @@ type User struct {
     Email string `db:"email" json:"email"`
     Username string `db:"username" json:"username"`
     RoleId int `db:"role_id" json:"role_id"`
+    EmailVerified bool `db:"email_verified" json:"email_verified"`
+    TotpEnabled bool `db:"totp_enabled" json:"totp_enabled"`
+    Disabled bool `db:"disabled" json:"disabled"`
+    CreatedAt time.Time `db:"created_at" json:"created_at"`
+    UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
 }
 
 type UserRegisterReq struct {
@@ -31,6 +38,11 @@ type UserCredentialCheck struct {
     Password string `db:"password"`
     Username string `db:"username"`
     RoleId int `db:"role_id"`
+    EmailVerified bool `db:"email_verified"`
+    TotpEnabled bool `db:"totp_enabled"`
+    Disabled bool `db:"disabled"`
+    CreatedAt time.Time `db:"created_at"`
+    UpdatedAt time.Time `db:"updated_at"`
 }
 
 // default hashing cost is 10
@@ -43,17 +55,79 @@ func (obj *UserRegisterReq) BcryptHashing() error {
     return nil
 }
 
+type UserForgotPasswordReq struct {
+    Email string `json:"email" form:"email"`
+}
+
+type UserVerifyEmailReq struct {
+    Token string `json:"token" form:"token"`
+}
+
+type UserResendVerificationReq struct {
+    Email string `json:"email" form:"email"`
+}
+
+type UserResetPasswordReq struct {
+    Token string `json:"token" form:"token"`
+    Password string `json:"password" form:"password"`
+}
+
+func (obj *UserResetPasswordReq) BcryptHashing() error {
+    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(obj.Password), 10)
+    if err != nil {
+        return fmt.Errorf("bcrypt hashing failed: %v", err)
+    }
+    obj.Password = string(hashedPassword)
+    return nil
+}
+
 func (obj *UserRegisterReq) IsEmail() bool {
-    match, err := regexp.MatchString((`^[\w-\.]+@([\w-]+\.)+[\w-]{2,4}$`), obj.Email)
+    return IsEmail(obj.Email)
+}
+
+func IsEmail(email string) bool {
+    match, err := regexp.MatchString((`^[\w-\.]+@([\w-]+\.)+[\w-]{2,4}$`), email)
     if err != nil {
         return false
     }
     return match
 }
 
+// UserUpdateReq empty field is not changed, new email must be verified again
+type UserUpdateReq struct {
+    Username string `json:"username" form:"username"`
+    Email string `json:"email" form:"email"`
+}
+
+type UserChangePasswordReq struct {
+    OldPassword string `json:"old_password" form:"old_password"`
+    NewPassword string `json:"new_password" form:"new_password"`
+}
+
+func (obj *UserChangePasswordReq) BcryptHashing() error {
+    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(obj.NewPassword), 10)
+    if err != nil {
+        return fmt.Errorf("bcrypt hashing failed: %v", err)
+    }
+    obj.NewPassword = string(hashedPassword)
+    return nil
+}
+
+// UserDeleteReq password confirm that owner of the account delete it
+type UserDeleteReq struct {
+    Password string `json:"password" form:"password"`
+}
+
+// UserPassport has Challenge instead of Token when user must pass totp step
 type UserPassport struct {
     User *User `json:"user"`
     Token *UserToken `json:"token"`
+    Challenge *UserChallenge `json:"challenge,omitempty"`
+}
+
+type UserChallenge struct {
+    Token string `json:"token"`
+    ExpiresIn int `json:"expires_in"`
 }
 
 type UserToken struct {
@@ -62,11 +136,21 @@ type UserToken struct {
     RefreshToken string `db:"refresh_token" json:"refresh_token"`
 }
 
+// Scope is empty for full access, "unverified" when email is not verified yet
 type UserClaims struct {
     Id string `db:"id" json:"id"`
     RoleId int `db:"role" json:"role"`
+    Scope string `db:"scope" json:"scope,omitempty"`
+    // only in oauth2 client token
+    ClientId string `db:"client_id" json:"client_id,omitempty"`
 }
 
+const (
+    UnverifiedScope = "unverified"
+    // user of role that require 2fa but has not enrolled, can only enroll totp
+    TotpEnrollScope = "totp_enroll"
+)
+
 type UserRefreshCredential struct {
     RefreshToken string `json:"refresh_token" form:"refresh_token"`
 }
@@ -76,6 +160,120 @@ type Oauth struct {
     UserId string `db:"user_id" json:"user_id"`
 }
 
+// OauthRefreshToken is one refresh token in rotation history of an oauth session
+type OauthRefreshToken struct {
+    Id string `db:"id" json:"id"`
+    OauthId string `db:"oauth_id" json:"oauth_id"`
+    UserId string `db:"user_id" json:"user_id"`
+    UsedAt *time.Time `db:"used_at" json:"used_at"`
+    RevokedAt *time.Time `db:"revoked_at" json:"revoked_at"`
+}
+
+// OauthClient is who sign in or refresh, read from request header
+type OauthClient struct {
+    UserAgent string `db:"user_agent" json:"user_agent"`
+    Ip string `db:"ip" json:"ip"`
+}
+
+type OauthSession struct {
+    Id string `db:"id" json:"id"`
+    UserAgent string `db:"user_agent" json:"user_agent"`
+    Ip string `db:"ip" json:"ip"`
+    Current bool `db:"current" json:"current"`
+    CreatedAt time.Time `db:"created_at" json:"created_at"`
+    RefreshedAt *time.Time `db:"refreshed_at" json:"refreshed_at"`
+}
+
+type UserTotp struct {
+    Secret *string `db:"totp_secret"`
+    Enabled bool `db:"totp_enabled"`
+    LastStep int64 `db:"totp_last_step"`
+}
+
+type UserTotpEnroll struct {
+    Secret string `json:"secret"`
+    Uri string `json:"uri"`
+}
+
+type UserTotpRecoveryCodes struct {
+    RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Code is totp code or one of recovery codes
+type UserTotpReq struct {
+    ChallengeToken string `json:"challenge_token" form:"challenge_token"`
+    Code string `json:"code" form:"code"`
+}
+
+type RoleTotpReq struct {
+    Required bool `json:"required" form:"required"`
+}
+
+type SignInThrottle struct {
+    Key string `db:"key"`
+    FailedCount int `db:"failed_count"`
+    LastFailedAt *time.Time `db:"last_failed_at"`
+    LockedUntil *time.Time `db:"locked_until"`
+}
+
 type UserRemoveCredential struct {
     OauthId string `json:"oauth_id" form:"oauth_id"`
 }
+
+// OidcAuthorizeRes Url is where browser go to sign in, State should be kept to compare on callback
+type OidcAuthorizeRes struct {
+    Url string `json:"url"`
+    State string `json:"state"`
+}
+
+type OidcCallbackReq struct {
+    Code string `json:"code" form:"code"`
+    State string `json:"state" form:"state"`
+}
+
+type OidcState struct {
+    Provider string `db:"provider"`
+    CodeVerifier string `db:"code_verifier"`
+    Nonce string `db:"nonce"`
+}
+
+// UserIdentity is external account that is linked to user
+type UserIdentity struct {
+    Provider string `db:"provider" json:"provider"`
+    Subject string `db:"subject" json:"subject"`
+    Email string `db:"email" json:"email"`
+}
+
+// UserDirectory is user in admin user listing, time is kept as text so it can be used in cursor
+type UserDirectory struct {
+    Id string `json:"id"`
+    Email string `json:"email"`
+    Username string `json:"username"`
+    RoleId int `json:"role_id"`
+    RoleIds []int `json:"role_ids"`
+    EmailVerified bool `json:"email_verified"`
+    TotpEnabled bool `json:"totp_enabled"`
+    DisabledAt *string `json:"disabled_at"`
+    SessionCount int `json:"session_count"`
+    CreatedAt string `json:"created_at"`
+    UpdatedAt string `json:"updated_at"`
+}
+
+// UserFilter created_from and created_to are date (2006-01-02) or RFC 3339 time
+type UserFilter struct {
+    Email string `query:"email"`
+    Username string `query:"username"`
+    RoleId int `query:"role_id"`
+    CreatedFrom string `query:"created_from"`
+    CreatedTo string `query:"created_to"`
+    *entities.CursorReq
+    *entities.SortReq
+}
+
+// UserCursor is last row of a page, Value is the order by column of the row
+type UserCursor struct {
+    OrderBy string `json:"o"`
+    Sort string `json:"s"`
+    Value string `json:"v"`
+    Id string `json:"i"`
+}
@@ -1,6 +1,7 @@
 package usersHandlers
 
 import (
+	"strconv"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
@@ -20,6 +21,28 @@ const (
     singupAdminErr userHandlerErrCode = "users-005"
     generateAdminTokenErr userHandlerErrCode = "users-006"
     getUserProfileErr userHandlerErrCode = "users-007"
+    findSessionErr userHandlerErrCode = "users-008"
+    revokeSessionErr userHandlerErrCode = "users-009"
+    revokeAllSessionErr userHandlerErrCode = "users-010"
+    forceSignOutErr userHandlerErrCode = "users-011"
+    forgotPasswordErr userHandlerErrCode = "users-012"
+    resetPasswordErr userHandlerErrCode = "users-013"
+    verifyEmailErr userHandlerErrCode = "users-014"
+    resendVerificationErr userHandlerErrCode = "users-015"
+    verifyTotpErr userHandlerErrCode = "users-016"
+    enrollTotpErr userHandlerErrCode = "users-017"
+    enableTotpErr userHandlerErrCode = "users-018"
+    disableTotpErr userHandlerErrCode = "users-019"
+    updateRoleTotpErr userHandlerErrCode = "users-020"
+    unlockUserErr userHandlerErrCode = "users-021"
+    oidcAuthorizeErr userHandlerErrCode = "users-022"
+    oidcSignInErr userHandlerErrCode = "users-023"
+    updateUserProfileErr userHandlerErrCode = "users-024"
+    changePasswordErr userHandlerErrCode = "users-025"
+    deleteUserErr userHandlerErrCode = "users-026"
+    findUserErr userHandlerErrCode = "users-027"
+    disableUserErr userHandlerErrCode = "users-029"
+    enableUserErr userHandlerErrCode = "users-030"
 )
 
 type IUsersHandler interface {
@@ -30,6 +53,28 @@ type IUsersHandler interface {
     SignUpAdmin(c *fiber.Ctx) error
     GenerateAdminToken(c *fiber.Ctx) error
     GetUserProfile(c *fiber.Ctx) error
+    FindSession(c *fiber.Ctx) error
+    RevokeSession(c *fiber.Ctx) error
+    RevokeAllSession(c *fiber.Ctx) error
+    ForceSignOut(c *fiber.Ctx) error
+    ForgotPassword(c *fiber.Ctx) error
+    ResetPassword(c *fiber.Ctx) error
+    VerifyEmail(c *fiber.Ctx) error
+    ResendVerification(c *fiber.Ctx) error
+    VerifyTotp(c *fiber.Ctx) error
+    EnrollTotp(c *fiber.Ctx) error
+    EnableTotp(c *fiber.Ctx) error
+    DisableTotp(c *fiber.Ctx) error
+    UpdateRoleTotp(c *fiber.Ctx) error
+    UnlockUser(c *fiber.Ctx) error
+    OidcAuthorize(c *fiber.Ctx) error
+    OidcSignIn(c *fiber.Ctx) error
+    UpdateUserProfile(c *fiber.Ctx) error
+    ChangePassword(c *fiber.Ctx) error
+    DeleteUser(c *fiber.Ctx) error
+    FindUser(c *fiber.Ctx) error
+    DisableUser(c *fiber.Ctx) error
+    EnableUser(c *fiber.Ctx) error
 }
 
 type usersHandler struct {
@@ -44,6 +89,13 @@ func UsersHandler(cfg config.IConfig, userUsecase usersUsecases.IUserUsecase) IU
     }
 }
 
+func oauthClient(c *fiber.Ctx) *users.OauthClient {
+    return &users.OauthClient{
+        UserAgent: c.Get(fiber.HeaderUserAgent),
+        Ip: c.IP(),
+    }
+}
+
 func (h *usersHandler) SignUpCustomer(c *fiber.Ctx) error {
     // Request body parsing
     req := new(users.UserRegisterReq)
@@ -63,7 +115,7 @@ func (h *usersHandler) SignUpCustomer(c *fiber.Ctx) error {
         ).Res()
     }
     // Insert users
-    result, err := h.usersUsecase.InsertCustomer(req)
+    result, err := h.usersUsecase.InsertCustomer(c.UserContext(), req)
     if err != nil {
         switch err.Error() {
             case "username has been used": 
@@ -99,8 +151,22 @@ func (h *usersHandler) SignIn(c *fiber.Ctx) error {
         ).Res()
     }
 
-    passport, err := h.usersUsecase.GetPassport(req)
+    passport, err := h.usersUsecase.GetPassport(c.UserContext(), req, oauthClient(c))
     if err != nil {
+        if err.Error() == "too many failed sign in attempts, please try again later" {
+            return entities.NewResponse(c).Error(
+                fiber.ErrTooManyRequests.Code,
+                string(signInErr),
+                err.Error(),
+            ).Res()
+        }
+        if err.Error() == "account is disabled" {
+            return entities.NewResponse(c).Error(
+                fiber.ErrForbidden.Code,
+                string(signInErr),
+                err.Error(),
+            ).Res()
+        }
         return entities.NewResponse(c).Error(
             fiber.ErrUnauthorized.Code,
             string(signInErr),
@@ -120,8 +186,15 @@ func (h *usersHandler) RefreshPassport(c *fiber.Ctx) error {
         ).Res()
     }
 
-    passport, err := h.usersUsecase.RefreshPassport(req)
+    passport, err := h.usersUsecase.RefreshPassport(c.UserContext(), req, oauthClient(c))
     if err != nil {
+        if err.Error() == "account is disabled" {
+            return entities.NewResponse(c).Error(
+                fiber.ErrForbidden.Code,
+                string(refreshPassportErr),
+                err.Error(),
+            ).Res()
+        }
         return entities.NewResponse(c).Error(
             fiber.ErrUnauthorized.Code,
             string(refreshPassportErr),
@@ -142,7 +215,8 @@ func (h *usersHandler) SignOut(c *fiber.Ctx) error {
         ).Res()
     }
     
-    if err := h.usersUsecase.DeleteOauth(req.OauthId); err != nil {
+    userId, _ := c.Locals("userId").(string)
+    if err := h.usersUsecase.DeleteOauth(c.UserContext(), userId, req.OauthId); err != nil {
         return entities.NewResponse(c).Error(
             fiber.ErrBadRequest.Code,
             string(signOutErr),
@@ -172,7 +246,7 @@ func (h *usersHandler) SignUpAdmin(c *fiber.Ctx) error {
         ).Res()
     }
     // Insert users
-    result, err := h.usersUsecase.InsertCustomer(req)
+    result, err := h.usersUsecase.InsertCustomer(c.UserContext(), req)
     if err != nil {
         switch err.Error() {
             case "username has been used": 
@@ -222,14 +296,14 @@ func (h *usersHandler) GenerateAdminToken(c *fiber.Ctx) error {
 func (h *usersHandler) GetUserProfile(c *fiber.Ctx) error {
     userId := strings.Trim(c.Params("user_id"), " ")
 
-    result, err := h.usersUsecase.GetUserProfile(userId)
+    result, err := h.usersUsecase.GetUserProfile(c.UserContext(), userId)
     if err != nil {
         switch err.Error() {
-        case "get user faild: sql: no rows in result set":
+        case "get user failed: sql: no rows in result set":
             return entities.NewResponse(c).Error(
                 fiber.ErrNotFound.Code,
                 string(getUserProfileErr),
-                err.Error(),
+                "user not found",
             ).Res()
         default:
             return entities.NewResponse(c).Error(
@@ -241,3 +315,608 @@ func (h *usersHandler) GetUserProfile(c *fiber.Ctx) error {
     }
     return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
 }
+
+func (h *usersHandler) UpdateUserProfile(c *fiber.Ctx) error {
+    userId := strings.Trim(c.Params("user_id"), " ")
+    req := new(users.UserUpdateReq)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(updateUserProfileErr),
+            err.Error(),
+        ).Res()
+    }
+
+    result, err := h.usersUsecase.UpdateUserProfile(c.UserContext(), userId, req)
+    if err != nil {
+        switch err.Error() {
+        case "email pattern is invalid", "username has been used", "email has been used":
+            return entities.NewResponse(c).Error(
+                fiber.ErrBadRequest.Code,
+                string(updateUserProfileErr),
+                err.Error(),
+            ).Res()
+        case "user not found", "get user failed: sql: no rows in result set":
+            return entities.NewResponse(c).Error(
+                fiber.ErrNotFound.Code,
+                string(updateUserProfileErr),
+                "user not found",
+            ).Res()
+        default:
+            return entities.NewResponse(c).Error(
+                fiber.ErrInternalServerError.Code,
+                string(updateUserProfileErr),
+                err.Error(),
+            ).Res()
+        }
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+// ChangePassword keep current session, other sessions are signed out
+func (h *usersHandler) ChangePassword(c *fiber.Ctx) error {
+    userId := strings.Trim(c.Params("user_id"), " ")
+    accessToken := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+    req := new(users.UserChangePasswordReq)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(changePasswordErr),
+            err.Error(),
+        ).Res()
+    }
+
+    if err := h.usersUsecase.ChangePassword(c.UserContext(), userId, accessToken, req); err != nil {
+        switch err.Error() {
+        case "old password is invalid", "password must be at least 8 characters":
+            return entities.NewResponse(c).Error(
+                fiber.ErrBadRequest.Code,
+                string(changePasswordErr),
+                err.Error(),
+            ).Res()
+        default:
+            return entities.NewResponse(c).Error(
+                fiber.ErrInternalServerError.Code,
+                string(changePasswordErr),
+                err.Error(),
+            ).Res()
+        }
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+func (h *usersHandler) DeleteUser(c *fiber.Ctx) error {
+    userId := strings.Trim(c.Params("user_id"), " ")
+    req := new(users.UserDeleteReq)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(deleteUserErr),
+            err.Error(),
+        ).Res()
+    }
+
+    if err := h.usersUsecase.DeleteUser(c.UserContext(), userId, req); err != nil {
+        switch err.Error() {
+        case "password is invalid":
+            return entities.NewResponse(c).Error(
+                fiber.ErrBadRequest.Code,
+                string(deleteUserErr),
+                err.Error(),
+            ).Res()
+        case "user not found":
+            return entities.NewResponse(c).Error(
+                fiber.ErrNotFound.Code,
+                string(deleteUserErr),
+                "user not found",
+            ).Res()
+        default:
+            return entities.NewResponse(c).Error(
+                fiber.ErrInternalServerError.Code,
+                string(deleteUserErr),
+                err.Error(),
+            ).Res()
+        }
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+func (h *usersHandler) FindUser(c *fiber.Ctx) error {
+    req := &users.UserFilter{
+        CursorReq: &entities.CursorReq{},
+        SortReq: &entities.SortReq{},
+    }
+    if err := c.QueryParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(findUserErr),
+            err.Error(),
+        ).Res()
+    }
+
+    result, err := h.usersUsecase.FindUser(c.UserContext(), req)
+    if err != nil {
+        switch err.Error() {
+        case "cursor is invalid",
+            "order_by is invalid",
+            "sort is invalid",
+            "created_from is invalid",
+            "created_to is invalid":
+            return entities.NewResponse(c).Error(
+                fiber.ErrBadRequest.Code,
+                string(findUserErr),
+                err.Error(),
+            ).Res()
+        default:
+            return entities.NewResponse(c).Error(
+                fiber.ErrInternalServerError.Code,
+                string(findUserErr),
+                err.Error(),
+            ).Res()
+        }
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+func (h *usersHandler) DisableUser(c *fiber.Ctx) error {
+    return h.disableUser(c, true, disableUserErr)
+}
+
+func (h *usersHandler) EnableUser(c *fiber.Ctx) error {
+    return h.disableUser(c, false, enableUserErr)
+}
+
+func (h *usersHandler) disableUser(c *fiber.Ctx, disabled bool, errCode userHandlerErrCode) error {
+    adminId, _ := c.Locals("userId").(string)
+    userId := strings.Trim(c.Params("user_id"), " ")
+
+    if err := h.usersUsecase.DisableUser(c.UserContext(), adminId, userId, disabled); err != nil {
+        switch err.Error() {
+        case "can not disable your own account":
+            return entities.NewResponse(c).Error(
+                fiber.ErrBadRequest.Code,
+                string(errCode),
+                err.Error(),
+            ).Res()
+        case "user not found":
+            return entities.NewResponse(c).Error(
+                fiber.ErrNotFound.Code,
+                string(errCode),
+                "user not found",
+            ).Res()
+        default:
+            return entities.NewResponse(c).Error(
+                fiber.ErrInternalServerError.Code,
+                string(errCode),
+                err.Error(),
+            ).Res()
+        }
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+func (h *usersHandler) FindSession(c *fiber.Ctx) error {
+    userId, _ := c.Locals("userId").(string)
+    accessToken := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+
+    sessions, err := h.usersUsecase.FindOauth(c.UserContext(), userId, accessToken)
+    if err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrInternalServerError.Code,
+            string(findSessionErr),
+            err.Error(),
+        ).Res()
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, sessions).Res()
+}
+
+func (h *usersHandler) RevokeSession(c *fiber.Ctx) error {
+    userId, _ := c.Locals("userId").(string)
+    oauthId := strings.Trim(c.Params("oauth_id"), " ")
+
+    if err := h.usersUsecase.RevokeOauth(c.UserContext(), userId, oauthId); err != nil {
+        if err.Error() == "oauth not found" {
+            return entities.NewResponse(c).Error(
+                fiber.ErrNotFound.Code,
+                string(revokeSessionErr),
+                err.Error(),
+            ).Res()
+        }
+        return entities.NewResponse(c).Error(
+            fiber.ErrInternalServerError.Code,
+            string(revokeSessionErr),
+            err.Error(),
+        ).Res()
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+func (h *usersHandler) RevokeAllSession(c *fiber.Ctx) error {
+    userId, _ := c.Locals("userId").(string)
+
+    if err := h.usersUsecase.RevokeAllOauth(c.UserContext(), userId); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrInternalServerError.Code,
+            string(revokeAllSessionErr),
+            err.Error(),
+        ).Res()
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+// ForceSignOut is used by admin to revoke every session of any user
+func (h *usersHandler) ForceSignOut(c *fiber.Ctx) error {
+    userId := strings.Trim(c.Params("user_id"), " ")
+
+    if err := h.usersUsecase.RevokeAllOauth(c.UserContext(), userId); err != nil {
+        if err.Error() == "get user failed: sql: no rows in result set" {
+            return entities.NewResponse(c).Error(
+                fiber.ErrNotFound.Code,
+                string(forceSignOutErr),
+                "user not found",
+            ).Res()
+        }
+        return entities.NewResponse(c).Error(
+            fiber.ErrInternalServerError.Code,
+            string(forceSignOutErr),
+            err.Error(),
+        ).Res()
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+func (h *usersHandler) ForgotPassword(c *fiber.Ctx) error {
+    req := new(users.UserForgotPasswordReq)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(forgotPasswordErr),
+            err.Error(),
+        ).Res()
+    }
+
+    if err := h.usersUsecase.ForgotPassword(c.UserContext(), req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrInternalServerError.Code,
+            string(forgotPasswordErr),
+            err.Error(),
+        ).Res()
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+func (h *usersHandler) ResetPassword(c *fiber.Ctx) error {
+    req := new(users.UserResetPasswordReq)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(resetPasswordErr),
+            err.Error(),
+        ).Res()
+    }
+
+    if err := h.usersUsecase.ResetPassword(c.UserContext(), req); err != nil {
+        switch err.Error() {
+            case "reset token is invalid or expired", "password must be at least 8 characters":
+                return entities.NewResponse(c).Error(
+                    fiber.ErrBadRequest.Code,
+                    string(resetPasswordErr),
+                    err.Error(),
+                ).Res()
+            default:
+                return entities.NewResponse(c).Error(
+                    fiber.ErrInternalServerError.Code,
+                    string(resetPasswordErr),
+                    err.Error(),
+                ).Res()
+        }
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+func (h *usersHandler) VerifyEmail(c *fiber.Ctx) error {
+    req := new(users.UserVerifyEmailReq)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(verifyEmailErr),
+            err.Error(),
+        ).Res()
+    }
+
+    if err := h.usersUsecase.VerifyEmail(c.UserContext(), req); err != nil {
+        if err.Error() == "verification token is invalid or expired" {
+            return entities.NewResponse(c).Error(
+                fiber.ErrBadRequest.Code,
+                string(verifyEmailErr),
+                err.Error(),
+            ).Res()
+        }
+        return entities.NewResponse(c).Error(
+            fiber.ErrInternalServerError.Code,
+            string(verifyEmailErr),
+            err.Error(),
+        ).Res()
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+func (h *usersHandler) ResendVerification(c *fiber.Ctx) error {
+    req := new(users.UserResendVerificationReq)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(resendVerificationErr),
+            err.Error(),
+        ).Res()
+    }
+
+    if err := h.usersUsecase.ResendVerification(c.UserContext(), req); err != nil {
+        if err.Error() == "verification email was sent recently, please try again later" {
+            return entities.NewResponse(c).Error(
+                fiber.ErrTooManyRequests.Code,
+                string(resendVerificationErr),
+                err.Error(),
+            ).Res()
+        }
+        return entities.NewResponse(c).Error(
+            fiber.ErrInternalServerError.Code,
+            string(resendVerificationErr),
+            err.Error(),
+        ).Res()
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+func (h *usersHandler) VerifyTotp(c *fiber.Ctx) error {
+    req := new(users.UserTotpReq)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(verifyTotpErr),
+            err.Error(),
+        ).Res()
+    }
+
+    passport, err := h.usersUsecase.VerifyTotp(c.UserContext(), req, oauthClient(c))
+    if err != nil {
+        if err.Error() == "too many failed sign in attempts, please try again later" {
+            return entities.NewResponse(c).Error(
+                fiber.ErrTooManyRequests.Code,
+                string(verifyTotpErr),
+                err.Error(),
+            ).Res()
+        }
+        return entities.NewResponse(c).Error(
+            fiber.ErrUnauthorized.Code,
+            string(verifyTotpErr),
+            err.Error(),
+        ).Res()
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, passport).Res()
+}
+
+func (h *usersHandler) EnrollTotp(c *fiber.Ctx) error {
+    userId, _ := c.Locals("userId").(string)
+
+    result, err := h.usersUsecase.EnrollTotp(c.UserContext(), userId)
+    if err != nil {
+        if err.Error() == "two-factor authentication is already enabled" {
+            return entities.NewResponse(c).Error(
+                fiber.ErrConflict.Code,
+                string(enrollTotpErr),
+                err.Error(),
+            ).Res()
+        }
+        return entities.NewResponse(c).Error(
+            fiber.ErrInternalServerError.Code,
+            string(enrollTotpErr),
+            err.Error(),
+        ).Res()
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+func (h *usersHandler) EnableTotp(c *fiber.Ctx) error {
+    userId, _ := c.Locals("userId").(string)
+    req := new(users.UserTotpReq)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(enableTotpErr),
+            err.Error(),
+        ).Res()
+    }
+
+    result, err := h.usersUsecase.EnableTotp(c.UserContext(), userId, req)
+    if err != nil {
+        switch err.Error() {
+            case "code is invalid", "two-factor authentication is not enrolled":
+                return entities.NewResponse(c).Error(
+                    fiber.ErrBadRequest.Code,
+                    string(enableTotpErr),
+                    err.Error(),
+                ).Res()
+            case "two-factor authentication is already enabled":
+                return entities.NewResponse(c).Error(
+                    fiber.ErrConflict.Code,
+                    string(enableTotpErr),
+                    err.Error(),
+                ).Res()
+            default:
+                return entities.NewResponse(c).Error(
+                    fiber.ErrInternalServerError.Code,
+                    string(enableTotpErr),
+                    err.Error(),
+                ).Res()
+        }
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+func (h *usersHandler) DisableTotp(c *fiber.Ctx) error {
+    userId, _ := c.Locals("userId").(string)
+    req := new(users.UserTotpReq)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(disableTotpErr),
+            err.Error(),
+        ).Res()
+    }
+
+    if err := h.usersUsecase.DisableTotp(c.UserContext(), userId, req); err != nil {
+        switch err.Error() {
+            case "code is invalid", "two-factor authentication is not enabled":
+                return entities.NewResponse(c).Error(
+                    fiber.ErrBadRequest.Code,
+                    string(disableTotpErr),
+                    err.Error(),
+                ).Res()
+            case "two-factor authentication is required for your role":
+                return entities.NewResponse(c).Error(
+                    fiber.ErrForbidden.Code,
+                    string(disableTotpErr),
+                    err.Error(),
+                ).Res()
+            default:
+                return entities.NewResponse(c).Error(
+                    fiber.ErrInternalServerError.Code,
+                    string(disableTotpErr),
+                    err.Error(),
+                ).Res()
+        }
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+func (h *usersHandler) UpdateRoleTotp(c *fiber.Ctx) error {
+    roleId, err := strconv.Atoi(strings.Trim(c.Params("role_id"), " "))
+    if err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(updateRoleTotpErr),
+            "role_id is invalid",
+        ).Res()
+    }
+    req := new(users.RoleTotpReq)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(updateRoleTotpErr),
+            err.Error(),
+        ).Res()
+    }
+
+    if err := h.usersUsecase.UpdateRoleTotp(c.UserContext(), roleId, req); err != nil {
+        if err.Error() == "role not found" {
+            return entities.NewResponse(c).Error(
+                fiber.ErrNotFound.Code,
+                string(updateRoleTotpErr),
+                err.Error(),
+            ).Res()
+        }
+        return entities.NewResponse(c).Error(
+            fiber.ErrInternalServerError.Code,
+            string(updateRoleTotpErr),
+            err.Error(),
+        ).Res()
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+func (h *usersHandler) UnlockUser(c *fiber.Ctx) error {
+    userId := strings.Trim(c.Params("user_id"), " ")
+
+    if err := h.usersUsecase.UnlockUser(c.UserContext(), userId); err != nil {
+        if err.Error() == "get user failed: sql: no rows in result set" {
+            return entities.NewResponse(c).Error(
+                fiber.ErrNotFound.Code,
+                string(unlockUserErr),
+                "user not found",
+            ).Res()
+        }
+        return entities.NewResponse(c).Error(
+            fiber.ErrInternalServerError.Code,
+            string(unlockUserErr),
+            err.Error(),
+        ).Res()
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+func (h *usersHandler) OidcAuthorize(c *fiber.Ctx) error {
+    result, err := h.usersUsecase.OidcAuthorize(c.UserContext(), strings.ToLower(c.Params("provider")))
+    if err != nil {
+        switch err.Error() {
+            case "oidc provider not found":
+                return entities.NewResponse(c).Error(
+                    fiber.ErrNotFound.Code,
+                    string(oidcAuthorizeErr),
+                    err.Error(),
+                ).Res()
+            default:
+                return entities.NewResponse(c).Error(
+                    fiber.ErrInternalServerError.Code,
+                    string(oidcAuthorizeErr),
+                    err.Error(),
+                ).Res()
+        }
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+// OidcSignIn is called by frontend with code and state that provider sent to redirect uri,
+// response is the same passport as SignIn
+func (h *usersHandler) OidcSignIn(c *fiber.Ctx) error {
+    req := new(users.OidcCallbackReq)
+    if err := c.BodyParser(req); err != nil {
+        return entities.NewResponse(c).Error(
+            fiber.ErrBadRequest.Code,
+            string(oidcSignInErr),
+            err.Error(),
+        ).Res()
+    }
+
+    passport, err := h.usersUsecase.OidcSignIn(c.UserContext(), strings.ToLower(c.Params("provider")), req, oauthClient(c))
+    if err != nil {
+        switch {
+            case err.Error() == "oidc provider not found":
+                return entities.NewResponse(c).Error(
+                    fiber.ErrNotFound.Code,
+                    string(oidcSignInErr),
+                    err.Error(),
+                ).Res()
+            case err.Error() == "code and state are required",
+                err.Error() == "email is required from provider":
+                return entities.NewResponse(c).Error(
+                    fiber.ErrBadRequest.Code,
+                    string(oidcSignInErr),
+                    err.Error(),
+                ).Res()
+            case err.Error() == "account is not linked, please sign up first",
+                err.Error() == "email has been used",
+                err.Error() == "email is not verified",
+                err.Error() == "account is disabled":
+                return entities.NewResponse(c).Error(
+                    fiber.ErrForbidden.Code,
+                    string(oidcSignInErr),
+                    err.Error(),
+                ).Res()
+            case err.Error() == "state is invalid or expired",
+                strings.HasPrefix(err.Error(), "oidc sign in failed"):
+                return entities.NewResponse(c).Error(
+                    fiber.ErrUnauthorized.Code,
+                    string(oidcSignInErr),
+                    err.Error(),
+                ).Res()
+            default:
+                return entities.NewResponse(c).Error(
+                    fiber.ErrInternalServerError.Code,
+                    string(oidcSignInErr),
+                    err.Error(),
+                ).Res()
+        }
+    }
+    return entities.NewResponse(c).Success(fiber.StatusOK, passport).Res()
+}
@@ -0,0 +1,250 @@
+package usersPatterns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/ppp3ppj/wymj/modules/users"
+)
+
+// use Builder pattern to build find user query with keyset pagination,
+// row after cursor is found by (order by column, id) so page is stable when users are added
+type IFindUserBuilder interface {
+    openJsonQuery()
+    initQuery()
+    whereQuery()
+    cursorQuery()
+    sort()
+    paginate()
+    closeJsonQuery()
+    resetQuery()
+    Result(ctx context.Context) ([]*users.UserDirectory, error)
+}
+
+type findUserBuilder struct {
+    db *sqlx.DB
+    req *users.UserFilter
+    cursor *users.UserCursor
+    query string
+    lastStackIndex int
+    values []any
+}
+
+// FindUserBuilder req.OrderBy and req.Sort must be checked by caller, cursor is nil on first page
+func FindUserBuilder(db *sqlx.DB, req *users.UserFilter, cursor *users.UserCursor) IFindUserBuilder {
+    return &findUserBuilder{
+        db: db,
+        req: req,
+        cursor: cursor,
+    }
+}
+
+// orderByMap column of each order by, email can be null so it is compared as empty string
+var orderByMap = map[string]string{
+    "id": `"u"."id"`,
+    "email": `COALESCE("u"."email", '')`,
+    "username": `"u"."username"`,
+    "created_at": `"u"."created_at"`,
+}
+
+func (b *findUserBuilder) openJsonQuery() {
+    b.query += `
+    SELECT
+        COALESCE(array_to_json(array_agg("t")), '[]'::json)
+    FROM (`
+}
+
+func (b *findUserBuilder) initQuery() {
+    b.query += `
+        SELECT
+            "u"."id",
+            COALESCE("u"."email", '') AS "email",
+            "u"."username",
+            "u"."role_id",
+            (
+                SELECT
+                    COALESCE(array_agg("ur"."role_id" ORDER BY "ur"."role_id"), '{}')
+                FROM "user_roles" "ur"
+                WHERE "ur"."user_id" = "u"."id"
+            ) AS "role_ids",
+            ("u"."email_verified_at" IS NOT NULL) AS "email_verified",
+            ("u"."totp_enabled_at" IS NOT NULL) AS "totp_enabled",
+            "u"."disabled_at",
+            (
+                SELECT
+                    COUNT(*)
+                FROM "oauth" "o"
+                WHERE "o"."user_id" = "u"."id"
+                AND "o"."revoked_at" IS NULL
+            ) AS "session_count",
+            "u"."created_at",
+            "u"."updated_at"
+        FROM "users" "u"
+        WHERE "u"."deleted_at" IS NULL`
+}
+
+func (b *findUserBuilder) whereQuery() {
+    var queryWhere string
+    queryWhereStack := make([]string, 0)
+
+    // Email check
+    if b.req.Email != "" {
+        b.values = append(b.values, "%"+strings.ToLower(b.req.Email)+"%")
+        queryWhereStack = append(queryWhereStack, `
+        AND LOWER("u"."email") LIKE ?`)
+    }
+
+    // Username check
+    if b.req.Username != "" {
+        b.values = append(b.values, "%"+strings.ToLower(b.req.Username)+"%")
+        queryWhereStack = append(queryWhereStack, `
+        AND LOWER("u"."username") LIKE ?`)
+    }
+
+    // Role check, user can have many roles
+    if b.req.RoleId != 0 {
+        b.values = append(b.values, b.req.RoleId)
+        queryWhereStack = append(queryWhereStack, `
+        AND EXISTS (SELECT 1 FROM "user_roles" "ur" WHERE "ur"."user_id" = "u"."id" AND "ur"."role_id" = ?)`)
+    }
+
+    // Created range check, created_to is exclusive
+    if b.req.CreatedFrom != "" {
+        b.values = append(b.values, b.req.CreatedFrom)
+        queryWhereStack = append(queryWhereStack, `
+        AND "u"."created_at" >= ?::timestamp`)
+    }
+    if b.req.CreatedTo != "" {
+        b.values = append(b.values, b.req.CreatedTo)
+        queryWhereStack = append(queryWhereStack, `
+        AND "u"."created_at" < ?::timestamp`)
+    }
+
+    // Replace ? with $1, $2, ... in order
+    index := 0
+    for _, stack := range queryWhereStack {
+        for strings.Contains(stack, "?") {
+            index++
+            stack = strings.Replace(stack, "?", "$"+fmt.Sprint(index), 1)
+        }
+        queryWhere += stack
+    }
+    // Last stack record
+    b.lastStackIndex = len(b.values)
+
+    b.query += queryWhere
+}
+
+func (b *findUserBuilder) cursorQuery() {
+    if b.cursor == nil {
+        return
+    }
+    operator := "<"
+    if b.req.Sort == "ASC" {
+        operator = ">"
+    }
+
+    if b.req.OrderBy == "id" {
+        b.values = append(b.values, b.cursor.Id)
+        b.query += fmt.Sprintf(`
+        AND "u"."id" %s $%d`, operator, b.lastStackIndex+1)
+        b.lastStackIndex = len(b.values)
+        return
+    }
+
+    value := "$%d"
+    if b.req.OrderBy == "created_at" {
+        value = "$%d::timestamp"
+    }
+    b.values = append(b.values, b.cursor.Value, b.cursor.Id)
+    b.query += fmt.Sprintf(`
+        AND (%s, "u"."id") %s (`+value+`, $%d)`,
+        orderByMap[b.req.OrderBy],
+        operator,
+        b.lastStackIndex+1,
+        b.lastStackIndex+2,
+    )
+    b.lastStackIndex = len(b.values)
+}
+
+func (b *findUserBuilder) sort() {
+    // order by column can not be a placeholder, it is safe because mapping above
+    if b.req.OrderBy == "id" {
+        b.query += fmt.Sprintf(`
+        ORDER BY "u"."id" %s`, b.req.Sort)
+        return
+    }
+    b.query += fmt.Sprintf(`
+        ORDER BY %s %s, "u"."id" %s`, orderByMap[b.req.OrderBy], b.req.Sort, b.req.Sort)
+}
+
+// paginate fetch one more row to know there is a next page
+func (b *findUserBuilder) paginate() {
+    b.values = append(b.values, b.req.Limit+1)
+
+    b.query += fmt.Sprintf(`
+        LIMIT $%d`, b.lastStackIndex+1)
+    b.lastStackIndex = len(b.values)
+}
+
+func (b *findUserBuilder) closeJsonQuery() {
+    b.query += `
+    ) AS "t";`
+}
+
+func (b *findUserBuilder) resetQuery() {
+    b.query = ""
+    b.values = make([]any, 0)
+    b.lastStackIndex = 0
+}
+
+func (b *findUserBuilder) Result(ctx context.Context) ([]*users.UserDirectory, error) {
+    bytes := make([]byte, 0)
+    usersData := make([]*users.UserDirectory, 0)
+    defer b.resetQuery()
+
+    if err := b.db.GetContext(ctx, &bytes, b.query, b.values...); err != nil {
+        return nil, fmt.Errorf("get users failed: %v", err)
+    }
+
+    if err := json.Unmarshal(bytes, &usersData); err != nil {
+        return nil, fmt.Errorf("unmarshal users failed: %v", err)
+    }
+    return usersData, nil
+}
+
+type findUserEngineer struct {
+    builder IFindUserBuilder
+}
+
+func FindUserEngineer(builder IFindUserBuilder) *findUserEngineer {
+    return &findUserEngineer{builder: builder}
+}
+
+func (en *findUserEngineer) FindUser() IFindUserBuilder {
+    en.builder.openJsonQuery()
+    en.builder.initQuery()
+    en.builder.whereQuery()
+    en.builder.cursorQuery()
+    en.builder.sort()
+    en.builder.paginate()
+    en.builder.closeJsonQuery()
+    return en.builder
+}
+
+// CursorValue is value of order by column of user that is put in next cursor
+func CursorValue(user *users.UserDirectory, orderBy string) string {
+    switch orderBy {
+        case "email":
+            return user.Email
+        case "username":
+            return user.Username
+        case "created_at":
+            return user.CreatedAt
+        default:
+            return user.Id
+    }
+}
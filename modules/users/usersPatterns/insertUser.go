@@ -11,9 +11,9 @@ import (
 
 // use Factory pattern to create user
 type IInsertUser interface {
-    Customer() (IInsertUser, error)
-    Admin() (IInsertUser, error)
-    Result() (*users.UserPassport, error)
+    Customer(ctx context.Context) (IInsertUser, error)
+    Admin(ctx context.Context) (IInsertUser, error)
+    Result(ctx context.Context) (*users.UserPassport, error)
 }
 
 type userReq struct {
@@ -56,19 +56,24 @@ func newAdmin(db *sqlx.DB, req *users.UserRegisterReq) IInsertUser {
     }
 }
 
-func (f *userReq) Customer() (IInsertUser, error) {
-    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (f *userReq) Customer(ctx context.Context) (IInsertUser, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
     defer cancel()
-    // change customer row id = 1 by default
+    // change customer row id = 1 by default, primary role is also added to user_roles
     query := `
-    INSERT INTO "users" (
-        "email",
-        "username",
-        "password",
-        "role_id"
-    ) 
-    VALUES ($1, $2, $3, 1)
-    RETURNING "id";`
+    WITH "u" AS (
+        INSERT INTO "users" (
+            "email",
+            "username",
+            "password",
+            "role_id"
+        ) 
+        VALUES ($1, $2, $3, 1)
+        RETURNING "id", "role_id"
+    )
+    INSERT INTO "user_roles" ("user_id", "role_id")
+    SELECT "id", "role_id" FROM "u"
+    RETURNING "user_id";`
 
     if err := f.db.QueryRowContext(
         ctx,
@@ -91,20 +96,26 @@ func (f *userReq) Customer() (IInsertUser, error) {
     return f, nil
 }
 
-func (f *userReq) Admin() (IInsertUser, error) {
-    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (f *userReq) Admin(ctx context.Context) (IInsertUser, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
     defer cancel()
 
-    // send row id = 2 for admin role
+    // send row id = 2 for admin role, admin is created by admin so email is trusted
     query := `
-    INSERT INTO "users" (
-        "email",
-        "username",
-        "password",
-        "role_id"
-    ) 
-    VALUES ($1, $2, $3, 2)
-    RETURNING "id";`
+    WITH "u" AS (
+        INSERT INTO "users" (
+            "email",
+            "username",
+            "password",
+            "role_id",
+            "email_verified_at"
+        ) 
+        VALUES ($1, $2, $3, 2, NOW())
+        RETURNING "id", "role_id"
+    )
+    INSERT INTO "user_roles" ("user_id", "role_id")
+    SELECT "id", "role_id" FROM "u"
+    RETURNING "user_id";`
 
     if err := f.db.QueryRowContext(
         ctx,
@@ -127,7 +138,7 @@ func (f *userReq) Admin() (IInsertUser, error) {
     return f, nil
 }
 
-func (f *userReq) Result() (*users.UserPassport, error) {
+func (f *userReq) Result(ctx context.Context) (*users.UserPassport, error) {
     query := `
     SELECT
         json_build_object(
@@ -139,13 +150,18 @@ func (f *userReq) Result() (*users.UserPassport, error) {
             "u"."id",
             "u"."email",
             "u"."username",
-            "u"."role_id"
+            "u"."role_id",
+            ("u"."email_verified_at" IS NOT NULL) AS "email_verified",
+            ("u"."totp_enabled_at" IS NOT NULL) AS "totp_enabled",
+            ("u"."disabled_at" IS NOT NULL) AS "disabled",
+            "u"."created_at"::timestamptz,
+            "u"."updated_at"::timestamptz
         FROM "users" "u"
         WHERE "u"."id" = $1
     ) AS "t"`
 
     data := make([]byte, 0)
-    if err := f.db.Get(&data, query, f.id); err != nil {
+    if err := f.db.GetContext(ctx, &data, query, f.id); err != nil {
         return nil, fmt.Errorf("get user failed: %v", err)
     }
 
@@ -2,23 +2,60 @@ package usersRepositories
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/ppp3ppj/wymj/modules/users"
 	"github.com/ppp3ppj/wymj/modules/users/usersPatterns"
+	"github.com/ppp3ppj/wymj/pkg/wymjauth"
 )
 
 
 type IUserRepository interface {
-    InsertUser(req *users.UserRegisterReq, isAdmin bool) (*users.UserPassport, error)
-    FindOneUserByEmail(email string) (*users.UserCredentialCheck, error)
-    InsertOauth(req *users.UserPassport) error
-    FindOneOauth(refreshToken string) (*users.Oauth, error)
-    UpdateOauth(req *users.UserToken) error
-    GetProfile(userId string) (*users.User, error)
-    DeleteOauth(oauthId string) error
+    InsertUser(ctx context.Context, req *users.UserRegisterReq, isAdmin bool) (*users.UserPassport, error)
+    FindOneUserByEmail(ctx context.Context, email string) (*users.UserCredentialCheck, error)
+    InsertOauth(ctx context.Context, req *users.UserPassport, client *users.OauthClient) error
+    FindOneOauth(ctx context.Context, refreshToken string) (*users.Oauth, error)
+    FindOneRefreshToken(ctx context.Context, refreshToken string) (*users.OauthRefreshToken, error)
+    RotateOauth(ctx context.Context, prev *users.OauthRefreshToken, req *users.UserToken, client *users.OauthClient) error
+    RevokeOauth(ctx context.Context, oauthId string) error
+    RevokeAllOauth(ctx context.Context, userId string) error
+    FindOneOauthById(ctx context.Context, oauthId string) (*users.Oauth, error)
+    FindOauth(ctx context.Context, userId, accessToken string) ([]*users.OauthSession, error)
+    GetProfile(ctx context.Context, userId string) (*users.User, error)
+    DeleteOauth(ctx context.Context, userId, oauthId string) error
+    InsertPasswordReset(ctx context.Context, userId, token string, expiredAt time.Time) error
+    ResetPassword(ctx context.Context, token, password string) error
+    InsertEmailVerification(ctx context.Context, userId, token string, expiredAt time.Time) error
+    FindLastEmailVerificationAt(ctx context.Context, userId string) (*time.Time, error)
+    VerifyEmail(ctx context.Context, token string) error
+    FindTotp(ctx context.Context, userId string) (*users.UserTotp, error)
+    UpdateTotpSecret(ctx context.Context, userId, secret string) error
+    UpdateTotpLastStep(ctx context.Context, userId string, step int64) error
+    EnableTotp(ctx context.Context, userId string, step int64, recoveryCodes []string) error
+    DisableTotp(ctx context.Context, userId string) error
+    UseRecoveryCode(ctx context.Context, userId, code string) error
+    IsTotpRequired(ctx context.Context, userId string) bool
+    UpdateRoleTotp(ctx context.Context, roleId int, required bool) error
+    FindSignInThrottle(ctx context.Context, key string) (*users.SignInThrottle, error)
+    FailSignIn(ctx context.Context, key string, threshold, lockout int) error
+    ClearSignInThrottle(ctx context.Context, key string) error
+    InsertOidcState(ctx context.Context, state string, req *users.OidcState, expiredAt time.Time) error
+    UseOidcState(ctx context.Context, provider, state string) (*users.OidcState, error)
+    FindUserIdByIdentity(ctx context.Context, provider, subject string) (string, error)
+    InsertIdentity(ctx context.Context, userId string, identity *users.UserIdentity) error
+    InsertOidcUser(ctx context.Context, req *users.UserRegisterReq, emailVerified bool, identity *users.UserIdentity) (string, error)
+    FindOneUserById(ctx context.Context, userId string) (*users.UserCredentialCheck, error)
+    UpdateProfile(ctx context.Context, userId string, req *users.UserUpdateReq) error
+    ChangePassword(ctx context.Context, userId, password, accessToken string) error
+    SoftDeleteUser(ctx context.Context, userId string) ([]string, error)
+    DeleteUser(ctx context.Context, userId string) ([]string, error)
+    FindUser(ctx context.Context, req *users.UserFilter, cursor *users.UserCursor) ([]*users.UserDirectory, error)
+    DisableUser(ctx context.Context, userId string, disabled bool) error
 }
 
 type userRepository struct {
@@ -31,73 +68,128 @@ func UsersRepository(db *sqlx.DB) IUserRepository {
     }
 }
 
-func (r *userRepository) InsertUser(req *users.UserRegisterReq, isAdmin bool) (*users.UserPassport, error) {
+func (r *userRepository) InsertUser(ctx context.Context, req *users.UserRegisterReq, isAdmin bool) (*users.UserPassport, error) {
     result := usersPatterns.InsertUser(r.db, req, isAdmin)
     var err error
     if isAdmin {
-        result, err = result.Admin()
+        result, err = result.Admin(ctx)
         if err != nil {
             return nil, err
         }
     } else {
-        result, err = result.Customer()
+        result, err = result.Customer(ctx)
         if err != nil {
             return nil, err
         }
     }
     // Get result from inserting
-    user, err := result.Result()
+    user, err := result.Result(ctx)
     if err != nil {
         return nil, err
     }
     return user, nil
 }
 
-func (r *userRepository) FindOneUserByEmail(email string) (*users.UserCredentialCheck, error) {
+func (r *userRepository) FindOneUserByEmail(ctx context.Context, email string) (*users.UserCredentialCheck, error) {
     query := `
     SELECT
         "id",
         "email",
         "password",
         "username",
-        "role_id"
+        "role_id",
+        ("email_verified_at" IS NOT NULL) AS "email_verified",
+        ("totp_enabled_at" IS NOT NULL) AS "totp_enabled",
+        ("disabled_at" IS NOT NULL) AS "disabled",
+        "created_at",
+        "updated_at"
     FROM "users"
-    WHERE "email" = $1;`
+    WHERE "email" = $1
+    AND "deleted_at" IS NULL;`
 
     user := new(users.UserCredentialCheck)
-    if err := r.db.Get(user, query, email); err != nil {
+    if err := r.db.GetContext(ctx, user, query, email); err != nil {
         return nil, fmt.Errorf("user not found: %v", err)
     }
     return user, nil
 }
 
-func (r *userRepository) InsertOauth(req *users.UserPassport) error {
+func (r *userRepository) FindOneUserById(ctx context.Context, userId string) (*users.UserCredentialCheck, error) {
+    query := `
+    SELECT
+        "id",
+        "email",
+        "password",
+        "username",
+        "role_id",
+        ("email_verified_at" IS NOT NULL) AS "email_verified",
+        ("totp_enabled_at" IS NOT NULL) AS "totp_enabled",
+        ("disabled_at" IS NOT NULL) AS "disabled",
+        "created_at",
+        "updated_at"
+    FROM "users"
+    WHERE "id" = $1
+    AND "deleted_at" IS NULL;`
+
+    user := new(users.UserCredentialCheck)
+    if err := r.db.GetContext(ctx, user, query, userId); err != nil {
+        return nil, fmt.Errorf("user not found: %v", err)
+    }
+    return user, nil
+}
+
+func (r *userRepository) InsertOauth(ctx context.Context, req *users.UserPassport, client *users.OauthClient) error {
     // set timeout for query 10s
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
     defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return err
+    }
+
     query := `
     INSERT INTO "oauth" (
         "user_id",
         "access_token",
-        "refresh_token"
+        "refresh_token",
+        "user_agent",
+        "ip"
     )
-    VALUES ($1, $2, $3)
+    VALUES ($1, $2, $3, $4, $5)
     RETURNING "id";`
 
-    if err := r.db.QueryRowContext(
+    if err := tx.QueryRowContext(
         ctx,
         query,
         req.User.Id,
         req.Token.AccessToken,
         req.Token.RefreshToken,
+        client.UserAgent,
+        client.Ip,
     ).Scan(&req.Token.Id); err != nil {
+        tx.Rollback()
         return fmt.Errorf("insert oauth failed: %v", err)
     }
 
+    // First refresh token of the session
+    if _, err := tx.ExecContext(
+        ctx,
+        `INSERT INTO "oauth_refresh_tokens" ("oauth_id", "token_hash") VALUES ($1, $2);`,
+        req.Token.Id,
+        wymjauth.HashToken(req.Token.RefreshToken),
+    ); err != nil {
+        tx.Rollback()
+        return fmt.Errorf("insert refresh token failed: %v", err)
+    }
+
+    if err := tx.Commit(); err != nil {
+        return err
+    }
     return nil
 }
 
-func (r *userRepository) FindOneOauth(refreshToken string) (*users.Oauth, error) {
+func (r *userRepository) FindOneOauth(ctx context.Context, refreshToken string) (*users.Oauth, error) {
     query := `
     SELECT 
         "id",
@@ -106,48 +198,1031 @@ func (r *userRepository) FindOneOauth(refreshToken string) (*users.Oauth, error)
     WHERE "refresh_token" = $1;`
 
     oauth := new(users.Oauth)
-    if err := r.db.Get(oauth, query, refreshToken); err != nil {
+    if err := r.db.GetContext(ctx, oauth, query, refreshToken); err != nil {
         return nil, fmt.Errorf("oauth not found: %v", err)
     }
     return oauth, nil
 }
 
-func (r *userRepository) UpdateOauth(req *users.UserToken) error {
+// FindOneRefreshToken find token in rotation history, revoked_at is of the oauth session
+func (r *userRepository) FindOneRefreshToken(ctx context.Context, refreshToken string) (*users.OauthRefreshToken, error) {
     query := `
-    UPDATE "oauth" SET
-        "access_token" = :access_token,
-        "refresh_token" = :refresh_token
-    WHERE "id" = :id;`
+    SELECT
+        "rt"."id",
+        "rt"."oauth_id",
+        "o"."user_id",
+        "rt"."used_at",
+        "o"."revoked_at"
+    FROM "oauth_refresh_tokens" "rt"
+    JOIN "oauth" "o" ON "o"."id" = "rt"."oauth_id"
+    WHERE "rt"."token_hash" = $1;`
 
-    if _, err := r.db.NamedExecContext(context.Background(), query, req); err != nil {
+    token := new(users.OauthRefreshToken)
+    if err := r.db.GetContext(ctx, token, query, wymjauth.HashToken(refreshToken)); err != nil {
+        return nil, fmt.Errorf("oauth not found: %v", err)
+    }
+    return token, nil
+}
+
+// RotateOauth mark prev as used and make req the current token of the session,
+// used_at is checked again in the update so two concurrent refresh cannot both win
+func (r *userRepository) RotateOauth(ctx context.Context, prev *users.OauthRefreshToken, req *users.UserToken, client *users.OauthClient) error {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return err
+    }
+
+    result, err := tx.ExecContext(ctx, `
+    UPDATE "oauth_refresh_tokens" SET
+        "used_at" = NOW()
+    WHERE "id" = $1
+    AND "used_at" IS NULL
+    AND "revoked_at" IS NULL;`,
+        prev.Id,
+    )
+    if err != nil {
+        tx.Rollback()
+        return fmt.Errorf("update refresh token failed: %v", err)
+    }
+    if rows, _ := result.RowsAffected(); rows != 1 {
+        tx.Rollback()
+        return fmt.Errorf("refresh token has been used")
+    }
+
+    var nextId string
+    if err := tx.QueryRowContext(ctx, `
+    INSERT INTO "oauth_refresh_tokens" ("oauth_id", "token_hash") VALUES ($1, $2) RETURNING "id";`,
+        prev.OauthId,
+        wymjauth.HashToken(req.RefreshToken),
+    ).Scan(&nextId); err != nil {
+        tx.Rollback()
+        return fmt.Errorf("insert refresh token failed: %v", err)
+    }
+
+    if _, err := tx.ExecContext(ctx, `
+    UPDATE "oauth_refresh_tokens" SET "replaced_by" = $1 WHERE "id" = $2;`,
+        nextId,
+        prev.Id,
+    ); err != nil {
+        tx.Rollback()
+        return fmt.Errorf("update refresh token failed: %v", err)
+    }
+
+    if _, err := tx.ExecContext(ctx, `
+    UPDATE "oauth" SET
+        "access_token" = $1,
+        "refresh_token" = $2,
+        "user_agent" = $3,
+        "ip" = $4,
+        "refreshed_at" = NOW()
+    WHERE "id" = $5;`,
+        req.AccessToken,
+        req.RefreshToken,
+        client.UserAgent,
+        client.Ip,
+        req.Id,
+    ); err != nil {
+        tx.Rollback()
         return fmt.Errorf("update oauth failed: %v", err)
     }
+
+    if err := tx.Commit(); err != nil {
+        return err
+    }
     return nil
 }
 
-func (r *userRepository) GetProfile(userId string) (*users.User, error) {
+// RevokeOauth revoke the session and every refresh token in its history
+func (r *userRepository) RevokeOauth(ctx context.Context, oauthId string) error {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return err
+    }
+
+    if _, err := tx.ExecContext(ctx, `
+    UPDATE "oauth" SET "revoked_at" = NOW() WHERE "id" = $1 AND "revoked_at" IS NULL;`,
+        oauthId,
+    ); err != nil {
+        tx.Rollback()
+        return fmt.Errorf("revoke oauth failed: %v", err)
+    }
+
+    if _, err := tx.ExecContext(ctx, `
+    UPDATE "oauth_refresh_tokens" SET "revoked_at" = NOW() WHERE "oauth_id" = $1 AND "revoked_at" IS NULL;`,
+        oauthId,
+    ); err != nil {
+        tx.Rollback()
+        return fmt.Errorf("revoke refresh token failed: %v", err)
+    }
+
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    return nil
+}
+
+// RevokeAllOauth revoke every active session of the user
+func (r *userRepository) RevokeAllOauth(ctx context.Context, userId string) error {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    if err := revokeAllOauth(ctx, tx, userId); err != nil {
+        tx.Rollback()
+        return err
+    }
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    return nil
+}
+
+func revokeAllOauth(ctx context.Context, tx *sqlx.Tx, userId string) error {
+    if _, err := tx.ExecContext(ctx, `
+    UPDATE "oauth_refresh_tokens" SET "revoked_at" = NOW()
+    WHERE "revoked_at" IS NULL
+    AND "oauth_id" IN (
+        SELECT "id" FROM "oauth" WHERE "user_id" = $1
+    );`,
+        userId,
+    ); err != nil {
+        return fmt.Errorf("revoke refresh token failed: %v", err)
+    }
+
+    if _, err := tx.ExecContext(ctx, `
+    UPDATE "oauth" SET "revoked_at" = NOW() WHERE "user_id" = $1 AND "revoked_at" IS NULL;`,
+        userId,
+    ); err != nil {
+        return fmt.Errorf("revoke oauth failed: %v", err)
+    }
+    return nil
+}
+
+func (r *userRepository) FindOneOauthById(ctx context.Context, oauthId string) (*users.Oauth, error) {
+    query := `
+    SELECT
+        "id",
+        "user_id"
+    FROM "oauth"
+    WHERE "id" = $1
+    AND "revoked_at" IS NULL;`
+
+    oauth := new(users.Oauth)
+    if err := r.db.GetContext(ctx, oauth, query, oauthId); err != nil {
+        return nil, fmt.Errorf("oauth not found")
+    }
+    return oauth, nil
+}
+
+// FindOauth list active sessions, current is the session of accessToken
+func (r *userRepository) FindOauth(ctx context.Context, userId, accessToken string) ([]*users.OauthSession, error) {
+    query := `
+    SELECT
+        "id",
+        "user_agent",
+        "ip",
+        ("access_token" = $2) AS "current",
+        "created_at",
+        "refreshed_at"
+    FROM "oauth"
+    WHERE "user_id" = $1
+    AND "revoked_at" IS NULL
+    ORDER BY COALESCE("refreshed_at", "created_at") DESC;`
+
+    sessions := make([]*users.OauthSession, 0)
+    if err := r.db.SelectContext(ctx, &sessions, query, userId, accessToken); err != nil {
+        return nil, fmt.Errorf("get oauth failed: %v", err)
+    }
+    return sessions, nil
+}
+
+func (r *userRepository) GetProfile(ctx context.Context, userId string) (*users.User, error) {
     query := `
     SELECT
         "id",
         "email",
         "username",
-        "role_id"
+        "role_id",
+        ("email_verified_at" IS NOT NULL) AS "email_verified",
+        ("totp_enabled_at" IS NOT NULL) AS "totp_enabled",
+        ("disabled_at" IS NOT NULL) AS "disabled",
+        "created_at",
+        "updated_at"
     FROM "users"
-    WHERE "id" = $1;`
+    WHERE "id" = $1
+    AND "deleted_at" IS NULL;`
 
     profile := new(users.User)
-    if err := r.db.Get(profile, query, userId); err != nil {
+    if err := r.db.GetContext(ctx, profile, query, userId); err != nil {
         return nil, fmt.Errorf("get user failed: %v", err)
     }
     return profile, nil
 }
 
-func (r *userRepository) DeleteOauth(oauthId string) error {
-    query := `DELETE FROM "oauth" WHERE "id" = $1;`
+// DeleteOauth delete only session of the user
+func (r *userRepository) DeleteOauth(ctx context.Context, userId, oauthId string) error {
+    query := `DELETE FROM "oauth" WHERE "id" = $1 AND "user_id" = $2;`
+
+    result, err := r.db.ExecContext(ctx, query, oauthId, userId)
+    if err != nil {
+        return fmt.Errorf("delete oauth failed: %v", err)
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return fmt.Errorf("oauth not found")
+    }
+    return nil
+}
+
+func (r *userRepository) InsertPasswordReset(ctx context.Context, userId, token string, expiredAt time.Time) error {
+    query := `
+    INSERT INTO "password_resets" (
+        "user_id",
+        "token_hash",
+        "expired_at"
+    )
+    VALUES ($1, $2, $3);`
+
+    if _, err := r.db.ExecContext(ctx, query, userId, wymjauth.HashToken(token), expiredAt); err != nil {
+        return fmt.Errorf("insert password reset failed: %v", err)
+    }
+    return nil
+}
+
+// ResetPassword use the token, set new password, make other pending tokens of the user
+// unusable and revoke all sessions in one transaction
+func (r *userRepository) ResetPassword(ctx context.Context, token, password string) error {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return err
+    }
+
+    var userId string
+    if err := tx.QueryRowContext(ctx, `
+    UPDATE "password_resets" SET
+        "used_at" = NOW()
+    WHERE "token_hash" = $1
+    AND "used_at" IS NULL
+    AND "expired_at" > NOW()
+    RETURNING "user_id";`,
+        wymjauth.HashToken(token),
+    ).Scan(&userId); err != nil {
+        tx.Rollback()
+        return fmt.Errorf("reset token is invalid or expired")
+    }
+
+    if _, err := tx.ExecContext(ctx, `
+    UPDATE "password_resets" SET "used_at" = NOW() WHERE "user_id" = $1 AND "used_at" IS NULL;`,
+        userId,
+    ); err != nil {
+        tx.Rollback()
+        return fmt.Errorf("update password reset failed: %v", err)
+    }
+
+    if _, err := tx.ExecContext(ctx, `
+    UPDATE "users" SET "password" = $1 WHERE "id" = $2;`,
+        password,
+        userId,
+    ); err != nil {
+        tx.Rollback()
+        return fmt.Errorf("update password failed: %v", err)
+    }
+
+    if err := revokeAllOauth(ctx, tx, userId); err != nil {
+        tx.Rollback()
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    return nil
+}
+
+func (r *userRepository) InsertEmailVerification(ctx context.Context, userId, token string, expiredAt time.Time) error {
+    query := `
+    INSERT INTO "email_verifications" (
+        "user_id",
+        "token_hash",
+        "expired_at"
+    )
+    VALUES ($1, $2, $3);`
+
+    if _, err := r.db.ExecContext(ctx, query, userId, wymjauth.HashToken(token), expiredAt); err != nil {
+        return fmt.Errorf("insert email verification failed: %v", err)
+    }
+    return nil
+}
+
+// FindLastEmailVerificationAt return nil when no verification was sent to the user
+func (r *userRepository) FindLastEmailVerificationAt(ctx context.Context, userId string) (*time.Time, error) {
+    query := `
+    SELECT
+        MAX("created_at")
+    FROM "email_verifications"
+    WHERE "user_id" = $1;`
+
+    var createdAt *time.Time
+    if err := r.db.GetContext(ctx, &createdAt, query, userId); err != nil {
+        return nil, fmt.Errorf("get email verification failed: %v", err)
+    }
+    return createdAt, nil
+}
+
+// VerifyEmail use the token and mark email of its user as verified
+func (r *userRepository) VerifyEmail(ctx context.Context, token string) error {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return err
+    }
+
+    var userId string
+    if err := tx.QueryRowContext(ctx, `
+    UPDATE "email_verifications" SET
+        "used_at" = NOW()
+    WHERE "token_hash" = $1
+    AND "used_at" IS NULL
+    AND "expired_at" > NOW()
+    RETURNING "user_id";`,
+        wymjauth.HashToken(token),
+    ).Scan(&userId); err != nil {
+        tx.Rollback()
+        return fmt.Errorf("verification token is invalid or expired")
+    }
+
+    if _, err := tx.ExecContext(ctx, `
+    UPDATE "users" SET "email_verified_at" = NOW() WHERE "id" = $1 AND "email_verified_at" IS NULL;`,
+        userId,
+    ); err != nil {
+        tx.Rollback()
+        return fmt.Errorf("update user failed: %v", err)
+    }
+
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    return nil
+}
+
+func (r *userRepository) FindTotp(ctx context.Context, userId string) (*users.UserTotp, error) {
+    query := `
+    SELECT
+        "totp_secret",
+        ("totp_enabled_at" IS NOT NULL) AS "totp_enabled",
+        "totp_last_step"
+    FROM "users"
+    WHERE "id" = $1;`
+
+    totp := new(users.UserTotp)
+    if err := r.db.GetContext(ctx, totp, query, userId); err != nil {
+        return nil, fmt.Errorf("get user failed: %v", err)
+    }
+    return totp, nil
+}
+
+// UpdateTotpSecret set pending secret, secret of enabled totp can not be replaced
+func (r *userRepository) UpdateTotpSecret(ctx context.Context, userId, secret string) error {
+    query := `
+    UPDATE "users" SET
+        "totp_secret" = $1
+    WHERE "id" = $2
+    AND "totp_enabled_at" IS NULL;`
+
+    result, err := r.db.ExecContext(ctx, query, secret, userId)
+    if err != nil {
+        return fmt.Errorf("update totp failed: %v", err)
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return fmt.Errorf("two-factor authentication is already enabled")
+    }
+    return nil
+}
+
+// UpdateTotpLastStep fail when the step or a later one was already used
+func (r *userRepository) UpdateTotpLastStep(ctx context.Context, userId string, step int64) error {
+    query := `
+    UPDATE "users" SET
+        "totp_last_step" = $1
+    WHERE "id" = $2
+    AND "totp_last_step" < $1;`
+
+    result, err := r.db.ExecContext(ctx, query, step, userId)
+    if err != nil {
+        return fmt.Errorf("update totp failed: %v", err)
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return fmt.Errorf("code is invalid")
+    }
+    return nil
+}
+
+// EnableTotp turn on 2fa and replace recovery codes
+func (r *userRepository) EnableTotp(ctx context.Context, userId string, step int64, recoveryCodes []string) error {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return err
+    }
+
+    result, err := tx.ExecContext(ctx, `
+    UPDATE "users" SET
+        "totp_enabled_at" = NOW(),
+        "totp_last_step" = $1
+    WHERE "id" = $2
+    AND "totp_enabled_at" IS NULL
+    AND "totp_secret" IS NOT NULL;`,
+        step,
+        userId,
+    )
+    if err != nil {
+        tx.Rollback()
+        return fmt.Errorf("update totp failed: %v", err)
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        tx.Rollback()
+        return fmt.Errorf("two-factor authentication is already enabled")
+    }
+
+    if _, err := tx.ExecContext(ctx, `DELETE FROM "recovery_codes" WHERE "user_id" = $1;`, userId); err != nil {
+        tx.Rollback()
+        return fmt.Errorf("delete recovery code failed: %v", err)
+    }
+    for _, code := range recoveryCodes {
+        if _, err := tx.ExecContext(ctx, `
+        INSERT INTO "recovery_codes" ("user_id", "code_hash") VALUES ($1, $2);`,
+            userId,
+            wymjauth.HashToken(code),
+        ); err != nil {
+            tx.Rollback()
+            return fmt.Errorf("insert recovery code failed: %v", err)
+        }
+    }
+
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    return nil
+}
+
+func (r *userRepository) DisableTotp(ctx context.Context, userId string) error {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return err
+    }
+
+    if _, err := tx.ExecContext(ctx, `
+    UPDATE "users" SET
+        "totp_secret" = NULL,
+        "totp_enabled_at" = NULL,
+        "totp_last_step" = 0
+    WHERE "id" = $1;`,
+        userId,
+    ); err != nil {
+        tx.Rollback()
+        return fmt.Errorf("update totp failed: %v", err)
+    }
+    if _, err := tx.ExecContext(ctx, `DELETE FROM "recovery_codes" WHERE "user_id" = $1;`, userId); err != nil {
+        tx.Rollback()
+        return fmt.Errorf("delete recovery code failed: %v", err)
+    }
+
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    return nil
+}
+
+func (r *userRepository) UseRecoveryCode(ctx context.Context, userId, code string) error {
+    query := `
+    UPDATE "recovery_codes" SET
+        "used_at" = NOW()
+    WHERE "id" = (
+        SELECT "id"
+        FROM "recovery_codes"
+        WHERE "user_id" = $1
+        AND "code_hash" = $2
+        AND "used_at" IS NULL
+        LIMIT 1
+    );`
+
+    result, err := r.db.ExecContext(ctx, query, userId, wymjauth.HashToken(code))
+    if err != nil {
+        return fmt.Errorf("update recovery code failed: %v", err)
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return fmt.Errorf("code is invalid")
+    }
+    return nil
+}
+
+// IsTotpRequired is true when any role of user require totp
+func (r *userRepository) IsTotpRequired(ctx context.Context, userId string) bool {
+    query := `
+    SELECT
+        COALESCE(bool_or("r"."require_totp"), FALSE)
+    FROM "user_roles" "ur"
+    JOIN "roles" "r" ON "r"."id" = "ur"."role_id"
+    WHERE "ur"."user_id" = $1;`
+
+    var check bool
+    if err := r.db.GetContext(ctx, &check, query, userId); err != nil {
+        return false
+    }
+    return check
+}
+
+func (r *userRepository) UpdateRoleTotp(ctx context.Context, roleId int, required bool) error {
+    query := `
+    UPDATE "roles" SET
+        "require_totp" = $1
+    WHERE "id" = $2;`
+
+    result, err := r.db.ExecContext(ctx, query, required, roleId)
+    if err != nil {
+        return fmt.Errorf("update role failed: %v", err)
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return fmt.Errorf("role not found")
+    }
+    return nil
+}
+
+// FindSignInThrottle return nil without error when key has no failed sign in
+func (r *userRepository) FindSignInThrottle(ctx context.Context, key string) (*users.SignInThrottle, error) {
+    query := `
+    SELECT
+        "key",
+        "failed_count",
+        "last_failed_at",
+        "locked_until"
+    FROM "signin_throttles"
+    WHERE "key" = $1;`
+
+    throttle := new(users.SignInThrottle)
+    if err := r.db.GetContext(ctx, throttle, query, key); err != nil {
+        if errors.Is(err, sql.ErrNoRows) {
+            return nil, nil
+        }
+        return nil, fmt.Errorf("get signin throttle failed: %v", err)
+    }
+    return throttle, nil
+}
+
+// FailSignIn count failed sign in, count older than lockout seconds start over.
+// Key is locked for lockout seconds when count reach threshold
+func (r *userRepository) FailSignIn(ctx context.Context, key string, threshold, lockout int) error {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
 
-    if _, err := r.db.ExecContext(context.Background(), query, oauthId); err != nil {
-        return fmt.Errorf("oauth not found: %v", err)
-        //return fmt.Errorf("oauth not found")
+    var failedCount int
+    if err := r.db.QueryRowContext(ctx, `
+    INSERT INTO "signin_throttles" AS "t" ("key", "failed_count", "last_failed_at")
+    VALUES ($1, 1, NOW())
+    ON CONFLICT ("key") DO UPDATE SET
+        "failed_count" = CASE
+            WHEN "t"."last_failed_at" < NOW() - make_interval(secs => $2) THEN 1
+            ELSE "t"."failed_count" + 1
+        END,
+        "last_failed_at" = NOW()
+    RETURNING "failed_count";`,
+        key,
+        lockout,
+    ).Scan(&failedCount); err != nil {
+        return fmt.Errorf("update signin throttle failed: %v", err)
+    }
+
+    if failedCount < threshold {
+        return nil
+    }
+    if _, err := r.db.ExecContext(ctx, `
+    UPDATE "signin_throttles" SET
+        "failed_count" = 0,
+        "locked_until" = NOW() + make_interval(secs => $2)
+    WHERE "key" = $1;`,
+        key,
+        lockout,
+    ); err != nil {
+        return fmt.Errorf("update signin throttle failed: %v", err)
+    }
+    return nil
+}
+
+func (r *userRepository) ClearSignInThrottle(ctx context.Context, key string) error {
+    query := `DELETE FROM "signin_throttles" WHERE "key" = $1;`
+
+    if _, err := r.db.ExecContext(ctx, query, key); err != nil {
+        return fmt.Errorf("delete signin throttle failed: %v", err)
+    }
+    return nil
+}
+
+// InsertOidcState keep pkce verifier and nonce until callback, expired states are cleaned here
+func (r *userRepository) InsertOidcState(ctx context.Context, state string, req *users.OidcState, expiredAt time.Time) error {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    if _, err := r.db.ExecContext(ctx, `DELETE FROM "oidc_states" WHERE "expired_at" < NOW();`); err != nil {
+        return fmt.Errorf("delete oidc states failed: %v", err)
+    }
+
+    query := `
+    INSERT INTO "oidc_states" (
+        "state_hash",
+        "provider",
+        "code_verifier",
+        "nonce",
+        "expired_at"
+    )
+    VALUES ($1, $2, $3, $4, $5);`
+
+    if _, err := r.db.ExecContext(
+        ctx,
+        query,
+        wymjauth.HashToken(state),
+        req.Provider,
+        req.CodeVerifier,
+        req.Nonce,
+        expiredAt,
+    ); err != nil {
+        return fmt.Errorf("insert oidc state failed: %v", err)
+    }
+    return nil
+}
+
+// UseOidcState delete the state so it can be used once
+func (r *userRepository) UseOidcState(ctx context.Context, provider, state string) (*users.OidcState, error) {
+    query := `
+    DELETE FROM "oidc_states"
+    WHERE "state_hash" = $1
+    AND "provider" = $2
+    AND "expired_at" > NOW()
+    RETURNING "provider", "code_verifier", "nonce";`
+
+    oidcState := new(users.OidcState)
+    if err := r.db.GetContext(ctx, oidcState, query, wymjauth.HashToken(state), provider); err != nil {
+        return nil, fmt.Errorf("state is invalid or expired")
+    }
+    return oidcState, nil
+}
+
+// FindUserIdByIdentity return empty string without error when identity is not linked
+func (r *userRepository) FindUserIdByIdentity(ctx context.Context, provider, subject string) (string, error) {
+    query := `
+    UPDATE "user_identities" SET
+        "last_signin_at" = NOW()
+    WHERE "provider" = $1
+    AND "subject" = $2
+    AND "user_id" IN (SELECT "id" FROM "users" WHERE "deleted_at" IS NULL)
+    RETURNING "user_id";`
+
+    var userId string
+    if err := r.db.GetContext(ctx, &userId, query, provider, subject); err != nil {
+        if errors.Is(err, sql.ErrNoRows) {
+            return "", nil
+        }
+        return "", fmt.Errorf("get user identity failed: %v", err)
+    }
+    return userId, nil
+}
+
+func (r *userRepository) InsertIdentity(ctx context.Context, userId string, identity *users.UserIdentity) error {
+    query := `
+    INSERT INTO "user_identities" (
+        "user_id",
+        "provider",
+        "subject",
+        "email"
+    )
+    VALUES ($1, $2, $3, NULLIF($4, ''));`
+
+    if _, err := r.db.ExecContext(
+        ctx,
+        query,
+        userId,
+        identity.Provider,
+        identity.Subject,
+        identity.Email,
+    ); err != nil {
+        return fmt.Errorf("insert user identity failed: %v", err)
+    }
+    return nil
+}
+
+// InsertOidcUser create customer with its identity in one transaction, password is random
+func (r *userRepository) InsertOidcUser(ctx context.Context, req *users.UserRegisterReq, emailVerified bool, identity *users.UserIdentity) (string, error) {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return "", err
+    }
+
+    var userId string
+    if err := tx.QueryRowContext(ctx, `
+    INSERT INTO "users" (
+        "email",
+        "username",
+        "password",
+        "role_id",
+        "email_verified_at"
+    )
+    VALUES ($1, $2, $3, 1, CASE WHEN $4 THEN NOW() END)
+    RETURNING "id";`,
+        req.Email,
+        req.Username,
+        req.Password,
+        emailVerified,
+    ).Scan(&userId); err != nil {
+        tx.Rollback()
+        switch err.Error() {
+            case "ERROR: duplicate key value violates unique constraint \"users_username_key\" (SQLSTATE 23505)":
+                return "", fmt.Errorf("username has been used")
+            case "ERROR: duplicate key value violates unique constraint \"users_email_key\" (SQLSTATE 23505)":
+                return "", fmt.Errorf("email has been used")
+            default:
+                return "", fmt.Errorf("insert user failed: %v", err)
+        }
+    }
+
+    if _, err := tx.ExecContext(ctx, `
+    INSERT INTO "user_roles" ("user_id", "role_id") VALUES ($1, 1);`,
+        userId,
+    ); err != nil {
+        tx.Rollback()
+        return "", fmt.Errorf("insert user role failed: %v", err)
+    }
+
+    if _, err := tx.ExecContext(ctx, `
+    INSERT INTO "user_identities" ("user_id", "provider", "subject", "email")
+    VALUES ($1, $2, $3, NULLIF($4, ''));`,
+        userId,
+        identity.Provider,
+        identity.Subject,
+        identity.Email,
+    ); err != nil {
+        tx.Rollback()
+        return "", fmt.Errorf("insert user identity failed: %v", err)
+    }
+
+    if err := tx.Commit(); err != nil {
+        return "", err
+    }
+    return userId, nil
+}
+
+// UpdateProfile change only field that is not empty, email is unverified when it is changed
+func (r *userRepository) UpdateProfile(ctx context.Context, userId string, req *users.UserUpdateReq) error {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    queryWhereStack := make([]string, 0)
+    values := make([]any, 0)
+    lastIndex := 1
+    if req.Username != "" {
+        values = append(values, req.Username)
+        queryWhereStack = append(queryWhereStack, fmt.Sprintf(`"username" = $%d`, lastIndex))
+        lastIndex++
+    }
+    if req.Email != "" {
+        values = append(values, req.Email)
+        queryWhereStack = append(queryWhereStack, fmt.Sprintf(`"email_verified_at" = CASE WHEN "email" = $%d THEN "email_verified_at" END`, lastIndex))
+        queryWhereStack = append(queryWhereStack, fmt.Sprintf(`"email" = $%d`, lastIndex))
+        lastIndex++
+    }
+    if len(queryWhereStack) == 0 {
+        return nil
+    }
+    values = append(values, userId)
+
+    query := fmt.Sprintf(`
+    UPDATE "users" SET
+        %s
+    WHERE "id" = $%d
+    AND "deleted_at" IS NULL;`, strings.Join(queryWhereStack, ",\n        "), lastIndex)
+
+    result, err := r.db.ExecContext(ctx, query, values...)
+    if err != nil {
+        switch err.Error() {
+            case "ERROR: duplicate key value violates unique constraint \"users_username_key\" (SQLSTATE 23505)":
+                return fmt.Errorf("username has been used")
+            case "ERROR: duplicate key value violates unique constraint \"users_email_key\" (SQLSTATE 23505)":
+                return fmt.Errorf("email has been used")
+            default:
+                return fmt.Errorf("update user failed: %v", err)
+        }
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return fmt.Errorf("user not found")
+    }
+    return nil
+}
+
+// ChangePassword set new password and revoke every session except the one of accessToken,
+// pending reset links can not be used anymore
+func (r *userRepository) ChangePassword(ctx context.Context, userId, password, accessToken string) error {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return err
+    }
+
+    if _, err := tx.ExecContext(ctx, `
+    UPDATE "users" SET "password" = $1 WHERE "id" = $2;`,
+        password,
+        userId,
+    ); err != nil {
+        tx.Rollback()
+        return fmt.Errorf("update password failed: %v", err)
+    }
+
+    if _, err := tx.ExecContext(ctx, `
+    UPDATE "password_resets" SET "used_at" = NOW() WHERE "user_id" = $1 AND "used_at" IS NULL;`,
+        userId,
+    ); err != nil {
+        tx.Rollback()
+        return fmt.Errorf("update password reset failed: %v", err)
+    }
+
+    if _, err := tx.ExecContext(ctx, `
+    UPDATE "oauth_refresh_tokens" SET "revoked_at" = NOW()
+    WHERE "revoked_at" IS NULL
+    AND "oauth_id" IN (
+        SELECT "id" FROM "oauth" WHERE "user_id" = $1 AND "access_token" <> $2
+    );`,
+        userId,
+        accessToken,
+    ); err != nil {
+        tx.Rollback()
+        return fmt.Errorf("revoke refresh token failed: %v", err)
+    }
+
+    if _, err := tx.ExecContext(ctx, `
+    UPDATE "oauth" SET "revoked_at" = NOW()
+    WHERE "user_id" = $1
+    AND "access_token" <> $2
+    AND "revoked_at" IS NULL;`,
+        userId,
+        accessToken,
+    ); err != nil {
+        tx.Rollback()
+        return fmt.Errorf("revoke oauth failed: %v", err)
+    }
+
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    return nil
+}
+
+// SoftDeleteUser keep the row but the user can not sign in, every session, api key
+// and token given to third party app is revoked. Email, username and linked identities
+// are replaced with random values so the row does not point to the person anymore.
+// Images are removed, storage key of them is returned so caller delete the files
+func (r *userRepository) SoftDeleteUser(ctx context.Context, userId string) ([]string, error) {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return nil, err
+    }
+
+    result, err := tx.ExecContext(ctx, `
+    UPDATE "users" SET
+        "deleted_at" = NOW(),
+        "email" = CONCAT(uuid_generate_v4(), '@deleted.invalid'),
+        "username" = CONCAT('deleted-', uuid_generate_v4()),
+        "totp_secret" = NULL
+    WHERE "id" = $1
+    AND "deleted_at" IS NULL;`,
+        userId,
+    )
+    if err != nil {
+        tx.Rollback()
+        return nil, fmt.Errorf("delete user failed: %v", err)
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        tx.Rollback()
+        return nil, fmt.Errorf("user not found")
+    }
+
+    if err := revokeAllOauth(ctx, tx, userId); err != nil {
+        tx.Rollback()
+        return nil, err
+    }
+
+    for _, query := range []string{
+        `UPDATE "api_keys" SET "revoked_at" = NOW() WHERE "user_id" = $1 AND "revoked_at" IS NULL;`,
+        `UPDATE "oauth2_clients" SET "revoked_at" = NOW() WHERE "user_id" = $1 AND "revoked_at" IS NULL;`,
+        `UPDATE "oauth2_tokens" SET "revoked_at" = NOW() WHERE "user_id" = $1 AND "revoked_at" IS NULL;`,
+        // subject is unique per provider, so it get the random id of the row
+        `UPDATE "user_identities" SET "subject" = CONCAT('deleted-', "id"), "email" = NULL WHERE "user_id" = $1;`,
+    } {
+        if _, err := tx.ExecContext(ctx, query, userId); err != nil {
+            tx.Rollback()
+            return nil, fmt.Errorf("delete user failed: %v", err)
+        }
+    }
+
+    keys := make([]string, 0)
+    if err := tx.SelectContext(ctx, &keys, `
+    DELETE FROM "images"
+    WHERE "task_id" IN (SELECT "id" FROM "tasks" WHERE "user_id" = $1)
+    RETURNING "filename";`,
+        userId,
+    ); err != nil {
+        tx.Rollback()
+        return nil, fmt.Errorf("delete images failed: %v", err)
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+    return keys, nil
+}
+
+// DeleteUser remove the user, sessions, tasks, time entries, project memberships and
+// everything else of the user are removed by foreign key cascade. Storage key of images
+// is returned because files are not removed by the database
+func (r *userRepository) DeleteUser(ctx context.Context, userId string) ([]string, error) {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return nil, err
+    }
+
+    keys := make([]string, 0)
+    if err := tx.SelectContext(ctx, &keys, `
+    SELECT "i"."filename"
+    FROM "images" "i"
+    JOIN "tasks" "t" ON "t"."id" = "i"."task_id"
+    WHERE "t"."user_id" = $1;`,
+        userId,
+    ); err != nil {
+        tx.Rollback()
+        return nil, fmt.Errorf("get images failed: %v", err)
+    }
+
+    result, err := tx.ExecContext(ctx, `DELETE FROM "users" WHERE "id" = $1;`, userId)
+    if err != nil {
+        tx.Rollback()
+        return nil, fmt.Errorf("delete user failed: %v", err)
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        tx.Rollback()
+        return nil, fmt.Errorf("user not found")
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+    return keys, nil
+}
+
+func (r *userRepository) FindUser(ctx context.Context, req *users.UserFilter, cursor *users.UserCursor) ([]*users.UserDirectory, error) {
+    builder := usersPatterns.FindUserBuilder(r.db, req, cursor)
+    engineer := usersPatterns.FindUserEngineer(builder)
+    return engineer.FindUser().Result(ctx)
+}
+
+// DisableUser keep sessions, JwtAuth reject them while the user is disabled so enable give them back
+func (r *userRepository) DisableUser(ctx context.Context, userId string, disabled bool) error {
+    query := `
+    UPDATE "users" SET
+        "disabled_at" = CASE WHEN $1 THEN COALESCE("disabled_at", NOW()) ELSE NULL END
+    WHERE "id" = $2
+    AND "deleted_at" IS NULL;`
+
+    result, err := r.db.ExecContext(ctx, query, disabled, userId)
+    if err != nil {
+        return fmt.Errorf("update user failed: %v", err)
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return fmt.Errorf("user not found")
     }
     return nil
 }
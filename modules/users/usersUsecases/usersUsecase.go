@@ -1,123 +1,311 @@
 package usersUsecases
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/modules/entities"
 	"github.com/ppp3ppj/wymj/modules/users"
+	"github.com/ppp3ppj/wymj/modules/users/usersPatterns"
 	"github.com/ppp3ppj/wymj/modules/users/usersRepositories"
 	"github.com/ppp3ppj/wymj/pkg/wymjauth"
+	"github.com/ppp3ppj/wymj/pkg/wymjmailer"
+	"github.com/ppp3ppj/wymj/pkg/wymjmetrics"
+	"github.com/ppp3ppj/wymj/pkg/wymjoidc"
+	"github.com/ppp3ppj/wymj/pkg/wymjstorage"
+	"github.com/ppp3ppj/wymj/pkg/wymjtotp"
+	"github.com/ppp3ppj/wymj/pkg/wymjtrace"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type IUserUsecase interface {
-    InsertCustomer(req *users.UserRegisterReq) (*users.UserPassport, error)
-    InsertAdmin(req *users.UserRegisterReq) (*users.UserPassport, error)
-    GetPassport(req *users.UserCredential) (*users.UserPassport, error)
-    RefreshPassport(req *users.UserRefreshCredential) (*users.UserPassport, error)
-    DeleteOauth(oauthId string) error
-    GetUserProfile(userId string) (*users.User, error)
+    InsertCustomer(ctx context.Context, req *users.UserRegisterReq) (*users.UserPassport, error)
+    InsertAdmin(ctx context.Context, req *users.UserRegisterReq) (*users.UserPassport, error)
+    GetPassport(ctx context.Context, req *users.UserCredential, client *users.OauthClient) (*users.UserPassport, error)
+    RefreshPassport(ctx context.Context, req *users.UserRefreshCredential, client *users.OauthClient) (*users.UserPassport, error)
+    DeleteOauth(ctx context.Context, userId, oauthId string) error
+    FindOauth(ctx context.Context, userId, accessToken string) ([]*users.OauthSession, error)
+    RevokeOauth(ctx context.Context, userId, oauthId string) error
+    RevokeAllOauth(ctx context.Context, userId string) error
+    GetUserProfile(ctx context.Context, userId string) (*users.User, error)
+    ForgotPassword(ctx context.Context, req *users.UserForgotPasswordReq) error
+    ResetPassword(ctx context.Context, req *users.UserResetPasswordReq) error
+    VerifyEmail(ctx context.Context, req *users.UserVerifyEmailReq) error
+    ResendVerification(ctx context.Context, req *users.UserResendVerificationReq) error
+    VerifyTotp(ctx context.Context, req *users.UserTotpReq, client *users.OauthClient) (*users.UserPassport, error)
+    EnrollTotp(ctx context.Context, userId string) (*users.UserTotpEnroll, error)
+    EnableTotp(ctx context.Context, userId string, req *users.UserTotpReq) (*users.UserTotpRecoveryCodes, error)
+    DisableTotp(ctx context.Context, userId string, req *users.UserTotpReq) error
+    UpdateRoleTotp(ctx context.Context, roleId int, req *users.RoleTotpReq) error
+    UnlockUser(ctx context.Context, userId string) error
+    OidcAuthorize(ctx context.Context, provider string) (*users.OidcAuthorizeRes, error)
+    OidcSignIn(ctx context.Context, provider string, req *users.OidcCallbackReq, client *users.OauthClient) (*users.UserPassport, error)
+    UpdateUserProfile(ctx context.Context, userId string, req *users.UserUpdateReq) (*users.User, error)
+    ChangePassword(ctx context.Context, userId, accessToken string, req *users.UserChangePasswordReq) error
+    DeleteUser(ctx context.Context, userId string, req *users.UserDeleteReq) error
+    FindUser(ctx context.Context, req *users.UserFilter) (*entities.CursorRes, error)
+    DisableUser(ctx context.Context, adminId, userId string, disabled bool) error
 }
 
+const (
+    passwordResetExpire = 30 * time.Minute
+    emailVerificationExpire = 24 * time.Hour
+    recoveryCodeCount = 10
+    oidcStateExpire = 10 * time.Minute
+    // bcrypt hash with cost 10 of a random password, compared when email is unknown
+    dummyPasswordHash = "$2a$10$S3WTPuh9VCaF1/9LB61B4OlrEELTyH5K4ZRvzobtnd8WZuGTOeO0."
+)
+
 type userUsecase struct {
     cfg config.IConfig
     userRepository usersRepositories.IUserRepository
+    mailer wymjmailer.IWymjMailer
+    oidc map[string]wymjoidc.IWymjOidc
+    storage wymjstorage.IWymjStorage
 }
 
-func UsersUsecase(cfg config.IConfig, userRepository usersRepositories.IUserRepository) IUserUsecase {
+func UsersUsecase(cfg config.IConfig, userRepository usersRepositories.IUserRepository, mailer wymjmailer.IWymjMailer, oidc map[string]wymjoidc.IWymjOidc, storage wymjstorage.IWymjStorage) IUserUsecase {
     return &userUsecase{
         cfg: cfg,
         userRepository: userRepository,
+        mailer: mailer,
+        oidc: oidc,
+        storage: storage,
     }
 }
 
-func (u *userUsecase) InsertCustomer(req *users.UserRegisterReq) (*users.UserPassport, error) {
+// InsertCustomer create unverified customer and send verification link
+func (u *userUsecase) InsertCustomer(ctx context.Context, req *users.UserRegisterReq) (*users.UserPassport, error) {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.InsertCustomer")
+    defer span.End()
+
     // Hashing password
     if err := req.BcryptHashing(); err != nil {
         return nil, err
     }
     // Insert user
-    result, err := u.userRepository.InsertUser(req, false)
+    result, err := u.userRepository.InsertUser(ctx, req, false)
     if err != nil {
         return nil, err
     }
+    // user can ask for a new link when this failed
+    if err := u.sendVerification(ctx, result.User); err != nil {
+        slog.ErrorContext(ctx, "send verification failed", slog.String("user_id", result.User.Id), slog.String("error", err.Error()))
+    }
     return result, nil
 }
 
-func (u *userUsecase) InsertAdmin(req *users.UserRegisterReq) (*users.UserPassport, error) {
+func (u *userUsecase) InsertAdmin(ctx context.Context, req *users.UserRegisterReq) (*users.UserPassport, error) {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.InsertAdmin")
+    defer span.End()
+
     // Hashing password
     if err := req.BcryptHashing(); err != nil {
         return nil, err
     }
     // Insert user
-    result, err := u.userRepository.InsertUser(req, true)
+    result, err := u.userRepository.InsertUser(ctx, req, true)
     if err != nil {
         return nil, err
     }
     return result, nil
 }
 
-func (u *userUsecase) GetPassport(req *users.UserCredential) (*users.UserPassport, error) {
+// GetPassport return the same error for unknown email and wrong password so it can not be used to find accounts
+func (u *userUsecase) GetPassport(ctx context.Context, req *users.UserCredential, client *users.OauthClient) (*users.UserPassport, error) {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.GetPassport")
+    defer span.End()
+
+    accountKey, ipKey := signInKeys(req.Email, client)
+    if err := u.checkSignInThrottle(ctx, accountKey, ipKey); err != nil {
+        wymjmetrics.LoginFailed(wymjmetrics.Password, "locked")
+        return nil, err
+    }
+
     // Find user
-    user, err := u.userRepository.FindOneUserByEmail(req.Email)
+    found, err := u.userRepository.FindOneUserByEmail(ctx, req.Email)
     if err != nil {
-        return nil, err
+        // compare anyway so response time does not tell the email is unknown
+        bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(req.Password))
+        u.failSignIn(ctx, accountKey, ipKey)
+        wymjmetrics.LoginFailed(wymjmetrics.Password, "invalid_credentials")
+        return nil, fmt.Errorf("email or password is invalid")
     }
 
     // Compare password
-    if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-        return nil, fmt.Errorf("password is invalid")
+    if err := bcrypt.CompareHashAndPassword([]byte(found.Password), []byte(req.Password)); err != nil {
+        u.failSignIn(ctx, accountKey, ipKey)
+        wymjmetrics.LoginFailed(wymjmetrics.Password, "invalid_credentials")
+        return nil, fmt.Errorf("email or password is invalid")
+    }
+    if err := u.userRepository.ClearSignInThrottle(ctx, accountKey); err != nil {
+        return nil, err
     }
 
-    accessToken, err := wymjauth.NewWymjAuth(wymjauth.Access, u.cfg.Jwt(), &users.UserClaims{
-        Id: user.Id,
-        RoleId: user.RoleId,
-    })
+    user := &users.User{
+        Id: found.Id,
+        Email: found.Email,
+        Username: found.Username,
+        RoleId: found.RoleId,
+        EmailVerified: found.EmailVerified,
+        TotpEnabled: found.TotpEnabled,
+        Disabled: found.Disabled,
+        CreatedAt: found.CreatedAt,
+        UpdatedAt: found.UpdatedAt,
+    }
+    passport, err := u.signIn(ctx, user, client)
+    countSignIn(wymjmetrics.Password, passport, err)
+    return passport, err
+}
+
+// countSignIn count only passport with token, 2fa user is counted when VerifyTotp succeed
+func countSignIn(method string, passport *users.UserPassport, err error) {
+    if err != nil {
+        reason := "error"
+        switch err.Error() {
+            case "account is disabled":
+                reason = "disabled"
+            case "email is not verified":
+                reason = "unverified"
+        }
+        wymjmetrics.LoginFailed(method, reason)
+        return
+    }
+    if passport.Token != nil {
+        wymjmetrics.SignIn(method)
+    }
+}
 
-    refreshToken, err := wymjauth.NewWymjAuth(wymjauth.Refresh, u.cfg.Jwt(), &users.UserClaims{
+// signIn give 2fa user a challenge, passport is given by VerifyTotp
+func (u *userUsecase) signIn(ctx context.Context, user *users.User, client *users.OauthClient) (*users.UserPassport, error) {
+    if user.Disabled {
+        return nil, fmt.Errorf("account is disabled")
+    }
+    if user.TotpEnabled {
+        challenge, err := wymjauth.NewWymjAuth(wymjauth.Challenge, u.cfg.Jwt(), &users.UserClaims{
+            Id: user.Id,
+            RoleId: user.RoleId,
+        })
+        if err != nil {
+            return nil, err
+        }
+        return &users.UserPassport{
+            User: user,
+            Challenge: &users.UserChallenge{
+                Token: challenge.SignToken(),
+                ExpiresIn: wymjauth.ChallengeExpireAt,
+            },
+        }, nil
+    }
+    return u.newPassport(ctx, user, client)
+}
+
+// scope of token for user, disabled user get nothing, unverified user get limited scope or
+// nothing depending on config, user of role that require 2fa can only enroll until totp is enabled
+func (u *userUsecase) scope(ctx context.Context, user *users.User) (string, error) {
+    if user.Disabled {
+        return "", fmt.Errorf("account is disabled")
+    }
+    if !user.EmailVerified {
+        if u.cfg.Auth().UnverifiedSignIn() == "limited" {
+            return users.UnverifiedScope, nil
+        }
+        return "", fmt.Errorf("email is not verified")
+    }
+    if !user.TotpEnabled && u.userRepository.IsTotpRequired(ctx, user.Id) {
+        return users.TotpEnrollScope, nil
+    }
+    return "", nil
+}
+
+// newPassport sign tokens and start a new oauth session for user
+func (u *userUsecase) newPassport(ctx context.Context, user *users.User, client *users.OauthClient) (*users.UserPassport, error) {
+    scope, err := u.scope(ctx, user)
+    if err != nil {
+        return nil, err
+    }
+    claims := &users.UserClaims{
         Id: user.Id,
         RoleId: user.RoleId,
-    })
+        Scope: scope,
+    }
+
+    accessToken, err := wymjauth.NewWymjAuth(wymjauth.Access, u.cfg.Jwt(), claims)
+    if err != nil {
+        return nil, err
+    }
+    refreshToken, err := wymjauth.NewWymjAuth(wymjauth.Refresh, u.cfg.Jwt(), claims)
+    if err != nil {
+        return nil, err
+    }
 
     // Set user passport
     passport := &users.UserPassport{
-        User: &users.User{
-            Id: user.Id,
-            Email: user.Email,
-            Username: user.Username,
-            RoleId: user.RoleId,
-        },
+        User: user,
         Token: &users.UserToken{
             AccessToken: accessToken.SignToken(),
             RefreshToken: refreshToken.SignToken(),
         },
     }
 
-    if err := u.userRepository.InsertOauth(passport); err != nil {
+    if err := u.userRepository.InsertOauth(ctx, passport, client); err != nil {
         return nil, err
     }
     return passport, nil
 }
 
-func (u *userUsecase) RefreshPassport(req *users.UserRefreshCredential) (*users.UserPassport, error) {
+// RefreshPassport rotate refresh token, each token can be used once.
+// Presenting a used token again revoke the whole oauth session
+func (u *userUsecase) RefreshPassport(ctx context.Context, req *users.UserRefreshCredential, client *users.OauthClient) (*users.UserPassport, error) {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.RefreshPassport")
+    defer span.End()
+
+    passport, err := u.refreshPassport(ctx, req, client)
+    wymjmetrics.TokenRefreshed(wymjmetrics.UserClient, err == nil)
+    return passport, err
+}
+
+func (u *userUsecase) refreshPassport(ctx context.Context, req *users.UserRefreshCredential, client *users.OauthClient) (*users.UserPassport, error) {
     // Parse Token
-    claims, err := wymjauth.ParseToken(u.cfg.Jwt(), req.RefreshToken)
+    claims, err := wymjauth.ParseRefreshToken(u.cfg.Jwt(), req.RefreshToken)
     if err != nil {
         return nil, err
     }
 
-    // Find oauth
-    oauth, err := u.userRepository.FindOneOauth(req.RefreshToken)
+    // Find token in rotation history
+    prev, err := u.userRepository.FindOneRefreshToken(ctx, req.RefreshToken)
     if err != nil {
         return nil, err
     }
+    if prev.RevokedAt != nil {
+        return nil, fmt.Errorf("oauth has been revoked")
+    }
+    if prev.UsedAt != nil {
+        return nil, u.revokeReusedOauth(ctx, prev)
+    }
 
     // Find user profile
-    profile, err := u.userRepository.GetProfile(oauth.UserId)
+    profile, err := u.userRepository.GetProfile(ctx, prev.UserId)
+    if err != nil {
+        return nil, err
+    }
 
+    // email may be verified since last refresh
+    scope, err := u.scope(ctx, profile)
+    if err != nil {
+        return nil, err
+    }
     newClaims := &users.UserClaims{
         Id: profile.Id,
         RoleId: profile.RoleId,
+        Scope: scope,
     }
 
     accessToken, err := wymjauth.NewWymjAuth(
@@ -125,7 +313,11 @@ func (u *userUsecase) RefreshPassport(req *users.UserRefreshCredential) (*users.
         u.cfg.Jwt(), 
         newClaims,
     )
+    if err != nil {
+        return nil, err
+    }
     
+    // New refresh token keep expiry of the session
     refreshToken := wymjauth.RepeatToken(
         u.cfg.Jwt(), 
         newClaims,
@@ -135,29 +327,824 @@ func (u *userUsecase) RefreshPassport(req *users.UserRefreshCredential) (*users.
     passport := &users.UserPassport{
         User: profile,
         Token: &users.UserToken{
-            Id: oauth.Id,
+            Id: prev.OauthId,
             AccessToken: accessToken.SignToken(),
             RefreshToken: refreshToken,
         },
     }
 
-    if err := u.userRepository.UpdateOauth(passport.Token); err != nil {
+    if err := u.userRepository.RotateOauth(ctx, prev, passport.Token, client); err != nil {
+        // another request used the same token first
+        if err.Error() == "refresh token has been used" {
+            return nil, u.revokeReusedOauth(ctx, prev)
+        }
         return nil, err
     }
     return passport, nil
 }
 
-func (u *userUsecase) DeleteOauth(oauthId string) error {
-    if err := u.userRepository.DeleteOauth(oauthId); err != nil {
+func (u *userUsecase) revokeReusedOauth(ctx context.Context, token *users.OauthRefreshToken) error {
+    slog.WarnContext(ctx, "refresh token reuse detected", slog.String("oauth_id", token.OauthId), slog.String("user_id", token.UserId))
+    if err := u.userRepository.RevokeOauth(ctx, token.OauthId); err != nil {
+        return err
+    }
+    return fmt.Errorf("refresh token has been used, oauth is revoked")
+}
+
+func (u *userUsecase) DeleteOauth(ctx context.Context, userId, oauthId string) error {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.DeleteOauth")
+    defer span.End()
+
+    if err := u.userRepository.DeleteOauth(ctx, userId, oauthId); err != nil {
         return err
     }
     return nil
 }
 
-func (u *userUsecase) GetUserProfile(userId string) (*users.User, error) {
-    profile, err := u.userRepository.GetProfile(userId)
+func (u *userUsecase) FindOauth(ctx context.Context, userId, accessToken string) ([]*users.OauthSession, error) {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.FindOauth")
+    defer span.End()
+
+    sessions, err := u.userRepository.FindOauth(ctx, userId, accessToken)
+    if err != nil {
+        return nil, err
+    }
+    return sessions, nil
+}
+
+// RevokeOauth revoke one session, the session must belong to the user
+func (u *userUsecase) RevokeOauth(ctx context.Context, userId, oauthId string) error {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.RevokeOauth")
+    defer span.End()
+
+    oauth, err := u.userRepository.FindOneOauthById(ctx, oauthId)
+    if err != nil {
+        return err
+    }
+    if oauth.UserId != userId {
+        return fmt.Errorf("oauth not found")
+    }
+    if err := u.userRepository.RevokeOauth(ctx, oauthId); err != nil {
+        return err
+    }
+    return nil
+}
+
+func (u *userUsecase) RevokeAllOauth(ctx context.Context, userId string) error {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.RevokeAllOauth")
+    defer span.End()
+
+    if _, err := u.userRepository.GetProfile(ctx, userId); err != nil {
+        return err
+    }
+    if err := u.userRepository.RevokeAllOauth(ctx, userId); err != nil {
+        return err
+    }
+    return nil
+}
+
+func (u *userUsecase) GetUserProfile(ctx context.Context, userId string) (*users.User, error) {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.GetUserProfile")
+    defer span.End()
+
+    profile, err := u.userRepository.GetProfile(ctx, userId)
     if err != nil {
         return nil, err
     }
     return profile, nil
 }
+
+// UpdateUserProfile send verification link when email is changed
+func (u *userUsecase) UpdateUserProfile(ctx context.Context, userId string, req *users.UserUpdateReq) (*users.User, error) {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.UpdateUserProfile")
+    defer span.End()
+
+    req.Username = strings.Trim(req.Username, " ")
+    req.Email = strings.Trim(req.Email, " ")
+    if req.Email != "" && !users.IsEmail(req.Email) {
+        return nil, fmt.Errorf("email pattern is invalid")
+    }
+
+    before, err := u.userRepository.GetProfile(ctx, userId)
+    if err != nil {
+        return nil, err
+    }
+    if err := u.userRepository.UpdateProfile(ctx, userId, req); err != nil {
+        return nil, err
+    }
+    profile, err := u.userRepository.GetProfile(ctx, userId)
+    if err != nil {
+        return nil, err
+    }
+    if profile.Email != before.Email {
+        if err := u.sendVerification(ctx, profile); err != nil {
+            slog.ErrorContext(ctx, "send verification failed", slog.String("user_id", userId), slog.String("error", err.Error()))
+        }
+    }
+    return profile, nil
+}
+
+// ChangePassword need the old password, session of accessToken is kept and others are signed out
+func (u *userUsecase) ChangePassword(ctx context.Context, userId, accessToken string, req *users.UserChangePasswordReq) error {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.ChangePassword")
+    defer span.End()
+
+    if len(req.NewPassword) < 8 {
+        return fmt.Errorf("password must be at least 8 characters")
+    }
+    found, err := u.userRepository.FindOneUserById(ctx, userId)
+    if err != nil {
+        return err
+    }
+    if err := bcrypt.CompareHashAndPassword([]byte(found.Password), []byte(req.OldPassword)); err != nil {
+        return fmt.Errorf("old password is invalid")
+    }
+    if err := req.BcryptHashing(); err != nil {
+        return err
+    }
+    if err := u.userRepository.ChangePassword(ctx, userId, req.NewPassword, accessToken); err != nil {
+        return err
+    }
+    return nil
+}
+
+// DeleteUser delete own account, AUTH_ACCOUNT_DELETE choose soft or hard delete
+func (u *userUsecase) DeleteUser(ctx context.Context, userId string, req *users.UserDeleteReq) error {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.DeleteUser")
+    defer span.End()
+
+    found, err := u.userRepository.FindOneUserById(ctx, userId)
+    if err != nil {
+        return err
+    }
+    if err := bcrypt.CompareHashAndPassword([]byte(found.Password), []byte(req.Password)); err != nil {
+        return fmt.Errorf("password is invalid")
+    }
+
+    var keys []string
+    if u.cfg.Auth().AccountDelete() == "hard" {
+        keys, err = u.userRepository.DeleteUser(ctx, userId)
+    } else {
+        keys, err = u.userRepository.SoftDeleteUser(ctx, userId)
+    }
+    if err != nil {
+        return err
+    }
+    u.deleteFiles(ctx, keys)
+    return nil
+}
+
+// deleteFiles remove image files after rows are gone, file that fail is only logged
+// because the account is already deleted and can not be deleted again
+func (u *userUsecase) deleteFiles(ctx context.Context, keys []string) {
+    ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+    defer cancel()
+
+    for _, key := range keys {
+        if err := u.storage.Delete(ctx, key); err != nil {
+            slog.ErrorContext(ctx, "delete user file failed", slog.String("key", key), slog.String("error", err.Error()))
+        }
+    }
+}
+
+// userOrderBy is allowed order_by of FindUser
+var userOrderBy = map[string]bool{
+    "id": true,
+    "email": true,
+    "username": true,
+    "created_at": true,
+}
+
+// FindUser list users with keyset pagination, order_by and sort of next page come from cursor
+func (u *userUsecase) FindUser(ctx context.Context, req *users.UserFilter) (*entities.CursorRes, error) {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.FindUser")
+    defer span.End()
+
+    if req.Limit < 1 {
+        req.Limit = 20
+    }
+    if req.Limit > 100 {
+        req.Limit = 100
+    }
+
+    var cursor *users.UserCursor
+    if req.Cursor != "" {
+        var err error
+        cursor, err = decodeUserCursor(req.Cursor)
+        if err != nil {
+            return nil, err
+        }
+        req.OrderBy = cursor.OrderBy
+        req.Sort = cursor.Sort
+    }
+    if req.OrderBy == "" {
+        req.OrderBy = "created_at"
+    }
+    if !userOrderBy[req.OrderBy] {
+        return nil, fmt.Errorf("order_by is invalid")
+    }
+    req.Sort = strings.ToUpper(req.Sort)
+    if req.Sort == "" {
+        req.Sort = "DESC"
+    }
+    if req.Sort != "ASC" && req.Sort != "DESC" {
+        return nil, fmt.Errorf("sort is invalid")
+    }
+
+    var err error
+    if req.CreatedFrom, err = parseCreatedAt(req.CreatedFrom, false); err != nil {
+        return nil, fmt.Errorf("created_from is invalid")
+    }
+    if req.CreatedTo, err = parseCreatedAt(req.CreatedTo, true); err != nil {
+        return nil, fmt.Errorf("created_to is invalid")
+    }
+
+    usersData, err := u.userRepository.FindUser(ctx, req, cursor)
+    if err != nil {
+        return nil, err
+    }
+
+    res := &entities.CursorRes{
+        Limit: req.Limit,
+    }
+    if len(usersData) > req.Limit {
+        usersData = usersData[:req.Limit]
+        last := usersData[len(usersData)-1]
+        res.NextCursor = encodeUserCursor(&users.UserCursor{
+            OrderBy: req.OrderBy,
+            Sort: req.Sort,
+            Value: usersPatterns.CursorValue(last, req.OrderBy),
+            Id: last.Id,
+        })
+    }
+    res.Data = usersData
+    return res, nil
+}
+
+func encodeUserCursor(cursor *users.UserCursor) string {
+    data, _ := json.Marshal(cursor)
+    return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeUserCursor(value string) (*users.UserCursor, error) {
+    data, err := base64.RawURLEncoding.DecodeString(value)
+    if err != nil {
+        return nil, fmt.Errorf("cursor is invalid")
+    }
+    cursor := new(users.UserCursor)
+    if err := json.Unmarshal(data, cursor); err != nil || cursor.Id == "" {
+        return nil, fmt.Errorf("cursor is invalid")
+    }
+    if cursor.OrderBy == "created_at" {
+        if _, err := time.Parse("2006-01-02T15:04:05.999999", cursor.Value); err != nil {
+            return nil, fmt.Errorf("cursor is invalid")
+        }
+    }
+    return cursor, nil
+}
+
+// parseCreatedAt accept date or RFC 3339 time and return UTC time for timestamp column,
+// date of upper bound is moved to next day so the whole day is included
+func parseCreatedAt(value string, isUpper bool) (string, error) {
+    if value == "" {
+        return "", nil
+    }
+    t, err := time.Parse(time.RFC3339, value)
+    if err != nil {
+        t, err = time.Parse("2006-01-02", value)
+        if err != nil {
+            return "", err
+        }
+        if isUpper {
+            t = t.AddDate(0, 0, 1)
+        }
+    }
+    return t.UTC().Format("2006-01-02 15:04:05.999999"), nil
+}
+
+// DisableUser admin can not disable own account so there is always someone to enable it back
+func (u *userUsecase) DisableUser(ctx context.Context, adminId, userId string, disabled bool) error {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.DisableUser")
+    defer span.End()
+
+    if disabled && adminId == userId {
+        return fmt.Errorf("can not disable your own account")
+    }
+    return u.userRepository.DisableUser(ctx, userId, disabled)
+}
+
+// ForgotPassword always succeed when email is unknown so it can not be used to find accounts,
+// mail is sent in background for the same reason
+func (u *userUsecase) ForgotPassword(ctx context.Context, req *users.UserForgotPasswordReq) error {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.ForgotPassword")
+    defer span.End()
+
+    user, err := u.userRepository.FindOneUserByEmail(ctx, req.Email)
+    if err != nil {
+        return nil
+    }
+
+    token, err := wymjauth.RandomToken(32)
+    if err != nil {
+        return err
+    }
+    if err := u.userRepository.InsertPasswordReset(ctx, user.Id, token, time.Now().Add(passwordResetExpire)); err != nil {
+        return err
+    }
+
+    mail := &wymjmailer.Mail{
+        To: user.Email,
+        Subject: fmt.Sprintf("Reset your %s password", u.cfg.App().Name()),
+        Body: fmt.Sprintf(
+            "Hi %s,\n\nUse the link below to set a new password. The link expires in %d minutes and can be used once.\n\n%s/reset-password?token=%s\n\nIf you did not request this, you can ignore this email.\n",
+            user.Username,
+            int(passwordResetExpire.Minutes()),
+            strings.TrimSuffix(u.cfg.Mail().LinkUrl(), "/"),
+            token,
+        ),
+    }
+    // mail is sent after response, keep trace of request but not its cancel
+    go func() {
+        ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+        defer cancel()
+        if err := u.mailer.Send(ctx, mail); err != nil {
+            slog.ErrorContext(ctx, "send password reset mail failed", slog.String("user_id", user.Id), slog.String("error", err.Error()))
+        }
+    }()
+    return nil
+}
+
+// ResetPassword set new password and sign out every session of the user
+func (u *userUsecase) ResetPassword(ctx context.Context, req *users.UserResetPasswordReq) error {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.ResetPassword")
+    defer span.End()
+
+    if req.Token == "" {
+        return fmt.Errorf("reset token is invalid or expired")
+    }
+    if len(req.Password) < 8 {
+        return fmt.Errorf("password must be at least 8 characters")
+    }
+    if err := req.BcryptHashing(); err != nil {
+        return err
+    }
+    if err := u.userRepository.ResetPassword(ctx, req.Token, req.Password); err != nil {
+        return err
+    }
+    return nil
+}
+
+// sendVerification create verification token and send it in background
+func (u *userUsecase) sendVerification(ctx context.Context, user *users.User) error {
+    token, err := wymjauth.RandomToken(32)
+    if err != nil {
+        return err
+    }
+    if err := u.userRepository.InsertEmailVerification(ctx, user.Id, token, time.Now().Add(emailVerificationExpire)); err != nil {
+        return err
+    }
+
+    mail := &wymjmailer.Mail{
+        To: user.Email,
+        Subject: fmt.Sprintf("Verify your %s email", u.cfg.App().Name()),
+        Body: fmt.Sprintf(
+            "Hi %s,\n\nUse the link below to verify your email. The link expires in %d hours.\n\n%s/verify-email?token=%s\n",
+            user.Username,
+            int(emailVerificationExpire.Hours()),
+            strings.TrimSuffix(u.cfg.Mail().LinkUrl(), "/"),
+            token,
+        ),
+    }
+    // mail is sent after response, keep trace of request but not its cancel
+    go func() {
+        ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+        defer cancel()
+        if err := u.mailer.Send(ctx, mail); err != nil {
+            slog.ErrorContext(ctx, "send verification mail failed", slog.String("user_id", user.Id), slog.String("error", err.Error()))
+        }
+    }()
+    return nil
+}
+
+func (u *userUsecase) VerifyEmail(ctx context.Context, req *users.UserVerifyEmailReq) error {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.VerifyEmail")
+    defer span.End()
+
+    if req.Token == "" {
+        return fmt.Errorf("verification token is invalid or expired")
+    }
+    if err := u.userRepository.VerifyEmail(ctx, req.Token); err != nil {
+        return err
+    }
+    return nil
+}
+
+// ResendVerification do nothing for unknown or verified email so it can not be used to find accounts
+func (u *userUsecase) ResendVerification(ctx context.Context, req *users.UserResendVerificationReq) error {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.ResendVerification")
+    defer span.End()
+
+    found, err := u.userRepository.FindOneUserByEmail(ctx, req.Email)
+    if err != nil || found.EmailVerified {
+        return nil
+    }
+
+    lastSentAt, err := u.userRepository.FindLastEmailVerificationAt(ctx, found.Id)
+    if err != nil {
+        return err
+    }
+    interval := time.Duration(u.cfg.Auth().VerifyResendInterval()) * time.Second
+    if lastSentAt != nil && time.Since(*lastSentAt) < interval {
+        return fmt.Errorf("verification email was sent recently, please try again later")
+    }
+
+    return u.sendVerification(ctx, &users.User{
+        Id: found.Id,
+        Email: found.Email,
+        Username: found.Username,
+        RoleId: found.RoleId,
+    })
+}
+
+// checkTotpCode accept totp code or unused recovery code
+func (u *userUsecase) checkTotpCode(ctx context.Context, userId string, totp *users.UserTotp, code string) error {
+    code = strings.ReplaceAll(code, " ", "")
+    if _, err := strconv.Atoi(code); err == nil && len(code) == 6 {
+        if totp.Secret == nil {
+            return fmt.Errorf("code is invalid")
+        }
+        step, ok := wymjtotp.Validate(*totp.Secret, code, time.Now())
+        if !ok {
+            return fmt.Errorf("code is invalid")
+        }
+        return u.userRepository.UpdateTotpLastStep(ctx, userId, step)
+    }
+    return u.userRepository.UseRecoveryCode(ctx, userId, wymjtotp.NormalizeRecoveryCode(code))
+}
+
+// VerifyTotp is second step of sign in, exchange challenge token and code for passport
+func (u *userUsecase) VerifyTotp(ctx context.Context, req *users.UserTotpReq, client *users.OauthClient) (*users.UserPassport, error) {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.VerifyTotp")
+    defer span.End()
+
+    claims, err := wymjauth.ParseChallengeToken(u.cfg.Jwt(), req.ChallengeToken)
+    if err != nil {
+        return nil, err
+    }
+    userId := claims.Claims.Id
+
+    profile, err := u.userRepository.GetProfile(ctx, userId)
+    if err != nil {
+        return nil, err
+    }
+    // code guessing is throttled together with password
+    accountKey, ipKey := signInKeys(profile.Email, client)
+    if err := u.checkSignInThrottle(ctx, accountKey, ipKey); err != nil {
+        wymjmetrics.LoginFailed(wymjmetrics.Totp, "locked")
+        return nil, err
+    }
+
+    totp, err := u.userRepository.FindTotp(ctx, userId)
+    if err != nil {
+        return nil, err
+    }
+    if !totp.Enabled {
+        return nil, fmt.Errorf("two-factor authentication is not enabled")
+    }
+    if err := u.checkTotpCode(ctx, userId, totp, req.Code); err != nil {
+        u.failSignIn(ctx, accountKey, ipKey)
+        wymjmetrics.LoginFailed(wymjmetrics.Totp, "invalid_code")
+        return nil, err
+    }
+    if err := u.userRepository.ClearSignInThrottle(ctx, accountKey); err != nil {
+        return nil, err
+    }
+    passport, err := u.newPassport(ctx, profile, client)
+    countSignIn(wymjmetrics.Totp, passport, err)
+    return passport, err
+}
+
+// EnrollTotp create pending secret, totp is not enabled until EnableTotp confirm a code
+func (u *userUsecase) EnrollTotp(ctx context.Context, userId string) (*users.UserTotpEnroll, error) {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.EnrollTotp")
+    defer span.End()
+
+    profile, err := u.userRepository.GetProfile(ctx, userId)
+    if err != nil {
+        return nil, err
+    }
+    if profile.TotpEnabled {
+        return nil, fmt.Errorf("two-factor authentication is already enabled")
+    }
+
+    secret, err := wymjtotp.GenerateSecret()
+    if err != nil {
+        return nil, err
+    }
+    if err := u.userRepository.UpdateTotpSecret(ctx, userId, secret); err != nil {
+        return nil, err
+    }
+    return &users.UserTotpEnroll{
+        Secret: secret,
+        Uri: wymjtotp.ProvisioningUri(u.cfg.App().Name(), profile.Email, secret),
+    }, nil
+}
+
+// EnableTotp confirm authenticator app is set up, recovery codes are returned only this time
+func (u *userUsecase) EnableTotp(ctx context.Context, userId string, req *users.UserTotpReq) (*users.UserTotpRecoveryCodes, error) {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.EnableTotp")
+    defer span.End()
+
+    totp, err := u.userRepository.FindTotp(ctx, userId)
+    if err != nil {
+        return nil, err
+    }
+    if totp.Enabled {
+        return nil, fmt.Errorf("two-factor authentication is already enabled")
+    }
+    if totp.Secret == nil {
+        return nil, fmt.Errorf("two-factor authentication is not enrolled")
+    }
+
+    step, ok := wymjtotp.Validate(*totp.Secret, strings.ReplaceAll(req.Code, " ", ""), time.Now())
+    if !ok {
+        return nil, fmt.Errorf("code is invalid")
+    }
+
+    codes, err := wymjtotp.RecoveryCodes(recoveryCodeCount)
+    if err != nil {
+        return nil, err
+    }
+    normalized := make([]string, 0, len(codes))
+    for _, code := range codes {
+        normalized = append(normalized, wymjtotp.NormalizeRecoveryCode(code))
+    }
+    if err := u.userRepository.EnableTotp(ctx, userId, step, normalized); err != nil {
+        return nil, err
+    }
+    return &users.UserTotpRecoveryCodes{
+        RecoveryCodes: codes,
+    }, nil
+}
+
+func (u *userUsecase) DisableTotp(ctx context.Context, userId string, req *users.UserTotpReq) error {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.DisableTotp")
+    defer span.End()
+
+    if u.userRepository.IsTotpRequired(ctx, userId) {
+        return fmt.Errorf("two-factor authentication is required for your role")
+    }
+    totp, err := u.userRepository.FindTotp(ctx, userId)
+    if err != nil {
+        return err
+    }
+    if !totp.Enabled {
+        return fmt.Errorf("two-factor authentication is not enabled")
+    }
+    if err := u.checkTotpCode(ctx, userId, totp, req.Code); err != nil {
+        return err
+    }
+    if err := u.userRepository.DisableTotp(ctx, userId); err != nil {
+        return err
+    }
+    return nil
+}
+
+func (u *userUsecase) UpdateRoleTotp(ctx context.Context, roleId int, req *users.RoleTotpReq) error {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.UpdateRoleTotp")
+    defer span.End()
+
+    if err := u.userRepository.UpdateRoleTotp(ctx, roleId, req.Required); err != nil {
+        return err
+    }
+    return nil
+}
+
+// signInKeys return throttle key of account and client,
+// email is used instead of user id so unknown email is throttled the same way
+func signInKeys(email string, client *users.OauthClient) (string, string) {
+    return "email:" + strings.ToLower(strings.Trim(email, " ")), "ip:" + client.Ip
+}
+
+// signInBackoff is wait time after failed sign in, 1s 2s 4s ... up to 1 minute
+func signInBackoff(failedCount int) time.Duration {
+    if failedCount > 7 {
+        return time.Minute
+    }
+    backoff := time.Second << (failedCount - 1)
+    if backoff > time.Minute {
+        return time.Minute
+    }
+    return backoff
+}
+
+func (u *userUsecase) checkSignInThrottle(ctx context.Context, keys ...string) error {
+    now := time.Now()
+    for _, key := range keys {
+        throttle, err := u.userRepository.FindSignInThrottle(ctx, key)
+        if err != nil {
+            return err
+        }
+        if throttle == nil {
+            continue
+        }
+        if throttle.LockedUntil != nil && now.Before(*throttle.LockedUntil) {
+            return fmt.Errorf("too many failed sign in attempts, please try again later")
+        }
+        if throttle.FailedCount > 0 && throttle.LastFailedAt != nil && now.Before(throttle.LastFailedAt.Add(signInBackoff(throttle.FailedCount))) {
+            return fmt.Errorf("too many failed sign in attempts, please try again later")
+        }
+    }
+    return nil
+}
+
+func (u *userUsecase) failSignIn(ctx context.Context, accountKey, ipKey string) {
+    if err := u.userRepository.FailSignIn(ctx, accountKey, u.cfg.Auth().LockoutThreshold(), u.cfg.Auth().LockoutDuration()); err != nil {
+        slog.ErrorContext(ctx, "fail sign in", slog.String("error", err.Error()))
+    }
+    if err := u.userRepository.FailSignIn(ctx, ipKey, u.cfg.Auth().LockoutIpThreshold(), u.cfg.Auth().LockoutDuration()); err != nil {
+        slog.ErrorContext(ctx, "fail sign in", slog.String("error", err.Error()))
+    }
+}
+
+// UnlockUser clear failed sign in of the account, lock of ip is kept
+func (u *userUsecase) UnlockUser(ctx context.Context, userId string) error {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.UnlockUser")
+    defer span.End()
+
+    profile, err := u.userRepository.GetProfile(ctx, userId)
+    if err != nil {
+        return err
+    }
+    accountKey, _ := signInKeys(profile.Email, &users.OauthClient{})
+    if err := u.userRepository.ClearSignInThrottle(ctx, accountKey); err != nil {
+        return err
+    }
+    return nil
+}
+
+// OidcAuthorize start authorization code flow with pkce, verifier and nonce stay on server
+func (u *userUsecase) OidcAuthorize(ctx context.Context, provider string) (*users.OidcAuthorizeRes, error) {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.OidcAuthorize")
+    defer span.End()
+
+    client, ok := u.oidc[provider]
+    if !ok {
+        return nil, fmt.Errorf("oidc provider not found")
+    }
+
+    state, err := wymjauth.RandomToken(32)
+    if err != nil {
+        return nil, err
+    }
+    codeVerifier, err := wymjauth.RandomToken(32)
+    if err != nil {
+        return nil, err
+    }
+    nonce, err := wymjauth.RandomToken(16)
+    if err != nil {
+        return nil, err
+    }
+
+    url, err := client.AuthCodeUrl(state, wymjoidc.CodeChallenge(codeVerifier), nonce)
+    if err != nil {
+        return nil, err
+    }
+    if err := u.userRepository.InsertOidcState(ctx, state, &users.OidcState{
+        Provider: provider,
+        CodeVerifier: codeVerifier,
+        Nonce: nonce,
+    }, time.Now().Add(oidcStateExpire)); err != nil {
+        return nil, err
+    }
+    return &users.OidcAuthorizeRes{
+        Url: url,
+        State: state,
+    }, nil
+}
+
+// OidcSignIn exchange code and sign in the linked user. Identity that is not linked is linked
+// to user with the same verified email, or a new customer when auto provision is on
+func (u *userUsecase) OidcSignIn(ctx context.Context, provider string, req *users.OidcCallbackReq, client *users.OauthClient) (*users.UserPassport, error) {
+    ctx, span := wymjtrace.Start(ctx, "userUsecase.OidcSignIn")
+    defer span.End()
+
+    oidcClient, ok := u.oidc[provider]
+    if !ok {
+        return nil, fmt.Errorf("oidc provider not found")
+    }
+    if req.Code == "" || req.State == "" {
+        return nil, fmt.Errorf("code and state are required")
+    }
+
+    state, err := u.userRepository.UseOidcState(ctx, provider, req.State)
+    if err != nil {
+        return nil, err
+    }
+
+    ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+    defer cancel()
+    external, err := oidcClient.Exchange(ctx, req.Code, state.CodeVerifier, state.Nonce)
+    if err != nil {
+        wymjmetrics.LoginFailed(wymjmetrics.Oidc, "invalid_credentials")
+        return nil, fmt.Errorf("oidc sign in failed: %v", err)
+    }
+    identity := &users.UserIdentity{
+        Provider: provider,
+        Subject: external.Subject,
+        Email: strings.ToLower(external.Email),
+    }
+
+    userId, err := u.userRepository.FindUserIdByIdentity(ctx, provider, identity.Subject)
+    if err != nil {
+        return nil, err
+    }
+    if userId == "" {
+        userId, err = u.linkOidcUser(ctx, identity, external)
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    user, err := u.userRepository.GetProfile(ctx, userId)
+    if err != nil {
+        return nil, err
+    }
+    passport, err := u.signIn(ctx, user, client)
+    countSignIn(wymjmetrics.Oidc, passport, err)
+    return passport, err
+}
+
+// linkOidcUser never link to account whose email is not verified, otherwise anyone could
+// sign up with the email first and take over the account later
+func (u *userUsecase) linkOidcUser(ctx context.Context, identity *users.UserIdentity, external *wymjoidc.Identity) (string, error) {
+    if identity.Email != "" && external.EmailVerified {
+        found, err := u.userRepository.FindOneUserByEmail(ctx, identity.Email)
+        if err == nil {
+            if !found.EmailVerified {
+                return "", fmt.Errorf("email has been used")
+            }
+            if err := u.userRepository.InsertIdentity(ctx, found.Id, identity); err != nil {
+                return "", err
+            }
+            return found.Id, nil
+        }
+    }
+
+    if !u.cfg.Oidc().AutoProvision() {
+        return "", fmt.Errorf("account is not linked, please sign up first")
+    }
+    if identity.Email == "" {
+        return "", fmt.Errorf("email is required from provider")
+    }
+
+    // user can set a password later with forgot password
+    password, err := wymjauth.RandomToken(32)
+    if err != nil {
+        return "", err
+    }
+    suffix, err := wymjauth.RandomToken(3)
+    if err != nil {
+        return "", err
+    }
+    req := &users.UserRegisterReq{
+        Email: identity.Email,
+        Username: oidcUsername(identity.Email) + "-" + strings.ToLower(suffix),
+        Password: password,
+    }
+    if err := req.BcryptHashing(); err != nil {
+        return "", err
+    }
+    userId, err := u.userRepository.InsertOidcUser(ctx, req, external.EmailVerified, identity)
+    if err != nil {
+        return "", err
+    }
+
+    if !external.EmailVerified {
+        profile, err := u.userRepository.GetProfile(ctx, userId)
+        if err == nil {
+            err = u.sendVerification(ctx, profile)
+        }
+        if err != nil {
+            slog.ErrorContext(ctx, "send verification failed", slog.String("user_id", userId), slog.String("error", err.Error()))
+        }
+    }
+    return userId, nil
+}
+
+// oidcUsername is local part of email with only letter, digit, dot, dash and underscore
+func oidcUsername(email string) string {
+    local, _, _ := strings.Cut(email, "@")
+    username := strings.Map(func(r rune) rune {
+        switch {
+        case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+            return r
+        default:
+            return -1
+        }
+    }, strings.ToLower(local))
+    if username == "" {
+        return "user"
+    }
+    return username
+}
@@ -0,0 +1,252 @@
+package usersUsecases
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/modules/users"
+	"github.com/ppp3ppj/wymj/modules/users/usersRepositories"
+	"github.com/ppp3ppj/wymj/pkg/wymjoidc"
+	"github.com/ppp3ppj/wymj/pkg/wymjstorage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type testConfig struct {
+    config.IConfig
+    accountDelete string
+}
+
+type testAuthConfig struct {
+    config.IAuthconfig
+    accountDelete string
+}
+
+type testOidcConfig struct {
+    config.IOidcconfig
+}
+
+type testJwtConfig struct {
+    config.IJwtconfig
+}
+
+func (testConfig) Oidc() config.IOidcconfig { return testOidcConfig{} }
+func (testConfig) Jwt() config.IJwtconfig { return testJwtConfig{} }
+func (c testConfig) Auth() config.IAuthconfig { return testAuthConfig{accountDelete: c.accountDelete} }
+func (c testAuthConfig) AccountDelete() string { return c.accountDelete }
+func (testOidcConfig) AutoProvision() bool { return false }
+func (testJwtConfig) SecretKey() []byte { return []byte("secret") }
+func (testJwtConfig) KeyFiles() map[string]string { return nil }
+func (testJwtConfig) ActiveKid() string { return "" }
+
+// testRepository keep oidc states, identities and users in memory. User has totp enabled
+// so sign in stop at challenge and does not need session tables
+type testRepository struct {
+    usersRepositories.IUserRepository
+    states map[string]*users.OidcState
+    identities map[string]string
+    users map[string]*users.UserCredentialCheck
+    linked []*users.UserIdentity
+    password string
+    images []string
+    deletedBy string
+}
+
+func (r *testRepository) UseOidcState(ctx context.Context, provider, state string) (*users.OidcState, error) {
+    oidcState, ok := r.states[state]
+    if !ok || oidcState.Provider != provider {
+        return nil, fmt.Errorf("state is invalid or expired")
+    }
+    delete(r.states, state)
+    return oidcState, nil
+}
+
+func (r *testRepository) FindUserIdByIdentity(ctx context.Context, provider, subject string) (string, error) {
+    return r.identities[provider+":"+subject], nil
+}
+
+func (r *testRepository) FindOneUserByEmail(ctx context.Context, email string) (*users.UserCredentialCheck, error) {
+    user, ok := r.users[email]
+    if !ok {
+        return nil, fmt.Errorf("user not found")
+    }
+    return user, nil
+}
+
+func (r *testRepository) InsertIdentity(ctx context.Context, userId string, identity *users.UserIdentity) error {
+    r.linked = append(r.linked, identity)
+    r.identities[identity.Provider+":"+identity.Subject] = userId
+    return nil
+}
+
+func (r *testRepository) GetProfile(ctx context.Context, userId string) (*users.User, error) {
+    return &users.User{Id: userId, EmailVerified: true, TotpEnabled: true}, nil
+}
+
+func (r *testRepository) FindOneUserById(ctx context.Context, userId string) (*users.UserCredentialCheck, error) {
+    return &users.UserCredentialCheck{Id: userId, Password: r.password}, nil
+}
+
+func (r *testRepository) DeleteUser(ctx context.Context, userId string) ([]string, error) {
+    r.deletedBy = "hard"
+    return r.images, nil
+}
+
+func (r *testRepository) SoftDeleteUser(ctx context.Context, userId string) ([]string, error) {
+    r.deletedBy = "soft"
+    return r.images, nil
+}
+
+type testStorage struct {
+    wymjstorage.IWymjStorage
+    files map[string]bool
+}
+
+func (s *testStorage) Delete(ctx context.Context, key string) error {
+    if key == "tasks/T0000002/broken.png" {
+        return fmt.Errorf("delete file failed: 503 Service Unavailable")
+    }
+    delete(s.files, key)
+    return nil
+}
+
+// testOidc stand for provider, it only accept code of the flow whose verifier and nonce it get
+type testOidc struct {
+    codeVerifier string
+    nonce string
+    identity *wymjoidc.Identity
+    exchanged int
+}
+
+func (o *testOidc) AuthCodeUrl(state, codeChallenge, nonce string) (string, error) {
+    return "", nil
+}
+
+func (o *testOidc) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*wymjoidc.Identity, error) {
+    o.exchanged++
+    if codeVerifier != o.codeVerifier || nonce != o.nonce {
+        return nil, fmt.Errorf("id_token nonce is invalid")
+    }
+    return o.identity, nil
+}
+
+func TestOidcSignIn(t *testing.T) {
+    tests := []struct {
+        name string
+        state string
+        provider string
+        emailVerified bool
+        localVerified bool
+        linked bool
+        wantUserId string
+        wantErr string
+    }{
+        {"verified email is linked", "st4te", "mock", true, true, false, "U000001", ""},
+        {"linked identity sign in", "st4te", "mock", false, true, true, "U000001", ""},
+        {"state mismatch", "other-state", "mock", true, true, false, "", "state is invalid or expired"},
+        {"state of other provider", "st4te", "github", true, true, false, "", "state is invalid or expired"},
+        {"unverified email from provider is not linked", "st4te", "mock", false, true, false, "", "account is not linked, please sign up first"},
+        {"email of unverified account is not linked", "st4te", "mock", true, false, false, "", "email has been used"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            repository := &testRepository{
+                states: map[string]*users.OidcState{
+                    "st4te": {Provider: "mock", CodeVerifier: "verifier", Nonce: "n0nce"},
+                },
+                identities: make(map[string]string),
+                users: map[string]*users.UserCredentialCheck{
+                    "ppp@wymj.dev": {Id: "U000001", Email: "ppp@wymj.dev", EmailVerified: tt.localVerified},
+                },
+            }
+            if tt.linked {
+                repository.identities["mock:248289761001"] = "U000001"
+            }
+            provider := &testOidc{
+                codeVerifier: "verifier",
+                nonce: "n0nce",
+                identity: &wymjoidc.Identity{Provider: "mock", Subject: "248289761001", Email: "PPP@wymj.dev", EmailVerified: tt.emailVerified},
+            }
+            usecase := UsersUsecase(testConfig{}, repository, nil, map[string]wymjoidc.IWymjOidc{"mock": provider, "github": provider}, nil)
+
+            passport, err := usecase.OidcSignIn(context.Background(), tt.provider, &users.OidcCallbackReq{Code: "code", State: tt.state}, &users.OauthClient{})
+            if tt.wantErr != "" {
+                if err == nil || err.Error() != tt.wantErr {
+                    t.Fatalf("error = %v, want %q", err, tt.wantErr)
+                }
+                if len(repository.linked) != 0 {
+                    t.Errorf("identity is linked: %+v", repository.linked)
+                }
+                if tt.wantErr == "state is invalid or expired" && provider.exchanged != 0 {
+                    t.Errorf("code is exchanged with state that does not match")
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("oidc sign in: %v", err)
+            }
+            if passport.User.Id != tt.wantUserId || passport.Challenge == nil {
+                t.Errorf("passport = %+v", passport)
+            }
+            if !tt.linked && (len(repository.linked) != 1 || repository.linked[0].Email != "ppp@wymj.dev") {
+                t.Errorf("linked = %+v", repository.linked)
+            }
+            if _, ok := repository.states[tt.state]; ok {
+                t.Errorf("state can be used again")
+            }
+        })
+    }
+}
+
+func TestDeleteUserFiles(t *testing.T) {
+    hash, err := bcrypt.GenerateFromPassword([]byte("p@ssw0rd"), bcrypt.MinCost)
+    if err != nil {
+        t.Fatal(err)
+    }
+    tests := []struct {
+        name string
+        accountDelete string
+        password string
+        wantErr string
+    }{
+        {"soft delete", "soft", "p@ssw0rd", ""},
+        {"hard delete", "hard", "p@ssw0rd", ""},
+        {"wrong password", "hard", "wrong", "password is invalid"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            repository := &testRepository{
+                password: string(hash),
+                images: []string{"tasks/T0000001/a.png", "tasks/T0000002/broken.png", "tasks/T0000002/b.png"},
+            }
+            storage := &testStorage{files: map[string]bool{
+                "tasks/T0000001/a.png": true,
+                "tasks/T0000002/b.png": true,
+                "tasks/T0000003/other-user.png": true,
+            }}
+            usecase := UsersUsecase(testConfig{accountDelete: tt.accountDelete}, repository, nil, nil, storage)
+
+            err := usecase.DeleteUser(context.Background(), "U000001", &users.UserDeleteReq{Password: tt.password})
+            if tt.wantErr != "" {
+                if err == nil || err.Error() != tt.wantErr {
+                    t.Fatalf("error = %v, want %q", err, tt.wantErr)
+                }
+                if repository.deletedBy != "" || len(storage.files) != 3 {
+                    t.Errorf("user is deleted with wrong password")
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("delete user: %v", err)
+            }
+            if repository.deletedBy != tt.accountDelete {
+                t.Errorf("deleted by %q, want %q", repository.deletedBy, tt.accountDelete)
+            }
+            // file that fail to delete does not stop the others
+            if len(storage.files) != 1 || !storage.files["tasks/T0000003/other-user.png"] {
+                t.Errorf("files left = %v", storage.files)
+            }
+        })
+    }
+}
@@ -1,17 +1,31 @@
 package databases
 
 import (
-	"log"
-	"github.com/ppp3ppj/wymj/config"
+	"database/sql"
+
+	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/pkg/wymjlogger"
+	"github.com/ppp3ppj/wymj/pkg/wymjmetrics"
 )
 
+// pgx driver with a span for every query, see traceDriver
+const traceDriverName = "pgx-trace"
+
+func init() {
+    sql.Register(traceDriverName, &traceDriver{Driver: stdlib.GetDefaultDriver()})
+    sqlx.BindDriver(traceDriverName, sqlx.DOLLAR)
+}
+
 func DbConnect(cfg config.IDbconfig) *sqlx.DB {
-    db, err := sqlx.Connect("pgx", cfg.Url())
+    db, err := sqlx.Connect(traceDriverName, cfg.Url())
     if err != nil {
-        log.Fatalf("connect to db failed: %v", err)
+        wymjlogger.Fatalf("connect to db failed: %v", err)
     }   
     db.DB.SetMaxOpenConns(cfg.MaxConnections())
+    if err := wymjmetrics.RegisterDb(db.DB); err != nil {
+        wymjlogger.Fatalf("register db metrics failed: %v", err)
+    }
     return db
 }
@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE "user_projects" DROP CONSTRAINT IF EXISTS "user_projects_user_id_project_id_key";
+
+COMMIT;
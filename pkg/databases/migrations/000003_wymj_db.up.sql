@@ -0,0 +1,6 @@
+BEGIN;
+
+-- one membership per user per project
+ALTER TABLE "user_projects" ADD CONSTRAINT "user_projects_user_id_project_id_key" UNIQUE ("user_id", "project_id");
+
+COMMIT;
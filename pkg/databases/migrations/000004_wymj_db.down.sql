@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP TRIGGER IF EXISTS set_updated_at_timestamp_time_entries_table ON "time_entries";
+
+DROP TABLE IF EXISTS "time_entries" CASCADE;
+
+COMMIT;
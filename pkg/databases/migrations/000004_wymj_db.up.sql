@@ -0,0 +1,26 @@
+BEGIN;
+
+-- each start/stop of a timer is a time entry, duration is rolled up into tasks.duration when stop
+CREATE TABLE "time_entries" (
+  "id" uuid NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+  "user_id" varchar NOT NULL,
+  "task_id" varchar NOT NULL,
+  "started_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "stopped_at" TIMESTAMPTZ,
+  "duration" int NOT NULL DEFAULT 0,
+  "created_at" TIMESTAMP NOT NULL DEFAULT NOW(),
+  "updated_at" TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE "time_entries" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+
+ALTER TABLE "time_entries" ADD FOREIGN KEY ("task_id") REFERENCES "tasks" ("id");
+
+-- at most one running timer per user
+CREATE UNIQUE INDEX "time_entries_running_user_id_key" ON "time_entries" ("user_id") WHERE "stopped_at" IS NULL;
+
+CREATE INDEX "time_entries_task_id_idx" ON "time_entries" ("task_id");
+
+CREATE TRIGGER set_updated_at_timestamp_time_entries_table BEFORE UPDATE ON "time_entries" FOR EACH ROW EXECUTE PROCEDURE set_updated_at_column();
+
+COMMIT;
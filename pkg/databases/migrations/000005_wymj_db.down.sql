@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP TRIGGER IF EXISTS set_updated_at_timestamp_oauth_refresh_tokens_table ON "oauth_refresh_tokens";
+
+DROP TABLE IF EXISTS "oauth_refresh_tokens" CASCADE;
+
+ALTER TABLE "oauth" DROP COLUMN IF EXISTS "revoked_at";
+
+COMMIT;
@@ -0,0 +1,30 @@
+BEGIN;
+
+-- oauth is a session family, revoked when a used refresh token is presented again
+ALTER TABLE "oauth" ADD COLUMN "revoked_at" TIMESTAMP;
+
+-- every refresh token issued for a session, only sha256 of the token is stored
+CREATE TABLE "oauth_refresh_tokens" (
+  "id" uuid NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+  "oauth_id" uuid NOT NULL,
+  "token_hash" varchar UNIQUE NOT NULL,
+  "used_at" TIMESTAMP,
+  "replaced_by" uuid,
+  "revoked_at" TIMESTAMP,
+  "created_at" TIMESTAMP NOT NULL DEFAULT NOW(),
+  "updated_at" TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE "oauth_refresh_tokens" ADD FOREIGN KEY ("oauth_id") REFERENCES "oauth" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "oauth_refresh_tokens" ADD FOREIGN KEY ("replaced_by") REFERENCES "oauth_refresh_tokens" ("id") ON DELETE SET NULL;
+
+CREATE INDEX "oauth_refresh_tokens_oauth_id_idx" ON "oauth_refresh_tokens" ("oauth_id");
+
+-- current refresh token of existing sessions
+INSERT INTO "oauth_refresh_tokens" ("oauth_id", "token_hash")
+SELECT "id", encode(sha256(convert_to("refresh_token", 'UTF8')), 'hex') FROM "oauth";
+
+CREATE TRIGGER set_updated_at_timestamp_oauth_refresh_tokens_table BEFORE UPDATE ON "oauth_refresh_tokens" FOR EACH ROW EXECUTE PROCEDURE set_updated_at_column();
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+-- client of the session, updated on sign in and every refresh
+ALTER TABLE "oauth" ADD COLUMN "user_agent" varchar NOT NULL DEFAULT '';
+ALTER TABLE "oauth" ADD COLUMN "ip" varchar NOT NULL DEFAULT '';
+ALTER TABLE "oauth" ADD COLUMN "refreshed_at" TIMESTAMP;
+
+CREATE INDEX "oauth_user_id_idx" ON "oauth" ("user_id");
+
+COMMIT;
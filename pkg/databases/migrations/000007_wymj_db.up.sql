@@ -0,0 +1,17 @@
+BEGIN;
+
+-- single-use password reset token, only sha256 of the token is stored
+CREATE TABLE "password_resets" (
+  "id" uuid NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+  "user_id" varchar NOT NULL,
+  "token_hash" varchar UNIQUE NOT NULL,
+  "expired_at" TIMESTAMPTZ NOT NULL,
+  "used_at" TIMESTAMPTZ,
+  "created_at" TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE "password_resets" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+
+CREATE INDEX "password_resets_user_id_idx" ON "password_resets" ("user_id");
+
+COMMIT;
@@ -0,0 +1,22 @@
+BEGIN;
+
+ALTER TABLE "users" ADD COLUMN "email_verified_at" TIMESTAMP;
+
+-- accounts created before verification was required are trusted
+UPDATE "users" SET "email_verified_at" = NOW();
+
+-- single-use email verification token, only sha256 of the token is stored
+CREATE TABLE "email_verifications" (
+  "id" uuid NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+  "user_id" varchar NOT NULL,
+  "token_hash" varchar UNIQUE NOT NULL,
+  "expired_at" TIMESTAMPTZ NOT NULL,
+  "used_at" TIMESTAMPTZ,
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE "email_verifications" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+
+CREATE INDEX "email_verifications_user_id_idx" ON "email_verifications" ("user_id");
+
+COMMIT;
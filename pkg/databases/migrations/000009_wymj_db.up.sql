@@ -0,0 +1,24 @@
+BEGIN;
+
+-- totp_secret is set on enroll, 2fa is on only after totp_enabled_at is set
+ALTER TABLE "users" ADD COLUMN "totp_secret" varchar;
+ALTER TABLE "users" ADD COLUMN "totp_enabled_at" TIMESTAMP;
+-- last accepted time step, a code can not be used twice
+ALTER TABLE "users" ADD COLUMN "totp_last_step" bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE "roles" ADD COLUMN "require_totp" boolean NOT NULL DEFAULT FALSE;
+
+-- one-time recovery codes, only sha256 of the code is stored
+CREATE TABLE "recovery_codes" (
+  "id" uuid NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+  "user_id" varchar NOT NULL,
+  "code_hash" varchar NOT NULL,
+  "used_at" TIMESTAMP,
+  "created_at" TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE "recovery_codes" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+
+CREATE INDEX "recovery_codes_user_id_idx" ON "recovery_codes" ("user_id");
+
+COMMIT;
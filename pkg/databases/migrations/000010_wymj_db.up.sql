@@ -0,0 +1,11 @@
+BEGIN;
+
+-- failed sign in per account (email:<email>) and per client (ip:<ip>)
+CREATE TABLE "signin_throttles" (
+  "key" varchar PRIMARY KEY,
+  "failed_count" int NOT NULL DEFAULT 0,
+  "last_failed_at" TIMESTAMPTZ,
+  "locked_until" TIMESTAMPTZ
+);
+
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE IF EXISTS "api_keys" CASCADE;
+
+COMMIT;
@@ -0,0 +1,22 @@
+BEGIN;
+
+-- api key is shown once on create, only prefix and sha256 of the key are stored
+CREATE TABLE "api_keys" (
+  "id" uuid NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+  "name" varchar NOT NULL,
+  "prefix" varchar NOT NULL,
+  "key_hash" varchar UNIQUE NOT NULL,
+  "user_id" varchar NOT NULL,
+  "scopes" jsonb NOT NULL DEFAULT '[]'::jsonb,
+  "expired_at" TIMESTAMPTZ,
+  "last_used_at" TIMESTAMPTZ,
+  "revoked_at" TIMESTAMPTZ,
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE "api_keys" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+
+-- no key is created here, first key come from AUTH_BOOTSTRAP_API_KEY and development key
+-- is in pkg/databases/seeds/dev.sql
+
+COMMIT;
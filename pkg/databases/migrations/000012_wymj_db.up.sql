@@ -0,0 +1,56 @@
+BEGIN;
+
+-- permission is named as <resource>:<action> e.g. tasks:write, users:admin
+CREATE TABLE "permissions" (
+  "id" SERIAL PRIMARY KEY,
+  "name" varchar NOT NULL UNIQUE,
+  "description" varchar NOT NULL DEFAULT '',
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE "role_permissions" (
+  "role_id" int NOT NULL,
+  "permission_id" int NOT NULL,
+  PRIMARY KEY ("role_id", "permission_id")
+);
+
+-- users.role_id is kept as primary role of the token, permissions come from every role here
+CREATE TABLE "user_roles" (
+  "user_id" varchar NOT NULL,
+  "role_id" int NOT NULL,
+  PRIMARY KEY ("user_id", "role_id")
+);
+
+ALTER TABLE "role_permissions" ADD FOREIGN KEY ("role_id") REFERENCES "roles" ("id") ON DELETE CASCADE;
+ALTER TABLE "role_permissions" ADD FOREIGN KEY ("permission_id") REFERENCES "permissions" ("id") ON DELETE CASCADE;
+ALTER TABLE "user_roles" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+ALTER TABLE "user_roles" ADD FOREIGN KEY ("role_id") REFERENCES "roles" ("id") ON DELETE CASCADE;
+
+INSERT INTO "permissions" ("name", "description") VALUES
+  ('tasks:write', 'create, update and delete own tasks and images'),
+  ('tasks:admin', 'access tasks and images of every user'),
+  ('timers:write', 'start and stop timer and import time entries'),
+  ('timers:admin', 'access time entries of every user'),
+  ('projects:admin', 'manage categories, projects and members'),
+  ('reports:admin', 'report and export data of every user'),
+  ('users:admin', 'create admin, sign out and unlock users'),
+  ('roles:admin', 'manage roles, permissions and user roles'),
+  ('apikeys:admin', 'manage api keys');
+
+-- customer
+INSERT INTO "role_permissions" ("role_id", "permission_id")
+SELECT "r"."id", "p"."id"
+FROM "roles" "r", "permissions" "p"
+WHERE "r"."title" = 'customer'
+AND "p"."name" IN ('tasks:write', 'timers:write');
+
+-- admin has every permission
+INSERT INTO "role_permissions" ("role_id", "permission_id")
+SELECT "r"."id", "p"."id"
+FROM "roles" "r", "permissions" "p"
+WHERE "r"."title" = 'admin';
+
+INSERT INTO "user_roles" ("user_id", "role_id")
+SELECT "id", "role_id" FROM "users";
+
+COMMIT;
@@ -0,0 +1,29 @@
+BEGIN;
+
+-- pending social login, row is deleted when callback use it
+CREATE TABLE "oidc_states" (
+  "state_hash" varchar PRIMARY KEY,
+  "provider" varchar NOT NULL,
+  "code_verifier" varchar NOT NULL,
+  "nonce" varchar NOT NULL,
+  "expired_at" TIMESTAMPTZ NOT NULL,
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- external account that can sign in as the user
+CREATE TABLE "user_identities" (
+  "id" uuid NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+  "user_id" varchar NOT NULL,
+  "provider" varchar NOT NULL,
+  "subject" varchar NOT NULL,
+  "email" varchar,
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "last_signin_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE ("provider", "subject")
+);
+
+ALTER TABLE "user_identities" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+
+CREATE INDEX "user_identities_user_id_idx" ON "user_identities" ("user_id");
+
+COMMIT;
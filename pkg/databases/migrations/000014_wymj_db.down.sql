@@ -0,0 +1,8 @@
+BEGIN;
+
+DROP TABLE IF EXISTS "oauth2_tokens" CASCADE;
+DROP TABLE IF EXISTS "oauth2_codes" CASCADE;
+DROP TABLE IF EXISTS "oauth2_consents" CASCADE;
+DROP TABLE IF EXISTS "oauth2_clients" CASCADE;
+
+COMMIT;
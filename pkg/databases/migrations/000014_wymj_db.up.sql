@@ -0,0 +1,65 @@
+BEGIN;
+
+-- third party app, secret is NULL for public client (must use pkce)
+CREATE TABLE "oauth2_clients" (
+  "id" varchar PRIMARY KEY,
+  "name" varchar NOT NULL,
+  "secret_hash" varchar,
+  "user_id" varchar NOT NULL,
+  "redirect_uris" jsonb NOT NULL DEFAULT '[]'::jsonb,
+  "scopes" jsonb NOT NULL DEFAULT '[]'::jsonb,
+  "grant_types" jsonb NOT NULL DEFAULT '[]'::jsonb,
+  "revoked_at" TIMESTAMPTZ,
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- scope is space separated as in RFC 6749
+CREATE TABLE "oauth2_consents" (
+  "user_id" varchar NOT NULL,
+  "client_id" varchar NOT NULL,
+  "scope" varchar NOT NULL,
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY ("user_id", "client_id")
+);
+
+CREATE TABLE "oauth2_codes" (
+  "code_hash" varchar PRIMARY KEY,
+  "client_id" varchar NOT NULL,
+  "user_id" varchar NOT NULL,
+  "redirect_uri" varchar NOT NULL,
+  "redirect_uri_sent" boolean NOT NULL DEFAULT false,
+  "scope" varchar NOT NULL,
+  "code_challenge" varchar NOT NULL DEFAULT '',
+  "expired_at" TIMESTAMPTZ NOT NULL,
+  "used_at" TIMESTAMPTZ,
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- id is jti of access token, refresh token is opaque and stored as sha256
+CREATE TABLE "oauth2_tokens" (
+  "id" uuid NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+  "client_id" varchar NOT NULL,
+  "user_id" varchar NOT NULL,
+  "scope" varchar NOT NULL,
+  "grant_type" varchar NOT NULL,
+  "code_hash" varchar,
+  "refresh_hash" varchar UNIQUE,
+  "expired_at" TIMESTAMPTZ NOT NULL,
+  "refresh_expired_at" TIMESTAMPTZ,
+  "revoked_at" TIMESTAMPTZ,
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE "oauth2_clients" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+ALTER TABLE "oauth2_consents" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+ALTER TABLE "oauth2_consents" ADD FOREIGN KEY ("client_id") REFERENCES "oauth2_clients" ("id") ON DELETE CASCADE;
+ALTER TABLE "oauth2_codes" ADD FOREIGN KEY ("client_id") REFERENCES "oauth2_clients" ("id") ON DELETE CASCADE;
+ALTER TABLE "oauth2_codes" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+ALTER TABLE "oauth2_tokens" ADD FOREIGN KEY ("client_id") REFERENCES "oauth2_clients" ("id") ON DELETE CASCADE;
+ALTER TABLE "oauth2_tokens" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+
+CREATE INDEX "oauth2_tokens_user_client_idx" ON "oauth2_tokens" ("user_id", "client_id");
+CREATE INDEX "oauth2_tokens_code_hash_idx" ON "oauth2_tokens" ("code_hash");
+
+COMMIT;
@@ -0,0 +1,28 @@
+BEGIN;
+
+-- soft deleted user can not sign in, username and email stay reserved
+ALTER TABLE "users" ADD COLUMN "deleted_at" TIMESTAMP;
+
+-- hard delete of user remove everything that belong to the user
+ALTER TABLE "oauth" DROP CONSTRAINT "oauth_user_id_fkey";
+ALTER TABLE "oauth" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+ALTER TABLE "tasks" DROP CONSTRAINT "tasks_user_id_fkey";
+ALTER TABLE "tasks" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+ALTER TABLE "images" DROP CONSTRAINT "images_task_id_fkey";
+ALTER TABLE "images" ADD FOREIGN KEY ("task_id") REFERENCES "tasks" ("id") ON DELETE CASCADE;
+ALTER TABLE "user_projects" DROP CONSTRAINT "user_projects_user_id_fkey";
+ALTER TABLE "user_projects" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+ALTER TABLE "time_entries" DROP CONSTRAINT "time_entries_user_id_fkey";
+ALTER TABLE "time_entries" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+ALTER TABLE "time_entries" DROP CONSTRAINT "time_entries_task_id_fkey";
+ALTER TABLE "time_entries" ADD FOREIGN KEY ("task_id") REFERENCES "tasks" ("id") ON DELETE CASCADE;
+ALTER TABLE "password_resets" DROP CONSTRAINT "password_resets_user_id_fkey";
+ALTER TABLE "password_resets" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+ALTER TABLE "email_verifications" DROP CONSTRAINT "email_verifications_user_id_fkey";
+ALTER TABLE "email_verifications" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+ALTER TABLE "recovery_codes" DROP CONSTRAINT "recovery_codes_user_id_fkey";
+ALTER TABLE "recovery_codes" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+ALTER TABLE "api_keys" DROP CONSTRAINT "api_keys_user_id_fkey";
+ALTER TABLE "api_keys" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP INDEX IF EXISTS "users_created_at_idx";
+
+ALTER TABLE "users" DROP COLUMN "disabled_at";
+
+COMMIT;
@@ -0,0 +1,8 @@
+BEGIN;
+
+-- disabled user can not sign in and token of the user is rejected, admin can enable again
+ALTER TABLE "users" ADD COLUMN "disabled_at" TIMESTAMP;
+
+CREATE INDEX "users_created_at_idx" ON "users" ("created_at", "id");
+
+COMMIT;
@@ -0,0 +1,12 @@
+-- Development only, never run in shared or production database: make seed-dev
+BEGIN;
+
+-- Mock key so admin can sign in and create real keys
+-- key: wymj_dev-only-apikey-please-revoke
+INSERT INTO "api_keys" ("name", "prefix", "key_hash", "user_id", "scopes")
+SELECT 'development', 'wymj_dev-onl', 'c65448b1bac54c3c85b9a54715a2e6c826676a0d3b999e15ef54b3d225369f8c', "id", '["*"]'::jsonb
+FROM "users"
+WHERE "username" = 'admin001'
+ON CONFLICT ("key_hash") DO NOTHING;
+
+COMMIT;
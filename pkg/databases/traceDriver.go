@@ -0,0 +1,262 @@
+package databases
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/ppp3ppj/wymj/pkg/wymjtrace"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceDriver wrap pgx driver so every query has span with statement and row count,
+// argument values are not recorded because they can be password or token
+type traceDriver struct {
+    driver.Driver
+}
+
+type traceConn struct {
+    driver.Conn
+}
+
+type traceStmt struct {
+    driver.Stmt
+    query string
+}
+
+type traceRows struct {
+    driver.Rows
+    span trace.Span
+    count int
+}
+
+func (d *traceDriver) Open(name string) (driver.Conn, error) {
+    conn, err := d.Driver.Open(name)
+    if err != nil {
+        return nil, err
+    }
+    return &traceConn{Conn: conn}, nil
+}
+
+// startSpan name is first keyword of statement like SELECT or INSERT
+func startSpan(ctx context.Context, query string) (context.Context, trace.Span) {
+    statement := strings.Join(strings.Fields(query), " ")
+    operation, _, _ := strings.Cut(statement, " ")
+    return wymjtrace.Start(ctx, "sql "+strings.ToUpper(operation),
+        attribute.String("db.system", "postgresql"),
+        attribute.String("db.operation", strings.ToUpper(operation)),
+        attribute.String("db.statement", statement),
+    )
+}
+
+func endSpan(span trace.Span, err error) {
+    if err != nil && err != driver.ErrSkip {
+        span.RecordError(err)
+        span.SetStatus(codes.Error, err.Error())
+    }
+    span.End()
+}
+
+func (c *traceConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+    execer, ok := c.Conn.(driver.ExecerContext)
+    if !ok {
+        return nil, driver.ErrSkip
+    }
+    ctx, span := startSpan(ctx, query)
+    result, err := execer.ExecContext(ctx, query, args)
+    if err == nil {
+        if n, rowsErr := result.RowsAffected(); rowsErr == nil {
+            span.SetAttributes(attribute.Int64("db.rows_affected", n))
+        }
+    }
+    endSpan(span, err)
+    return result, err
+}
+
+// QueryContext span is ended when rows is closed so row count is known
+func (c *traceConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+    queryer, ok := c.Conn.(driver.QueryerContext)
+    if !ok {
+        return nil, driver.ErrSkip
+    }
+    ctx, span := startSpan(ctx, query)
+    rows, err := queryer.QueryContext(ctx, query, args)
+    if err != nil {
+        endSpan(span, err)
+        return nil, err
+    }
+    return &traceRows{Rows: rows, span: span}, nil
+}
+
+func (c *traceConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+    var stmt driver.Stmt
+    var err error
+    if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+        stmt, err = preparer.PrepareContext(ctx, query)
+    } else {
+        stmt, err = c.Conn.Prepare(query)
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &traceStmt{Stmt: stmt, query: query}, nil
+}
+
+func (c *traceConn) Prepare(query string) (driver.Stmt, error) {
+    return c.PrepareContext(context.Background(), query)
+}
+
+func (c *traceConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+    if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+        return beginner.BeginTx(ctx, opts)
+    }
+    return c.Conn.Begin()
+}
+
+func (c *traceConn) Ping(ctx context.Context) error {
+    if pinger, ok := c.Conn.(driver.Pinger); ok {
+        return pinger.Ping(ctx)
+    }
+    return nil
+}
+
+func (c *traceConn) ResetSession(ctx context.Context) error {
+    if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+        return resetter.ResetSession(ctx)
+    }
+    return nil
+}
+
+func (c *traceConn) IsValid() bool {
+    if validator, ok := c.Conn.(driver.Validator); ok {
+        return validator.IsValid()
+    }
+    return true
+}
+
+// CheckNamedValue keep pgx type conversion, database/sql only ask the outer conn
+func (c *traceConn) CheckNamedValue(value *driver.NamedValue) error {
+    if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+        return checker.CheckNamedValue(value)
+    }
+    return driver.ErrSkip
+}
+
+func (s *traceStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+    ctx, span := startSpan(ctx, s.query)
+    var result driver.Result
+    var err error
+    if execer, ok := s.Stmt.(driver.StmtExecContext); ok {
+        result, err = execer.ExecContext(ctx, args)
+    } else {
+        var values []driver.Value
+        if values, err = namedToValues(args); err == nil {
+            result, err = s.Stmt.Exec(values)
+        }
+    }
+    if err == nil {
+        if n, rowsErr := result.RowsAffected(); rowsErr == nil {
+            span.SetAttributes(attribute.Int64("db.rows_affected", n))
+        }
+    }
+    endSpan(span, err)
+    return result, err
+}
+
+func (s *traceStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+    ctx, span := startSpan(ctx, s.query)
+    var rows driver.Rows
+    var err error
+    if queryer, ok := s.Stmt.(driver.StmtQueryContext); ok {
+        rows, err = queryer.QueryContext(ctx, args)
+    } else {
+        var values []driver.Value
+        if values, err = namedToValues(args); err == nil {
+            rows, err = s.Stmt.Query(values)
+        }
+    }
+    if err != nil {
+        endSpan(span, err)
+        return nil, err
+    }
+    return &traceRows{Rows: rows, span: span}, nil
+}
+
+func (s *traceStmt) CheckNamedValue(value *driver.NamedValue) error {
+    if checker, ok := s.Stmt.(driver.NamedValueChecker); ok {
+        return checker.CheckNamedValue(value)
+    }
+    return driver.ErrSkip
+}
+
+func namedToValues(args []driver.NamedValue) ([]driver.Value, error) {
+    values := make([]driver.Value, len(args))
+    for i, arg := range args {
+        if arg.Name != "" {
+            return nil, driver.ErrSkip
+        }
+        values[i] = arg.Value
+    }
+    return values, nil
+}
+
+func (r *traceRows) Next(dest []driver.Value) error {
+    err := r.Rows.Next(dest)
+    if err == nil {
+        r.count++
+    } else if err != io.EOF {
+        r.span.RecordError(err)
+        r.span.SetStatus(codes.Error, err.Error())
+    }
+    return err
+}
+
+// Close may be called more than once, span is ended only first time
+func (r *traceRows) Close() error {
+    err := r.Rows.Close()
+    if r.span != nil {
+        r.span.SetAttributes(attribute.Int("db.rows_returned", r.count))
+        endSpan(r.span, err)
+        r.span = nil
+    }
+    return err
+}
+
+func (r *traceRows) ColumnTypeDatabaseTypeName(index int) string {
+    if rows, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+        return rows.ColumnTypeDatabaseTypeName(index)
+    }
+    return ""
+}
+
+func (r *traceRows) ColumnTypeLength(index int) (int64, bool) {
+    if rows, ok := r.Rows.(driver.RowsColumnTypeLength); ok {
+        return rows.ColumnTypeLength(index)
+    }
+    return 0, false
+}
+
+func (r *traceRows) ColumnTypeNullable(index int) (bool, bool) {
+    if rows, ok := r.Rows.(driver.RowsColumnTypeNullable); ok {
+        return rows.ColumnTypeNullable(index)
+    }
+    return false, false
+}
+
+func (r *traceRows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+    if rows, ok := r.Rows.(driver.RowsColumnTypePrecisionScale); ok {
+        return rows.ColumnTypePrecisionScale(index)
+    }
+    return 0, 0, false
+}
+
+func (r *traceRows) ColumnTypeScanType(index int) reflect.Type {
+    if rows, ok := r.Rows.(driver.RowsColumnTypeScanType); ok {
+        return rows.ColumnTypeScanType(index)
+    }
+    return reflect.TypeOf(new(any)).Elem()
+}
@@ -0,0 +1,213 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/ppp3ppj/wymj/pkg/wymjtrace"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type testTracingConfig struct{}
+
+func (testTracingConfig) Exporter() string { return "memory" }
+func (testTracingConfig) ServiceName() string { return "wymj-test" }
+func (testTracingConfig) OtlpEndpoint() string { return "" }
+func (testTracingConfig) OtlpInsecure() bool { return false }
+func (testTracingConfig) OtlpHeaders() map[string]string { return nil }
+func (testTracingConfig) SampleRatio() float64 { return 1 }
+
+// testDriver stand for pgx, SELECT return 3 rows, other statement affect 2 rows and
+// statement with "missing" fail like a query on unknown table
+type testDriver struct{}
+
+type testConn struct{}
+
+type testStmt struct {
+    query string
+}
+
+type testResult struct{}
+
+type testRows struct {
+    left int
+}
+
+func (testDriver) Open(name string) (driver.Conn, error) { return testConn{}, nil }
+
+func (testConn) Prepare(query string) (driver.Stmt, error) { return &testStmt{query: query}, nil }
+func (testConn) Close() error { return nil }
+func (testConn) Begin() (driver.Tx, error) { return nil, fmt.Errorf("transaction is not supported") }
+
+func (testConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+    if err := checkQuery(query); err != nil {
+        return nil, err
+    }
+    return testResult{}, nil
+}
+
+func (testConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+    if err := checkQuery(query); err != nil {
+        return nil, err
+    }
+    return &testRows{left: 3}, nil
+}
+
+func (s *testStmt) Close() error { return nil }
+func (s *testStmt) NumInput() int { return -1 }
+func (s *testStmt) Exec(args []driver.Value) (driver.Result, error) { return testResult{}, nil }
+func (s *testStmt) Query(args []driver.Value) (driver.Rows, error) { return &testRows{left: 3}, nil }
+
+func (testResult) LastInsertId() (int64, error) { return 0, fmt.Errorf("not supported") }
+func (testResult) RowsAffected() (int64, error) { return 2, nil }
+
+func (r *testRows) Columns() []string { return []string{"id"} }
+func (r *testRows) Close() error { return nil }
+func (r *testRows) Next(dest []driver.Value) error {
+    if r.left == 0 {
+        return io.EOF
+    }
+    dest[0] = fmt.Sprintf("U%07d", r.left)
+    r.left--
+    return nil
+}
+
+func checkQuery(query string) error {
+    if query == `SELECT * FROM "missing";` {
+        return fmt.Errorf(`ERROR: relation "missing" does not exist (SQLSTATE 42P01)`)
+    }
+    return nil
+}
+
+func init() {
+    sql.Register("test-trace", &traceDriver{Driver: testDriver{}})
+    sqlx.BindDriver("test-trace", sqlx.DOLLAR)
+}
+
+func newTestDb(t *testing.T) *sqlx.DB {
+    tracer, err := wymjtrace.NewTracer(testTracingConfig{}, "test")
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { tracer.Shutdown(context.Background()) })
+    wymjtrace.ResetMemorySpans()
+
+    db, err := sqlx.Open("test-trace", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { db.Close() })
+    return db
+}
+
+func spanAttr(span tracetest.SpanStub, key string) (attribute.Value, bool) {
+    for _, attr := range span.Attributes {
+        if string(attr.Key) == key {
+            return attr.Value, true
+        }
+    }
+    return attribute.Value{}, false
+}
+
+func TestTraceDriver(t *testing.T) {
+    db := newTestDb(t)
+    ctx := context.Background()
+
+    ids := make([]string, 0)
+    if err := db.SelectContext(ctx, &ids, `
+    SELECT "id"
+    FROM "users"
+    WHERE "email" = $1;`, "ppp@wymj.dev"); err != nil {
+        t.Fatal(err)
+    }
+    if len(ids) != 3 {
+        t.Fatalf("ids = %v", ids)
+    }
+    if _, err := db.ExecContext(ctx, `UPDATE "users" SET "username" = $1 WHERE "id" = $2;`, "ppp", "U0000001"); err != nil {
+        t.Fatal(err)
+    }
+
+    spans := wymjtrace.MemorySpans()
+    if len(spans) != 2 {
+        t.Fatalf("got %d spans", len(spans))
+    }
+    tests := []struct {
+        name string
+        statement string
+        countKey string
+        count int64
+    }{
+        {"sql SELECT", `SELECT "id" FROM "users" WHERE "email" = $1;`, "db.rows_returned", 3},
+        {"sql UPDATE", `UPDATE "users" SET "username" = $1 WHERE "id" = $2;`, "db.rows_affected", 2},
+    }
+    for i, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            span := spans[i]
+            if span.Name != tt.name {
+                t.Errorf("name = %q, want %q", span.Name, tt.name)
+            }
+            if v, _ := spanAttr(span, "db.statement"); v.AsString() != tt.statement {
+                t.Errorf("db.statement = %q, want %q", v.AsString(), tt.statement)
+            }
+            if v, _ := spanAttr(span, "db.system"); v.AsString() != "postgresql" {
+                t.Errorf("db.system = %q", v.AsString())
+            }
+            if v, ok := spanAttr(span, tt.countKey); !ok || v.AsInt64() != tt.count {
+                t.Errorf("%s = %v, want %d", tt.countKey, v.Emit(), tt.count)
+            }
+            for _, attr := range span.Attributes {
+                if attr.Value.Emit() == "ppp@wymj.dev" || attr.Value.Emit() == "ppp" {
+                    t.Errorf("argument value is recorded in %s", attr.Key)
+                }
+            }
+            if span.Status.Code == codes.Error {
+                t.Errorf("status = %v", span.Status)
+            }
+        })
+    }
+}
+
+func TestTraceDriverPreparedStatement(t *testing.T) {
+    db := newTestDb(t)
+    ctx := context.Background()
+
+    stmt, err := db.PreparexContext(ctx, `DELETE FROM "oidc_states" WHERE "expired_at" < NOW();`)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer stmt.Close()
+    if _, err := stmt.ExecContext(ctx); err != nil {
+        t.Fatal(err)
+    }
+
+    spans := wymjtrace.MemorySpans()
+    if len(spans) != 1 || spans[0].Name != "sql DELETE" {
+        t.Fatalf("spans = %+v", spans)
+    }
+    if v, _ := spanAttr(spans[0], "db.rows_affected"); v.AsInt64() != 2 {
+        t.Errorf("db.rows_affected = %v", v.Emit())
+    }
+}
+
+func TestTraceDriverError(t *testing.T) {
+    db := newTestDb(t)
+
+    if _, err := db.QueryContext(context.Background(), `SELECT * FROM "missing";`); err == nil {
+        t.Fatal("error is expected")
+    }
+
+    spans := wymjtrace.MemorySpans()
+    if len(spans) != 1 {
+        t.Fatalf("got %d spans", len(spans))
+    }
+    if spans[0].Status.Code != codes.Error || len(spans[0].Events) == 0 {
+        t.Errorf("error is not recorded: status %v, events %v", spans[0].Status, spans[0].Events)
+    }
+}
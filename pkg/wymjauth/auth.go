@@ -1,12 +1,17 @@
 package wymjauth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"math"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/ppp3ppj/wymj/config"
 	"github.com/ppp3ppj/wymj/modules/users"
 )
@@ -17,9 +22,12 @@ const (
     Access TokenType = "access"
     Refresh TokenType = "refresh"
     Admin TokenType = "admin"
-    ApiKey TokenType = "apiKey"
+    Challenge TokenType = "challenge"
 )
 
+// ChallengeExpireAt is lifetime of challenge token between password and totp step, in seconds
+const ChallengeExpireAt = 300
+
 type wymjAuth struct {
     mapClaims *wymjMapClaims // is call payload
     cfg config.IJwtconfig
@@ -29,10 +37,6 @@ type wymjAdmin struct {
     *wymjAuth
 }
 
-type wymjApiKey struct {
-    *wymjAuth
-}
-
 type wymjMapClaims struct {
     Claims *users.UserClaims `json:"claims"`
     jwt.RegisteredClaims 
@@ -46,10 +50,6 @@ type IWymjAdmin interface {
     SignToken() string
 }
 
-type IWymjApiKey interface {
-    SignToken() string
-}
-
 func jwtTimeDurationCal(t int) *jwt.NumericDate {
     return jwt.NewNumericDate(time.Now().Add(time.Duration(int64(t) * int64(math.Pow10(9)))))
 }
@@ -58,30 +58,53 @@ func jwtTimeRepeatAdapter(t int64) *jwt.NumericDate {
     return jwt.NewNumericDate(time.Unix(t, 0))
 }
 
-func (w *wymjAuth) SignToken() string {
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, w.mapClaims)
-    ss, _ := token.SignedString(w.cfg.SecretKey())
+// sign use active asymmetric key with kid header when configured, otherwise HS256 with secret
+func sign(cfg config.IJwtconfig, claims *wymjMapClaims, secret []byte) string {
+    if ks, err := loadKeySet(cfg); err == nil && ks.active != nil {
+        token := jwt.NewWithClaims(ks.active.method, claims)
+        token.Header["kid"] = ks.active.kid
+        ss, _ := token.SignedString(ks.active.private)
+        return ss
+    }
+    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+    ss, _ := token.SignedString(secret)
     return ss
 }
 
-func (a *wymjAdmin) SignToken() string {
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, a.mapClaims)
-    ss, _ := token.SignedString(a.cfg.AdminKey())
-    return ss
+func (w *wymjAuth) SignToken() string {
+    return sign(w.cfg, w.mapClaims, w.cfg.SecretKey())
 }
 
-func (a *wymjApiKey) SignToken() string {
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, a.mapClaims)
-    ss, _ := token.SignedString(a.cfg.ApiKey())
-    return ss
+func (a *wymjAdmin) SignToken() string {
+    return sign(a.cfg, a.mapClaims, a.cfg.AdminKey())
 }
 
-func ParseToken(cfg config.IJwtconfig, tokenString string) (*wymjMapClaims, error) {
+// parse pick verification key by kid, token without kid is HS256 token signed with secret.
+// One asymmetric key sign every token type so subject must be one of subjects
+func parse(cfg config.IJwtconfig, tokenString string, secret []byte, subjects ...string) (*wymjMapClaims, error) {
     token, err := jwt.ParseWithClaims(tokenString, &wymjMapClaims{}, func(t *jwt.Token) (interface{}, error) {
+        ks, err := loadKeySet(cfg)
+        if err != nil {
+            return nil, err
+        }
+        if kid, ok := t.Header["kid"].(string); ok {
+            key, ok := ks.keys[kid]
+            if !ok {
+                return nil, fmt.Errorf("signing key is unknown")
+            }
+            if t.Method.Alg() != key.method.Alg() {
+                return nil, fmt.Errorf("signing method is invalid")
+            }
+            return key.private.Public(), nil
+        }
+        // secret is only for setup without key files, otherwise leaked secret could still forge token
+        if ks.active != nil {
+            return nil, fmt.Errorf("token kid is required")
+        }
         if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
             return nil, fmt.Errorf("signing method is invalid")
         }
-        return cfg.SecretKey(), nil
+        return secret, nil
     })
 
     if err != nil {
@@ -94,64 +117,79 @@ func ParseToken(cfg config.IJwtconfig, tokenString string) (*wymjMapClaims, erro
         }
     }
 
-    if claims, ok := token.Claims.(*wymjMapClaims); ok {
-        return claims, nil
-    } else {
+    claims, ok := token.Claims.(*wymjMapClaims)
+    if !ok {
         return nil, fmt.Errorf("claims type is invalid")
     }
-}
-
-func ParseAdminToken(cfg config.IJwtconfig, tokenString string) (*wymjMapClaims, error) {
-    token, err := jwt.ParseWithClaims(tokenString, &wymjMapClaims{}, func(t *jwt.Token) (interface{}, error) {
-        if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-            return nil, fmt.Errorf("signing method is invalid")
-        }
-        return cfg.AdminKey(), nil
-    })
-
-    if err != nil {
-        if errors.Is(err, jwt.ErrTokenMalformed) {
-            return nil, fmt.Errorf("token malformed is invalid")
-        } else if errors.Is(err, jwt.ErrTokenExpired) {
-            return nil, fmt.Errorf("token had expired")
-        } else {
-            return nil, fmt.Errorf("parse token failed: %v", err)
+    for _, subject := range subjects {
+        if claims.Subject == subject {
+            return claims, nil
         }
     }
+    return nil, fmt.Errorf("token subject is invalid")
+}
 
-    if claims, ok := token.Claims.(*wymjMapClaims); ok {
-        return claims, nil
-    } else {
-        return nil, fmt.Errorf("claims type is invalid")
-    }
+// ParseAccessToken accept only access token, refresh or challenge token can not call api
+func ParseAccessToken(cfg config.IJwtconfig, tokenString string) (*wymjMapClaims, error) {
+    return parse(cfg, tokenString, cfg.SecretKey(), "access-token")
 }
 
+// ParseRefreshToken accept only refresh token, so access token can not be exchanged for new one
+func ParseRefreshToken(cfg config.IJwtconfig, tokenString string) (*wymjMapClaims, error) {
+    return parse(cfg, tokenString, cfg.SecretKey(), "refresh-token")
+}
 
-func ParseApiKey(cfg config.IJwtconfig, tokenString string) (*wymjMapClaims, error) {
-    token, err := jwt.ParseWithClaims(tokenString, &wymjMapClaims{}, func(t *jwt.Token) (interface{}, error) {
-        if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-            return nil, fmt.Errorf("signing method is invalid")
-        }
-        return cfg.ApiKey(), nil
-    })
+func ParseAdminToken(cfg config.IJwtconfig, tokenString string) (*wymjMapClaims, error) {
+    return parse(cfg, tokenString, cfg.AdminKey(), "admin-token")
+}
 
-    if err != nil {
-        if errors.Is(err, jwt.ErrTokenMalformed) {
-            return nil, fmt.Errorf("token malformed is invalid")
-        } else if errors.Is(err, jwt.ErrTokenExpired) {
-            return nil, fmt.Errorf("token had expired")
-        } else {
-            return nil, fmt.Errorf("parse token failed: %v", err)
-        }
+// ParseClientToken accept only access token issued to third party app by oauth2 module
+func ParseClientToken(cfg config.IJwtconfig, tokenString string) (*wymjMapClaims, error) {
+    return parse(cfg, tokenString, cfg.SecretKey(), "client-token")
+}
+
+// ClientToken sign oauth2 access token, jti is id of the token row so it can be revoked
+// and audience is the client. Scope of claims is space separated granted scopes
+func ClientToken(cfg config.IJwtconfig, claims *users.UserClaims, jti string) string {
+    obj := &wymjAuth{
+        cfg: cfg,
+        mapClaims: &wymjMapClaims{
+            Claims: claims,
+            RegisteredClaims: jwt.RegisteredClaims{
+                Issuer: "wymj-api",
+                Subject: "client-token",
+                Audience: []string{claims.ClientId},
+                ExpiresAt: jwtTimeDurationCal(cfg.AccessExpireAt()),
+                ID: jti,
+                NotBefore: jwt.NewNumericDate(time.Now()),
+                IssuedAt: jwt.NewNumericDate(time.Now()),
+            },
+        },
     }
+    return obj.SignToken()
+}
 
-    if claims, ok := token.Claims.(*wymjMapClaims); ok {
-        return claims, nil
-    } else {
-        return nil, fmt.Errorf("claims type is invalid")
+// RandomToken return url safe opaque token of n random bytes
+func RandomToken(n int) (string, error) {
+    b := make([]byte, n)
+    if _, err := rand.Read(b); err != nil {
+        return "", fmt.Errorf("generate token failed: %v", err)
     }
+    return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
+// HashToken is used to store refresh token history without the token itself
+func HashToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
+
+// ParseChallengeToken accept only challenge token, access or refresh token can not skip totp step
+func ParseChallengeToken(cfg config.IJwtconfig, tokenString string) (*wymjMapClaims, error) {
+    return parse(cfg, tokenString, cfg.SecretKey(), "challenge-token")
+}
+
+// RepeatToken sign a new refresh token that keep expiry of the previous one
 func RepeatToken(cfg config.IJwtconfig, claims *users.UserClaims, exp int64) string {
     obj := &wymjAuth{
         cfg: cfg,
@@ -162,6 +200,7 @@ func RepeatToken(cfg config.IJwtconfig, claims *users.UserClaims, exp int64) str
                 Subject: "refresh-token",
                 Audience: []string{"customer", "admin"},
                 ExpiresAt: jwtTimeRepeatAdapter(exp),
+                ID: uuid.NewString(),
                 NotBefore: jwt.NewNumericDate(time.Now()),
                 IssuedAt: jwt.NewNumericDate(time.Now()),
             },
@@ -179,8 +218,8 @@ func NewWymjAuth(tokenType TokenType, cfg config.IJwtconfig, claims *users.UserC
             return newRefreshToken(cfg, claims), nil
         case Admin:
             return newAdminToken(cfg), nil
-        case ApiKey:
-            return newApiKey(cfg), nil
+        case Challenge:
+            return newChallengeToken(cfg, claims), nil
         default:
             return nil, fmt.Errorf("unknown token type")
     }
@@ -196,6 +235,7 @@ func newAccessToken(cfg config.IJwtconfig, claims *users.UserClaims) IWymjAuth {
                 Subject: "access-token",
                 Audience: []string{"customer", "admin"},
                 ExpiresAt: jwtTimeDurationCal(cfg.AccessExpireAt()),
+                ID: uuid.NewString(),
                 NotBefore: jwt.NewNumericDate(time.Now()),
                 IssuedAt: jwt.NewNumericDate(time.Now()),
             },
@@ -213,6 +253,7 @@ func newRefreshToken(cfg config.IJwtconfig, claims *users.UserClaims) IWymjAuth
                 Subject: "refresh-token",
                 Audience: []string{"customer", "admin"},
                 ExpiresAt: jwtTimeDurationCal(cfg.RefreshExpireAt()),
+                ID: uuid.NewString(),
                 NotBefore: jwt.NewNumericDate(time.Now()),
                 IssuedAt: jwt.NewNumericDate(time.Now()),
             },
@@ -220,38 +261,36 @@ func newRefreshToken(cfg config.IJwtconfig, claims *users.UserClaims) IWymjAuth
     }
 }
 
-func newAdminToken(cfg config.IJwtconfig) IWymjAuth {
-    return &wymjAdmin{
-        wymjAuth: &wymjAuth{
-            cfg: cfg,
-            mapClaims: &wymjMapClaims{
-            Claims: nil,
+// challenge token prove password step of sign in, it is exchanged with totp code for passport
+func newChallengeToken(cfg config.IJwtconfig, claims *users.UserClaims) IWymjAuth {
+    return &wymjAuth{
+        cfg: cfg,
+        mapClaims: &wymjMapClaims{
+            Claims: claims,
             RegisteredClaims: jwt.RegisteredClaims{
                 Issuer: "wymj-api",
-                Subject: "admin-token",
-                Audience: []string{"admin"},
-                ExpiresAt: jwtTimeDurationCal(300), // 5 minutes
+                Subject: "challenge-token",
+                Audience: []string{"customer", "admin"},
+                ExpiresAt: jwtTimeDurationCal(ChallengeExpireAt),
                 NotBefore: jwt.NewNumericDate(time.Now()),
                 IssuedAt: jwt.NewNumericDate(time.Now()),
+                ID: uuid.NewString(),
             },
         },
-
-        },
     }
 }
 
-// apikey = apitoken
-func newApiKey(cfg config.IJwtconfig) IWymjAuth {
-    return &wymjApiKey{
+func newAdminToken(cfg config.IJwtconfig) IWymjAuth {
+    return &wymjAdmin{
         wymjAuth: &wymjAuth{
             cfg: cfg,
             mapClaims: &wymjMapClaims{
             Claims: nil,
             RegisteredClaims: jwt.RegisteredClaims{
                 Issuer: "wymj-api",
-                Subject: "api-key",
-                Audience: []string{"admin", "customer"},
-                ExpiresAt: jwt.NewNumericDate(time.Now().AddDate(2, 0, 0)), // 2 years
+                Subject: "admin-token",
+                Audience: []string{"admin"},
+                ExpiresAt: jwtTimeDurationCal(300), // 5 minutes
                 NotBefore: jwt.NewNumericDate(time.Now()),
                 IssuedAt: jwt.NewNumericDate(time.Now()),
             },
@@ -260,4 +299,3 @@ func newApiKey(cfg config.IJwtconfig) IWymjAuth {
         },
     }
 }
-
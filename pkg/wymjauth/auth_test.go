@@ -0,0 +1,149 @@
+package wymjauth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/modules/users"
+)
+
+type testJwtConfig struct {
+    keyFiles map[string]string
+}
+
+func (c *testJwtConfig) SecretKey() []byte { return []byte("secret") }
+func (c *testJwtConfig) AdminKey() []byte { return []byte("admin") }
+func (c *testJwtConfig) AccessExpireAt() int { return 60 }
+func (c *testJwtConfig) RefreshExpireAt() int { return 60 }
+func (c *testJwtConfig) KeyFiles() map[string]string { return c.keyFiles }
+func (c *testJwtConfig) ActiveKid() string { return "k1" }
+func (c *testJwtConfig) SetJwtAccessExpireAt(t int) {}
+func (c *testJwtConfig) SetJwtExpireAt(t int) {}
+
+// key set is loaded once per process, so every case run against the same Ed25519 key
+func TestParseWithKeySet(t *testing.T) {
+    _, private, err := ed25519.GenerateKey(rand.Reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+    der, err := x509.MarshalPKCS8PrivateKey(private)
+    if err != nil {
+        t.Fatal(err)
+    }
+    path := filepath.Join(t.TempDir(), "k1.pem")
+    if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+        t.Fatal(err)
+    }
+    cfg := &testJwtConfig{keyFiles: map[string]string{"k1": path}}
+    if err := LoadKeySet(cfg); err != nil {
+        t.Fatal(err)
+    }
+
+    claims := func() *wymjMapClaims {
+        return &wymjMapClaims{
+            Claims: &users.UserClaims{Id: "U000001", RoleId: 1},
+            RegisteredClaims: jwt.RegisteredClaims{
+                Subject: "access-token",
+                ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+            },
+        }
+    }
+    hs256 := func(kid string) string {
+        token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims())
+        if kid != "" {
+            token.Header["kid"] = kid
+        }
+        ss, _ := token.SignedString(cfg.SecretKey())
+        return ss
+    }
+    unknownKid := func() string {
+        _, other, _ := ed25519.GenerateKey(rand.Reader)
+        token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims())
+        token.Header["kid"] = "k2"
+        ss, _ := token.SignedString(other)
+        return ss
+    }
+
+    tests := []struct {
+        name string
+        token string
+        wantErr string
+    }{
+        {"token signed by active key", sign(cfg, claims(), cfg.SecretKey()), ""},
+        {"hs256 token without kid", hs256(""), "token kid is required"},
+        {"hs256 token with kid of asymmetric key", hs256("k1"), "signing method is invalid"},
+        {"unknown kid", unknownKid(), "signing key is unknown"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            result, err := ParseAccessToken(cfg, tt.token)
+            if tt.wantErr == "" {
+                if err != nil {
+                    t.Fatalf("parse: %v", err)
+                }
+                if result.Claims.Id != "U000001" {
+                    t.Errorf("claims = %+v", result.Claims)
+                }
+                return
+            }
+            if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                t.Errorf("error = %v, want %q", err, tt.wantErr)
+            }
+        })
+    }
+}
+
+func TestParseSubject(t *testing.T) {
+    cfg := &testJwtConfig{}
+    token := func(subject string) string {
+        return sign(cfg, &wymjMapClaims{
+            Claims: &users.UserClaims{Id: "U000001", RoleId: 1},
+            RegisteredClaims: jwt.RegisteredClaims{
+                Subject: subject,
+                ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+            },
+        }, cfg.SecretKey())
+    }
+
+    tests := []struct {
+        name string
+        parse func(cfg config.IJwtconfig, tokenString string) (*wymjMapClaims, error)
+        subject string
+        wantErr bool
+    }{
+        {"access token for api", ParseAccessToken, "access-token", false},
+        {"refresh token for api", ParseAccessToken, "refresh-token", true},
+        {"challenge token for api", ParseAccessToken, "challenge-token", true},
+        {"refresh token for refresh", ParseRefreshToken, "refresh-token", false},
+        {"access token for refresh", ParseRefreshToken, "access-token", true},
+        {"challenge token for refresh", ParseRefreshToken, "challenge-token", true},
+        {"challenge token for totp step", ParseChallengeToken, "challenge-token", false},
+        {"access token for totp step", ParseChallengeToken, "access-token", true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            result, err := tt.parse(cfg, token(tt.subject))
+            if tt.wantErr {
+                if err == nil || err.Error() != "token subject is invalid" {
+                    t.Errorf("error = %v, want token subject is invalid", err)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("parse: %v", err)
+            }
+            if result.Claims.Id != "U000001" {
+                t.Errorf("claims = %+v", result.Claims)
+            }
+        })
+    }
+}
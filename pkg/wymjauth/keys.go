@@ -0,0 +1,179 @@
+package wymjauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ppp3ppj/wymj/config"
+)
+
+// signingKey algorithm follow key type: RSA is RS256, P-256 is ES256 and Ed25519 is EdDSA
+type signingKey struct {
+    kid string
+    method jwt.SigningMethod
+    private crypto.Signer
+}
+
+type keySet struct {
+    active *signingKey
+    keys map[string]*signingKey
+}
+
+type Jwk struct {
+    Kid string `json:"kid"`
+    Kty string `json:"kty"`
+    Alg string `json:"alg"`
+    Use string `json:"use"`
+    N string `json:"n,omitempty"`
+    E string `json:"e,omitempty"`
+    Crv string `json:"crv,omitempty"`
+    X string `json:"x,omitempty"`
+    Y string `json:"y,omitempty"`
+}
+
+type Jwks struct {
+    Keys []*Jwk `json:"keys"`
+}
+
+var (
+    keysOnce sync.Once
+    keys *keySet
+    keysErr error
+)
+
+// LoadKeySet read key files once, call it at start up to fail fast on bad key
+func LoadKeySet(cfg config.IJwtconfig) error {
+    _, err := loadKeySet(cfg)
+    return err
+}
+
+func loadKeySet(cfg config.IJwtconfig) (*keySet, error) {
+    keysOnce.Do(func() {
+        keys, keysErr = newKeySet(cfg)
+    })
+    return keys, keysErr
+}
+
+func newKeySet(cfg config.IJwtconfig) (*keySet, error) {
+    ks := &keySet{
+        keys: make(map[string]*signingKey),
+    }
+    for kid, path := range cfg.KeyFiles() {
+        key, err := readSigningKey(kid, path)
+        if err != nil {
+            return nil, err
+        }
+        ks.keys[kid] = key
+    }
+    if len(ks.keys) == 0 {
+        return ks, nil
+    }
+
+    active, ok := ks.keys[cfg.ActiveKid()]
+    if !ok {
+        return nil, fmt.Errorf("active kid %q is not in key files", cfg.ActiveKid())
+    }
+    ks.active = active
+    return ks, nil
+}
+
+func readSigningKey(kid, path string) (*signingKey, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("read key %s failed: %v", kid, err)
+    }
+    block, _ := pem.Decode(data)
+    if block == nil {
+        return nil, fmt.Errorf("key %s is not pem", kid)
+    }
+
+    var private any
+    switch block.Type {
+        case "RSA PRIVATE KEY":
+            private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+        case "EC PRIVATE KEY":
+            private, err = x509.ParseECPrivateKey(block.Bytes)
+        default:
+            private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("parse key %s failed: %v", kid, err)
+    }
+
+    switch k := private.(type) {
+        case *rsa.PrivateKey:
+            if k.N.BitLen() < 2048 {
+                return nil, fmt.Errorf("key %s: rsa key must be at least 2048 bits", kid)
+            }
+            return &signingKey{kid: kid, method: jwt.SigningMethodRS256, private: k}, nil
+        case *ecdsa.PrivateKey:
+            if k.Curve != elliptic.P256() {
+                return nil, fmt.Errorf("key %s: only P-256 curve is supported", kid)
+            }
+            return &signingKey{kid: kid, method: jwt.SigningMethodES256, private: k}, nil
+        case ed25519.PrivateKey:
+            return &signingKey{kid: kid, method: jwt.SigningMethodEdDSA, private: k}, nil
+        default:
+            return nil, fmt.Errorf("key %s: key type is not supported", kid)
+    }
+}
+
+// PublicJwks return public part of every configured key, empty when HS256 is used
+func PublicJwks(cfg config.IJwtconfig) (*Jwks, error) {
+    ks, err := loadKeySet(cfg)
+    if err != nil {
+        return nil, err
+    }
+
+    kids := make([]string, 0, len(ks.keys))
+    for kid := range ks.keys {
+        kids = append(kids, kid)
+    }
+    sort.Strings(kids)
+
+    jwks := &Jwks{
+        Keys: make([]*Jwk, 0, len(kids)),
+    }
+    b64 := base64.RawURLEncoding.EncodeToString
+    for _, kid := range kids {
+        key := ks.keys[kid]
+        jwk := &Jwk{
+            Kid: kid,
+            Alg: key.method.Alg(),
+            Use: "sig",
+        }
+        switch pub := key.private.Public().(type) {
+            case *rsa.PublicKey:
+                jwk.Kty = "RSA"
+                jwk.N = b64(pub.N.Bytes())
+                jwk.E = b64(big.NewInt(int64(pub.E)).Bytes())
+            case *ecdsa.PublicKey:
+                // coordinates are fixed 32 bytes for P-256
+                x, y := make([]byte, 32), make([]byte, 32)
+                pub.X.FillBytes(x)
+                pub.Y.FillBytes(y)
+                jwk.Kty = "EC"
+                jwk.Crv = "P-256"
+                jwk.X = b64(x)
+                jwk.Y = b64(y)
+            case ed25519.PublicKey:
+                jwk.Kty = "OKP"
+                jwk.Crv = "Ed25519"
+                jwk.X = b64(pub)
+        }
+        jwks.Keys = append(jwks.Keys, jwk)
+    }
+    return jwks, nil
+}
@@ -0,0 +1,50 @@
+package wymjexport
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type csvExport struct {
+    w *csv.Writer
+}
+
+func newCsvExport(w io.Writer) IWymjExport {
+    return &csvExport{
+        w: csv.NewWriter(w),
+    }
+}
+
+// csvEscape prevent formula injection when file is opened by spreadsheet program
+func csvEscape(s string) string {
+    if s != "" && strings.ContainsAny(s[:1], "=+-@\t\r") {
+        return "'" + s
+    }
+    return s
+}
+
+func (e *csvExport) WriteHeader(columns []string) error {
+    return e.w.Write(columns)
+}
+
+func (e *csvExport) WriteRow(values []any) error {
+    record := make([]string, len(values))
+    for i, v := range values {
+        switch v := v.(type) {
+            case nil:
+                record[i] = ""
+            case string:
+                record[i] = csvEscape(v)
+            default:
+                record[i] = fmt.Sprint(v)
+        }
+    }
+    return e.w.Write(record)
+}
+
+func (e *csvExport) Close() error {
+    e.w.Flush()
+    return e.w.Error()
+}
@@ -0,0 +1,47 @@
+package wymjexport
+
+import (
+	"fmt"
+	"io"
+)
+
+type Format string
+
+const (
+    Csv Format = "csv"
+    Xlsx Format = "xlsx"
+    Ics Format = "ics"
+)
+
+// ContentType of each format for response header
+func (f Format) ContentType() string {
+    switch f {
+        case Csv:
+            return "text/csv; charset=utf-8"
+        case Xlsx:
+            return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+        case Ics:
+            return "text/calendar; charset=utf-8"
+        default:
+            return "application/octet-stream"
+    }
+}
+
+// IWymjExport write table row by row, nothing is kept in memory
+type IWymjExport interface {
+    WriteHeader(columns []string) error
+    // value can be string, int, int64, float64 or nil
+    WriteRow(values []any) error
+    Close() error
+}
+
+func NewWymjExport(format Format, w io.Writer, sheetName string) (IWymjExport, error) {
+    switch format {
+        case Csv:
+            return newCsvExport(w), nil
+        case Xlsx:
+            return newXlsxExport(w, sheetName)
+        default:
+            return nil, fmt.Errorf("unknown export format: %v", format)
+    }
+}
@@ -0,0 +1,90 @@
+package wymjexport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type CalendarEvent struct {
+    Uid string
+    Summary string
+    Description string
+    Start time.Time
+    End time.Time
+}
+
+// IWymjCalendar write iCalendar (RFC 5545) feed, one VEVENT per call
+type IWymjCalendar interface {
+    WriteEvent(event *CalendarEvent) error
+    Close() error
+}
+
+type calendar struct {
+    w *bufio.Writer
+    stamp string
+}
+
+func NewWymjCalendar(w io.Writer, name string) IWymjCalendar {
+    c := &calendar{
+        w: bufio.NewWriter(w),
+        stamp: time.Now().UTC().Format("20060102T150405Z"),
+    }
+    c.line("BEGIN:VCALENDAR")
+    c.line("VERSION:2.0")
+    c.line("PRODID:-//wymj//wymj-api//EN")
+    c.line("CALSCALE:GREGORIAN")
+    c.line("X-WR-CALNAME:" + icsEscape(name))
+    return c
+}
+
+// icsEscape escape text value
+func icsEscape(s string) string {
+    return strings.NewReplacer(
+        `\`, `\\`,
+        ";", `\;`,
+        ",", `\,`,
+        "\r\n", `\n`,
+        "\n", `\n`,
+    ).Replace(s)
+}
+
+// line fold content line longer than 75 octets and end with CRLF
+func (c *calendar) line(s string) error {
+    limit := 75
+    for len(s) > limit {
+        cut := limit
+        // do not split utf-8 character
+        for cut > 0 && s[cut]&0xC0 == 0x80 {
+            cut--
+        }
+        c.w.WriteString(s[:cut] + "\r\n ")
+        s = s[cut:]
+        // next line start with a space
+        limit = 74
+    }
+    _, err := c.w.WriteString(s + "\r\n")
+    return err
+}
+
+func (c *calendar) WriteEvent(event *CalendarEvent) error {
+    c.line("BEGIN:VEVENT")
+    c.line("UID:" + icsEscape(event.Uid))
+    c.line("DTSTAMP:" + c.stamp)
+    c.line("DTSTART:" + event.Start.UTC().Format("20060102T150405Z"))
+    c.line("DTEND:" + event.End.UTC().Format("20060102T150405Z"))
+    c.line("SUMMARY:" + icsEscape(event.Summary))
+    if event.Description != "" {
+        c.line("DESCRIPTION:" + icsEscape(event.Description))
+    }
+    return c.line("END:VEVENT")
+}
+
+func (c *calendar) Close() error {
+    if err := c.line("END:VCALENDAR"); err != nil {
+        return fmt.Errorf("write calendar failed: %v", err)
+    }
+    return c.w.Flush()
+}
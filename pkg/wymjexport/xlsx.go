@@ -0,0 +1,149 @@
+package wymjexport
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// xlsxExport write the minimum parts of an Office Open XML workbook with one sheet.
+// Zip entries are streamed with data descriptor, so output does not need to be seekable.
+type xlsxExport struct {
+    zw *zip.Writer
+    sheet *bufio.Writer
+    row int
+}
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`
+
+const xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+const xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`
+
+// xlsxSheetName cut name to 31 characters, not bytes, so thai or emoji name stay valid utf-8.
+// Sheet name can not contain []:*?/\
+func xlsxSheetName(name string) string {
+    name = strings.Map(func(r rune) rune {
+        if strings.ContainsRune(`[]:*?/\`, r) {
+            return '_'
+        }
+        return r
+    }, name)
+    if runes := []rune(name); len(runes) > 31 {
+        name = string(runes[:31])
+    }
+    if name == "" {
+        name = "Sheet1"
+    }
+    return name
+}
+
+func newXlsxExport(w io.Writer, sheetName string) (IWymjExport, error) {
+    zw := zip.NewWriter(w)
+
+    sheetName = xlsxSheetName(sheetName)
+
+    parts := []struct {
+        name string
+        body string
+    }{
+        {"[Content_Types].xml", xlsxContentTypes},
+        {"_rels/.rels", xlsxRels},
+        {"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, xmlEscape(sheetName))},
+        {"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+    }
+    for _, part := range parts {
+        f, err := zw.Create(part.name)
+        if err != nil {
+            return nil, fmt.Errorf("create xlsx part failed: %v", err)
+        }
+        if _, err := io.WriteString(f, part.body); err != nil {
+            return nil, fmt.Errorf("write xlsx part failed: %v", err)
+        }
+    }
+
+    // sheet must be the last entry, it stays open until Close
+    f, err := zw.Create("xl/worksheets/sheet1.xml")
+    if err != nil {
+        return nil, fmt.Errorf("create xlsx sheet failed: %v", err)
+    }
+    sheet := bufio.NewWriter(f)
+    sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+    return &xlsxExport{
+        zw: zw,
+        sheet: sheet,
+    }, nil
+}
+
+func xmlEscape(s string) string {
+    var b strings.Builder
+    xml.EscapeText(&b, []byte(s))
+    return b.String()
+}
+
+// xlsxColumn convert 0 -> A, 25 -> Z, 26 -> AA
+func xlsxColumn(i int) string {
+    name := ""
+    for i >= 0 {
+        name = string(rune('A'+i%26)) + name
+        i = i/26 - 1
+    }
+    return name
+}
+
+func (e *xlsxExport) WriteHeader(columns []string) error {
+    values := make([]any, len(columns))
+    for i, col := range columns {
+        values[i] = col
+    }
+    return e.WriteRow(values)
+}
+
+func (e *xlsxExport) WriteRow(values []any) error {
+    e.row++
+    fmt.Fprintf(e.sheet, `<row r="%d">`, e.row)
+    for i, v := range values {
+        ref := fmt.Sprintf("%s%d", xlsxColumn(i), e.row)
+        switch v := v.(type) {
+            case nil:
+            case int, int64, float64:
+                fmt.Fprintf(e.sheet, `<c r="%s"><v>%v</v></c>`, ref, v)
+            default:
+                fmt.Fprintf(e.sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, xmlEscape(fmt.Sprint(v)))
+        }
+    }
+    _, err := e.sheet.WriteString(`</row>`)
+    return err
+}
+
+func (e *xlsxExport) Close() error {
+    if _, err := e.sheet.WriteString(`</sheetData></worksheet>`); err != nil {
+        return err
+    }
+    if err := e.sheet.Flush(); err != nil {
+        return err
+    }
+    return e.zw.Close()
+}
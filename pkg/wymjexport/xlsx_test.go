@@ -0,0 +1,33 @@
+package wymjexport
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestXlsxSheetName(t *testing.T) {
+    tests := []struct {
+        name string
+        sheetName string
+        want string
+    }{
+        {"short name", "Report", "Report"},
+        {"empty name", "", "Sheet1"},
+        {"invalid character", "2024/04 [draft]", "2024_04 _draft_"},
+        {"long ascii name", strings.Repeat("a", 40), strings.Repeat("a", 31)},
+        {"long thai name", strings.Repeat("รายงาน", 6), strings.Repeat("รายงาน", 5) + "ร"},
+        {"long emoji name", strings.Repeat("⏱️", 20), strings.Repeat("⏱️", 15) + "⏱"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := xlsxSheetName(tt.sheetName)
+            if got != tt.want {
+                t.Errorf("sheet name = %q, want %q", got, tt.want)
+            }
+            if !utf8.ValidString(got) || utf8.RuneCountInString(got) > 31 {
+                t.Errorf("sheet name %q is invalid", got)
+            }
+        })
+    }
+}
@@ -0,0 +1,332 @@
+package wymjlogger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ppp3ppj/wymj/config"
+	"github.com/ppp3ppj/wymj/pkg/wymjtrace"
+)
+
+// Sink receive one formatted log line, Write is called from the writer goroutine only
+type Sink interface {
+    Write(level slog.Level, p []byte) error
+    Close() error
+}
+
+type ILogger interface {
+    Logger() *slog.Logger
+    SetDefault()
+    Close() error
+}
+
+// entry with flushed is not a line, it is closed when every line before it is written
+type entry struct {
+    level slog.Level
+    data []byte
+    flushed chan struct{}
+}
+
+// asyncWriter hand lines to sinks in background, request never wait for disk or network
+type asyncWriter struct {
+    entries chan *entry
+    sinks []Sink
+    dropped atomic.Int64
+    done chan struct{}
+    closeOnce sync.Once
+}
+
+type wymjSlog struct {
+    logger *slog.Logger
+    writer *asyncWriter
+    redactor *Redactor
+}
+
+// NewWymjLogger build logger from LOG_* config, error is only returned at start up
+// when a sink can not be created
+func NewWymjLogger(cfg config.ILogconfig) (ILogger, error) {
+    level, err := ParseLevel(cfg.Level())
+    if err != nil {
+        return nil, err
+    }
+    redactor, err := NewRedactor(cfg.RedactFields(), cfg.RedactHeaders(), cfg.RedactRoutes())
+    if err != nil {
+        return nil, err
+    }
+
+    sinks := make([]Sink, 0)
+    for _, name := range cfg.Sinks() {
+        var sink Sink
+        switch name {
+            case "stdout":
+                sink = StdoutSink()
+            case "file":
+                sink, err = FileSink(cfg.FileDir(), int64(cfg.FileMaxSize())*1024*1024, time.Duration(cfg.FileMaxAge())*24*time.Hour, cfg.FileCompress())
+            case "syslog":
+                sink, err = SyslogSink(cfg.SyslogAddr(), cfg.SyslogTag())
+            default:
+                err = fmt.Errorf("log sink %q is not supported", name)
+        }
+        if err != nil {
+            for _, s := range sinks {
+                s.Close()
+            }
+            return nil, err
+        }
+        sinks = append(sinks, sink)
+    }
+
+    writer := newAsyncWriter(sinks, cfg.BufferSize())
+    return &wymjSlog{
+        logger: slog.New(newHandler(writer, cfg.Format(), level, redactor)),
+        writer: writer,
+        redactor: redactor,
+    }, nil
+}
+
+func ParseLevel(level string) (slog.Level, error) {
+    switch strings.ToLower(level) {
+        case "debug":
+            return slog.LevelDebug, nil
+        case "", "info":
+            return slog.LevelInfo, nil
+        case "warn":
+            return slog.LevelWarn, nil
+        case "error":
+            return slog.LevelError, nil
+        default:
+            return 0, fmt.Errorf("log level %q is not supported", level)
+    }
+}
+
+func (l *wymjSlog) Logger() *slog.Logger { return l.logger }
+
+// SetDefault make logger and its redactor default of slog and log package
+func (l *wymjSlog) SetDefault() {
+    SetRedactor(l.redactor)
+    slog.SetDefault(l.logger)
+    defaultWriter.Store(l.writer)
+    log.SetFlags(0)
+    log.SetOutput(&stdWriter{
+        logger: l.logger,
+    })
+}
+
+var defaultWriter atomic.Pointer[asyncWriter]
+
+// Fatalf log error, wait shortly for sinks and exit. Use it instead of log.Fatalf after
+// SetDefault, line of log package is written in background and os.Exit does not wait for it
+func Fatalf(format string, args ...any) {
+    slog.Error(fmt.Sprintf(format, args...))
+    if w := defaultWriter.Load(); w != nil {
+        w.flush(5 * time.Second)
+    }
+    os.Exit(1)
+}
+
+type stdWriter struct {
+    logger *slog.Logger
+}
+
+func (w *stdWriter) Write(p []byte) (int, error) {
+    w.logger.Info(strings.TrimRight(string(p), "\n"))
+    return len(p), nil
+}
+
+// Close flush buffered lines and close every sink, logging after Close is dropped
+func (l *wymjSlog) Close() error {
+    return l.writer.Close()
+}
+
+func newAsyncWriter(sinks []Sink, bufferSize int) *asyncWriter {
+    if bufferSize < 1 {
+        bufferSize = 1024
+    }
+    w := &asyncWriter{
+        entries: make(chan *entry, bufferSize),
+        sinks: sinks,
+        done: make(chan struct{}),
+    }
+    go w.run()
+    return w
+}
+
+// write never block, line is dropped when buffer is full or writer is closed
+func (w *asyncWriter) write(level slog.Level, data []byte) {
+    defer func() {
+        // send on closed channel
+        if recover() != nil {
+            w.dropped.Add(1)
+        }
+    }()
+    select {
+        case w.entries <- &entry{level: level, data: data}:
+        default:
+            w.dropped.Add(1)
+    }
+}
+
+// flush wait until lines before it are written or timeout
+func (w *asyncWriter) flush(timeout time.Duration) {
+    defer func() {
+        recover()
+    }()
+    flushed := make(chan struct{})
+    timer := time.NewTimer(timeout)
+    defer timer.Stop()
+
+    select {
+        case w.entries <- &entry{flushed: flushed}:
+        case <-timer.C:
+            return
+    }
+    select {
+        case <-flushed:
+        case <-timer.C:
+    }
+}
+
+func (w *asyncWriter) run() {
+    defer close(w.done)
+    ticker := time.NewTicker(10 * time.Second)
+    defer ticker.Stop()
+
+    for {
+        select {
+            case e, ok := <-w.entries:
+                if !ok {
+                    w.reportDropped()
+                    return
+                }
+                if e.flushed != nil {
+                    close(e.flushed)
+                    continue
+                }
+                for _, sink := range w.sinks {
+                    w.writeSink(sink, e)
+                }
+            case <-ticker.C:
+                w.reportDropped()
+        }
+    }
+}
+
+// writeSink report failure to stderr, bad sink must not stop other sinks or the writer
+func (w *asyncWriter) writeSink(sink Sink, e *entry) {
+    defer func() {
+        if r := recover(); r != nil {
+            fmt.Fprintf(os.Stderr, "log sink panic: %v\n", r)
+        }
+    }()
+    if err := sink.Write(e.level, e.data); err != nil {
+        fmt.Fprintf(os.Stderr, "log sink write failed: %v\n", err)
+    }
+}
+
+func (w *asyncWriter) reportDropped() {
+    if n := w.dropped.Swap(0); n > 0 {
+        fmt.Fprintf(os.Stderr, "log buffer is full, %d lines are dropped\n", n)
+    }
+}
+
+func (w *asyncWriter) Close() error {
+    var errs []string
+    w.closeOnce.Do(func() {
+        close(w.entries)
+        <-w.done
+        for _, sink := range w.sinks {
+            if err := sink.Close(); err != nil {
+                errs = append(errs, err.Error())
+            }
+        }
+    })
+    if len(errs) > 0 {
+        return fmt.Errorf("close log sink failed: %s", strings.Join(errs, ", "))
+    }
+    return nil
+}
+
+// handler format record with slog json or text handler into shared buffer, then copy
+// the line to async writer with its level so sink like syslog can use it
+type handler struct {
+    inner slog.Handler
+    shared *sharedBuffer
+    writer *asyncWriter
+}
+
+type sharedBuffer struct {
+    mu sync.Mutex
+    buf bytes.Buffer
+}
+
+func (b *sharedBuffer) Write(p []byte) (int, error) {
+    return b.buf.Write(p)
+}
+
+// newHandler also redact attribute whose key is secret field, like slog.String("token", ...)
+func newHandler(writer *asyncWriter, format string, level slog.Level, redactor *Redactor) slog.Handler {
+    shared := new(sharedBuffer)
+    opts := &slog.HandlerOptions{
+        Level: level,
+        ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+            if a.Value.Kind() != slog.KindGroup && redactor.IsField(a.Key) {
+                return slog.String(a.Key, Redacted)
+            }
+            return a
+        },
+    }
+
+    var inner slog.Handler
+    if strings.ToLower(format) == "text" {
+        inner = slog.NewTextHandler(shared, opts)
+    } else {
+        inner = slog.NewJSONHandler(shared, opts)
+    }
+    return &handler{
+        inner: inner,
+        shared: shared,
+        writer: writer,
+    }
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+    return h.inner.Enabled(ctx, level)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+    // record logged with request context is tied to the request
+    if trace := wymjtrace.FromContext(ctx); trace != nil {
+        r = r.Clone()
+        r.AddAttrs(
+            slog.String("request_id", trace.RequestId),
+            slog.String("trace_id", trace.TraceId),
+            slog.String("span_id", trace.SpanId),
+        )
+    }
+    h.shared.mu.Lock()
+    h.shared.buf.Reset()
+    err := h.inner.Handle(ctx, r)
+    data := bytes.Clone(h.shared.buf.Bytes())
+    h.shared.mu.Unlock()
+    if err != nil {
+        return err
+    }
+    h.writer.write(r.Level, data)
+    return nil
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+    return &handler{inner: h.inner.WithAttrs(attrs), shared: h.shared, writer: h.writer}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+    return &handler{inner: h.inner.WithGroup(name), shared: h.shared, writer: h.writer}
+}
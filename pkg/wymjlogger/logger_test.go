@@ -0,0 +1,66 @@
+package wymjlogger
+
+import (
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockedSink hold every write until release is closed
+type blockedSink struct {
+    release chan struct{}
+    mu sync.Mutex
+    lines []string
+}
+
+func (s *blockedSink) Write(level slog.Level, p []byte) error {
+    <-s.release
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.lines = append(s.lines, string(p))
+    return nil
+}
+
+func (s *blockedSink) Close() error { return nil }
+
+func TestStdWriterDoesNotWaitForSink(t *testing.T) {
+    previous := slog.Default()
+    previousRedactor := redactor()
+    t.Cleanup(func() {
+        slog.SetDefault(previous)
+        SetRedactor(previousRedactor)
+        defaultWriter.Store(nil)
+        log.SetOutput(os.Stderr)
+        log.SetFlags(log.LstdFlags)
+    })
+
+    sink := &blockedSink{release: make(chan struct{})}
+    writer := newAsyncWriter([]Sink{sink}, 16)
+    r, _ := NewRedactor(nil, nil, nil)
+    logger := &wymjSlog{
+        logger: slog.New(newHandler(writer, "json", slog.LevelInfo, r)),
+        writer: writer,
+        redactor: r,
+    }
+    logger.SetDefault()
+
+    start := time.Now()
+    for i := 0; i < 3; i++ {
+        log.Printf("line %d", i)
+    }
+    if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+        t.Fatalf("log.Printf wait %v for sink", elapsed)
+    }
+
+    close(sink.release)
+    if err := logger.Close(); err != nil {
+        t.Fatal(err)
+    }
+    if len(sink.lines) != 3 || !strings.Contains(sink.lines[2], `"msg":"line 2"`) {
+        t.Errorf("lines = %q", sink.lines)
+    }
+}
@@ -0,0 +1,218 @@
+package wymjlogger
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"sync/atomic"
+)
+
+const Redacted = "[REDACTED]"
+
+// DefaultRedactFields is always redacted, config can only add to it
+var DefaultRedactFields = []string{
+    "password",
+    "*_password",
+    "token",
+    "*_token",
+    "secret",
+    "*_secret",
+    "key",
+    "*_key",
+    "code",
+    "code_verifier",
+    "recovery_codes",
+    "authorization",
+    "cookie",
+}
+
+var DefaultRedactHeaders = []string{
+    "Authorization",
+    "X-Api-Key",
+    "Cookie",
+    "Set-Cookie",
+    "Proxy-Authorization",
+}
+
+// DefaultRedactRoutes hide value that is secret but has a normal field name
+var DefaultRedactRoutes = []string{
+    // uri has the totp secret
+    "POST /v1/users/totp/enroll=response",
+}
+
+// Redactor replace value of secret field with Redacted, field name pattern is glob that
+// match whole name case insensitively, so *_token match refresh_token but not token_type
+type Redactor struct {
+    fields []string
+    headers map[string]bool
+    routes []*redactRoute
+}
+
+type redactRoute struct {
+    method string
+    path string
+    parts map[string]bool
+}
+
+var redactorValue atomic.Pointer[Redactor]
+
+func init() {
+    r, _ := NewRedactor(nil, nil, nil)
+    redactorValue.Store(r)
+}
+
+// SetRedactor replace redactor used by response log and slog attributes
+func SetRedactor(r *Redactor) {
+    redactorValue.Store(r)
+}
+
+func redactor() *Redactor {
+    return redactorValue.Load()
+}
+
+// NewRedactor route is "METHOD /path=part|part", method and path may use *,
+// part is query | body | response | headers | all
+func NewRedactor(fields, headers, routes []string) (*Redactor, error) {
+    r := &Redactor{
+        fields: make([]string, 0),
+        headers: make(map[string]bool),
+        routes: make([]*redactRoute, 0),
+    }
+    for _, field := range append(append([]string{}, DefaultRedactFields...), fields...) {
+        field = normalizeField(field)
+        if _, err := path.Match(field, ""); err != nil {
+            return nil, fmt.Errorf("redact field %q is invalid", field)
+        }
+        r.fields = append(r.fields, field)
+    }
+    for _, header := range append(append([]string{}, DefaultRedactHeaders...), headers...) {
+        r.headers[strings.ToLower(strings.Trim(header, " "))] = true
+    }
+    for _, value := range append(append([]string{}, DefaultRedactRoutes...), routes...) {
+        route, err := parseRedactRoute(value)
+        if err != nil {
+            return nil, err
+        }
+        r.routes = append(r.routes, route)
+    }
+    return r, nil
+}
+
+func parseRedactRoute(value string) (*redactRoute, error) {
+    target, partsValue, ok := strings.Cut(value, "=")
+    method, routePath, okPath := strings.Cut(strings.Trim(target, " "), " ")
+    if !ok || !okPath {
+        return nil, fmt.Errorf("redact route %q expect METHOD /path=part", value)
+    }
+    route := &redactRoute{
+        method: strings.ToUpper(strings.Trim(method, " ")),
+        path: strings.Trim(routePath, " "),
+        parts: make(map[string]bool),
+    }
+    if _, err := path.Match(route.path, ""); err != nil {
+        return nil, fmt.Errorf("redact route %q has invalid path", value)
+    }
+    for _, part := range strings.Split(partsValue, "|") {
+        part = strings.ToLower(strings.Trim(part, " "))
+        switch part {
+            case "query", "body", "response", "headers", "all":
+                route.parts[part] = true
+            default:
+                return nil, fmt.Errorf("redact route %q has unknown part %q", value, part)
+        }
+    }
+    return route, nil
+}
+
+// normalizeField make X-Api-Key and x_api_key the same name
+func normalizeField(name string) string {
+    return strings.ReplaceAll(strings.ToLower(strings.Trim(name, " ")), "-", "_")
+}
+
+func (r *Redactor) IsField(name string) bool {
+    name = normalizeField(name)
+    for _, pattern := range r.fields {
+        if ok, _ := path.Match(pattern, name); ok {
+            return true
+        }
+    }
+    return false
+}
+
+func (r *Redactor) IsHeader(name string) bool {
+    return r.headers[strings.ToLower(name)] || r.IsField(name)
+}
+
+// IsRoutePart report whether whole part of request to method path must be hidden
+func (r *Redactor) IsRoutePart(method, routePath, part string) bool {
+    method = strings.ToUpper(method)
+    for _, route := range r.routes {
+        if route.method != "*" && route.method != method {
+            continue
+        }
+        if ok, _ := path.Match(route.path, strings.TrimSuffix(routePath, "/")); !ok {
+            continue
+        }
+        if route.parts[part] || route.parts["all"] {
+            return true
+        }
+    }
+    return false
+}
+
+// Value return copy of v as plain json value with secret fields redacted, value that can
+// not be encoded is redacted as a whole because it can not be checked
+func (r *Redactor) Value(v any) any {
+    if v == nil {
+        return nil
+    }
+    data, err := json.Marshal(v)
+    if err != nil {
+        return Redacted
+    }
+    var value any
+    if err := json.Unmarshal(data, &value); err != nil {
+        return Redacted
+    }
+    return r.walk(value)
+}
+
+func (r *Redactor) walk(value any) any {
+    switch v := value.(type) {
+        case map[string]any:
+            for key, item := range v {
+                if r.IsField(key) {
+                    if item != nil {
+                        v[key] = Redacted
+                    }
+                    continue
+                }
+                v[key] = r.walk(item)
+            }
+            return v
+        case []any:
+            for i, item := range v {
+                v[i] = r.walk(item)
+            }
+            return v
+        default:
+            return v
+    }
+}
+
+func (r *Redactor) Headers(headers map[string][]string) map[string]any {
+    res := make(map[string]any, len(headers))
+    for name, values := range headers {
+        if r.IsHeader(name) {
+            res[name] = Redacted
+            continue
+        }
+        if len(values) == 1 {
+            res[name] = values[0]
+            continue
+        }
+        res[name] = values
+    }
+    return res
+}
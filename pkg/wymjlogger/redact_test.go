@@ -0,0 +1,279 @@
+package wymjlogger
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func newTestRedactor(t *testing.T) *Redactor {
+    r, err := NewRedactor([]string{"X-Session"}, []string{"X-Tenant-Signature"}, []string{"GET /v1/reports/*=query|headers"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    return r
+}
+
+// jsonValue decode test literal the same way Value decode its copy
+func jsonValue(t *testing.T, s string) any {
+    var v any
+    if err := json.Unmarshal([]byte(s), &v); err != nil {
+        t.Fatal(err)
+    }
+    return v
+}
+
+func TestRedactorValue(t *testing.T) {
+    r := newTestRedactor(t)
+    tests := []struct {
+        name string
+        value any
+        want string
+    }{
+        {
+            "flat body",
+            map[string]any{"username": "ppp", "password": "p@ss", "new_password": "n3w"},
+            `{"username":"ppp","password":"[REDACTED]","new_password":"[REDACTED]"}`,
+        },
+        {
+            "refresh_token is secret but token_type is not",
+            map[string]any{"access_token": "a", "refresh_token": "r", "token_type": "Bearer", "expires_in": 60},
+            `{"access_token":"[REDACTED]","refresh_token":"[REDACTED]","token_type":"Bearer","expires_in":60}`,
+        },
+        {
+            "nested object",
+            map[string]any{"data": map[string]any{"user": map[string]any{"id": "U1"}, "token": map[string]any{"access_token": "a"}}},
+            `{"data":{"user":{"id":"U1"},"token":"[REDACTED]"}}`,
+        },
+        {
+            "array of objects",
+            []any{map[string]any{"name": "ci", "key": "wymj_x"}, map[string]any{"name": "cd", "key": "wymj_y"}},
+            `[{"name":"ci","key":"[REDACTED]"},{"name":"cd","key":"[REDACTED]"}]`,
+        },
+        {
+            "array in object",
+            map[string]any{"recovery_codes": []string{"a", "b"}, "items": []any{map[string]any{"client_secret": "s"}}},
+            `{"recovery_codes":"[REDACTED]","items":[{"client_secret":"[REDACTED]"}]}`,
+        },
+        {
+            "field name case and dash",
+            map[string]any{"Password": "p", "X-Api-Key": "k", "x-session": "s", "Code_Verifier": "v"},
+            `{"Password":"[REDACTED]","X-Api-Key":"[REDACTED]","x-session":"[REDACTED]","Code_Verifier":"[REDACTED]"}`,
+        },
+        {
+            "null secret stay null",
+            map[string]any{"password": nil},
+            `{"password":null}`,
+        },
+        {
+            "struct use json name",
+            struct {
+                Id string `json:"id"`
+                Secret string `json:"client_secret"`
+            }{"C1", "s"},
+            `{"id":"C1","client_secret":"[REDACTED]"}`,
+        },
+        {
+            "scalar",
+            "plain",
+            `"plain"`,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got, want := r.Value(tt.value), jsonValue(t, tt.want); !reflect.DeepEqual(got, want) {
+                t.Errorf("value = %v, want %v", got, want)
+            }
+        })
+    }
+
+    if got := r.Value(map[string]any{"ch": make(chan int)}); got != Redacted {
+        t.Errorf("value that can not be encoded = %v", got)
+    }
+    if got := r.Value(nil); got != nil {
+        t.Errorf("nil value = %v", got)
+    }
+}
+
+func TestRedactorValueDoesNotChangeInput(t *testing.T) {
+    body := map[string]any{"password": "p"}
+    newTestRedactor(t).Value(body)
+    if body["password"] != "p" {
+        t.Errorf("input is changed: %v", body)
+    }
+}
+
+func TestRedactorHeaders(t *testing.T) {
+    r := newTestRedactor(t)
+    got := r.Headers(map[string][]string{
+        "authorization": {"Bearer x"},
+        "X-API-KEY": {"wymj_x"},
+        "Cookie": {"a=1", "b=2"},
+        "X-Tenant-Signature": {"sig"},
+        "X-Csrf-Token": {"t"},
+        "Accept": {"application/json", "text/plain"},
+        "User-Agent": {"curl"},
+    })
+    want := map[string]any{
+        "authorization": Redacted,
+        "X-API-KEY": Redacted,
+        "Cookie": Redacted,
+        "X-Tenant-Signature": Redacted,
+        "X-Csrf-Token": Redacted,
+        "Accept": []string{"application/json", "text/plain"},
+        "User-Agent": "curl",
+    }
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("headers = %v, want %v", got, want)
+    }
+}
+
+func TestRedactorIsRoutePart(t *testing.T) {
+    r := newTestRedactor(t)
+    tests := []struct {
+        method string
+        path string
+        part string
+        want bool
+    }{
+        {"POST", "/v1/users/totp/enroll", "response", true},
+        {"post", "/v1/users/totp/enroll/", "response", true},
+        {"POST", "/v1/users/totp/enroll", "body", false},
+        {"GET", "/v1/users/totp/enroll", "response", false},
+        {"POST", "/v1/users/totp/verify", "response", false},
+        {"GET", "/v1/reports/summary", "query", true},
+        {"GET", "/v1/reports/summary", "headers", true},
+        {"GET", "/v1/reports/summary", "response", false},
+        {"GET", "/v1/reports/summary/daily", "query", false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.method+" "+tt.path+"="+tt.part, func(t *testing.T) {
+            if got := r.IsRoutePart(tt.method, tt.path, tt.part); got != tt.want {
+                t.Errorf("is route part = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestNewRedactorInvalid(t *testing.T) {
+    tests := []struct {
+        name string
+        fields []string
+        routes []string
+    }{
+        {"bad field pattern", []string{"[token"}, nil},
+        {"route without part", nil, []string{"POST /v1/users"}},
+        {"route without method", nil, []string{"/v1/users=body"}},
+        {"unknown part", nil, []string{"POST /v1/users=cookies"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if _, err := NewRedactor(tt.fields, nil, tt.routes); err == nil {
+                t.Errorf("error is expected")
+            }
+        })
+    }
+}
+
+// captureDefault make slog default write json at debug level to buffer until test end
+func captureDefault(t *testing.T) *bytes.Buffer {
+    buf := new(bytes.Buffer)
+    previous := slog.Default()
+    slog.SetDefault(slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+    t.Cleanup(func() { slog.SetDefault(previous) })
+    return buf
+}
+
+func TestWymjLoggerSave(t *testing.T) {
+    buf := captureDefault(t)
+
+    app := fiber.New()
+    app.Post("/v1/users/signin", func(c *fiber.Ctx) error {
+        res := map[string]any{
+            "user": map[string]any{"id": "U000001", "username": "ppp"},
+            "token": map[string]any{"access_token": "eyJ.a", "refresh_token": "eyJ.r", "token_type": "Bearer"},
+        }
+        InitWymjLogger(c, res).Save()
+        return c.JSON(res)
+    })
+    app.Post("/v1/users/totp/enroll", func(c *fiber.Ctx) error {
+        res := map[string]any{"uri": "otpauth://totp/wymj:ppp?secret=JBSWY3DPEHPK3PXP"}
+        InitWymjLogger(c, res).Save()
+        return c.JSON(res)
+    })
+
+    req := httptest.NewRequest("POST", "/v1/users/signin?next=/home&state=abc", strings.NewReader(`{"email":"ppp@wymj.dev","password":"p@ssw0rd","devices":[{"name":"pc","key":"k"}]}`))
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("authorization", "Bearer old")
+    req.Header.Set("X-Request-Id", "R1")
+    if _, err := app.Test(req); err != nil {
+        t.Fatal(err)
+    }
+    req = httptest.NewRequest("POST", "/v1/users/totp/enroll", nil)
+    if _, err := app.Test(req); err != nil {
+        t.Fatal(err)
+    }
+
+    for _, secret := range []string{"p@ssw0rd", "eyJ.a", "eyJ.r", "Bearer old", `"k"`, "JBSWY3DPEHPK3PXP"} {
+        if strings.Contains(buf.String(), secret) {
+            t.Errorf("log has secret %s:\n%s", secret, buf.String())
+        }
+    }
+
+    lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+    if len(lines) != 2 {
+        t.Fatalf("got %d log lines:\n%s", len(lines), buf.String())
+    }
+    var signin, enroll map[string]any
+    if err := json.Unmarshal([]byte(lines[0]), &signin); err != nil {
+        t.Fatal(err)
+    }
+    if err := json.Unmarshal([]byte(lines[1]), &enroll); err != nil {
+        t.Fatal(err)
+    }
+
+    if signin["msg"] != "http response" || signin["path"] != "/v1/users/signin" || signin["method"] != "POST" {
+        t.Errorf("record = %v", signin)
+    }
+    wantBody := jsonValue(t, `{"email":"ppp@wymj.dev","password":"[REDACTED]","devices":[{"name":"pc","key":"[REDACTED]"}]}`)
+    if !reflect.DeepEqual(signin["body"], wantBody) {
+        t.Errorf("body = %v", signin["body"])
+    }
+    wantResponse := jsonValue(t, `{"user":{"id":"U000001","username":"ppp"},"token":"[REDACTED]"}`)
+    if !reflect.DeepEqual(signin["response"], wantResponse) {
+        t.Errorf("response = %v", signin["response"])
+    }
+    if query := jsonValue(t, `{"next":"/home","state":"abc"}`); !reflect.DeepEqual(signin["query"], query) {
+        t.Errorf("query = %v", signin["query"])
+    }
+    headers, _ := signin["headers"].(map[string]any)
+    if headers["Authorization"] != Redacted || headers["X-Request-Id"] != "R1" {
+        t.Errorf("headers = %v", signin["headers"])
+    }
+    if enroll["response"] != Redacted {
+        t.Errorf("totp enroll response = %v", enroll["response"])
+    }
+}
+
+func TestWymjLoggerSaveInfoLevel(t *testing.T) {
+    buf := captureDefault(t)
+    slog.SetDefault(slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelInfo})))
+
+    app := fiber.New()
+    app.Post("/v1/users/signin", func(c *fiber.Ctx) error {
+        InitWymjLogger(c, map[string]any{"token": "t"}).Save()
+        return nil
+    })
+    if _, err := app.Test(httptest.NewRequest("POST", "/v1/users/signin", nil)); err != nil {
+        t.Fatal(err)
+    }
+    if buf.Len() != 0 {
+        t.Errorf("debug log is written at info level: %s", buf.String())
+    }
+}
@@ -0,0 +1,238 @@
+package wymjlogger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+    fileName = "wymjlogger.log"
+    backupPrefix = "wymjlogger-"
+    backupTimeFormat = "20060102T150405.000"
+)
+
+// fileSink write to dir/wymjlogger.log and rotate it when it reach maxSize or the day
+// change, backup older than maxAge is removed and the rest is gzipped when compress is on
+type fileSink struct {
+    dir string
+    maxSize int64
+    maxAge time.Duration
+    compress bool
+    file *os.File
+    size int64
+    openedAt time.Time
+    // cleanup run in background, mu keep two cleanups from touching the same backup
+    mu sync.Mutex
+    wg sync.WaitGroup
+}
+
+func FileSink(dir string, maxSize int64, maxAge time.Duration, compress bool) (Sink, error) {
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return nil, fmt.Errorf("create log dir failed: %v", err)
+    }
+    s := &fileSink{
+        dir: dir,
+        maxSize: maxSize,
+        maxAge: maxAge,
+        compress: compress,
+    }
+    if err := s.open(); err != nil {
+        return nil, err
+    }
+    s.cleanup()
+    return s, nil
+}
+
+func (s *fileSink) open() error {
+    // dir may be removed while running
+    if err := os.MkdirAll(s.dir, 0755); err != nil {
+        return fmt.Errorf("create log dir failed: %v", err)
+    }
+    file, err := os.OpenFile(filepath.Join(s.dir, fileName), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+    if err != nil {
+        return fmt.Errorf("open log file failed: %v", err)
+    }
+    info, err := file.Stat()
+    if err != nil {
+        file.Close()
+        return fmt.Errorf("open log file failed: %v", err)
+    }
+    s.file = file
+    s.size = info.Size()
+    s.openedAt = info.ModTime()
+    if info.Size() == 0 {
+        s.openedAt = time.Now()
+    }
+    return nil
+}
+
+func (s *fileSink) Write(level slog.Level, p []byte) error {
+    if s.file == nil {
+        if err := s.open(); err != nil {
+            return err
+        }
+    }
+
+    now := time.Now()
+    if s.size > 0 && (s.maxSize > 0 && s.size+int64(len(p)) > s.maxSize || !sameDay(s.openedAt, now)) {
+        if err := s.rotate(now); err != nil {
+            return err
+        }
+    }
+
+    n, err := s.file.Write(p)
+    s.size += int64(n)
+    if err != nil {
+        return fmt.Errorf("write log file failed: %v", err)
+    }
+    return nil
+}
+
+func sameDay(a, b time.Time) bool {
+    ay, am, ad := a.Date()
+    by, bm, bd := b.Date()
+    return ay == by && am == bm && ad == bd
+}
+
+func (s *fileSink) rotate(now time.Time) error {
+    s.file.Close()
+    s.file = nil
+
+    backup := filepath.Join(s.dir, backupPrefix+now.Format(backupTimeFormat)+".log")
+    if err := os.Rename(filepath.Join(s.dir, fileName), backup); err != nil && !os.IsNotExist(err) {
+        return fmt.Errorf("rotate log file failed: %v", err)
+    }
+    if err := s.open(); err != nil {
+        return err
+    }
+    s.cleanup()
+    return nil
+}
+
+func (s *fileSink) cleanup() {
+    s.wg.Add(1)
+    go func() {
+        defer s.wg.Done()
+        s.mu.Lock()
+        defer s.mu.Unlock()
+
+        if err := s.removeOld(); err != nil {
+            fmt.Fprintf(os.Stderr, "log cleanup failed: %v\n", err)
+        }
+        if s.compress {
+            if err := s.compressBackups(); err != nil {
+                fmt.Fprintf(os.Stderr, "log compress failed: %v\n", err)
+            }
+        }
+    }()
+}
+
+func (s *fileSink) backups() ([]string, error) {
+    entries, err := os.ReadDir(s.dir)
+    if err != nil {
+        return nil, err
+    }
+    names := make([]string, 0)
+    for _, e := range entries {
+        if !e.IsDir() && strings.HasPrefix(e.Name(), backupPrefix) {
+            names = append(names, e.Name())
+        }
+    }
+    sort.Strings(names)
+    return names, nil
+}
+
+// backupTime read rotate time from name so copying files does not change their age
+func backupTime(name string) (time.Time, bool) {
+    value := strings.TrimPrefix(name, backupPrefix)
+    value = strings.TrimSuffix(strings.TrimSuffix(value, ".gz"), ".log")
+    t, err := time.ParseInLocation(backupTimeFormat, value, time.Local)
+    return t, err == nil
+}
+
+func (s *fileSink) removeOld() error {
+    if s.maxAge <= 0 {
+        return nil
+    }
+    names, err := s.backups()
+    if err != nil {
+        return err
+    }
+    cutoff := time.Now().Add(-s.maxAge)
+    for _, name := range names {
+        if t, ok := backupTime(name); ok && t.Before(cutoff) {
+            if err := os.Remove(filepath.Join(s.dir, name)); err != nil && !os.IsNotExist(err) {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+func (s *fileSink) compressBackups() error {
+    names, err := s.backups()
+    if err != nil {
+        return err
+    }
+    for _, name := range names {
+        if strings.HasSuffix(name, ".log") {
+            if err := gzipFile(filepath.Join(s.dir, name)); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+// gzipFile write to temp file first so a crash never leave a broken .gz
+func gzipFile(path string) error {
+    src, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer src.Close()
+
+    tmp := path + ".gz.tmp"
+    dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+    if err != nil {
+        return err
+    }
+    gz := gzip.NewWriter(dst)
+    if _, err := io.Copy(gz, src); err != nil {
+        gz.Close()
+        dst.Close()
+        os.Remove(tmp)
+        return err
+    }
+    if err := gz.Close(); err != nil {
+        dst.Close()
+        os.Remove(tmp)
+        return err
+    }
+    if err := dst.Close(); err != nil {
+        os.Remove(tmp)
+        return err
+    }
+    if err := os.Rename(tmp, path+".gz"); err != nil {
+        return err
+    }
+    return os.Remove(path)
+}
+
+func (s *fileSink) Close() error {
+    s.wg.Wait()
+    if s.file == nil {
+        return nil
+    }
+    err := s.file.Close()
+    s.file = nil
+    return err
+}
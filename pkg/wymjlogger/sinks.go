@@ -0,0 +1,117 @@
+package wymjlogger
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+type stdoutSink struct{}
+
+func StdoutSink() Sink {
+    return &stdoutSink{}
+}
+
+func (s *stdoutSink) Write(level slog.Level, p []byte) error {
+    _, err := os.Stdout.Write(p)
+    return err
+}
+
+func (s *stdoutSink) Close() error { return nil }
+
+// syslogSink send RFC 5424 message with facility local0, connection is dialed again
+// after a failed write so restart of syslog server does not lose logs forever
+type syslogSink struct {
+    network string
+    addr string
+    tag string
+    hostname string
+    conn net.Conn
+}
+
+// SyslogSink addr is udp://host:514 or tcp://host:514, host:port is udp
+func SyslogSink(addr, tag string) (Sink, error) {
+    network := "udp"
+    if strings.Contains(addr, "://") {
+        u, err := url.Parse(addr)
+        if err != nil {
+            return nil, fmt.Errorf("syslog addr is invalid: %v", err)
+        }
+        network, addr = u.Scheme, u.Host
+    }
+    if network != "udp" && network != "tcp" {
+        return nil, fmt.Errorf("syslog network %q is not supported", network)
+    }
+    if _, _, err := net.SplitHostPort(addr); err != nil {
+        return nil, fmt.Errorf("syslog addr is invalid: %v", err)
+    }
+
+    hostname, _ := os.Hostname()
+    if hostname == "" {
+        hostname = "-"
+    }
+    if tag == "" {
+        tag = "-"
+    }
+    return &syslogSink{
+        network: network,
+        addr: addr,
+        tag: strings.ReplaceAll(tag, " ", "_"),
+        hostname: hostname,
+    }, nil
+}
+
+func severity(level slog.Level) int {
+    switch {
+        case level >= slog.LevelError:
+            return 3
+        case level >= slog.LevelWarn:
+            return 4
+        case level >= slog.LevelInfo:
+            return 6
+        default:
+            return 7
+    }
+}
+
+func (s *syslogSink) Write(level slog.Level, p []byte) error {
+    if s.conn == nil {
+        conn, err := net.DialTimeout(s.network, s.addr, 5*time.Second)
+        if err != nil {
+            return fmt.Errorf("dial syslog failed: %v", err)
+        }
+        s.conn = conn
+    }
+
+    msg := fmt.Sprintf("<%d>1 %s %s %s %d - - %s",
+        16*8+severity(level),
+        time.Now().UTC().Format(time.RFC3339Nano),
+        s.hostname,
+        s.tag,
+        os.Getpid(),
+        strings.TrimRight(string(p), "\n"),
+    )
+    // tcp use newline as message separator
+    if s.network == "tcp" {
+        msg += "\n"
+    }
+
+    s.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+    if _, err := s.conn.Write([]byte(msg)); err != nil {
+        s.conn.Close()
+        s.conn = nil
+        return fmt.Errorf("write syslog failed: %v", err)
+    }
+    return nil
+}
+
+func (s *syslogSink) Close() error {
+    if s.conn == nil {
+        return nil
+    }
+    return s.conn.Close()
+}
@@ -1,90 +1,137 @@
 package wymjlogger
 
 import (
-	"fmt"
-	"log"
-	"os"
+	"encoding/json"
+	"log/slog"
 	"strings"
-	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/ppp3ppj/wymj/pkg/utils"
 )
 
 type IWymjLogger interface {
-    Print() IWymjLogger
     Save()
     SetQuery(c *fiber.Ctx)
     SetBody(c *fiber.Ctx)
+    SetHeaders(c *fiber.Ctx)
     SetResponse(res any)
 }
 
 type wymjLogger struct {
-    Time string `json:"time"`
+    ctx *fiber.Ctx
+    redactor *Redactor
     Ip string `json:"ip"`
     Method string `json:"method"`
     StatusCode int `json:"status_code"`
     Path string `json:"path"`
+    Headers any `json:"headers"`
     Query any `json:"query"`
     Body any `json:"body"`
     Response any `json:"response"`
 }
 
+// InitWymjLogger body is only parsed when debug level is on, it is costly on every response.
+// Every part is redacted here so no sink ever see the secret
 func InitWymjLogger(c *fiber.Ctx, res any) IWymjLogger {
     log := &wymjLogger{
-        Time: time.Now().Local().Format("2006-01-02 15:04:05"),
+        ctx: c,
+        redactor: redactor(),
         Ip: c.IP(),
         Method: c.Method(),
         Path: c.Path(),
         StatusCode: c.Response().StatusCode(),
     }
-    log.SetQuery(c)
-    log.SetBody(c)
-    log.SetResponse(res)   
+    if slog.Default().Enabled(c.UserContext(), slog.LevelDebug) {
+        log.SetHeaders(c)
+        log.SetQuery(c)
+        log.SetBody(c)
+        log.SetResponse(res)
+    }
     return log
 }
 
-func (l *wymjLogger) Print() IWymjLogger {
-    utils.Debug(l)
-    return l
+// Save log request and response at debug level, access log is written by Logger middleware
+func (l *wymjLogger) Save() {
+    slog.LogAttrs(l.ctx.UserContext(), slog.LevelDebug, "http response",
+        slog.String("ip", l.Ip),
+        slog.String("method", l.Method),
+        slog.Int("status_code", l.StatusCode),
+        slog.String("path", l.Path),
+        slog.Any("headers", l.Headers),
+        slog.Any("query", l.Query),
+        slog.Any("body", l.Body),
+        slog.Any("response", l.Response),
+    )
 }
 
-func (l *wymjLogger) Save() {
-    data := utils.Output(l)
+func (l *wymjLogger) isRedacted(part string) bool {
+    return l.redactor.IsRoutePart(l.Method, l.Path, part)
+}
 
-    filename := fmt.Sprintf("./assets/logs/wymjlogger_%v.txt", 
-        strings.ReplaceAll(time.Now().Format("2006-01-02"), "-", ""))
-    file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-    if err != nil {
-        log.Fatalf("error opening file: %v", err)
+func (l *wymjLogger) SetHeaders(c *fiber.Ctx) {
+    if l.isRedacted("headers") {
+        l.Headers = Redacted
+        return
     }
-    defer file.Close()
-    file.WriteString(string(data) + "\n")
+    l.Headers = l.redactor.Headers(c.GetReqHeaders())
 }
 
 func (l *wymjLogger) SetQuery(c *fiber.Ctx) {
-    var body any
-    if err := c.QueryParser(&body); err != nil {
-        log.Printf("body parser error: %v", err)
+    if l.isRedacted("query") {
+        l.Query = Redacted
+        return
+    }
+    queries := c.Queries()
+    if len(queries) == 0 {
+        return
     }
-    l.Query = body
+    l.Query = l.redactor.Value(queries)
 }
 
+// SetBody read json and form body, file of multipart form is not logged
 func (l *wymjLogger) SetBody(c *fiber.Ctx) {
-    var body any
-    if err := c.BodyParser(&body); err != nil {
-        log.Printf("body parser error: %v", err)
+    if l.isRedacted("body") {
+        l.Body = Redacted
+        return
+    }
+    if len(c.Body()) == 0 {
+        return
     }
 
-    switch l.Path {
-        case "v1/users/signup":
-            l.Body = "never gonna give you up"
+    var body any
+    contentType := strings.ToLower(c.Get(fiber.HeaderContentType))
+    switch {
+        case strings.HasPrefix(contentType, fiber.MIMEApplicationJSON):
+            if err := json.Unmarshal(c.Body(), &body); err != nil {
+                slog.Debug("body parser error", slog.String("error", err.Error()))
+                return
+            }
+        case strings.HasPrefix(contentType, fiber.MIMEApplicationForm):
+            form := make(map[string]any)
+            c.Request().PostArgs().VisitAll(func(key, value []byte) {
+                form[string(key)] = string(value)
+            })
+            body = form
+        case strings.HasPrefix(contentType, fiber.MIMEMultipartForm):
+            multipart, err := c.MultipartForm()
+            if err != nil {
+                slog.Debug("body parser error", slog.String("error", err.Error()))
+                return
+            }
+            form := make(map[string]any)
+            for key, values := range multipart.Value {
+                form[key] = values
+            }
+            body = form
         default:
-            l.Body = body
+            return
     }
+    l.Body = l.redactor.Value(body)
 }
 
 func (l *wymjLogger) SetResponse(res any) {
-    l.Response = res
+    if l.isRedacted("response") {
+        l.Response = Redacted
+        return
+    }
+    l.Response = l.redactor.Value(res)
 }
-
@@ -0,0 +1,44 @@
+package wymjmailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/ppp3ppj/wymj/config"
+)
+
+// fileMailer is for local development, mail is written to file dir or printed to stdout
+type fileMailer struct {
+    cfg config.IMailconfig
+    console bool
+}
+
+func newFileMailer(cfg config.IMailconfig, console bool) IWymjMailer {
+    return &fileMailer{
+        cfg: cfg,
+        console: console,
+    }
+}
+
+var unsafeFilename = regexp.MustCompile(`[^A-Za-z0-9@._-]`)
+
+func (m *fileMailer) Send(ctx context.Context, mail *Mail) error {
+    msg := message(m.cfg.From(), mail)
+    if m.console {
+        fmt.Printf("---- mail ----\n%s\n--------------\n", msg)
+        return nil
+    }
+
+    if err := os.MkdirAll(m.cfg.FileDir(), 0755); err != nil {
+        return fmt.Errorf("create directory failed: %v", err)
+    }
+    name := fmt.Sprintf("%d_%s.eml", time.Now().UnixNano(), unsafeFilename.ReplaceAllString(mail.To, "_"))
+    if err := os.WriteFile(filepath.Join(m.cfg.FileDir(), name), msg, 0644); err != nil {
+        return fmt.Errorf("write mail failed: %v", err)
+    }
+    return nil
+}
@@ -0,0 +1,57 @@
+package wymjmailer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ppp3ppj/wymj/config"
+)
+
+type Mail struct {
+    To string
+    Subject string
+    Body string
+}
+
+type IWymjMailer interface {
+    Send(ctx context.Context, mail *Mail) error
+}
+
+func NewWymjMailer(cfg config.IMailconfig) (IWymjMailer, error) {
+    switch cfg.Driver() {
+        case "smtp":
+            if cfg.Host() == "" {
+                return nil, fmt.Errorf("mail host is required for smtp driver")
+            }
+            return newSmtpMailer(cfg), nil
+        case "file":
+            return newFileMailer(cfg, false), nil
+        case "console":
+            return newFileMailer(cfg, true), nil
+        case "":
+            return nil, fmt.Errorf("mail driver is required: smtp, or file and console for local development")
+        default:
+            return nil, fmt.Errorf("unknown mail driver: %v", cfg.Driver())
+    }
+}
+
+// message build plain text mail in RFC 5322 format,
+// line break is removed from header to prevent header injection
+func message(from string, mail *Mail) []byte {
+    header := func(s string) string {
+        return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+    }
+
+    var b strings.Builder
+    b.WriteString("From: " + header(from) + "\r\n")
+    b.WriteString("To: " + header(mail.To) + "\r\n")
+    b.WriteString("Subject: " + header(mail.Subject) + "\r\n")
+    b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+    b.WriteString("MIME-Version: 1.0\r\n")
+    b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+    b.WriteString("\r\n")
+    b.WriteString(strings.ReplaceAll(strings.ReplaceAll(mail.Body, "\r\n", "\n"), "\n", "\r\n"))
+    return []byte(b.String())
+}
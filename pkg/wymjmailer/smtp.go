@@ -0,0 +1,46 @@
+package wymjmailer
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"github.com/ppp3ppj/wymj/config"
+)
+
+type smtpMailer struct {
+    cfg config.IMailconfig
+}
+
+func newSmtpMailer(cfg config.IMailconfig) IWymjMailer {
+    return &smtpMailer{
+        cfg: cfg,
+    }
+}
+
+// Send use STARTTLS when server support it, auth is skipped when username is empty
+func (m *smtpMailer) Send(ctx context.Context, mail *Mail) error {
+    if strings.ContainsAny(mail.To, "\r\n") {
+        return fmt.Errorf("mail recipient is invalid")
+    }
+
+    var auth smtp.Auth
+    if m.cfg.Username() != "" {
+        auth = smtp.PlainAuth("", m.cfg.Username(), m.cfg.Password(), m.cfg.Host())
+    }
+
+    done := make(chan error, 1)
+    go func() {
+        done <- smtp.SendMail(m.cfg.Addr(), auth, m.cfg.From(), []string{mail.To}, message(m.cfg.From(), mail))
+    }()
+    select {
+        case err := <-done:
+            if err != nil {
+                return fmt.Errorf("send mail failed: %v", err)
+            }
+            return nil
+        case <-ctx.Done():
+            return fmt.Errorf("send mail failed: %v", ctx.Err())
+    }
+}
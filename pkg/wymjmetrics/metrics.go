@@ -0,0 +1,120 @@
+package wymjmetrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "wymj"
+
+// own registry so only metrics of this app are exposed, not everything in default registry
+var registry = prometheus.NewRegistry()
+
+var (
+    httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: namespace,
+        Name: "http_requests_total",
+        Help: "Number of HTTP requests by route, method and status.",
+    }, []string{"route", "method", "status"})
+    httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+        Namespace: namespace,
+        Name: "http_request_duration_seconds",
+        Help: "Latency of HTTP requests by route, method and status.",
+        Buckets: prometheus.DefBuckets,
+    }, []string{"route", "method", "status"})
+
+    signIns = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: namespace,
+        Subsystem: "auth",
+        Name: "sign_ins_total",
+        Help: "Number of successful sign ins by method.",
+    }, []string{"method"})
+    failedLogins = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: namespace,
+        Subsystem: "auth",
+        Name: "failed_logins_total",
+        Help: "Number of rejected sign ins by method and reason.",
+    }, []string{"method", "reason"})
+    tokenRefreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: namespace,
+        Subsystem: "auth",
+        Name: "token_refreshes_total",
+        Help: "Number of refresh token grants by client type and result.",
+    }, []string{"client", "result"})
+    apiKeyRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: namespace,
+        Subsystem: "auth",
+        Name: "api_key_rejections_total",
+        Help: "Number of requests rejected by api key check by reason.",
+    }, []string{"reason"})
+)
+
+// sign in method
+const (
+    Password = "password"
+    Totp = "totp"
+    Oidc = "oidc"
+)
+
+// token refresh client
+const (
+    UserClient = "user"
+    OAuth2Client = "oauth2"
+)
+
+func init() {
+    registry.MustRegister(
+        collectors.NewGoCollector(),
+        collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+        httpRequests,
+        httpDuration,
+        signIns,
+        failedLogins,
+        tokenRefreshes,
+        apiKeyRejections,
+    )
+}
+
+// Handler write metrics in Prometheus text format
+func Handler() http.Handler {
+    return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// RegisterDb expose sql.DBStats of the pool as wymj_go_sql_* metrics
+func RegisterDb(db *sql.DB) error {
+    return prometheus.WrapRegistererWithPrefix(namespace+"_", registry).Register(collectors.NewDBStatsCollector(db, namespace))
+}
+
+// ObserveHttp route is matched route pattern like /v1/tasks/:task_id so path params do not
+// make new series
+func ObserveHttp(route, method string, status int, latency time.Duration) {
+    code := strconv.Itoa(status)
+    httpRequests.WithLabelValues(route, method, code).Inc()
+    httpDuration.WithLabelValues(route, method, code).Observe(latency.Seconds())
+}
+
+func SignIn(method string) {
+    signIns.WithLabelValues(method).Inc()
+}
+
+func LoginFailed(method, reason string) {
+    failedLogins.WithLabelValues(method, reason).Inc()
+}
+
+func TokenRefreshed(client string, ok bool) {
+    result := "success"
+    if !ok {
+        result = "failure"
+    }
+    tokenRefreshes.WithLabelValues(client, result).Inc()
+}
+
+func ApiKeyRejected(reason string) {
+    apiKeyRejections.WithLabelValues(reason).Inc()
+}
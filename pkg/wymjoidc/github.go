@@ -0,0 +1,103 @@
+package wymjoidc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ppp3ppj/wymj/config"
+)
+
+// githubClient use GitHub OAuth app, it has no id_token so identity come from rest api
+type githubClient struct {
+    cfg config.IOidcProvider
+    redirectUrl string
+    http *http.Client
+    webUrl string
+    apiUrl string
+}
+
+func newGithubClient(cfg config.IOidcProvider, redirectUrl string) IWymjOidc {
+    webUrl := strings.TrimSuffix(cfg.Issuer(), "/")
+    // GitHub Enterprise serve api under /api/v3 of the same host
+    apiUrl := webUrl + "/api/v3"
+    if webUrl == "https://github.com" {
+        apiUrl = "https://api.github.com"
+    }
+    return &githubClient{
+        cfg: cfg,
+        redirectUrl: redirectUrl,
+        http: &http.Client{Timeout: 10 * time.Second},
+        webUrl: webUrl,
+        apiUrl: apiUrl,
+    }
+}
+
+// nonce is not used, state and pkce protect the flow
+func (g *githubClient) AuthCodeUrl(state, codeChallenge, nonce string) (string, error) {
+    q := url.Values{
+        "client_id": {g.cfg.ClientId()},
+        "redirect_uri": {g.redirectUrl},
+        "scope": {strings.Join(g.cfg.Scopes(), " ")},
+        "state": {state},
+        "code_challenge": {codeChallenge},
+        "code_challenge_method": {"S256"},
+    }
+    return withQuery(g.webUrl+"/login/oauth/authorize", q), nil
+}
+
+func (g *githubClient) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error) {
+    token, err := exchangeCode(ctx, g.http, g.webUrl+"/login/oauth/access_token", url.Values{
+        "code": {code},
+        "redirect_uri": {g.redirectUrl},
+        "client_id": {g.cfg.ClientId()},
+        "client_secret": {g.cfg.ClientSecret()},
+        "code_verifier": {codeVerifier},
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    user := new(struct {
+        Id int64 `json:"id"`
+        Login string `json:"login"`
+        Name string `json:"name"`
+    })
+    if err := getJson(ctx, g.http, g.apiUrl+"/user", token.AccessToken, user); err != nil {
+        return nil, fmt.Errorf("get github user failed: %v", err)
+    }
+    if user.Id == 0 {
+        return nil, fmt.Errorf("get github user failed: id is missing")
+    }
+
+    identity := &Identity{
+        Provider: g.cfg.Name(),
+        Subject: strconv.FormatInt(user.Id, 10),
+        Name: user.Name,
+    }
+    if identity.Name == "" {
+        identity.Name = user.Login
+    }
+
+    // public email on profile may be unverified, use primary email from emails api
+    emails := make([]*struct {
+        Email string `json:"email"`
+        Primary bool `json:"primary"`
+        Verified bool `json:"verified"`
+    }, 0)
+    if err := getJson(ctx, g.http, g.apiUrl+"/user/emails", token.AccessToken, &emails); err != nil {
+        return nil, fmt.Errorf("get github emails failed: %v", err)
+    }
+    for _, e := range emails {
+        if e.Primary {
+            identity.Email = e.Email
+            identity.EmailVerified = e.Verified
+            break
+        }
+    }
+    return identity, nil
+}
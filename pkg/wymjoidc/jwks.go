@@ -0,0 +1,89 @@
+package wymjoidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+)
+
+type jwk struct {
+    Kid string `json:"kid"`
+    Kty string `json:"kty"`
+    Use string `json:"use"`
+    N string `json:"n"`
+    E string `json:"e"`
+    Crv string `json:"crv"`
+    X string `json:"x"`
+    Y string `json:"y"`
+}
+
+// fetchJwks return kid -> public key, key that can not be read is skipped
+func fetchJwks(ctx context.Context, client *http.Client, jwksUri string) (map[string]any, error) {
+    set := new(struct {
+        Keys []*jwk `json:"keys"`
+    })
+    if err := getJson(ctx, client, jwksUri, "", set); err != nil {
+        return nil, fmt.Errorf("get jwks failed: %v", err)
+    }
+
+    keys := make(map[string]any)
+    for _, k := range set.Keys {
+        if k.Use != "" && k.Use != "sig" {
+            continue
+        }
+        if key, err := k.publicKey(); err == nil {
+            keys[k.Kid] = key
+        }
+    }
+    return keys, nil
+}
+
+func (k *jwk) publicKey() (any, error) {
+    b64 := base64.RawURLEncoding.DecodeString
+    switch k.Kty {
+        case "RSA":
+            n, err := b64(k.N)
+            if err != nil {
+                return nil, err
+            }
+            e, err := b64(k.E)
+            if err != nil {
+                return nil, err
+            }
+            return &rsa.PublicKey{
+                N: new(big.Int).SetBytes(n),
+                E: int(new(big.Int).SetBytes(e).Int64()),
+            }, nil
+        case "EC":
+            if k.Crv != "P-256" {
+                return nil, fmt.Errorf("curve %s is not supported", k.Crv)
+            }
+            x, err := b64(k.X)
+            if err != nil {
+                return nil, err
+            }
+            y, err := b64(k.Y)
+            if err != nil {
+                return nil, err
+            }
+            return &ecdsa.PublicKey{
+                Curve: elliptic.P256(),
+                X: new(big.Int).SetBytes(x),
+                Y: new(big.Int).SetBytes(y),
+            }, nil
+        case "OKP":
+            x, err := b64(k.X)
+            if err != nil || k.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+                return nil, fmt.Errorf("okp key is invalid")
+            }
+            return ed25519.PublicKey(x), nil
+        default:
+            return nil, fmt.Errorf("kty %s is not supported", k.Kty)
+    }
+}
@@ -0,0 +1,296 @@
+package wymjoidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ppp3ppj/wymj/config"
+)
+
+// Identity is the external account after code exchange
+type Identity struct {
+    Provider string
+    Subject string
+    Email string
+    EmailVerified bool
+    Name string
+}
+
+type IWymjOidc interface {
+    // AuthCodeUrl is where browser is sent to sign in at provider
+    AuthCodeUrl(state, codeChallenge, nonce string) (string, error)
+    // Exchange trade code for tokens and return verified identity
+    Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error)
+}
+
+func NewWymjOidc(cfg config.IOidcProvider, redirectUrl string) (IWymjOidc, error) {
+    switch cfg.Type() {
+        case "oidc":
+            return &oidcClient{
+                cfg: cfg,
+                redirectUrl: redirectUrl,
+                http: &http.Client{Timeout: 10 * time.Second},
+            }, nil
+        case "github":
+            return newGithubClient(cfg, redirectUrl), nil
+        default:
+            return nil, fmt.Errorf("oidc type %q is not supported", cfg.Type())
+    }
+}
+
+// NewWymjOidcProviders build client of every configured provider by name
+func NewWymjOidcProviders(cfg config.IOidcconfig) (map[string]IWymjOidc, error) {
+    providers := make(map[string]IWymjOidc)
+    for name, provider := range cfg.Providers() {
+        client, err := NewWymjOidc(provider, cfg.RedirectUrl(name))
+        if err != nil {
+            return nil, fmt.Errorf("oidc provider %s: %v", name, err)
+        }
+        providers[name] = client
+    }
+    return providers, nil
+}
+
+// CodeChallenge is S256 PKCE challenge of verifier
+func CodeChallenge(codeVerifier string) string {
+    sum := sha256.Sum256([]byte(codeVerifier))
+    return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+type discovery struct {
+    Issuer string `json:"issuer"`
+    AuthorizationEndpoint string `json:"authorization_endpoint"`
+    TokenEndpoint string `json:"token_endpoint"`
+    UserinfoEndpoint string `json:"userinfo_endpoint"`
+    JwksUri string `json:"jwks_uri"`
+}
+
+type tokenRes struct {
+    AccessToken string `json:"access_token"`
+    IdToken string `json:"id_token"`
+    Error string `json:"error"`
+    ErrorDescription string `json:"error_description"`
+}
+
+type idTokenClaims struct {
+    Email string `json:"email"`
+    EmailVerified any `json:"email_verified"`
+    Name string `json:"name"`
+    Nonce string `json:"nonce"`
+    jwt.RegisteredClaims
+}
+
+// oidcClient follow OpenID Connect discovery, metadata and keys are cached
+type oidcClient struct {
+    cfg config.IOidcProvider
+    redirectUrl string
+    http *http.Client
+
+    mu sync.Mutex
+    meta *discovery
+    keys map[string]any
+}
+
+func (o *oidcClient) discover(ctx context.Context) (*discovery, error) {
+    o.mu.Lock()
+    defer o.mu.Unlock()
+    if o.meta != nil {
+        return o.meta, nil
+    }
+
+    meta := new(discovery)
+    wellKnown := strings.TrimSuffix(o.cfg.Issuer(), "/") + "/.well-known/openid-configuration"
+    if err := getJson(ctx, o.http, wellKnown, "", meta); err != nil {
+        return nil, fmt.Errorf("oidc discovery failed: %v", err)
+    }
+    if meta.Issuer != o.cfg.Issuer() {
+        return nil, fmt.Errorf("oidc discovery failed: issuer %q does not match", meta.Issuer)
+    }
+    o.meta = meta
+    return o.meta, nil
+}
+
+func (o *oidcClient) AuthCodeUrl(state, codeChallenge, nonce string) (string, error) {
+    meta, err := o.discover(context.Background())
+    if err != nil {
+        return "", err
+    }
+    q := url.Values{
+        "response_type": {"code"},
+        "client_id": {o.cfg.ClientId()},
+        "redirect_uri": {o.redirectUrl},
+        "scope": {strings.Join(o.cfg.Scopes(), " ")},
+        "state": {state},
+        "nonce": {nonce},
+        "code_challenge": {codeChallenge},
+        "code_challenge_method": {"S256"},
+    }
+    return withQuery(meta.AuthorizationEndpoint, q), nil
+}
+
+func (o *oidcClient) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error) {
+    meta, err := o.discover(ctx)
+    if err != nil {
+        return nil, err
+    }
+    token, err := exchangeCode(ctx, o.http, meta.TokenEndpoint, url.Values{
+        "grant_type": {"authorization_code"},
+        "code": {code},
+        "redirect_uri": {o.redirectUrl},
+        "client_id": {o.cfg.ClientId()},
+        "client_secret": {o.cfg.ClientSecret()},
+        "code_verifier": {codeVerifier},
+    })
+    if err != nil {
+        return nil, err
+    }
+    if token.IdToken == "" {
+        return nil, fmt.Errorf("id_token is missing")
+    }
+
+    claims := new(idTokenClaims)
+    if _, err := jwt.ParseWithClaims(
+        token.IdToken,
+        claims,
+        func(t *jwt.Token) (interface{}, error) {
+            kid, _ := t.Header["kid"].(string)
+            return o.key(ctx, meta.JwksUri, kid)
+        },
+        jwt.WithIssuer(meta.Issuer),
+        jwt.WithAudience(o.cfg.ClientId()),
+        jwt.WithExpirationRequired(),
+        jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+    ); err != nil {
+        return nil, fmt.Errorf("id_token is invalid: %v", err)
+    }
+    if claims.Nonce != nonce {
+        return nil, fmt.Errorf("id_token nonce is invalid")
+    }
+
+    identity := &Identity{
+        Provider: o.cfg.Name(),
+        Subject: claims.Subject,
+        Email: claims.Email,
+        EmailVerified: isTrue(claims.EmailVerified),
+        Name: claims.Name,
+    }
+    // some provider put email only in userinfo
+    if identity.Email == "" && meta.UserinfoEndpoint != "" {
+        info := new(idTokenClaims)
+        if err := getJson(ctx, o.http, meta.UserinfoEndpoint, token.AccessToken, info); err != nil {
+            return nil, fmt.Errorf("get userinfo failed: %v", err)
+        }
+        if info.Subject == identity.Subject {
+            identity.Email = info.Email
+            identity.EmailVerified = isTrue(info.EmailVerified)
+        }
+    }
+    if identity.Subject == "" {
+        return nil, fmt.Errorf("id_token subject is missing")
+    }
+    return identity, nil
+}
+
+// key find verification key by kid, keys are fetched again once when kid is unknown (key rotation)
+func (o *oidcClient) key(ctx context.Context, jwksUri, kid string) (any, error) {
+    o.mu.Lock()
+    defer o.mu.Unlock()
+    for i := 0; i < 2; i++ {
+        if key, ok := o.keys[kid]; ok {
+            return key, nil
+        }
+        // single key without kid
+        if kid == "" && len(o.keys) == 1 {
+            for _, key := range o.keys {
+                return key, nil
+            }
+        }
+        if i == 1 {
+            break
+        }
+        keys, err := fetchJwks(ctx, o.http, jwksUri)
+        if err != nil {
+            return nil, err
+        }
+        o.keys = keys
+    }
+    return nil, fmt.Errorf("signing key is unknown")
+}
+
+// email_verified is bool by spec but some provider send "true"
+func isTrue(v any) bool {
+    switch t := v.(type) {
+        case bool:
+            return t
+        case string:
+            return t == "true"
+        default:
+            return false
+    }
+}
+
+func withQuery(endpoint string, q url.Values) string {
+    if strings.Contains(endpoint, "?") {
+        return endpoint + "&" + q.Encode()
+    }
+    return endpoint + "?" + q.Encode()
+}
+
+func exchangeCode(ctx context.Context, client *http.Client, endpoint string, form url.Values) (*tokenRes, error) {
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    req.Header.Set("Accept", "application/json")
+
+    res, err := client.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("exchange code failed: %v", err)
+    }
+    defer res.Body.Close()
+
+    token := new(tokenRes)
+    body, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+    if err := json.Unmarshal(body, token); err != nil {
+        return nil, fmt.Errorf("exchange code failed: status %d", res.StatusCode)
+    }
+    if token.Error != "" {
+        return nil, fmt.Errorf("exchange code failed: %s %s", token.Error, token.ErrorDescription)
+    }
+    if res.StatusCode != http.StatusOK || token.AccessToken == "" {
+        return nil, fmt.Errorf("exchange code failed: status %d", res.StatusCode)
+    }
+    return token, nil
+}
+
+func getJson(ctx context.Context, client *http.Client, endpoint, accessToken string, dest any) error {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Accept", "application/json")
+    if accessToken != "" {
+        req.Header.Set("Authorization", "Bearer "+accessToken)
+    }
+
+    res, err := client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer res.Body.Close()
+    if res.StatusCode != http.StatusOK {
+        return fmt.Errorf("%s: status %d", endpoint, res.StatusCode)
+    }
+    return json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(dest)
+}
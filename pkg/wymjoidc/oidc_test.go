@@ -0,0 +1,385 @@
+package wymjoidc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type testProvider struct {
+    kind string
+    issuer string
+}
+
+func (p *testProvider) Name() string { return "mock" }
+func (p *testProvider) Type() string { return p.kind }
+func (p *testProvider) Issuer() string { return p.issuer }
+func (p *testProvider) ClientId() string { return "wymj-client" }
+func (p *testProvider) ClientSecret() string { return "wymj-secret" }
+func (p *testProvider) Scopes() []string { return []string{"openid", "email"} }
+
+// testIssuer is mock OpenID provider that serve discovery, jwks, token and userinfo.
+// id_token is made from claims and signed by signer with signKid when code is exchanged
+type testIssuer struct {
+    t *testing.T
+    server *httptest.Server
+
+    mu sync.Mutex
+    issuer string
+    jwks map[string]ed25519.PublicKey
+    signer ed25519.PrivateKey
+    signKid string
+    claims jwt.MapClaims
+    userinfo map[string]any
+    tokenForm url.Values
+    jwksFetched int
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+    public, private, err := ed25519.GenerateKey(rand.Reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+    s := &testIssuer{
+        t: t,
+        jwks: map[string]ed25519.PublicKey{"k1": public},
+        signer: private,
+        signKid: "k1",
+    }
+    s.server = httptest.NewServer(s)
+    t.Cleanup(s.server.Close)
+    s.issuer = s.server.URL
+    return s
+}
+
+// validClaims is what a correct provider put in id_token for this client
+func (s *testIssuer) validClaims(nonce string) jwt.MapClaims {
+    return jwt.MapClaims{
+        "iss": s.server.URL,
+        "sub": "248289761001",
+        "aud": "wymj-client",
+        "exp": time.Now().Add(time.Minute).Unix(),
+        "iat": time.Now().Unix(),
+        "nonce": nonce,
+        "email": "ppp@wymj.dev",
+        "email_verified": true,
+        "name": "ppp",
+    }
+}
+
+func (s *testIssuer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    w.Header().Set("Content-Type", "application/json")
+    switch r.URL.Path {
+        case "/.well-known/openid-configuration":
+            json.NewEncoder(w).Encode(map[string]any{
+                "issuer": s.issuer,
+                "authorization_endpoint": s.server.URL + "/authorize",
+                "token_endpoint": s.server.URL + "/token",
+                "userinfo_endpoint": s.server.URL + "/userinfo",
+                "jwks_uri": s.server.URL + "/jwks",
+            })
+        case "/jwks":
+            s.jwksFetched++
+            keys := make([]map[string]string, 0)
+            for kid, key := range s.jwks {
+                keys = append(keys, map[string]string{
+                    "kid": kid,
+                    "kty": "OKP",
+                    "crv": "Ed25519",
+                    "use": "sig",
+                    "x": base64.RawURLEncoding.EncodeToString(key),
+                })
+            }
+            json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+        case "/token":
+            r.ParseForm()
+            s.tokenForm = r.PostForm
+            if r.PostForm.Get("code") != "good-code" {
+                w.WriteHeader(http.StatusBadRequest)
+                json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "code is invalid"})
+                return
+            }
+            token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, s.claims)
+            if s.signKid != "" {
+                token.Header["kid"] = s.signKid
+            }
+            idToken, err := token.SignedString(s.signer)
+            if err != nil {
+                s.t.Error(err)
+            }
+            json.NewEncoder(w).Encode(map[string]string{
+                "access_token": "provider-access-token",
+                "token_type": "Bearer",
+                "id_token": idToken,
+            })
+        case "/userinfo":
+            if r.Header.Get("Authorization") != "Bearer provider-access-token" {
+                w.WriteHeader(http.StatusUnauthorized)
+                return
+            }
+            json.NewEncoder(w).Encode(s.userinfo)
+        default:
+            w.WriteHeader(http.StatusNotFound)
+    }
+}
+
+func (s *testIssuer) client(t *testing.T) IWymjOidc {
+    client, err := NewWymjOidc(&testProvider{kind: "oidc", issuer: s.server.URL}, "https://wymj.dev/callback")
+    if err != nil {
+        t.Fatal(err)
+    }
+    return client
+}
+
+func TestOidcExchange(t *testing.T) {
+    tests := []struct {
+        name string
+        change func(s *testIssuer, claims jwt.MapClaims)
+        want *Identity
+        wantErr string
+    }{
+        {
+            name: "valid id_token",
+            want: &Identity{Provider: "mock", Subject: "248289761001", Email: "ppp@wymj.dev", EmailVerified: true, Name: "ppp"},
+        },
+        {
+            name: "email_verified as string",
+            change: func(s *testIssuer, claims jwt.MapClaims) { claims["email_verified"] = "true" },
+            want: &Identity{Provider: "mock", Subject: "248289761001", Email: "ppp@wymj.dev", EmailVerified: true, Name: "ppp"},
+        },
+        {
+            name: "email is not verified",
+            change: func(s *testIssuer, claims jwt.MapClaims) { delete(claims, "email_verified") },
+            want: &Identity{Provider: "mock", Subject: "248289761001", Email: "ppp@wymj.dev", EmailVerified: false, Name: "ppp"},
+        },
+        {
+            name: "email from userinfo",
+            change: func(s *testIssuer, claims jwt.MapClaims) {
+                delete(claims, "email")
+                delete(claims, "email_verified")
+                s.userinfo = map[string]any{"sub": "248289761001", "email": "ppp@wymj.dev", "email_verified": true}
+            },
+            want: &Identity{Provider: "mock", Subject: "248289761001", Email: "ppp@wymj.dev", EmailVerified: true, Name: "ppp"},
+        },
+        {
+            name: "userinfo of other subject is ignored",
+            change: func(s *testIssuer, claims jwt.MapClaims) {
+                delete(claims, "email")
+                s.userinfo = map[string]any{"sub": "other", "email": "admin@wymj.dev", "email_verified": true}
+            },
+            want: &Identity{Provider: "mock", Subject: "248289761001", EmailVerified: true, Name: "ppp"},
+        },
+        {
+            name: "nonce mismatch",
+            change: func(s *testIssuer, claims jwt.MapClaims) { claims["nonce"] = "nonce-of-other-flow" },
+            wantErr: "id_token nonce is invalid",
+        },
+        {
+            name: "nonce is missing",
+            change: func(s *testIssuer, claims jwt.MapClaims) { delete(claims, "nonce") },
+            wantErr: "id_token nonce is invalid",
+        },
+        {
+            name: "bad aud",
+            change: func(s *testIssuer, claims jwt.MapClaims) { claims["aud"] = "other-client" },
+            wantErr: "token has invalid audience",
+        },
+        {
+            name: "bad iss",
+            change: func(s *testIssuer, claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" },
+            wantErr: "token has invalid issuer",
+        },
+        {
+            name: "expired id_token",
+            change: func(s *testIssuer, claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() },
+            wantErr: "token is expired",
+        },
+        {
+            name: "exp is missing",
+            change: func(s *testIssuer, claims jwt.MapClaims) { delete(claims, "exp") },
+            wantErr: "token is missing required claim",
+        },
+        {
+            name: "unknown kid",
+            change: func(s *testIssuer, claims jwt.MapClaims) {
+                _, s.signer, _ = ed25519.GenerateKey(rand.Reader)
+                s.signKid = "k9"
+            },
+            wantErr: "signing key is unknown",
+        },
+        {
+            name: "signed by other key with known kid",
+            change: func(s *testIssuer, claims jwt.MapClaims) { _, s.signer, _ = ed25519.GenerateKey(rand.Reader) },
+            wantErr: "signature is invalid",
+        },
+        {
+            name: "subject is missing",
+            change: func(s *testIssuer, claims jwt.MapClaims) { delete(claims, "sub") },
+            wantErr: "id_token subject is missing",
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            issuer := newTestIssuer(t)
+            issuer.claims = issuer.validClaims("n0nce")
+            if tt.change != nil {
+                tt.change(issuer, issuer.claims)
+            }
+
+            identity, err := issuer.client(t).Exchange(context.Background(), "good-code", "verifier", "n0nce")
+            if tt.wantErr != "" {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("exchange: %v", err)
+            }
+            if *identity != *tt.want {
+                t.Errorf("identity = %+v, want %+v", identity, tt.want)
+            }
+            if form := issuer.tokenForm; form.Get("code_verifier") != "verifier" || form.Get("redirect_uri") != "https://wymj.dev/callback" {
+                t.Errorf("token request = %v", form)
+            }
+        })
+    }
+}
+
+func TestOidcKeyRotation(t *testing.T) {
+    issuer := newTestIssuer(t)
+    issuer.claims = issuer.validClaims("n0nce")
+    client := issuer.client(t)
+    ctx := context.Background()
+
+    if _, err := client.Exchange(ctx, "good-code", "verifier", "n0nce"); err != nil {
+        t.Fatalf("exchange: %v", err)
+    }
+
+    public, private, _ := ed25519.GenerateKey(rand.Reader)
+    issuer.mu.Lock()
+    issuer.jwks = map[string]ed25519.PublicKey{"k2": public}
+    issuer.signer = private
+    issuer.signKid = "k2"
+    issuer.mu.Unlock()
+
+    if _, err := client.Exchange(ctx, "good-code", "verifier", "n0nce"); err != nil {
+        t.Fatalf("exchange after rotation: %v", err)
+    }
+    issuer.mu.Lock()
+    defer issuer.mu.Unlock()
+    if issuer.jwksFetched != 2 {
+        t.Errorf("jwks fetched %d times, want 2", issuer.jwksFetched)
+    }
+}
+
+func TestOidcDiscoveryIssuerMismatch(t *testing.T) {
+    issuer := newTestIssuer(t)
+    issuer.issuer = "https://evil.example.com"
+
+    if _, err := issuer.client(t).AuthCodeUrl("state", "challenge", "nonce"); err == nil || !strings.Contains(err.Error(), "does not match") {
+        t.Errorf("error = %v", err)
+    }
+}
+
+func TestOidcAuthCodeUrl(t *testing.T) {
+    issuer := newTestIssuer(t)
+
+    authUrl, err := issuer.client(t).AuthCodeUrl("st4te", "ch4llenge", "n0nce")
+    if err != nil {
+        t.Fatal(err)
+    }
+    uri, err := url.Parse(authUrl)
+    if err != nil {
+        t.Fatal(err)
+    }
+    q := uri.Query()
+    if uri.Path != "/authorize" || q.Get("state") != "st4te" || q.Get("nonce") != "n0nce" ||
+        q.Get("code_challenge") != "ch4llenge" || q.Get("code_challenge_method") != "S256" || q.Get("client_id") != "wymj-client" {
+        t.Errorf("auth code url = %s", authUrl)
+    }
+}
+
+func TestOidcExchangeError(t *testing.T) {
+    issuer := newTestIssuer(t)
+
+    if _, err := issuer.client(t).Exchange(context.Background(), "used-code", "verifier", "n0nce"); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+        t.Errorf("error = %v", err)
+    }
+}
+
+func TestGithubExchange(t *testing.T) {
+    type email struct {
+        Email string `json:"email"`
+        Primary bool `json:"primary"`
+        Verified bool `json:"verified"`
+    }
+    tests := []struct {
+        name string
+        emails []email
+        want *Identity
+    }{
+        {
+            "primary email is verified",
+            []email{{"old@wymj.dev", false, true}, {"ppp@wymj.dev", true, true}},
+            &Identity{Provider: "mock", Subject: "1001", Email: "ppp@wymj.dev", EmailVerified: true, Name: "ppp"},
+        },
+        {
+            "primary email is not verified",
+            []email{{"ppp@wymj.dev", true, false}, {"old@wymj.dev", false, true}},
+            &Identity{Provider: "mock", Subject: "1001", Email: "ppp@wymj.dev", EmailVerified: false, Name: "ppp"},
+        },
+        {
+            "no primary email",
+            []email{{"old@wymj.dev", false, true}},
+            &Identity{Provider: "mock", Subject: "1001", Name: "ppp"},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                w.Header().Set("Content-Type", "application/json")
+                if r.URL.Path != "/login/oauth/access_token" && r.Header.Get("Authorization") != "Bearer gho_token" {
+                    w.WriteHeader(http.StatusUnauthorized)
+                    return
+                }
+                switch r.URL.Path {
+                    case "/login/oauth/access_token":
+                        json.NewEncoder(w).Encode(map[string]string{"access_token": "gho_token", "token_type": "bearer"})
+                    case "/api/v3/user":
+                        json.NewEncoder(w).Encode(map[string]any{"id": 1001, "login": "ppp"})
+                    case "/api/v3/user/emails":
+                        json.NewEncoder(w).Encode(tt.emails)
+                    default:
+                        w.WriteHeader(http.StatusNotFound)
+                }
+            }))
+            defer server.Close()
+
+            client, err := NewWymjOidc(&testProvider{kind: "github", issuer: server.URL}, "https://wymj.dev/callback")
+            if err != nil {
+                t.Fatal(err)
+            }
+            identity, err := client.Exchange(context.Background(), "code", "verifier", "")
+            if err != nil {
+                t.Fatalf("exchange: %v", err)
+            }
+            if *identity != *tt.want {
+                t.Errorf("identity = %+v, want %+v", identity, tt.want)
+            }
+        })
+    }
+}
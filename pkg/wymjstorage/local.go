@@ -0,0 +1,82 @@
+package wymjstorage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ppp3ppj/wymj/config"
+)
+
+type localStorage struct {
+    cfg config.IStorageconfig
+}
+
+func newLocalStorage(cfg config.IStorageconfig) IWymjStorage {
+    return &localStorage{
+        cfg: cfg,
+    }
+}
+
+// path make sure key can not escape from local dir
+func (s *localStorage) path(key string) (string, error) {
+    p := filepath.Join(s.cfg.LocalDir(), filepath.FromSlash(key))
+    if !strings.HasPrefix(p, filepath.Clean(s.cfg.LocalDir())+string(os.PathSeparator)) {
+        return "", fmt.Errorf("file key is invalid")
+    }
+    return p, nil
+}
+
+func (s *localStorage) Upload(ctx context.Context, key, contentType string, file io.Reader, size int64) (string, error) {
+    p, err := s.path(key)
+    if err != nil {
+        return "", err
+    }
+    if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+        return "", fmt.Errorf("create directory failed: %v", err)
+    }
+
+    dest, err := os.Create(p)
+    if err != nil {
+        return "", fmt.Errorf("create file failed: %v", err)
+    }
+    defer dest.Close()
+
+    if _, err := io.Copy(dest, file); err != nil {
+        os.Remove(p)
+        return "", fmt.Errorf("write file failed: %v", err)
+    }
+    if s.cfg.PublicUrl() == "" {
+        return key, nil
+    }
+    return fmt.Sprintf("%s/%s", strings.TrimSuffix(s.cfg.PublicUrl(), "/"), key), nil
+}
+
+func (s *localStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+    p, err := s.path(key)
+    if err != nil {
+        return nil, err
+    }
+    f, err := os.Open(p)
+    if err != nil {
+        if os.IsNotExist(err) {
+            return nil, fmt.Errorf("file not found")
+        }
+        return nil, fmt.Errorf("open file failed: %v", err)
+    }
+    return f, nil
+}
+
+func (s *localStorage) Delete(ctx context.Context, key string) error {
+    p, err := s.path(key)
+    if err != nil {
+        return err
+    }
+    if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+        return fmt.Errorf("delete file failed: %v", err)
+    }
+    return nil
+}
@@ -0,0 +1,264 @@
+package wymjstorage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ppp3ppj/wymj/config"
+)
+
+// s3Storage talk to any S3 compatible api (AWS S3, GCS interoperability, MinIO)
+// with path-style url and signature version 4
+type s3Storage struct {
+    cfg config.IStorageconfig
+    client *http.Client
+}
+
+func newS3Storage(cfg config.IStorageconfig) IWymjStorage {
+    return &s3Storage{
+        cfg: cfg,
+        client: &http.Client{Timeout: 60 * time.Second},
+    }
+}
+
+func (s *s3Storage) objectUrl(key string) (*url.URL, error) {
+    u, err := url.Parse(strings.TrimSuffix(s.cfg.Endpoint(), "/"))
+    if err != nil {
+        return nil, fmt.Errorf("storage endpoint is invalid: %v", err)
+    }
+    segments := strings.Split(key, "/")
+    for i := range segments {
+        segments[i] = awsEscape(segments[i])
+    }
+    u.RawPath = fmt.Sprintf("%s/%s/%s", u.Path, awsEscape(s.cfg.Bucket()), strings.Join(segments, "/"))
+    u.Path = fmt.Sprintf("%s/%s/%s", u.Path, s.cfg.Bucket(), key)
+    return u, nil
+}
+
+func (s *s3Storage) Upload(ctx context.Context, key, contentType string, file io.Reader, size int64) (string, error) {
+    u, err := s.objectUrl(key)
+    if err != nil {
+        return "", err
+    }
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), file)
+    if err != nil {
+        return "", fmt.Errorf("create upload request failed: %v", err)
+    }
+    req.ContentLength = size
+    req.Header.Set("Content-Type", contentType)
+    s.sign(req)
+
+    res, err := s.client.Do(req)
+    if err != nil {
+        return "", fmt.Errorf("upload file failed: %v", err)
+    }
+    defer res.Body.Close()
+
+    if res.StatusCode != http.StatusOK {
+        body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+        return "", fmt.Errorf("upload file failed: %s %s", res.Status, string(body))
+    }
+
+    if s.cfg.PublicUrl() != "" {
+        return fmt.Sprintf("%s/%s", strings.TrimSuffix(s.cfg.PublicUrl(), "/"), key), nil
+    }
+    return u.String(), nil
+}
+
+func (s *s3Storage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+    u, err := s.objectUrl(key)
+    if err != nil {
+        return nil, err
+    }
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+    if err != nil {
+        return nil, fmt.Errorf("create download request failed: %v", err)
+    }
+    s.sign(req)
+
+    res, err := s.client.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("download file failed: %v", err)
+    }
+    switch res.StatusCode {
+        case http.StatusOK:
+            return res.Body, nil
+        case http.StatusNotFound:
+            res.Body.Close()
+            return nil, fmt.Errorf("file not found")
+        default:
+            body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+            res.Body.Close()
+            return nil, fmt.Errorf("download file failed: %s %s", res.Status, string(body))
+    }
+}
+
+func (s *s3Storage) Delete(ctx context.Context, key string) error {
+    u, err := s.objectUrl(key)
+    if err != nil {
+        return err
+    }
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u.String(), nil)
+    if err != nil {
+        return fmt.Errorf("create delete request failed: %v", err)
+    }
+    s.sign(req)
+
+    res, err := s.client.Do(req)
+    if err != nil {
+        return fmt.Errorf("delete file failed: %v", err)
+    }
+    defer res.Body.Close()
+
+    // 404 is mean already deleted
+    if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotFound {
+        body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+        return fmt.Errorf("delete file failed: %s %s", res.Status, string(body))
+    }
+    return nil
+}
+
+// sign add AWS signature version 4 headers, payload is not signed
+func (s *s3Storage) sign(req *http.Request) {
+    v := &sigV4{
+        method: req.Method,
+        path: req.URL.EscapedPath(),
+        query: req.URL.RawQuery,
+        headers: map[string]string{
+            "host": req.URL.Host,
+            "x-amz-content-sha256": "UNSIGNED-PAYLOAD",
+            "x-amz-date": time.Now().UTC().Format("20060102T150405Z"),
+        },
+        payloadHash: "UNSIGNED-PAYLOAD",
+        region: s.cfg.Region(),
+        service: "s3",
+        accessKey: s.cfg.AccessKey(),
+        secretKey: s.cfg.SecretKey(),
+    }
+    if contentType := req.Header.Get("Content-Type"); contentType != "" {
+        v.headers["content-type"] = contentType
+    }
+
+    req.Header.Set("X-Amz-Date", v.headers["x-amz-date"])
+    req.Header.Set("X-Amz-Content-Sha256", v.headers["x-amz-content-sha256"])
+    req.Header.Set("Authorization", v.authorization())
+}
+
+// sigV4 is one request to sign, every header in headers is signed and x-amz-date is required.
+// It has no http.Request so it can be checked against AWS test vectors
+type sigV4 struct {
+    method string
+    path string // already escaped
+    query string
+    headers map[string]string // lower case name
+    payloadHash string
+    region string
+    service string
+    accessKey string
+    secretKey string
+}
+
+func (v *sigV4) authorization() string {
+    amzDate := v.headers["x-amz-date"]
+    date := amzDate[:8]
+
+    names := make([]string, 0, len(v.headers))
+    for name := range v.headers {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    var canonicalHeaders strings.Builder
+    for _, name := range names {
+        fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, strings.Join(strings.Fields(v.headers[name]), " "))
+    }
+    signedHeaders := strings.Join(names, ";")
+
+    canonicalRequest := strings.Join([]string{
+        v.method,
+        v.path,
+        canonicalQuery(v.query),
+        canonicalHeaders.String(),
+        signedHeaders,
+        v.payloadHash,
+    }, "\n")
+
+    scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, v.region, v.service)
+    hashedRequest := sha256.Sum256([]byte(canonicalRequest))
+    stringToSign := strings.Join([]string{
+        "AWS4-HMAC-SHA256",
+        amzDate,
+        scope,
+        hex.EncodeToString(hashedRequest[:]),
+    }, "\n")
+
+    key := hmacSHA256([]byte("AWS4"+v.secretKey), date)
+    key = hmacSHA256(key, v.region)
+    key = hmacSHA256(key, v.service)
+    key = hmacSHA256(key, "aws4_request")
+    signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+    return fmt.Sprintf(
+        "AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+        v.accessKey,
+        scope,
+        signedHeaders,
+        signature,
+    )
+}
+
+// canonicalQuery sort parameters by name then value and encode them the AWS way
+func canonicalQuery(rawQuery string) string {
+    values, err := url.ParseQuery(rawQuery)
+    if err != nil {
+        return rawQuery
+    }
+    params := make([][2]string, 0, len(values))
+    for name, list := range values {
+        for _, value := range list {
+            params = append(params, [2]string{awsEscape(name), awsEscape(value)})
+        }
+    }
+    sort.Slice(params, func(i, j int) bool {
+        if params[i][0] != params[j][0] {
+            return params[i][0] < params[j][0]
+        }
+        return params[i][1] < params[j][1]
+    })
+    result := make([]string, 0, len(params))
+    for _, param := range params {
+        result = append(result, param[0]+"="+param[1])
+    }
+    return strings.Join(result, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+    h := hmac.New(sha256.New, key)
+    h.Write([]byte(data))
+    return h.Sum(nil)
+}
+
+// awsEscape encode everything except unreserved characters (A-Z a-z 0-9 - _ . ~)
+func awsEscape(s string) string {
+    var b strings.Builder
+    for _, c := range []byte(s) {
+        if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+            c == '-' || c == '_' || c == '.' || c == '~' {
+            b.WriteByte(c)
+        } else {
+            fmt.Fprintf(&b, "%%%02X", c)
+        }
+    }
+    return b.String()
+}
@@ -0,0 +1,28 @@
+package wymjstorage
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/ppp3ppj/wymj/config"
+)
+
+type IWymjStorage interface {
+    // Upload save object with key and return public url
+    Upload(ctx context.Context, key, contentType string, file io.Reader, size int64) (string, error)
+    // Open read object, caller must close it. Error is "file not found" when key does not exist
+    Open(ctx context.Context, key string) (io.ReadCloser, error)
+    Delete(ctx context.Context, key string) error
+}
+
+func NewWymjStorage(cfg config.IStorageconfig) (IWymjStorage, error) {
+    switch cfg.Driver() {
+        case "local":
+            return newLocalStorage(cfg), nil
+        case "s3":
+            return newS3Storage(cfg), nil
+        default:
+            return nil, fmt.Errorf("unknown storage driver: %v", cfg.Driver())
+    }
+}
@@ -0,0 +1,96 @@
+package wymjtotp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RFC 6238 with the defaults every authenticator app support: SHA1, 6 digits, 30 seconds
+const (
+    digits = 6
+    period = 30
+    // accept one step before and after for clock drift
+    skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret return base32 secret of 160 bits as recommended by RFC 4226
+func GenerateSecret() (string, error) {
+    b := make([]byte, 20)
+    if _, err := rand.Read(b); err != nil {
+        return "", fmt.Errorf("generate secret failed: %v", err)
+    }
+    return encoding.EncodeToString(b), nil
+}
+
+// ProvisioningUri is the otpauth uri shown as QR code to authenticator app
+func ProvisioningUri(issuer, account, secret string) string {
+    v := url.Values{}
+    v.Set("secret", secret)
+    v.Set("issuer", issuer)
+    v.Set("algorithm", "SHA1")
+    v.Set("digits", fmt.Sprint(digits))
+    v.Set("period", fmt.Sprint(period))
+    label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+    return fmt.Sprintf("otpauth://totp/%s?%s", label, v.Encode())
+}
+
+// Validate check code at time t and return its time step,
+// caller should keep the step and reject code of the same or earlier step
+func Validate(secret, code string, t time.Time) (int64, bool) {
+    if len(code) != digits {
+        return 0, false
+    }
+    key, err := encoding.DecodeString(strings.ToUpper(secret))
+    if err != nil {
+        return 0, false
+    }
+    step := t.Unix() / period
+    for i := int64(-skew); i <= skew; i++ {
+        if subtle.ConstantTimeCompare([]byte(hotp(key, step+i)), []byte(code)) == 1 {
+            return step + i, true
+        }
+    }
+    return 0, false
+}
+
+// hotp is RFC 4226 dynamic truncation
+func hotp(key []byte, counter int64) string {
+    msg := make([]byte, 8)
+    binary.BigEndian.PutUint64(msg, uint64(counter))
+    mac := hmac.New(sha1.New, key)
+    mac.Write(msg)
+    sum := mac.Sum(nil)
+
+    offset := sum[len(sum)-1] & 0x0f
+    value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+    return fmt.Sprintf("%0*d", digits, value%1000000)
+}
+
+// RecoveryCodes return n random codes of 80 bits formatted as xxxx-xxxx-xxxx-xxxx
+func RecoveryCodes(n int) ([]string, error) {
+    codes := make([]string, 0, n)
+    for i := 0; i < n; i++ {
+        b := make([]byte, 10)
+        if _, err := rand.Read(b); err != nil {
+            return nil, fmt.Errorf("generate recovery code failed: %v", err)
+        }
+        code := strings.ToLower(encoding.EncodeToString(b))
+        codes = append(codes, code[:4]+"-"+code[4:8]+"-"+code[8:12]+"-"+code[12:])
+    }
+    return codes, nil
+}
+
+// NormalizeRecoveryCode make code typed by user comparable with the generated one
+func NormalizeRecoveryCode(code string) string {
+    return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+}
@@ -0,0 +1,81 @@
+package wymjtotp
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is SHA1 key of RFC 6238 appendix B, "12345678901234567890" in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// RFC 6238 appendix B list 8 digits codes, 6 digits code is the last 6 digits of them
+func TestHotpRfc6238(t *testing.T) {
+    tests := []struct {
+        unix int64
+        want string
+    }{
+        {59, "94287082"},
+        {1111111109, "07081804"},
+        {1111111111, "14050471"},
+        {1234567890, "89005924"},
+        {2000000000, "69279037"},
+        {20000000000, "65353130"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.want, func(t *testing.T) {
+            code := tt.want[2:]
+            if got := hotp([]byte("12345678901234567890"), tt.unix/period); got != code {
+                t.Errorf("hotp = %s, want %s", got, code)
+            }
+            step, ok := Validate(rfc6238Secret, code, time.Unix(tt.unix, 0))
+            if !ok || step != tt.unix/period {
+                t.Errorf("validate = %d, %v", step, ok)
+            }
+        })
+    }
+}
+
+func TestValidateSkew(t *testing.T) {
+    code := "287082" // step 1 of RFC 6238 appendix B
+    tests := []struct {
+        name string
+        secret string
+        unix int64
+        valid bool
+    }{
+        {"same step", rfc6238Secret, 59, true},
+        {"one step later", rfc6238Secret, 89, true},
+        {"two steps later", rfc6238Secret, 119, false},
+        {"lower case secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", 59, true},
+        {"invalid secret", "not base32!", 59, false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if _, ok := Validate(tt.secret, code, time.Unix(tt.unix, 0)); ok != tt.valid {
+                t.Errorf("valid = %v, want %v", ok, tt.valid)
+            }
+        })
+    }
+}
+
+func TestRecoveryCodes(t *testing.T) {
+    codes, err := RecoveryCodes(10)
+    if err != nil {
+        t.Fatal(err)
+    }
+    pattern := regexp.MustCompile(`^[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}$`)
+    seen := make(map[string]bool)
+    for _, code := range codes {
+        if !pattern.MatchString(code) {
+            t.Errorf("code %q is not xxxx-xxxx-xxxx-xxxx", code)
+        }
+        if seen[code] {
+            t.Errorf("code %q is repeated", code)
+        }
+        seen[code] = true
+        if normalized := NormalizeRecoveryCode(" " + code + " "); len(normalized) != 16 {
+            t.Errorf("normalized = %q", normalized)
+        }
+    }
+}
@@ -0,0 +1,118 @@
+package wymjtrace
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/ppp3ppj/wymj/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/ppp3ppj/wymj"
+
+// memory exporter is kept so tests can read finished spans
+var memoryExporter = tracetest.NewInMemoryExporter()
+
+type ITracer interface {
+    // Shutdown flush spans that are not exported yet
+    Shutdown(ctx context.Context) error
+}
+
+type wymjTracer struct {
+    provider *sdktrace.TracerProvider
+}
+
+// NewTracer set global tracer provider and W3C propagator, with exporter none spans are
+// not recorded but trace id from caller is still followed
+func NewTracer(cfg config.ITracingconfig, version string) (ITracer, error) {
+    otel.SetTextMapPropagator(propagation.TraceContext{})
+
+    var exporter sdktrace.SpanExporter
+    switch cfg.Exporter() {
+        case "none":
+            return &wymjTracer{}, nil
+        case "stdout":
+            e, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+            if err != nil {
+                return nil, fmt.Errorf("create stdout exporter failed: %v", err)
+            }
+            exporter = e
+        case "memory":
+            exporter = memoryExporter
+        case "otlp":
+            opts := []otlptracehttp.Option{
+                otlptracehttp.WithEndpoint(cfg.OtlpEndpoint()),
+                otlptracehttp.WithHeaders(cfg.OtlpHeaders()),
+            }
+            if cfg.OtlpInsecure() {
+                opts = append(opts, otlptracehttp.WithInsecure())
+            }
+            // client connect on first export, collector down does not stop the server
+            e, err := otlptracehttp.New(context.Background(), opts...)
+            if err != nil {
+                return nil, fmt.Errorf("create otlp exporter failed: %v", err)
+            }
+            exporter = e
+        default:
+            return nil, fmt.Errorf("trace exporter %q is not supported", cfg.Exporter())
+    }
+
+    res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+        semconv.SchemaURL,
+        semconv.ServiceName(cfg.ServiceName()),
+        semconv.ServiceVersion(version),
+    ))
+    if err != nil {
+        return nil, fmt.Errorf("create trace resource failed: %v", err)
+    }
+
+    var processor sdktrace.SpanProcessor
+    if cfg.Exporter() == "memory" {
+        // span can be read as soon as it is ended
+        processor = sdktrace.NewSimpleSpanProcessor(exporter)
+    } else {
+        processor = sdktrace.NewBatchSpanProcessor(exporter)
+    }
+    provider := sdktrace.NewTracerProvider(
+        sdktrace.WithSpanProcessor(processor),
+        sdktrace.WithResource(res),
+        sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio()))),
+    )
+    otel.SetTracerProvider(provider)
+    return &wymjTracer{provider: provider}, nil
+}
+
+func (t *wymjTracer) Shutdown(ctx context.Context) error {
+    if t.provider == nil {
+        return nil
+    }
+    return t.provider.Shutdown(ctx)
+}
+
+// MemorySpans return spans ended so far when exporter is memory
+func MemorySpans() tracetest.SpanStubs {
+    return memoryExporter.GetSpans()
+}
+
+func ResetMemorySpans() {
+    memoryExporter.Reset()
+}
+
+func Tracer() trace.Tracer {
+    return otel.Tracer(tracerName)
+}
+
+// Start child span of span in ctx, it is no-op when tracing is off
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+    return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
@@ -0,0 +1,139 @@
+package wymjtrace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const (
+    RequestIdHeader = "X-Request-Id"
+    TraceparentHeader = "traceparent"
+    // request id from client longer than this is replaced
+    maxRequestIdLength = 128
+)
+
+// Trace of one request, SpanId is span of this server and ParentId is span of caller
+type Trace struct {
+    RequestId string
+    TraceId string
+    SpanId string
+    ParentId string
+    Flags string
+}
+
+type contextKey struct{}
+
+func NewContext(ctx context.Context, trace *Trace) context.Context {
+    return context.WithValue(ctx, contextKey{}, trace)
+}
+
+// FromContext return nil when ctx is not from a request
+func FromContext(ctx context.Context) *Trace {
+    if ctx == nil {
+        return nil
+    }
+    trace, _ := ctx.Value(contextKey{}).(*Trace)
+    return trace
+}
+
+// RequestId return empty string when ctx is not from a request
+func RequestId(ctx context.Context) string {
+    if trace := FromContext(ctx); trace != nil {
+        return trace.RequestId
+    }
+    return ""
+}
+
+// NewTrace continue trace of valid traceparent or start a new one, valid request id from
+// client is kept so one id can be followed through every service. When ctx has server
+// span its ids are used so log and exported span can be matched
+func NewTrace(ctx context.Context, requestId, traceparent string) *Trace {
+    trace := &Trace{
+        SpanId: randomHex(8),
+        Flags: "01",
+    }
+    if traceId, parentId, flags, ok := ParseTraceparent(traceparent); ok {
+        trace.TraceId = traceId
+        trace.ParentId = parentId
+        trace.Flags = flags
+    } else {
+        trace.TraceId = randomHex(16)
+    }
+    if span := oteltrace.SpanContextFromContext(ctx); span.IsValid() && !span.IsRemote() {
+        trace.TraceId = span.TraceID().String()
+        trace.SpanId = span.SpanID().String()
+        trace.Flags = span.TraceFlags().String()
+    }
+
+    if isValidRequestId(requestId) {
+        trace.RequestId = requestId
+    } else {
+        trace.RequestId = trace.TraceId
+    }
+    return trace
+}
+
+// Traceparent of this server, it is sent back and to services called by this request
+func (t *Trace) Traceparent() string {
+    return fmt.Sprintf("00-%s-%s-%s", t.TraceId, t.SpanId, t.Flags)
+}
+
+// ParseTraceparent follow W3C trace context level 1: version-traceid-parentid-flags,
+// all zero id is invalid
+func ParseTraceparent(value string) (traceId, parentId, flags string, ok bool) {
+    parts := strings.Split(strings.Trim(value, " "), "-")
+    if len(parts) < 4 {
+        return "", "", "", false
+    }
+    version := parts[0]
+    // version 00 has exactly 4 parts, later versions may add more
+    if !isHex(version, 2) || version == "ff" || (version == "00" && len(parts) != 4) {
+        return "", "", "", false
+    }
+    traceId, parentId, flags = parts[1], parts[2], parts[3]
+    if !isHex(traceId, 32) || !isHex(parentId, 16) || !isHex(flags, 2) {
+        return "", "", "", false
+    }
+    if strings.Trim(traceId, "0") == "" || strings.Trim(parentId, "0") == "" {
+        return "", "", "", false
+    }
+    return traceId, parentId, flags, true
+}
+
+func isHex(value string, length int) bool {
+    if len(value) != length {
+        return false
+    }
+    for _, c := range value {
+        if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+            return false
+        }
+    }
+    return true
+}
+
+// isValidRequestId allow only characters that are safe in header and log
+func isValidRequestId(value string) bool {
+    if value == "" || len(value) > maxRequestIdLength {
+        return false
+    }
+    for _, c := range value {
+        if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || strings.ContainsRune("-_.:", c)) {
+            return false
+        }
+    }
+    return true
+}
+
+func randomHex(n int) string {
+    b := make([]byte, n)
+    if _, err := rand.Read(b); err != nil {
+        panic(fmt.Sprintf("read random failed: %v", err))
+    }
+    return hex.EncodeToString(b)
+}